@@ -0,0 +1,391 @@
+// Package audit keeps a tamper-evident record of who operated the doors and
+// the light, and from where. Each record includes the hash of the previous
+// record, so a record cannot be altered, removed or inserted without breaking
+// the chain of every later record.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+	gpos "github.com/robdimsdale/garagepi/os"
+)
+
+// Actions of entries. The target of door actions is the name of the door.
+// ActionDoorToggle is a toggle of the door, and ActionDoorOpen and
+// ActionDoorClose are requests to move it to a position.
+const (
+	ActionDoorToggle = "door-toggle"
+	ActionDoorOpen   = "door-open"
+	ActionDoorClose  = "door-close"
+	ActionLightOn    = "light-on"
+	ActionLightOff   = "light-off"
+)
+
+// TargetLight is the target of light actions.
+const TargetLight = "light"
+
+// Results of light actions. The result of door actions is the MoveResult.
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// Entry is an operation to be recorded. Principal and ClientIP are empty for
+// operations by garagepi itself, e.g. by automation rules.
+type Entry struct {
+	Principal string `json:"principal,omitempty"`
+	ClientIP  string `json:"clientIP,omitempty"`
+	Action    string `json:"action"`
+	Target    string `json:"target"`
+	Result    string `json:"result"`
+}
+
+// NewEntry returns an entry for an operation caused by source.
+func NewEntry(source events.Source, action, target, result string) Entry {
+	return Entry{
+		Principal: source.User,
+		ClientIP:  source.ClientIP,
+		Action:    action,
+		Target:    target,
+		Result:    result,
+	}
+}
+
+// Record is an entry in the trail. Seq starts at 1 and PrevHash is empty for
+// the first record. Hash is the hex encoded SHA-256 of the JSON encoding of
+// the record without its hash.
+type Record struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Entry
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+func (r Record) hash() string {
+	r.Hash = ""
+	b, _ := json.Marshal(r)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// Page is a page of records, newest first.
+// Next is set if there are older records, which are returned by repeating
+// the query with before set to Next.
+type Page struct {
+	Records []Record `json:"records"`
+	Next    *uint64  `json:"next,omitempty"`
+}
+
+//go:generate counterfeiter . Trail
+
+// Trail records operations. Recording never fails; errors are logged by the
+// trail.
+type Trail interface {
+	Record(e Entry)
+	Query(before uint64, limit int) (Page, error)
+	HandleList(w http.ResponseWriter, r *http.Request)
+}
+
+type trail struct {
+	logger lager.Logger
+	clock  gpos.OSHelper
+	path   string
+
+	// Only the last record is kept in memory, to continue the chain.
+	// Records are queried by reading the file.
+	mutex sync.Mutex
+	last  Record
+	file  *os.File
+}
+
+// NewTrail returns a trail which appends records to the file at path, one
+// JSON object per line, continuing the chain of the records already in it.
+// The file is never rewritten. If path is empty records are not kept, and
+// queries return no records.
+func NewTrail(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	path string,
+) (Trail, error) {
+	t := &trail{
+		logger: logger.Session("audit"),
+		clock:  clock,
+		path:   path,
+	}
+
+	if path == "" {
+		return t, nil
+	}
+
+	err := t.load()
+	if err != nil {
+		return nil, err
+	}
+
+	t.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// load reads the file to find the last record, and verifies the chain as it
+// does so. A broken chain is logged rather than returned so that the doors
+// can still be operated; it is reported by Verify.
+func (t *trail) load() error {
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var verifyErr error
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil {
+			t.logger.Error("skipping invalid audit record", err, lager.Data{"path": t.path, "line": scanner.Text()})
+			continue
+		}
+
+		if verifyErr == nil {
+			verifyErr = follows(r, t.last)
+		}
+		t.last = r
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if verifyErr != nil {
+		t.logger.Error("audit trail failed verification", verifyErr, lager.Data{"path": t.path})
+	}
+
+	return nil
+}
+
+func (t *trail) Record(e Entry) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	r := Record{
+		Seq:      t.last.Seq + 1,
+		Time:     t.clock.Now().UTC(),
+		Entry:    e,
+		PrevHash: t.last.Hash,
+	}
+	r.Hash = r.hash()
+
+	t.last = r
+
+	if t.file == nil {
+		return
+	}
+
+	// Each record is synced so that it survives a power cut.
+	b, _ := json.Marshal(r)
+	_, err := t.file.Write(append(b, '\n'))
+	if err == nil {
+		err = t.file.Sync()
+	}
+	if err != nil {
+		t.logger.Error("error recording audit record", err, lager.Data{"path": t.path, "seq": r.Seq})
+	}
+}
+
+// Query returns up to limit records older than before, or the newest records
+// if before is 0. Limit defaults to DefaultLimit and may not exceed MaxLimit.
+// The file is read from the start, keeping no more than limit records in
+// memory.
+func (t *trail) Query(before uint64, limit int) (Page, error) {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	page := Page{
+		Records: []Record{},
+	}
+
+	if t.path == "" {
+		return page, nil
+	}
+
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return page, nil
+	}
+	if err != nil {
+		return Page{}, err
+	}
+	defer f.Close()
+
+	// newest is a ring of the last limit matching records, the oldest of
+	// which is at start.
+	newest := make([]Record, limit)
+	var start, n int
+	older := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r Record
+		err := json.Unmarshal(scanner.Bytes(), &r)
+		if err != nil || (before > 0 && r.Seq >= before) {
+			continue
+		}
+
+		if n < limit {
+			newest[(start+n)%limit] = r
+			n++
+			continue
+		}
+
+		newest[start] = r
+		start = (start + 1) % limit
+		older = true
+	}
+	if err := scanner.Err(); err != nil {
+		return Page{}, err
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		page.Records = append(page.Records, newest[(start+i)%limit])
+	}
+
+	if older {
+		next := page.Records[n-1].Seq
+		page.Next = &next
+	}
+
+	return page, nil
+}
+
+// HandleList responds with a page of records, newest first, if the user of
+// the request is the admin. The records may be paged with the query parameters:
+//
+//	before - sequence number; use the next sequence number of the previous page
+//	limit  - maximum number of records
+func (t *trail) HandleList(w http.ResponseWriter, r *http.Request) {
+	if !events.RequestAdmin(r) {
+		source := events.RequestSource(r)
+		t.logger.Info("audit trail requested by non-admin", lager.Data{"user": source.User, "clientIP": source.ClientIP})
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	before, limit, err := parsePage(r)
+	if err != nil {
+		t.logger.Info("invalid audit page requested", lager.Data{"error": err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	page, err := t.Query(before, limit)
+	if err != nil {
+		t.logger.Error("error reading audit trail", err, lager.Data{"path": t.path})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, _ := json.Marshal(page)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func parsePage(r *http.Request) (uint64, int, error) {
+	var (
+		before uint64
+		limit  int
+		err    error
+	)
+
+	if b := r.URL.Query().Get("before"); b != "" {
+		before, err = strconv.ParseUint(b, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid before: %s", b)
+		}
+	}
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > MaxLimit {
+			return 0, 0, fmt.Errorf("invalid limit: %s must be between 1 and %d", l, MaxLimit)
+		}
+	}
+
+	return before, limit, nil
+}
+
+// Verify reads records from r, one JSON object per line, and checks that they
+// form an unbroken chain. It returns the number of records verified before
+// the chain was broken, if it was. Records removed from the end of the trail
+// cannot be detected, so the hash of the last record should be kept elsewhere
+// to check against later.
+func Verify(r io.Reader) (int, error) {
+	var prev Record
+	n := 0
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return n, fmt.Errorf("invalid audit record on line %d: %s", line, err)
+		}
+
+		err = follows(rec, prev)
+		if err != nil {
+			return n, err
+		}
+
+		prev = rec
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// follows returns an error unless r is the record after prev, which is the
+// zero Record for the first record.
+func follows(r Record, prev Record) error {
+	if r.Seq != prev.Seq+1 {
+		return fmt.Errorf("audit record %d follows record %d", r.Seq, prev.Seq)
+	}
+	if r.PrevHash != prev.Hash {
+		return fmt.Errorf("audit record %d does not follow the hash of record %d", r.Seq, prev.Seq)
+	}
+	if r.Hash != r.hash() {
+		return fmt.Errorf("audit record %d does not match its hash", r.Seq)
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/context"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/audit"
+	"github.com/robdimsdale/garagepi/api/events"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Trail", func() {
+	var (
+		fakeOSHelper *os_fakes.FakeOSHelper
+		tempDir      string
+		path         string
+	)
+
+	toggle := audit.NewEntry(
+		events.Source{User: "some-user", ClientIP: "192.168.1.10"},
+		audit.ActionDoorToggle,
+		"garage",
+		"pulsed",
+	)
+
+	lightOn := audit.NewEntry(
+		events.Source{},
+		audit.ActionLightOn,
+		audit.TargetLight,
+		audit.ResultOK,
+	)
+
+	newTrail := func() audit.Trail {
+		trail, err := audit.NewTrail(lagertest.NewTestLogger("audit test"), fakeOSHelper, path)
+		Expect(err).NotTo(HaveOccurred())
+		return trail
+	}
+
+	// query returns the records of the page, newest first.
+	query := func(trail audit.Trail, before uint64, limit int) ([]audit.Record, *uint64) {
+		page, err := trail.Query(before, limit)
+		Expect(err).NotTo(HaveOccurred())
+		return page.Records, page.Next
+	}
+
+	verifyFile := func() (int, error) {
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		return audit.Verify(f)
+	}
+
+	editLine := func(i int, edit func(r *audit.Record)) {
+		b, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+
+		var r audit.Record
+		Expect(json.Unmarshal([]byte(lines[i]), &r)).To(Succeed())
+		edit(&r)
+		line, err := json.Marshal(r)
+		Expect(err).NotTo(HaveOccurred())
+		lines[i] = string(line)
+
+		err = ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowReturns(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+
+		var err error
+		tempDir, err = ioutil.TempDir("", "audit")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tempDir, "audit.log")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	It("chains each record to the previous one", func() {
+		trail := newTrail()
+		trail.Record(toggle)
+		trail.Record(lightOn)
+
+		records, _ := query(trail, 0, 0)
+		Expect(records).To(HaveLen(2))
+
+		Expect(records[1].Seq).To(Equal(uint64(1)))
+		Expect(records[1].PrevHash).To(BeEmpty())
+		Expect(records[1].Entry).To(Equal(toggle))
+		Expect(records[1].Time).To(Equal(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)))
+		Expect(records[1].Hash).To(HaveLen(64))
+
+		Expect(records[0].Seq).To(Equal(uint64(2)))
+		Expect(records[0].PrevHash).To(Equal(records[1].Hash))
+		Expect(records[0].Entry).To(Equal(lightOn))
+	})
+
+	It("appends records which can be verified", func() {
+		trail := newTrail()
+		trail.Record(toggle)
+		trail.Record(lightOn)
+
+		n, err := verifyFile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+	})
+
+	It("continues the chain in the file", func() {
+		newTrail().Record(toggle)
+
+		trail := newTrail()
+		trail.Record(lightOn)
+
+		records, _ := query(trail, 0, 0)
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].Seq).To(Equal(uint64(2)))
+
+		n, err := verifyFile()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(2))
+	})
+
+	It("keeps no records if there is no file", func() {
+		path = ""
+		trail := newTrail()
+		trail.Record(toggle)
+
+		records, next := query(trail, 0, 0)
+		Expect(records).To(BeEmpty())
+		Expect(next).To(BeNil())
+	})
+
+	Describe("Query", func() {
+		var trail audit.Trail
+
+		BeforeEach(func() {
+			trail = newTrail()
+			for i := 0; i < 5; i++ {
+				trail.Record(toggle)
+			}
+		})
+
+		seqs := func(records []audit.Record) []uint64 {
+			s := []uint64{}
+			for _, r := range records {
+				s = append(s, r.Seq)
+			}
+			return s
+		}
+
+		It("returns the newest records up to the limit, and the next page", func() {
+			records, next := query(trail, 0, 2)
+			Expect(seqs(records)).To(Equal([]uint64{5, 4}))
+			Expect(next).NotTo(BeNil())
+			Expect(*next).To(Equal(uint64(4)))
+
+			records, next = query(trail, *next, 2)
+			Expect(seqs(records)).To(Equal([]uint64{3, 2}))
+			Expect(next).NotTo(BeNil())
+
+			records, next = query(trail, *next, 2)
+			Expect(seqs(records)).To(Equal([]uint64{1}))
+			Expect(next).To(BeNil())
+		})
+
+		It("does not set the next page when all records are returned", func() {
+			records, next := query(trail, 0, 5)
+			Expect(records).To(HaveLen(5))
+			Expect(next).To(BeNil())
+		})
+	})
+
+	Describe("HandleList", func() {
+		var trail audit.Trail
+
+		var admin bool
+
+		list := func(query string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", "/audit?"+query, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			defer context.Clear(req)
+			if admin {
+				events.SetRequestAdmin(req)
+			}
+
+			rec := httptest.NewRecorder()
+			trail.HandleList(rec, req)
+			return rec
+		}
+
+		BeforeEach(func() {
+			trail = newTrail()
+			trail.Record(toggle)
+			trail.Record(lightOn)
+			admin = true
+		})
+
+		It("responds with HTTP status code 403 if the user is not the admin", func() {
+			admin = false
+
+			rec := list("")
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(rec.Body.Len()).To(BeZero())
+		})
+
+		It("lists a page of records", func() {
+			rec := list("limit=1")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var page audit.Page
+			Expect(json.Unmarshal(rec.Body.Bytes(), &page)).To(Succeed())
+
+			expected, err := trail.Query(0, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page).To(Equal(expected))
+		})
+
+		It("responds with HTTP status code 400 for an invalid limit", func() {
+			rec := list(fmt.Sprintf("limit=%d", audit.MaxLimit+1))
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("responds with HTTP status code 400 for an invalid before", func() {
+			rec := list("before=yesterday")
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Verify", func() {
+		BeforeEach(func() {
+			trail := newTrail()
+			trail.Record(toggle)
+			trail.Record(lightOn)
+			trail.Record(toggle)
+		})
+
+		It("detects an altered record", func() {
+			editLine(1, func(r *audit.Record) {
+				r.Principal = "someone-else"
+			})
+
+			n, err := verifyFile()
+			Expect(err).To(MatchError("audit record 2 does not match its hash"))
+			Expect(n).To(Equal(1))
+		})
+
+		It("detects an altered record whose hash was recomputed", func() {
+			editLine(1, func(r *audit.Record) {
+				r.Principal = "someone-else"
+				r.PrevHash = strings.Repeat("0", 64)
+			})
+
+			_, err := verifyFile()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("detects a removed record", func() {
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			lines := strings.SplitAfter(string(b), "\n")
+
+			_, err = audit.Verify(strings.NewReader(lines[0] + lines[2]))
+			Expect(err).To(MatchError("audit record 3 follows record 1"))
+		})
+
+		It("rejects an invalid record", func() {
+			b, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			lines := strings.SplitAfter(string(b), "\n")
+
+			n, err := audit.Verify(bytes.NewBufferString(lines[0] + "not json\n"))
+			Expect(err).To(MatchError(ContainSubstring("line 2")))
+			Expect(n).To(Equal(1))
+		})
+
+		It("continues the chain after a broken record, which still fails verification", func() {
+			editLine(0, func(r *audit.Record) {
+				r.Result = "busy"
+			})
+
+			trail := newTrail()
+			trail.Record(lightOn)
+
+			records, _ := query(trail, 0, 0)
+			Expect(records).To(HaveLen(4))
+			Expect(records[0].Seq).To(Equal(uint64(4)))
+
+			n, err := verifyFile()
+			Expect(err).To(HaveOccurred())
+			Expect(n).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,116 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/audit"
+)
+
+type FakeTrail struct {
+	RecordStub        func(e audit.Entry)
+	recordMutex       sync.RWMutex
+	recordArgsForCall []struct {
+		e audit.Entry
+	}
+	QueryStub        func(before uint64, limit int) (audit.Page, error)
+	queryMutex       sync.RWMutex
+	queryArgsForCall []struct {
+		before uint64
+		limit  int
+	}
+	queryReturns struct {
+		result1 audit.Page
+		result2 error
+	}
+	HandleListStub        func(w http.ResponseWriter, r *http.Request)
+	handleListMutex       sync.RWMutex
+	handleListArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeTrail) Record(e audit.Entry) {
+	fake.recordMutex.Lock()
+	fake.recordArgsForCall = append(fake.recordArgsForCall, struct {
+		e audit.Entry
+	}{e})
+	fake.recordMutex.Unlock()
+	if fake.RecordStub != nil {
+		fake.RecordStub(e)
+	}
+}
+
+func (fake *FakeTrail) RecordCallCount() int {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return len(fake.recordArgsForCall)
+}
+
+func (fake *FakeTrail) RecordArgsForCall(i int) audit.Entry {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return fake.recordArgsForCall[i].e
+}
+
+func (fake *FakeTrail) Query(before uint64, limit int) (audit.Page, error) {
+	fake.queryMutex.Lock()
+	fake.queryArgsForCall = append(fake.queryArgsForCall, struct {
+		before uint64
+		limit  int
+	}{before, limit})
+	fake.queryMutex.Unlock()
+	if fake.QueryStub != nil {
+		return fake.QueryStub(before, limit)
+	} else {
+		return fake.queryReturns.result1, fake.queryReturns.result2
+	}
+}
+
+func (fake *FakeTrail) QueryCallCount() int {
+	fake.queryMutex.RLock()
+	defer fake.queryMutex.RUnlock()
+	return len(fake.queryArgsForCall)
+}
+
+func (fake *FakeTrail) QueryArgsForCall(i int) (uint64, int) {
+	fake.queryMutex.RLock()
+	defer fake.queryMutex.RUnlock()
+	return fake.queryArgsForCall[i].before, fake.queryArgsForCall[i].limit
+}
+
+func (fake *FakeTrail) QueryReturns(result1 audit.Page, result2 error) {
+	fake.QueryStub = nil
+	fake.queryReturns = struct {
+		result1 audit.Page
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeTrail) HandleList(w http.ResponseWriter, r *http.Request) {
+	fake.handleListMutex.Lock()
+	fake.handleListArgsForCall = append(fake.handleListArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleListMutex.Unlock()
+	if fake.HandleListStub != nil {
+		fake.HandleListStub(w, r)
+	}
+}
+
+func (fake *FakeTrail) HandleListCallCount() int {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return len(fake.handleListArgsForCall)
+}
+
+func (fake *FakeTrail) HandleListArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return fake.handleListArgsForCall[i].w, fake.handleListArgsForCall[i].r
+}
+
+var _ audit.Trail = new(FakeTrail)
@@ -0,0 +1,237 @@
+package door
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/robdimsdale/garagepi/timewindow"
+	"github.com/tedsuo/ifrit"
+)
+
+type AutoCloseOutcome string
+
+const (
+	AutoCloseOutcomePending   AutoCloseOutcome = "pending"
+	AutoCloseOutcomeSucceeded AutoCloseOutcome = "succeeded"
+	AutoCloseOutcomeFailed    AutoCloseOutcome = "failed"
+)
+
+type AutoCloseAttempt struct {
+	At      time.Time        `json:"at"`
+	Result  MoveResult       `json:"result"`
+	Outcome AutoCloseOutcome `json:"outcome"`
+	State   State            `json:"state,omitempty"`
+}
+
+type AutoCloseStatus struct {
+	Enabled     bool                   `json:"enabled"`
+	OpenFor     string                 `json:"openFor"`
+	Window      *timewindow.TimeWindow `json:"window,omitempty"`
+	LastAttempt *AutoCloseAttempt      `json:"lastAttempt,omitempty"`
+}
+
+// AutoCloser closes the door once it has been open for too long.
+type AutoCloser interface {
+	ifrit.Runner
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleSet(w http.ResponseWriter, r *http.Request)
+}
+
+type autoCloser struct {
+	logger      lager.Logger
+	clock       gpos.OSHelper
+	handler     Handler
+	openFor     time.Duration
+	window      *timewindow.TimeWindow
+	verifyAfter time.Duration
+	interval    time.Duration
+
+	mutex       sync.Mutex
+	enabled     bool
+	verifyAt    time.Time
+	lastAttempt *AutoCloseAttempt
+}
+
+// NewAutoCloser returns an auto-closer which closes the door once it has been
+// open for openFor, optionally only within window (which may be nil).
+// verifyAfter is how long after pulsing the relay the sensor is checked
+// to confirm the door closed, typically the travel time of the door.
+func NewAutoCloser(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	handler Handler,
+	openFor time.Duration,
+	window *timewindow.TimeWindow,
+	verifyAfter time.Duration,
+	interval time.Duration,
+) AutoCloser {
+	return &autoCloser{
+		logger:      logger,
+		clock:       clock,
+		handler:     handler,
+		openFor:     openFor,
+		window:      window,
+		verifyAfter: verifyAfter,
+		interval:    interval,
+		enabled:     true,
+	}
+}
+
+func (a *autoCloser) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			a.check()
+		}
+	}
+}
+
+// check is only called by Run, so attempts never overlap. The mutex is not
+// held while the door is read or moved, which includes pulsing the relay, so
+// that requests to HandleGet and HandleSet are not blocked meanwhile.
+func (a *autoCloser) check() {
+	now := a.clock.Now()
+
+	a.mutex.Lock()
+	pending := a.lastAttempt != nil && a.lastAttempt.Outcome == AutoCloseOutcomePending
+	verifyAt := a.verifyAt
+	due := a.enabled &&
+		(a.window == nil || a.window.Contains(now)) &&
+		(a.lastAttempt == nil || now.Sub(a.lastAttempt.At) >= a.openFor)
+	a.mutex.Unlock()
+
+	if pending {
+		if !now.Before(verifyAt) {
+			a.verify()
+		}
+		return
+	}
+
+	if !due {
+		return
+	}
+
+	ds, err := a.handler.DiscoverDoorState()
+	if err != nil {
+		a.logger.Debug("error reading door state - not auto-closing", lager.Data{"error": err.Error()})
+		return
+	}
+
+	if ds.State != StateOpen || now.Sub(ds.Since) < a.openFor {
+		return
+	}
+
+	a.logger.Info("auto-closing door", lager.Data{
+		"openSince": ds.Since,
+		"openFor":   now.Sub(ds.Since).String(),
+	})
+
+	mr := a.handler.MoveTo(StateClosed, events.Source{})
+
+	attempt := &AutoCloseAttempt{
+		At:     now,
+		Result: mr.Result,
+	}
+
+	switch mr.Result {
+	case MoveResultPulsed, MoveResultInProgress:
+		attempt.Outcome = AutoCloseOutcomePending
+	default:
+		attempt.Outcome = AutoCloseOutcomeFailed
+		if mr.Door != nil {
+			attempt.State = mr.Door.State
+		}
+		a.logger.Error("auto-close failed", errors.New("door not pulsed"), lager.Data{
+			"result":   mr.Result,
+			"errorMsg": mr.ErrorMsg,
+		})
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.lastAttempt = attempt
+	a.verifyAt = now.Add(a.verifyAfter)
+}
+
+// verify checks the outcome of the pending attempt.
+func (a *autoCloser) verify() {
+	ds, err := a.handler.DiscoverDoorState()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err != nil {
+		a.lastAttempt.Outcome = AutoCloseOutcomeFailed
+		a.lastAttempt.State = StateUnknown
+		a.logger.Error("auto-close failed", err)
+		return
+	}
+
+	a.lastAttempt.State = ds.State
+
+	if ds.State != StateClosed {
+		a.lastAttempt.Outcome = AutoCloseOutcomeFailed
+		a.logger.Error("auto-close failed", errors.New("door did not close"), lager.Data{"state": ds.State})
+		return
+	}
+
+	a.lastAttempt.Outcome = AutoCloseOutcomeSucceeded
+	a.logger.Info("auto-close succeeded")
+}
+
+func (a *autoCloser) status() AutoCloseStatus {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	s := AutoCloseStatus{
+		Enabled: a.enabled,
+		OpenFor: a.openFor.String(),
+		Window:  a.window,
+	}
+
+	if a.lastAttempt != nil {
+		attempt := *a.lastAttempt
+		s.LastAttempt = &attempt
+	}
+
+	return s
+}
+
+func (a *autoCloser) HandleGet(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(a.status())
+	w.Write(b)
+}
+
+func (a *autoCloser) HandleSet(w http.ResponseWriter, r *http.Request) {
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		a.logger.Info("invalid auto-close setting provided", lager.Data{"enabled": r.FormValue("enabled")})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	a.mutex.Lock()
+	a.enabled = enabled
+	a.mutex.Unlock()
+
+	a.logger.Info("auto-close setting changed", lager.Data{"enabled": enabled})
+
+	b, _ := json.Marshal(a.status())
+	w.Write(b)
+}
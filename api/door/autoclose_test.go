@@ -0,0 +1,246 @@
+package door_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/robdimsdale/garagepi/timewindow"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("AutoCloser", func() {
+	const (
+		openFor     = 10 * time.Minute
+		verifyAfter = 15 * time.Second
+	)
+
+	var (
+		logger      *lagertest.TestLogger
+		clock       *os_fakes.FakeOSHelper
+		fakeHandler *door_fakes.FakeHandler
+		window      *timewindow.TimeWindow
+
+		mutex     sync.Mutex
+		now       time.Time
+		doorState door.DoorState
+
+		autoCloser door.AutoCloser
+		process    ifrit.Process
+	)
+
+	setNow := func(t time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = t
+	}
+
+	setDoorState := func(ds door.DoorState) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		doorState = ds
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("autoclose test")
+		window = nil
+
+		now = time.Date(2016, 1, 2, 23, 0, 0, 0, time.UTC)
+		clock = new(os_fakes.FakeOSHelper)
+		clock.NowStub = func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now
+		}
+
+		doorState = door.DoorState{
+			State: door.StateOpen,
+			Since: now.Add(-2 * openFor),
+		}
+
+		fakeHandler = new(door_fakes.FakeHandler)
+		fakeHandler.DiscoverDoorStateStub = func() (*door.DoorState, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			ds := doorState
+			return &ds, nil
+		}
+		fakeHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+	})
+
+	JustBeforeEach(func() {
+		autoCloser = door.NewAutoCloser(
+			logger,
+			clock,
+			fakeHandler,
+			openFor,
+			window,
+			verifyAfter,
+			time.Millisecond,
+		)
+		process = ifrit.Invoke(autoCloser)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	Context("When the door has been open for longer than allowed", func() {
+		It("Should close the door", func() {
+			Eventually(fakeHandler.MoveToCallCount).Should(Equal(1))
+			Expect(fakeHandler.MoveToArgsForCall(0)).To(Equal(door.StateClosed))
+			Eventually(logger).Should(gbytes.Say("auto-closing door"))
+		})
+
+		It("Should log success once the sensor confirms the door closed", func() {
+			Eventually(fakeHandler.MoveToCallCount).Should(Equal(1))
+
+			setDoorState(door.DoorState{State: door.StateClosed})
+			setNow(now.Add(verifyAfter))
+
+			Eventually(logger).Should(gbytes.Say("auto-close succeeded"))
+		})
+
+		It("Should log failure if the door did not close", func() {
+			Eventually(fakeHandler.MoveToCallCount).Should(Equal(1))
+
+			setDoorState(door.DoorState{State: door.StateStuck})
+			setNow(now.Add(verifyAfter))
+
+			Eventually(logger).Should(gbytes.Say("auto-close failed"))
+			Consistently(fakeHandler.MoveToCallCount).Should(Equal(1))
+		})
+
+		Context("While the door is being moved", func() {
+			var release chan struct{}
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				fakeHandler.MoveToStub = func(door.State, events.Source) door.MoveResponse {
+					<-release
+					return door.MoveResponse{Result: door.MoveResultPulsed}
+				}
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("Should still report the policy", func() {
+				Eventually(fakeHandler.MoveToCallCount).Should(Equal(1))
+
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					autoCloser.HandleGet(httptest.NewRecorder(), new(http.Request))
+					close(done)
+				}()
+
+				Eventually(done).Should(BeClosed())
+			})
+		})
+
+		Context("When the door cannot be moved", func() {
+			BeforeEach(func() {
+				fakeHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultRejected})
+			})
+
+			It("Should log failure and not retry straight away", func() {
+				Eventually(logger).Should(gbytes.Say("auto-close failed"))
+				Consistently(fakeHandler.MoveToCallCount).Should(Equal(1))
+			})
+		})
+
+		Context("When outside the configured window", func() {
+			BeforeEach(func() {
+				w, err := timewindow.Parse("01:00-06:00")
+				Expect(err).NotTo(HaveOccurred())
+				window = &w
+			})
+
+			It("Should not close the door", func() {
+				Consistently(fakeHandler.MoveToCallCount).Should(Equal(0))
+			})
+		})
+
+		Context("When inside the configured window", func() {
+			BeforeEach(func() {
+				w, err := timewindow.Parse("22:00-06:00")
+				Expect(err).NotTo(HaveOccurred())
+				window = &w
+			})
+
+			It("Should close the door", func() {
+				Eventually(fakeHandler.MoveToCallCount).Should(Equal(1))
+			})
+		})
+	})
+
+	Context("When the door has not been open for long enough", func() {
+		BeforeEach(func() {
+			doorState.Since = now.Add(-openFor / 2)
+		})
+
+		It("Should not close the door", func() {
+			Consistently(fakeHandler.MoveToCallCount).Should(Equal(0))
+		})
+	})
+
+	Describe("Enabling and disabling", func() {
+		var (
+			recorder *httptest.ResponseRecorder
+			status   door.AutoCloseStatus
+		)
+
+		BeforeEach(func() {
+			recorder = httptest.NewRecorder()
+			setDoorState(door.DoorState{State: door.StateClosed})
+		})
+
+		It("Should report the policy", func() {
+			autoCloser.HandleGet(recorder, new(http.Request))
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &status)).To(Succeed())
+			Expect(status.Enabled).To(BeTrue())
+			Expect(status.OpenFor).To(Equal(openFor.String()))
+		})
+
+		It("Should not close the door once disabled", func() {
+			req, err := http.NewRequest("POST", "/", strings.NewReader(url.Values{"enabled": {"false"}}.Encode()))
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			autoCloser.HandleSet(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &status)).To(Succeed())
+			Expect(status.Enabled).To(BeFalse())
+
+			setDoorState(door.DoorState{
+				State: door.StateOpen,
+				Since: now.Add(-2 * openFor),
+			})
+			Consistently(fakeHandler.MoveToCallCount).Should(Equal(0))
+		})
+
+		It("Should reject invalid settings", func() {
+			req, err := http.NewRequest("POST", "/?enabled=maybe", nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			autoCloser.HandleSet(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
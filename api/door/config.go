@@ -0,0 +1,162 @@
+package door
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type Config struct {
+	Name          string
+	RelayPin      uint
+	PulseDuration time.Duration
+	TravelTime    time.Duration
+
+	// Cooldown is the minimum time between the end of one pulse and the start of the next.
+	Cooldown time.Duration
+
+	// RelayActiveLow is true if the relay is energized by writing low to RelayPin.
+	RelayActiveLow bool
+
+	// Sensor is nil if the door has no sensor.
+	Sensor *Sensor
+
+	Interlocks []Interlock
+}
+
+// ConfigSpecs collects door specifications from repeated command-line flags.
+type ConfigSpecs []string
+
+func (c *ConfigSpecs) String() string {
+	return strings.Join(*c, " ")
+}
+
+func (c *ConfigSpecs) Set(spec string) error {
+	*c = append(*c, spec)
+	return nil
+}
+
+// ParseConfig parses a door specification of comma-separated key=value pairs, e.g.
+//
+//	name=left,relayPin=17,relayActiveLow=true,pulseDuration=1s,travelTime=15s,cooldown=2s,sensorPin=27,sensorActiveLow=true,sensorContact=closed,interlock=photoeye:5:block-close
+//
+// name and relayPin are required; the door has a sensor only if sensorPin is provided.
+// interlock may be repeated; see ParseInterlock for its format.
+// Any other values not provided are taken from defaults.
+func ParseConfig(spec string, defaults Config) (Config, error) {
+	c := Config{
+		PulseDuration:  defaults.PulseDuration,
+		TravelTime:     defaults.TravelTime,
+		Cooldown:       defaults.Cooldown,
+		RelayActiveLow: defaults.RelayActiveLow,
+	}
+
+	sensor := Sensor{
+		Contact: SensorContactClosed,
+	}
+	hasSensor := false
+	hasRelayPin := false
+
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return Config{}, fmt.Errorf("invalid door specification: %s", pair)
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		var err error
+		switch key {
+		case "name":
+			c.Name = value
+		case "relayPin":
+			c.RelayPin, err = parsePin(value)
+			hasRelayPin = true
+		case "relayActiveLow":
+			c.RelayActiveLow, err = strconv.ParseBool(value)
+		case "pulseDuration":
+			c.PulseDuration, err = time.ParseDuration(value)
+		case "travelTime":
+			c.TravelTime, err = time.ParseDuration(value)
+		case "cooldown":
+			c.Cooldown, err = time.ParseDuration(value)
+		case "sensorPin":
+			sensor.Pin, err = parsePin(value)
+			hasSensor = true
+		case "sensorActiveLow":
+			sensor.ActiveLow, err = strconv.ParseBool(value)
+		case "sensorContact":
+			sensor.Contact, err = ParseSensorContact(value)
+		case "interlock":
+			var i Interlock
+			i, err = ParseInterlock(value)
+			c.Interlocks = append(c.Interlocks, i)
+		default:
+			err = fmt.Errorf("unknown door specification key: %s", key)
+		}
+
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	if !validName.MatchString(c.Name) {
+		return Config{}, fmt.Errorf("invalid door name: '%s'", c.Name)
+	}
+
+	if !hasRelayPin {
+		return Config{}, fmt.Errorf("relayPin must be provided for door: %s", c.Name)
+	}
+
+	if hasSensor {
+		c.Sensor = &sensor
+	}
+
+	return c, nil
+}
+
+// ValidateConfigs checks that door names are unique, pulse durations are positive,
+// cooldowns are not negative and interlock names are unique within each door.
+func ValidateConfigs(configs []Config) error {
+	if len(configs) == 0 {
+		return fmt.Errorf("at least one door must be configured")
+	}
+
+	names := map[string]bool{}
+	for _, c := range configs {
+		if names[c.Name] {
+			return fmt.Errorf("duplicate door name: %s", c.Name)
+		}
+		names[c.Name] = true
+
+		if c.PulseDuration <= 0 {
+			return fmt.Errorf("pulseDuration must be positive for door: %s", c.Name)
+		}
+
+		if c.Cooldown < 0 {
+			return fmt.Errorf("cooldown must not be negative for door: %s", c.Name)
+		}
+
+		interlocks := map[string]bool{}
+		for _, i := range c.Interlocks {
+			if interlocks[i.Name] {
+				return fmt.Errorf("duplicate interlock name: %s for door: %s", i.Name, c.Name)
+			}
+			interlocks[i.Name] = true
+		}
+	}
+
+	return nil
+}
+
+func parsePin(value string) (uint, error) {
+	pin, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pin: %s", value)
+	}
+	return uint(pin), nil
+}
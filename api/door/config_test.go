@@ -0,0 +1,129 @@
+package door_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/api/door"
+)
+
+var _ = Describe("Config", func() {
+	var defaults door.Config
+
+	BeforeEach(func() {
+		defaults = door.Config{
+			Name:          "door",
+			RelayPin:      17,
+			PulseDuration: 500 * time.Millisecond,
+			TravelTime:    15 * time.Second,
+			Cooldown:      time.Second,
+		}
+	})
+
+	Describe("ParseConfig", func() {
+		It("Should parse a full specification", func() {
+			c, err := door.ParseConfig(
+				"name=left,relayPin=22,relayActiveLow=true,pulseDuration=1s,travelTime=20s,cooldown=3s,sensorPin=27,sensorActiveLow=true,sensorContact=open,interlock=photoeye:5:block-close,interlock=car:6:warn-only:true",
+				defaults,
+			)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(Equal(door.Config{
+				Name:           "left",
+				RelayPin:       22,
+				RelayActiveLow: true,
+				PulseDuration:  time.Second,
+				TravelTime:     20 * time.Second,
+				Cooldown:       3 * time.Second,
+				Sensor: &door.Sensor{
+					Pin:       27,
+					ActiveLow: true,
+					Contact:   door.SensorContactOpen,
+				},
+				Interlocks: []door.Interlock{
+					{Name: "photoeye", Pin: 5, Policy: door.InterlockPolicyBlockClose},
+					{Name: "car", Pin: 6, ActiveLow: true, Policy: door.InterlockPolicyWarnOnly},
+				},
+			}))
+		})
+
+		It("Should take values not provided from the defaults and have no sensor without sensorPin", func() {
+			defaults.RelayActiveLow = true
+
+			c, err := door.ParseConfig("name=right,relayPin=23", defaults)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c).To(Equal(door.Config{
+				Name:           "right",
+				RelayPin:       23,
+				RelayActiveLow: true,
+				PulseDuration:  defaults.PulseDuration,
+				TravelTime:     defaults.TravelTime,
+				Cooldown:       defaults.Cooldown,
+			}))
+		})
+
+		It("Should return an error when relayPin is missing", func() {
+			_, err := door.ParseConfig("name=left", defaults)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error for an invalid name", func() {
+			_, err := door.ParseConfig("name=left door,relayPin=22", defaults)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error for an unknown key", func() {
+			_, err := door.ParseConfig("name=left,relayPin=22,colour=red", defaults)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error for an invalid pin", func() {
+			_, err := door.ParseConfig("name=left,relayPin=-1", defaults)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("ValidateConfigs", func() {
+		It("Should return an error when no doors are configured", func() {
+			Expect(door.ValidateConfigs(nil)).To(HaveOccurred())
+		})
+
+		It("Should return an error when door names are duplicated", func() {
+			err := door.ValidateConfigs([]door.Config{
+				{Name: "left", PulseDuration: time.Second},
+				{Name: "left", PulseDuration: time.Second},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error when a pulse duration is not positive", func() {
+			err := door.ValidateConfigs([]door.Config{{Name: "left"}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error when a cooldown is negative", func() {
+			err := door.ValidateConfigs([]door.Config{{Name: "left", PulseDuration: time.Second, Cooldown: -time.Second}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error when interlock names are duplicated within a door", func() {
+			err := door.ValidateConfigs([]door.Config{{
+				Name:          "left",
+				PulseDuration: time.Second,
+				Interlocks: []door.Interlock{
+					{Name: "photoeye", Pin: 5, Policy: door.InterlockPolicyBlockClose},
+					{Name: "photoeye", Pin: 6, Policy: door.InterlockPolicyBlockAll},
+				},
+			}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should accept uniquely named doors", func() {
+			err := door.ValidateConfigs([]door.Config{
+				{Name: "left", PulseDuration: time.Second},
+				{Name: "right", PulseDuration: time.Second},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -1,27 +1,43 @@
 package door_test
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
 
+	"github.com/gorilla/context"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/audit"
+	audit_fakes "github.com/robdimsdale/garagepi/api/audit/fakes"
 	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
 	test_helpers_fakes "github.com/robdimsdale/garagepi/fakes"
 	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
 	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
 )
 
 const (
-	gpioDoorPin = uint(1)
+	doorName          = "garage"
+	gpioDoorPin       = uint(1)
+	gpioDoorSensorPin = uint(2)
+	travelTime        = 10 * time.Second
+	pulseDuration     = 750 * time.Millisecond
 )
 
 var (
 	fakeOSHelper       *os_fakes.FakeOSHelper
 	fakeLogger         lager.Logger
 	fakeGpio           *gpio_fakes.FakeGpio
+	fakeRecorder       *events_fakes.FakeRecorder
+	fakeTrail          *audit_fakes.FakeTrail
 	fakeResponseWriter *test_helpers_fakes.FakeResponseWriter
 
 	dummyRequest *http.Request
@@ -33,13 +49,22 @@ var _ = Describe("Door", func() {
 		fakeLogger = lagertest.NewTestLogger("Door test")
 		fakeOSHelper = new(os_fakes.FakeOSHelper)
 		fakeGpio = new(gpio_fakes.FakeGpio)
+		fakeRecorder = new(events_fakes.FakeRecorder)
+		fakeTrail = new(audit_fakes.FakeTrail)
 		fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
 
 		dh = door.NewHandler(
 			fakeLogger,
 			fakeOSHelper,
 			fakeGpio,
-			gpioDoorPin,
+			door.Config{
+				Name:          doorName,
+				RelayPin:      gpioDoorPin,
+				PulseDuration: pulseDuration,
+				TravelTime:    travelTime,
+			},
+			fakeRecorder,
+			fakeTrail,
 		)
 
 		dummyRequest = new(http.Request)
@@ -48,7 +73,7 @@ var _ = Describe("Door", func() {
 	Context("When toggling and sleeping return sucessfully", func() {
 		It("Should write high to door pin, sleep, and write low to door pin", func() {
 			dh.HandleToggle(fakeResponseWriter, dummyRequest)
-			Expect(fakeOSHelper.SleepArgsForCall(0)).To(Equal(door.SleepTime))
+			Expect(fakeOSHelper.SleepArgsForCall(0)).To(Equal(pulseDuration))
 
 			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
 			Expect(fakeGpio.WriteLowCallCount()).To(Equal(1))
@@ -65,6 +90,48 @@ var _ = Describe("Door", func() {
 			Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
 			Expect(fakeResponseWriter.WriteArgsForCall(0)).To(Equal([]byte("door toggled")))
 		})
+
+		It("Should record the toggle with the user and client IP of the request", func() {
+			req, err := http.NewRequest("POST", "/api/v1/toggle", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.SetBasicAuth("some-user", "some-password")
+			req.RemoteAddr = "192.168.1.10:54321"
+
+			dh.HandleToggle(fakeResponseWriter, req)
+
+			Expect(fakeRecorder.RecordCallCount()).To(Equal(1))
+			Expect(fakeRecorder.RecordArgsForCall(0)).To(Equal(events.Event{
+				Type:   events.TypeDoorToggle,
+				Door:   doorName,
+				Result: "pulsed",
+				Source: events.Source{
+					User:     "some-user",
+					ClientIP: "192.168.1.10",
+				},
+			}))
+
+			Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+			Expect(fakeTrail.RecordArgsForCall(0)).To(Equal(audit.Entry{
+				Principal: "some-user",
+				ClientIP:  "192.168.1.10",
+				Action:    audit.ActionDoorToggle,
+				Target:    doorName,
+				Result:    "pulsed",
+			}))
+		})
+
+		It("Should use the source of the request set by the auth middleware", func() {
+			req, err := http.NewRequest("POST", "/api/v1/toggle", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.RemoteAddr = "192.168.1.10:54321"
+			events.SetRequestSource(req, events.Source{User: "session-user", ClientIP: "192.168.1.10"})
+			defer context.Clear(req)
+
+			dh.HandleToggle(fakeResponseWriter, req)
+
+			Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+			Expect(fakeTrail.RecordArgsForCall(0).Principal).To(Equal("session-user"))
+		})
 	})
 
 	Context("When writing high returns with errors", func() {
@@ -88,4 +155,460 @@ var _ = Describe("Door", func() {
 			Expect(fakeResponseWriter.WriteArgsForCall(0)).To(Equal([]byte("error - door not toggled")))
 		})
 	})
+
+	Describe("Overlapping operations", func() {
+		var (
+			now time.Time
+
+			nowMutex sync.Mutex
+		)
+
+		setNow := func(t time.Time) {
+			nowMutex.Lock()
+			defer nowMutex.Unlock()
+			now = t
+		}
+
+		toggle := func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			dh.HandleToggle(w, dummyRequest)
+			return w
+		}
+
+		rejection := func(w *httptest.ResponseRecorder) door.OperationRejectedResponse {
+			var r door.OperationRejectedResponse
+			err := json.Unmarshal(w.Body.Bytes(), &r)
+			Expect(err).NotTo(HaveOccurred())
+			return r
+		}
+
+		BeforeEach(func() {
+			setNow(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+			fakeOSHelper.NowStub = func() time.Time {
+				nowMutex.Lock()
+				defer nowMutex.Unlock()
+				return now
+			}
+
+			dh = door.NewHandler(
+				fakeLogger,
+				fakeOSHelper,
+				fakeGpio,
+				door.Config{
+					Name:          doorName,
+					RelayPin:      gpioDoorPin,
+					PulseDuration: pulseDuration,
+					TravelTime:    travelTime,
+					Cooldown:      5 * time.Second,
+				},
+				fakeRecorder,
+				fakeTrail,
+			)
+		})
+
+		Context("When the door is toggled while a toggle is in progress", func() {
+			var (
+				releaseSleep chan struct{}
+				firstDone    chan *httptest.ResponseRecorder
+			)
+
+			BeforeEach(func() {
+				release := make(chan struct{})
+				fakeOSHelper.SleepStub = func(time.Duration) {
+					<-release
+				}
+				releaseSleep = release
+
+				firstDone = make(chan *httptest.ResponseRecorder, 1)
+				go func(done chan<- *httptest.ResponseRecorder) {
+					done <- toggle()
+				}(firstDone)
+
+				Eventually(fakeOSHelper.SleepCallCount).Should(Equal(1))
+			})
+
+			AfterEach(func() {
+				close(releaseSleep)
+			})
+
+			It("Should not pulse the relay again and respond with HTTP status code 409", func() {
+				w := toggle()
+				Expect(w.Code).To(Equal(http.StatusConflict))
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+
+				r := rejection(w)
+				Expect(r.ErrorMsg).To(ContainSubstring("in progress"))
+				Expect(r.NextAvailable).To(Equal(now.Add(pulseDuration + 5*time.Second)))
+			})
+
+			It("Should log the rejection", func() {
+				toggle()
+				Expect(fakeLogger.(*lagertest.TestLogger).Buffer()).To(gbytes.Say("door operation rejected"))
+			})
+
+			It("Should complete the first toggle", func() {
+				toggle()
+				releaseSleep <- struct{}{}
+
+				var w *httptest.ResponseRecorder
+				Eventually(firstDone).Should(Receive(&w))
+				Expect(w.Body.String()).To(Equal("door toggled"))
+				Expect(fakeGpio.WriteLowCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("When the door is toggled within the cooldown", func() {
+			BeforeEach(func() {
+				toggle()
+				setNow(now.Add(2 * time.Second))
+			})
+
+			It("Should not pulse the relay and respond with HTTP status code 429", func() {
+				w := toggle()
+				Expect(w.Code).To(Equal(429))
+				Expect(w.Header().Get("Retry-After")).To(Equal("4"))
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+
+				r := rejection(w)
+				Expect(r.ErrorMsg).To(ContainSubstring("cooling down"))
+				Expect(r.NextAvailable).To(Equal(now.Add(3 * time.Second)))
+			})
+
+			It("Should log the rejection", func() {
+				toggle()
+				Expect(fakeLogger.(*lagertest.TestLogger).Buffer()).To(gbytes.Say("door operation rejected"))
+			})
+
+			It("Should record the rejection", func() {
+				toggle()
+				Expect(fakeRecorder.RecordCallCount()).To(Equal(2))
+				Expect(fakeRecorder.RecordArgsForCall(1).Result).To(Equal("cooldown"))
+			})
+		})
+
+		Context("When the door is toggled after the cooldown", func() {
+			BeforeEach(func() {
+				toggle()
+				setNow(now.Add(5 * time.Second))
+			})
+
+			It("Should pulse the relay", func() {
+				w := toggle()
+				Expect(w.Code).To(Equal(http.StatusOK))
+				Expect(w.Body.String()).To(Equal("door toggled"))
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(2))
+			})
+		})
+
+		Context("When the previous toggle failed to energize the relay", func() {
+			BeforeEach(func() {
+				fakeGpio.WriteHighReturns(errors.New("gpio error"))
+				toggle()
+				fakeGpio.WriteHighReturns(nil)
+			})
+
+			It("Should not apply the cooldown", func() {
+				w := toggle()
+				Expect(w.Body.String()).To(Equal("door toggled"))
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(2))
+			})
+		})
+	})
+
+	Describe("Idling the relay", func() {
+		It("Should write low to door pin", func() {
+			err := dh.IdleRelay()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(fakeGpio.WriteLowCallCount()).To(Equal(1))
+			Expect(fakeGpio.WriteLowArgsForCall(0)).To(Equal(gpioDoorPin))
+		})
+
+		It("Should return an error when writing fails", func() {
+			fakeGpio.WriteLowReturns(errors.New("gpio error"))
+
+			err := dh.IdleRelay()
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("When the relay is active-low", func() {
+		BeforeEach(func() {
+			dh = door.NewHandler(
+				fakeLogger,
+				fakeOSHelper,
+				fakeGpio,
+				door.Config{
+					Name:           doorName,
+					RelayPin:       gpioDoorPin,
+					RelayActiveLow: true,
+					PulseDuration:  pulseDuration,
+					TravelTime:     travelTime,
+				},
+				fakeRecorder,
+				fakeTrail,
+			)
+		})
+
+		It("Should write low to door pin, sleep, and write high to door pin when toggling", func() {
+			dh.HandleToggle(fakeResponseWriter, dummyRequest)
+
+			Expect(fakeGpio.WriteLowCallCount()).To(Equal(1))
+			Expect(fakeGpio.WriteLowArgsForCall(0)).To(Equal(gpioDoorPin))
+			Expect(fakeOSHelper.SleepArgsForCall(0)).To(Equal(pulseDuration))
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(fakeGpio.WriteHighArgsForCall(0)).To(Equal(gpioDoorPin))
+		})
+
+		It("Should not sleep when writing low returns with errors", func() {
+			fakeGpio.WriteLowReturns(errors.New("gpio error"))
+
+			dh.HandleToggle(fakeResponseWriter, dummyRequest)
+			Expect(fakeOSHelper.SleepCallCount()).To(Equal(0))
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+		})
+
+		It("Should write high to door pin when idling the relay", func() {
+			err := dh.IdleRelay()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeGpio.WriteLowCallCount()).To(Equal(0))
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(fakeGpio.WriteHighArgsForCall(0)).To(Equal(gpioDoorPin))
+		})
+	})
+
+	Describe("Reading state", func() {
+		var (
+			sensor *door.Sensor
+			now    time.Time
+		)
+
+		BeforeEach(func() {
+			now = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+			fakeOSHelper.NowReturns(now)
+
+			sensor = &door.Sensor{
+				Pin:     gpioDoorSensorPin,
+				Contact: door.SensorContactClosed,
+			}
+		})
+
+		JustBeforeEach(func() {
+			dh = door.NewHandler(
+				fakeLogger,
+				fakeOSHelper,
+				fakeGpio,
+				door.Config{
+					Name:          doorName,
+					RelayPin:      gpioDoorPin,
+					PulseDuration: pulseDuration,
+					TravelTime:    travelTime,
+					Sensor:        sensor,
+				},
+				fakeRecorder,
+				fakeTrail,
+			)
+		})
+
+		Context("When no sensor is configured", func() {
+			BeforeEach(func() {
+				sensor = nil
+			})
+
+			It("Should not read from any pin", func() {
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeGpio.ReadCallCount()).To(Equal(0))
+			})
+
+			It("Should return unknown door state", func() {
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateUnknown))
+			})
+		})
+
+		Context("When reading door state returns with error", func() {
+			BeforeEach(func() {
+				fakeGpio.ReadReturns("", errors.New("gpio read error"))
+			})
+
+			It("Should read from sensor pin", func() {
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeGpio.ReadCallCount()).To(Equal(1))
+				Expect(fakeGpio.ReadArgsForCall(0)).To(Equal(gpioDoorSensorPin))
+			})
+
+			It("Should return unknown door state", func() {
+				expectedReturn, err := json.Marshal(door.DoorState{
+					Name:  doorName,
+					State: door.StateUnknown,
+					Since: now,
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
+				Expect(fakeResponseWriter.WriteArgsForCall(0)).To(MatchJSON(expectedReturn))
+			})
+
+			It("Should respond with HTTP status code 503", func() {
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeResponseWriter.WriteHeaderCallCount()).To(Equal(1))
+				Expect(fakeResponseWriter.WriteHeaderArgsForCall(0)).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+
+		Context("When reading door state returns unrecognized value", func() {
+			BeforeEach(func() {
+				fakeGpio.ReadReturns("2", nil)
+			})
+
+			It("Should respond with HTTP status code 503", func() {
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeResponseWriter.WriteHeaderCallCount()).To(Equal(1))
+				Expect(fakeResponseWriter.WriteHeaderArgsForCall(0)).To(Equal(http.StatusServiceUnavailable))
+			})
+		})
+
+		Context("When the sensor contact is made with the door closed", func() {
+			It("Should return closed when the sensor reads high", func() {
+				fakeGpio.ReadReturns("1\n", nil)
+
+				expectedReturn, err := json.Marshal(door.DoorState{
+					Name:  doorName,
+					State: door.StateClosed,
+					Since: now,
+					LastTransition: &door.Transition{
+						From:  door.StateUnknown,
+						To:    door.StateClosed,
+						Cause: door.CauseSensor,
+						At:    now,
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				dh.HandleGet(fakeResponseWriter, dummyRequest)
+				Expect(fakeResponseWriter.WriteHeaderCallCount()).To(Equal(0))
+				Expect(fakeResponseWriter.WriteArgsForCall(0)).To(MatchJSON(expectedReturn))
+			})
+
+			It("Should return open when the sensor reads low", func() {
+				fakeGpio.ReadReturns("0", nil)
+
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateOpen))
+			})
+
+			Context("When the sensor is active-low", func() {
+				BeforeEach(func() {
+					sensor.ActiveLow = true
+				})
+
+				It("Should return closed when the sensor reads low", func() {
+					fakeGpio.ReadReturns("0", nil)
+
+					ds, err := dh.DiscoverDoorState()
+					Expect(err).NotTo(HaveOccurred())
+					Expect(ds.State).To(Equal(door.StateClosed))
+				})
+			})
+		})
+
+		Context("When the sensor contact is made with the door open", func() {
+			BeforeEach(func() {
+				sensor.Contact = door.SensorContactOpen
+			})
+
+			It("Should return open when the sensor reads high", func() {
+				fakeGpio.ReadReturns("1", nil)
+
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateOpen))
+			})
+
+			It("Should return closed when the sensor reads low", func() {
+				fakeGpio.ReadReturns("0", nil)
+
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateClosed))
+			})
+		})
+
+		Context("When the door state is read more than once", func() {
+			var later time.Time
+
+			BeforeEach(func() {
+				later = now.Add(time.Minute)
+				fakeGpio.ReadReturns("1", nil)
+			})
+
+			It("Should report when the current state was first observed", func() {
+				_, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+
+				fakeOSHelper.NowReturns(later)
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.Since).To(Equal(now))
+			})
+
+			It("Should reset since when the state changes", func() {
+				_, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+
+				fakeOSHelper.NowReturns(later)
+				fakeGpio.ReadReturns("0", nil)
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateOpening))
+				Expect(ds.Since).To(Equal(later))
+			})
+
+			It("Should record changes in the sensor reading", func() {
+				_, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				_, err = dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+
+				for i := 0; i < fakeRecorder.RecordCallCount(); i++ {
+					Expect(fakeRecorder.RecordArgsForCall(i).Type).NotTo(Equal(events.TypeSensor))
+				}
+
+				fakeGpio.ReadReturns("0", nil)
+				_, err = dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeRecorder.RecordArgsForCall(fakeRecorder.RecordCallCount() - 2)).To(Equal(events.Event{
+					Type:  events.TypeSensor,
+					Door:  doorName,
+					State: string(door.StateOpen),
+				}))
+			})
+		})
+
+		Context("When the door is toggled", func() {
+			BeforeEach(func() {
+				fakeGpio.ReadReturns("1", nil)
+			})
+
+			It("Should report the door as moving", func() {
+				_, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+
+				dh.HandleToggle(fakeResponseWriter, dummyRequest)
+
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.State).To(Equal(door.StateOpening))
+				Expect(ds.LastTransition).NotTo(BeNil())
+				Expect(ds.LastTransition.From).To(Equal(door.StateClosed))
+				Expect(ds.LastTransition.Cause).To(Equal(door.CausePulse))
+			})
+		})
+	})
 })
@@ -0,0 +1,138 @@
+package door
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+)
+
+//go:generate counterfeiter . Doors
+
+// Doors dispatches requests for /doors/{name}/... to the handler of the named door.
+type Doors interface {
+	All() []Handler
+	Get(name string) (Handler, bool)
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleToggle(w http.ResponseWriter, r *http.Request)
+	HandleOpen(w http.ResponseWriter, r *http.Request)
+	HandleClose(w http.ResponseWriter, r *http.Request)
+	HandleGetAutoClose(w http.ResponseWriter, r *http.Request)
+	HandleSetAutoClose(w http.ResponseWriter, r *http.Request)
+}
+
+type doors struct {
+	logger      lager.Logger
+	handlers    []Handler
+	autoClosers map[string]AutoCloser
+}
+
+// NewDoors returns the doors for the provided handlers, in the order provided.
+// autoClosers is keyed by door name; doors without auto-close may be omitted.
+func NewDoors(
+	logger lager.Logger,
+	handlers []Handler,
+	autoClosers map[string]AutoCloser,
+) Doors {
+	return &doors{
+		logger:      logger,
+		handlers:    handlers,
+		autoClosers: autoClosers,
+	}
+}
+
+func (d doors) All() []Handler {
+	return d.handlers
+}
+
+func (d doors) Get(name string) (Handler, bool) {
+	for _, h := range d.handlers {
+		if h.Name() == name {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+func (d doors) HandleList(w http.ResponseWriter, r *http.Request) {
+	states := []*DoorState{}
+	for _, h := range d.handlers {
+		ds, err := h.DiscoverDoorState()
+		if err != nil {
+			d.logger.Error("error reading door state", err, lager.Data{"door": h.Name()})
+		}
+		states = append(states, ds)
+	}
+
+	b, _ := json.Marshal(states)
+	w.Write(b)
+}
+
+func (d doors) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if h, ok := d.door(w, r); ok {
+		h.HandleGet(w, r)
+	}
+}
+
+func (d doors) HandleToggle(w http.ResponseWriter, r *http.Request) {
+	if h, ok := d.door(w, r); ok {
+		h.HandleToggle(w, r)
+	}
+}
+
+func (d doors) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	if h, ok := d.door(w, r); ok {
+		h.HandleOpen(w, r)
+	}
+}
+
+func (d doors) HandleClose(w http.ResponseWriter, r *http.Request) {
+	if h, ok := d.door(w, r); ok {
+		h.HandleClose(w, r)
+	}
+}
+
+func (d doors) HandleGetAutoClose(w http.ResponseWriter, r *http.Request) {
+	if a, ok := d.autoCloser(w, r); ok {
+		a.HandleGet(w, r)
+	}
+}
+
+func (d doors) HandleSetAutoClose(w http.ResponseWriter, r *http.Request) {
+	if a, ok := d.autoCloser(w, r); ok {
+		a.HandleSet(w, r)
+	}
+}
+
+func (d doors) door(w http.ResponseWriter, r *http.Request) (Handler, bool) {
+	name := mux.Vars(r)["name"]
+
+	h, ok := d.Get(name)
+	if !ok {
+		d.logger.Info("unknown door requested", lager.Data{"door": name})
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "unknown door: %s", name)
+		return nil, false
+	}
+
+	return h, true
+}
+
+func (d doors) autoCloser(w http.ResponseWriter, r *http.Request) (AutoCloser, bool) {
+	h, ok := d.door(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	a, ok := d.autoClosers[h.Name()]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "auto-close not configured for door: %s", h.Name())
+		return nil, false
+	}
+
+	return a, true
+}
@@ -0,0 +1,135 @@
+package door_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Doors", func() {
+	var (
+		leftHandler  *door_fakes.FakeHandler
+		rightHandler *door_fakes.FakeHandler
+		leftCloser   door.AutoCloser
+
+		doors door.Doors
+		rtr   *mux.Router
+	)
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		leftHandler = new(door_fakes.FakeHandler)
+		leftHandler.NameReturns("left")
+		leftHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "left", State: door.StateOpen}, nil)
+
+		rightHandler = new(door_fakes.FakeHandler)
+		rightHandler.NameReturns("right")
+		rightHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "right", State: door.StateClosed}, nil)
+
+		leftCloser = door.NewAutoCloser(
+			lagertest.NewTestLogger("doors test"),
+			new(os_fakes.FakeOSHelper),
+			leftHandler,
+			10*time.Minute,
+			nil,
+			15*time.Second,
+			time.Second,
+		)
+
+		doors = door.NewDoors(
+			lagertest.NewTestLogger("doors test"),
+			[]door.Handler{leftHandler, rightHandler},
+			map[string]door.AutoCloser{"left": leftCloser},
+		)
+
+		rtr = mux.NewRouter()
+		rtr.HandleFunc("/doors", doors.HandleList).Methods("GET")
+		rtr.HandleFunc("/doors/{name}", doors.HandleGet).Methods("GET")
+		rtr.HandleFunc("/doors/{name}/toggle", doors.HandleToggle).Methods("POST")
+		rtr.HandleFunc("/doors/{name}/open", doors.HandleOpen).Methods("POST")
+		rtr.HandleFunc("/doors/{name}/close", doors.HandleClose).Methods("POST")
+		rtr.HandleFunc("/doors/{name}/autoclose", doors.HandleGetAutoClose).Methods("GET")
+		rtr.HandleFunc("/doors/{name}/autoclose", doors.HandleSetAutoClose).Methods("POST")
+	})
+
+	It("Should look up doors by name", func() {
+		h, ok := doors.Get("right")
+		Expect(ok).To(BeTrue())
+		Expect(h).To(Equal(rightHandler))
+
+		_, ok = doors.Get("middle")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Should list the state of every door in order", func() {
+		rightHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "right", State: door.StateUnknown}, errors.New("gpio read error"))
+
+		expected, err := json.Marshal([]door.DoorState{
+			{Name: "left", State: door.StateOpen},
+			{Name: "right", State: door.StateUnknown},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := serve("GET", "/doors")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(expected))
+	})
+
+	It("Should dispatch requests to the named door", func() {
+		serve("GET", "/doors/right")
+		serve("POST", "/doors/right/toggle")
+		serve("POST", "/doors/right/open")
+		serve("POST", "/doors/left/close")
+
+		Expect(rightHandler.HandleGetCallCount()).To(Equal(1))
+		Expect(rightHandler.HandleToggleCallCount()).To(Equal(1))
+		Expect(rightHandler.HandleOpenCallCount()).To(Equal(1))
+		Expect(leftHandler.HandleCloseCallCount()).To(Equal(1))
+
+		Expect(leftHandler.HandleToggleCallCount()).To(Equal(0))
+		Expect(rightHandler.HandleCloseCallCount()).To(Equal(0))
+	})
+
+	It("Should respond with HTTP status code 404 for an unknown door", func() {
+		rec := serve("POST", "/doors/middle/toggle")
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+
+		Expect(leftHandler.HandleToggleCallCount()).To(Equal(0))
+		Expect(rightHandler.HandleToggleCallCount()).To(Equal(0))
+	})
+
+	Describe("auto-close", func() {
+		It("Should dispatch to the auto-closer of the named door", func() {
+			rec := serve("GET", "/doors/left/autoclose")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"enabled":true,"openFor":"10m0s"}`))
+
+			rec = serve("POST", "/doors/left/autoclose?enabled=false")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"enabled":false,"openFor":"10m0s"}`))
+		})
+
+		It("Should respond with HTTP status code 404 when the door has no auto-closer", func() {
+			rec := serve("GET", "/doors/right/autoclose")
+			Expect(rec.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,296 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/door"
+)
+
+type FakeDoors struct {
+	AllStub        func() []door.Handler
+	allMutex       sync.RWMutex
+	allArgsForCall []struct{}
+	allReturns     struct {
+		result1 []door.Handler
+	}
+	GetStub        func(name string) (door.Handler, bool)
+	getMutex       sync.RWMutex
+	getArgsForCall []struct {
+		name string
+	}
+	getReturns struct {
+		result1 door.Handler
+		result2 bool
+	}
+	HandleListStub        func(w http.ResponseWriter, r *http.Request)
+	handleListMutex       sync.RWMutex
+	handleListArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleGetStub        func(w http.ResponseWriter, r *http.Request)
+	handleGetMutex       sync.RWMutex
+	handleGetArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleToggleStub        func(w http.ResponseWriter, r *http.Request)
+	handleToggleMutex       sync.RWMutex
+	handleToggleArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleOpenStub        func(w http.ResponseWriter, r *http.Request)
+	handleOpenMutex       sync.RWMutex
+	handleOpenArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleCloseStub        func(w http.ResponseWriter, r *http.Request)
+	handleCloseMutex       sync.RWMutex
+	handleCloseArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleGetAutoCloseStub        func(w http.ResponseWriter, r *http.Request)
+	handleGetAutoCloseMutex       sync.RWMutex
+	handleGetAutoCloseArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleSetAutoCloseStub        func(w http.ResponseWriter, r *http.Request)
+	handleSetAutoCloseMutex       sync.RWMutex
+	handleSetAutoCloseArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeDoors) All() []door.Handler {
+	fake.allMutex.Lock()
+	fake.allArgsForCall = append(fake.allArgsForCall, struct{}{})
+	fake.allMutex.Unlock()
+	if fake.AllStub != nil {
+		return fake.AllStub()
+	} else {
+		return fake.allReturns.result1
+	}
+}
+
+func (fake *FakeDoors) AllCallCount() int {
+	fake.allMutex.RLock()
+	defer fake.allMutex.RUnlock()
+	return len(fake.allArgsForCall)
+}
+
+func (fake *FakeDoors) AllReturns(result1 []door.Handler) {
+	fake.AllStub = nil
+	fake.allReturns = struct {
+		result1 []door.Handler
+	}{result1}
+}
+
+func (fake *FakeDoors) Get(name string) (door.Handler, bool) {
+	fake.getMutex.Lock()
+	fake.getArgsForCall = append(fake.getArgsForCall, struct {
+		name string
+	}{name})
+	fake.getMutex.Unlock()
+	if fake.GetStub != nil {
+		return fake.GetStub(name)
+	} else {
+		return fake.getReturns.result1, fake.getReturns.result2
+	}
+}
+
+func (fake *FakeDoors) GetCallCount() int {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return len(fake.getArgsForCall)
+}
+
+func (fake *FakeDoors) GetArgsForCall(i int) string {
+	fake.getMutex.RLock()
+	defer fake.getMutex.RUnlock()
+	return fake.getArgsForCall[i].name
+}
+
+func (fake *FakeDoors) GetReturns(result1 door.Handler, result2 bool) {
+	fake.GetStub = nil
+	fake.getReturns = struct {
+		result1 door.Handler
+		result2 bool
+	}{result1, result2}
+}
+
+func (fake *FakeDoors) HandleList(w http.ResponseWriter, r *http.Request) {
+	fake.handleListMutex.Lock()
+	fake.handleListArgsForCall = append(fake.handleListArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleListMutex.Unlock()
+	if fake.HandleListStub != nil {
+		fake.HandleListStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleListCallCount() int {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return len(fake.handleListArgsForCall)
+}
+
+func (fake *FakeDoors) HandleListArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return fake.handleListArgsForCall[i].w, fake.handleListArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleGet(w http.ResponseWriter, r *http.Request) {
+	fake.handleGetMutex.Lock()
+	fake.handleGetArgsForCall = append(fake.handleGetArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleGetMutex.Unlock()
+	if fake.HandleGetStub != nil {
+		fake.HandleGetStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleGetCallCount() int {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return len(fake.handleGetArgsForCall)
+}
+
+func (fake *FakeDoors) HandleGetArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return fake.handleGetArgsForCall[i].w, fake.handleGetArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleToggle(w http.ResponseWriter, r *http.Request) {
+	fake.handleToggleMutex.Lock()
+	fake.handleToggleArgsForCall = append(fake.handleToggleArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleToggleMutex.Unlock()
+	if fake.HandleToggleStub != nil {
+		fake.HandleToggleStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleToggleCallCount() int {
+	fake.handleToggleMutex.RLock()
+	defer fake.handleToggleMutex.RUnlock()
+	return len(fake.handleToggleArgsForCall)
+}
+
+func (fake *FakeDoors) HandleToggleArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleToggleMutex.RLock()
+	defer fake.handleToggleMutex.RUnlock()
+	return fake.handleToggleArgsForCall[i].w, fake.handleToggleArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	fake.handleOpenMutex.Lock()
+	fake.handleOpenArgsForCall = append(fake.handleOpenArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleOpenMutex.Unlock()
+	if fake.HandleOpenStub != nil {
+		fake.HandleOpenStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleOpenCallCount() int {
+	fake.handleOpenMutex.RLock()
+	defer fake.handleOpenMutex.RUnlock()
+	return len(fake.handleOpenArgsForCall)
+}
+
+func (fake *FakeDoors) HandleOpenArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleOpenMutex.RLock()
+	defer fake.handleOpenMutex.RUnlock()
+	return fake.handleOpenArgsForCall[i].w, fake.handleOpenArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleClose(w http.ResponseWriter, r *http.Request) {
+	fake.handleCloseMutex.Lock()
+	fake.handleCloseArgsForCall = append(fake.handleCloseArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleCloseMutex.Unlock()
+	if fake.HandleCloseStub != nil {
+		fake.HandleCloseStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleCloseCallCount() int {
+	fake.handleCloseMutex.RLock()
+	defer fake.handleCloseMutex.RUnlock()
+	return len(fake.handleCloseArgsForCall)
+}
+
+func (fake *FakeDoors) HandleCloseArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleCloseMutex.RLock()
+	defer fake.handleCloseMutex.RUnlock()
+	return fake.handleCloseArgsForCall[i].w, fake.handleCloseArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleGetAutoClose(w http.ResponseWriter, r *http.Request) {
+	fake.handleGetAutoCloseMutex.Lock()
+	fake.handleGetAutoCloseArgsForCall = append(fake.handleGetAutoCloseArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleGetAutoCloseMutex.Unlock()
+	if fake.HandleGetAutoCloseStub != nil {
+		fake.HandleGetAutoCloseStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleGetAutoCloseCallCount() int {
+	fake.handleGetAutoCloseMutex.RLock()
+	defer fake.handleGetAutoCloseMutex.RUnlock()
+	return len(fake.handleGetAutoCloseArgsForCall)
+}
+
+func (fake *FakeDoors) HandleGetAutoCloseArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleGetAutoCloseMutex.RLock()
+	defer fake.handleGetAutoCloseMutex.RUnlock()
+	return fake.handleGetAutoCloseArgsForCall[i].w, fake.handleGetAutoCloseArgsForCall[i].r
+}
+
+func (fake *FakeDoors) HandleSetAutoClose(w http.ResponseWriter, r *http.Request) {
+	fake.handleSetAutoCloseMutex.Lock()
+	fake.handleSetAutoCloseArgsForCall = append(fake.handleSetAutoCloseArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleSetAutoCloseMutex.Unlock()
+	if fake.HandleSetAutoCloseStub != nil {
+		fake.HandleSetAutoCloseStub(w, r)
+	}
+}
+
+func (fake *FakeDoors) HandleSetAutoCloseCallCount() int {
+	fake.handleSetAutoCloseMutex.RLock()
+	defer fake.handleSetAutoCloseMutex.RUnlock()
+	return len(fake.handleSetAutoCloseArgsForCall)
+}
+
+func (fake *FakeDoors) HandleSetAutoCloseArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleSetAutoCloseMutex.RLock()
+	defer fake.handleSetAutoCloseMutex.RUnlock()
+	return fake.handleSetAutoCloseArgsForCall[i].w, fake.handleSetAutoCloseArgsForCall[i].r
+}
+
+var _ door.Doors = new(FakeDoors)
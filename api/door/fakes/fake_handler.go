@@ -6,15 +6,94 @@ import (
 	"sync"
 
 	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
 )
 
 type FakeHandler struct {
+	NameStub        func() string
+	nameMutex       sync.RWMutex
+	nameArgsForCall []struct{}
+	nameReturns     struct {
+		result1 string
+	}
 	HandleToggleStub        func(w http.ResponseWriter, r *http.Request)
 	handleToggleMutex       sync.RWMutex
 	handleToggleArgsForCall []struct {
 		w http.ResponseWriter
 		r *http.Request
 	}
+	HandleOpenStub        func(w http.ResponseWriter, r *http.Request)
+	handleOpenMutex       sync.RWMutex
+	handleOpenArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleCloseStub        func(w http.ResponseWriter, r *http.Request)
+	handleCloseMutex       sync.RWMutex
+	handleCloseArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleGetStub        func(w http.ResponseWriter, r *http.Request)
+	handleGetMutex       sync.RWMutex
+	handleGetArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	DiscoverDoorStateStub        func() (*door.DoorState, error)
+	discoverDoorStateMutex       sync.RWMutex
+	discoverDoorStateArgsForCall []struct{}
+	discoverDoorStateReturns     struct {
+		result1 *door.DoorState
+		result2 error
+	}
+	ToggleStub        func(source events.Source) error
+	toggleMutex       sync.RWMutex
+	toggleArgsForCall []struct {
+		source events.Source
+	}
+	toggleReturns struct {
+		result1 error
+	}
+	MoveToStub        func(position door.State, source events.Source) door.MoveResponse
+	moveToMutex       sync.RWMutex
+	moveToArgsForCall []struct {
+		position door.State
+		source   events.Source
+	}
+	moveToReturns struct {
+		result1 door.MoveResponse
+	}
+	IdleRelayStub        func() error
+	idleRelayMutex       sync.RWMutex
+	idleRelayArgsForCall []struct{}
+	idleRelayReturns     struct {
+		result1 error
+	}
+}
+
+func (fake *FakeHandler) Name() string {
+	fake.nameMutex.Lock()
+	fake.nameArgsForCall = append(fake.nameArgsForCall, struct{}{})
+	fake.nameMutex.Unlock()
+	if fake.NameStub != nil {
+		return fake.NameStub()
+	} else {
+		return fake.nameReturns.result1
+	}
+}
+
+func (fake *FakeHandler) NameCallCount() int {
+	fake.nameMutex.RLock()
+	defer fake.nameMutex.RUnlock()
+	return len(fake.nameArgsForCall)
+}
+
+func (fake *FakeHandler) NameReturns(result1 string) {
+	fake.NameStub = nil
+	fake.nameReturns = struct {
+		result1 string
+	}{result1}
 }
 
 func (fake *FakeHandler) HandleToggle(w http.ResponseWriter, r *http.Request) {
@@ -41,4 +120,190 @@ func (fake *FakeHandler) HandleToggleArgsForCall(i int) (http.ResponseWriter, *h
 	return fake.handleToggleArgsForCall[i].w, fake.handleToggleArgsForCall[i].r
 }
 
+func (fake *FakeHandler) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	fake.handleOpenMutex.Lock()
+	fake.handleOpenArgsForCall = append(fake.handleOpenArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleOpenMutex.Unlock()
+	if fake.HandleOpenStub != nil {
+		fake.HandleOpenStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleOpenCallCount() int {
+	fake.handleOpenMutex.RLock()
+	defer fake.handleOpenMutex.RUnlock()
+	return len(fake.handleOpenArgsForCall)
+}
+
+func (fake *FakeHandler) HandleOpenArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleOpenMutex.RLock()
+	defer fake.handleOpenMutex.RUnlock()
+	return fake.handleOpenArgsForCall[i].w, fake.handleOpenArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleClose(w http.ResponseWriter, r *http.Request) {
+	fake.handleCloseMutex.Lock()
+	fake.handleCloseArgsForCall = append(fake.handleCloseArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleCloseMutex.Unlock()
+	if fake.HandleCloseStub != nil {
+		fake.HandleCloseStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleCloseCallCount() int {
+	fake.handleCloseMutex.RLock()
+	defer fake.handleCloseMutex.RUnlock()
+	return len(fake.handleCloseArgsForCall)
+}
+
+func (fake *FakeHandler) HandleCloseArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleCloseMutex.RLock()
+	defer fake.handleCloseMutex.RUnlock()
+	return fake.handleCloseArgsForCall[i].w, fake.handleCloseArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	fake.handleGetMutex.Lock()
+	fake.handleGetArgsForCall = append(fake.handleGetArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleGetMutex.Unlock()
+	if fake.HandleGetStub != nil {
+		fake.HandleGetStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleGetCallCount() int {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return len(fake.handleGetArgsForCall)
+}
+
+func (fake *FakeHandler) HandleGetArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return fake.handleGetArgsForCall[i].w, fake.handleGetArgsForCall[i].r
+}
+
+func (fake *FakeHandler) DiscoverDoorState() (*door.DoorState, error) {
+	fake.discoverDoorStateMutex.Lock()
+	fake.discoverDoorStateArgsForCall = append(fake.discoverDoorStateArgsForCall, struct{}{})
+	fake.discoverDoorStateMutex.Unlock()
+	if fake.DiscoverDoorStateStub != nil {
+		return fake.DiscoverDoorStateStub()
+	} else {
+		return fake.discoverDoorStateReturns.result1, fake.discoverDoorStateReturns.result2
+	}
+}
+
+func (fake *FakeHandler) DiscoverDoorStateCallCount() int {
+	fake.discoverDoorStateMutex.RLock()
+	defer fake.discoverDoorStateMutex.RUnlock()
+	return len(fake.discoverDoorStateArgsForCall)
+}
+
+func (fake *FakeHandler) DiscoverDoorStateReturns(result1 *door.DoorState, result2 error) {
+	fake.DiscoverDoorStateStub = nil
+	fake.discoverDoorStateReturns = struct {
+		result1 *door.DoorState
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeHandler) Toggle(source events.Source) error {
+	fake.toggleMutex.Lock()
+	fake.toggleArgsForCall = append(fake.toggleArgsForCall, struct {
+		source events.Source
+	}{source})
+	fake.toggleMutex.Unlock()
+	if fake.ToggleStub != nil {
+		return fake.ToggleStub(source)
+	} else {
+		return fake.toggleReturns.result1
+	}
+}
+
+func (fake *FakeHandler) ToggleCallCount() int {
+	fake.toggleMutex.RLock()
+	defer fake.toggleMutex.RUnlock()
+	return len(fake.toggleArgsForCall)
+}
+
+func (fake *FakeHandler) ToggleArgsForCall(i int) events.Source {
+	fake.toggleMutex.RLock()
+	defer fake.toggleMutex.RUnlock()
+	return fake.toggleArgsForCall[i].source
+}
+
+func (fake *FakeHandler) ToggleReturns(result1 error) {
+	fake.ToggleStub = nil
+	fake.toggleReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeHandler) MoveTo(position door.State, source events.Source) door.MoveResponse {
+	fake.moveToMutex.Lock()
+	fake.moveToArgsForCall = append(fake.moveToArgsForCall, struct {
+		position door.State
+		source   events.Source
+	}{position, source})
+	fake.moveToMutex.Unlock()
+	if fake.MoveToStub != nil {
+		return fake.MoveToStub(position, source)
+	} else {
+		return fake.moveToReturns.result1
+	}
+}
+
+func (fake *FakeHandler) MoveToCallCount() int {
+	fake.moveToMutex.RLock()
+	defer fake.moveToMutex.RUnlock()
+	return len(fake.moveToArgsForCall)
+}
+
+func (fake *FakeHandler) MoveToArgsForCall(i int) (door.State, events.Source) {
+	fake.moveToMutex.RLock()
+	defer fake.moveToMutex.RUnlock()
+	return fake.moveToArgsForCall[i].position, fake.moveToArgsForCall[i].source
+}
+
+func (fake *FakeHandler) MoveToReturns(result1 door.MoveResponse) {
+	fake.MoveToStub = nil
+	fake.moveToReturns = struct {
+		result1 door.MoveResponse
+	}{result1}
+}
+
+func (fake *FakeHandler) IdleRelay() error {
+	fake.idleRelayMutex.Lock()
+	fake.idleRelayArgsForCall = append(fake.idleRelayArgsForCall, struct{}{})
+	fake.idleRelayMutex.Unlock()
+	if fake.IdleRelayStub != nil {
+		return fake.IdleRelayStub()
+	} else {
+		return fake.idleRelayReturns.result1
+	}
+}
+
+func (fake *FakeHandler) IdleRelayCallCount() int {
+	fake.idleRelayMutex.RLock()
+	defer fake.idleRelayMutex.RUnlock()
+	return len(fake.idleRelayArgsForCall)
+}
+
+func (fake *FakeHandler) IdleRelayReturns(result1 error) {
+	fake.IdleRelayStub = nil
+	fake.idleRelayReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ door.Handler = new(FakeHandler)
@@ -1,62 +1,269 @@
 package door
 
 import (
+	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/audit"
+	"github.com/robdimsdale/garagepi/api/events"
 	"github.com/robdimsdale/garagepi/gpio"
 	"github.com/robdimsdale/garagepi/os"
 )
 
 //go:generate counterfeiter . Handler
 
-var (
-	SleepTime = 500 * time.Millisecond
-)
-
 type Handler interface {
+	Name() string
 	HandleToggle(w http.ResponseWriter, r *http.Request)
+	HandleOpen(w http.ResponseWriter, r *http.Request)
+	HandleClose(w http.ResponseWriter, r *http.Request)
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	DiscoverDoorState() (*DoorState, error)
+	Toggle(source events.Source) error
+	MoveTo(position State, source events.Source) MoveResponse
+	IdleRelay() error
 }
 
 type handler struct {
-	logger      lager.Logger
-	osHelper    os.OSHelper
-	gpio        gpio.Gpio
-	gpioDoorPin uint
+	logger   lager.Logger
+	osHelper os.OSHelper
+	gpio     gpio.Gpio
+	config   Config
+	machine  *StateMachine
+	ops      *operationLock
+	readings *sensorReadings
+	recorder events.Recorder
+	trail    audit.Trail
 }
 
+// NewHandler returns a handler for a single door. If the door has no sensor
+// its state is always reported as unknown.
+// Toggles, changes in the state of the door and changes in the readings of
+// its sensor and interlocks are recorded with recorder.
+// Toggles, and who requested them, are also recorded with trail.
 func NewHandler(
 	logger lager.Logger,
 	osHelper os.OSHelper,
 	gpio gpio.Gpio,
-	gpioDoorPin uint,
+	config Config,
+	recorder events.Recorder,
+	trail audit.Trail,
 ) Handler {
 
+	logger = logger.WithData(lager.Data{"door": config.Name})
+
+	observed := StateUnknown
+	if config.Sensor != nil {
+		observed = config.Sensor.observedState()
+	}
+
+	onTransition := func(t Transition) {
+		recorder.Record(events.Event{
+			Type:  events.TypeDoorState,
+			Door:  config.Name,
+			State: string(t.To),
+			Cause: string(t.Cause),
+		})
+	}
+
 	return &handler{
-		logger:      logger,
-		gpio:        gpio,
-		gpioDoorPin: gpioDoorPin,
-		osHelper:    osHelper,
+		logger:   logger,
+		gpio:     gpio,
+		osHelper: osHelper,
+		config:   config,
+		machine:  NewStateMachine(logger, osHelper, config.TravelTime, observed, onTransition),
+		ops:      &operationLock{cooldown: config.Cooldown},
+		readings: newSensorReadings(),
+		recorder: recorder,
+		trail:    trail,
 	}
 }
 
+func (h handler) Name() string {
+	return h.config.Name
+}
+
 func (h handler) HandleToggle(w http.ResponseWriter, r *http.Request) {
-	err := h.gpio.WriteHigh(h.gpioDoorPin)
+	err := h.Toggle(events.RequestSource(r))
+	if rejected, ok := err.(*OperationRejectedError); ok {
+		renderOperationRejected(w, h.osHelper.Now(), rejected)
+		return
+	}
+	if interlocked, ok := err.(*InterlockError); ok {
+		renderInterlockError(w, interlocked)
+		return
+	}
 	if err != nil {
-		h.logger.Error("error toggling door. Skipping sleep and further executions", err)
 		w.Write([]byte("error - door not toggled"))
 		return
 	}
 
-	h.osHelper.Sleep(SleepTime)
+	h.logger.Info("door toggled")
+	w.Write([]byte("door toggled"))
+	return
+}
 
-	err = h.gpio.WriteLow(h.gpioDoorPin)
+// IdleRelay writes the idle level of the relay to its pin so that the door
+// is not triggered by the pin's state at startup.
+func (h handler) IdleRelay() error {
+	h.logger.Debug("setting relay to idle", lager.Data{"activeLow": h.config.RelayActiveLow})
+	return h.writeRelay(false)
+}
+
+// Toggle pulses the relay and records the outcome as caused by source.
+func (h handler) Toggle(source events.Source) error {
+	err := h.toggle(source, "")
+	h.trail.Record(audit.NewEntry(source, audit.ActionDoorToggle, h.config.Name, string(toggleResult(err))))
+	return err
+}
+
+// toggle is Toggle, except that it is not audited, and if position is not
+// empty the relay is only pulsed if doing so will still move the door towards
+// position once no other operation is in progress; otherwise a *notMovedError
+// is returned and no event is recorded.
+func (h handler) toggle(source events.Source, position State) error {
+	err := h.pulse(position)
+	if _, ok := err.(*notMovedError); ok {
+		return err
+	}
+
+	h.recorder.Record(events.Event{
+		Type:   events.TypeDoorToggle,
+		Door:   h.config.Name,
+		Result: string(toggleResult(err)),
+		Source: source,
+	})
+
+	return err
+}
+
+// toggleResult returns the result of a toggle which returned err.
+func toggleResult(err error) MoveResult {
+	switch e := err.(type) {
+	case nil:
+		return MoveResultPulsed
+	case *notMovedError:
+		return e.result
+	case *OperationRejectedError:
+		if e.InProgress {
+			return MoveResultBusy
+		}
+		return MoveResultCooldown
+	case *InterlockError:
+		return MoveResultInterlocked
+	default:
+		return MoveResultError
+	}
+}
+
+// pulse returns an *OperationRejectedError if the door is already being
+// operated or is cooling down, and an *InterlockError without pulsing the
+// relay if an active interlock prevents it. Interlocks are checked once the
+// operation lock is held, so that the state they are checked against cannot
+// be changed by a concurrent pulse.
+// If position is not empty, pulse returns a *notMovedError without pulsing
+// the relay if, once the operation lock is held, pulsing would not move the
+// door towards position, e.g. because a concurrent request has moved it.
+func (h handler) pulse(position State) error {
+	err := h.ops.acquire(h.osHelper.Now(), h.config.PulseDuration)
+	if err != nil {
+		rejected := err.(*OperationRejectedError)
+		h.logger.Info("door operation rejected", lager.Data{
+			"inProgress":    rejected.InProgress,
+			"nextAvailable": rejected.NextAvailable,
+		})
+		return err
+	}
+
+	err = h.checkInterlocks(h.machine.NextOnPulse())
+	if err != nil {
+		h.ops.release(h.osHelper.Now(), false)
+		return err
+	}
+
+	if position != "" {
+		if result, moves := h.movesTowards(position); !moves {
+			h.ops.release(h.osHelper.Now(), false)
+			h.logger.Info("door no longer needs pulsing", lager.Data{"position": position, "result": result})
+			return &notMovedError{result: result}
+		}
+	}
+
+	err = h.writeRelay(true)
+	if err != nil {
+		h.ops.release(h.osHelper.Now(), false)
+		h.logger.Error("error toggling door. Skipping sleep and further executions", err)
+		return err
+	}
+	defer func() {
+		h.ops.release(h.osHelper.Now(), true)
+	}()
+
+	h.osHelper.Sleep(h.config.PulseDuration)
+
+	err = h.writeRelay(false)
 	if err != nil {
 		h.logger.Error("error toggling door", err)
 	}
 
-	h.logger.Info("door toggled")
-	w.Write([]byte("door toggled"))
-	return
+	h.machine.Pulse()
+	return nil
+}
+
+func (h handler) writeRelay(active bool) error {
+	if active != h.config.RelayActiveLow {
+		return h.gpio.WriteHigh(h.config.RelayPin)
+	}
+	return h.gpio.WriteLow(h.config.RelayPin)
+}
+
+func (h handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	ds, err := h.DiscoverDoorState()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	b, _ := json.Marshal(ds)
+	w.Write(b)
+}
+
+func (h handler) DiscoverDoorState() (*DoorState, error) {
+	ds, err := h.discoverDoorState()
+	ds.Name = h.config.Name
+	ds.Interlocks = h.readInterlocks()
+	return &ds, err
+}
+
+func (h handler) discoverDoorState() (DoorState, error) {
+	if h.config.Sensor == nil {
+		h.logger.Debug("no door sensor configured")
+		return h.machine.Current(), nil
+	}
+
+	h.logger.Debug("reading door state")
+	reading, err := h.gpio.Read(h.config.Sensor.Pin)
+	if err != nil {
+		return h.machine.Current(), err
+	}
+
+	position, err := h.config.Sensor.stateForReading(reading)
+	if err != nil {
+		return h.machine.Current(), err
+	}
+
+	if h.readings.positionChanged(position) {
+		h.logger.Info("door sensor changed", lager.Data{"position": position})
+		h.recorder.Record(events.Event{
+			Type:  events.TypeSensor,
+			Door:  h.config.Name,
+			State: string(position),
+		})
+	}
+
+	h.machine.Observe(position)
+
+	ds := h.machine.Current()
+	h.logger.Debug("door state discovered", lager.Data{"state": ds.State})
+	return ds, nil
 }
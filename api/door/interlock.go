@@ -0,0 +1,211 @@
+package door
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+// InterlockPolicy is what happens to door operations while an interlock is active.
+type InterlockPolicy string
+
+const (
+	// InterlockPolicyBlockClose prevents any pulse which could close the door,
+	// including pulses for a door whose state is unknown.
+	InterlockPolicyBlockClose InterlockPolicy = "block-close"
+
+	// InterlockPolicyBlockAll prevents the door being operated at all.
+	InterlockPolicyBlockAll InterlockPolicy = "block-all"
+
+	// InterlockPolicyWarnOnly operates the door, but logs that the interlock was active.
+	InterlockPolicyWarnOnly InterlockPolicy = "warn-only"
+)
+
+func ParseInterlockPolicy(policy string) (InterlockPolicy, error) {
+	switch InterlockPolicy(policy) {
+	case InterlockPolicyBlockClose, InterlockPolicyBlockAll, InterlockPolicyWarnOnly:
+		return InterlockPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unknown interlock policy: %s", policy)
+	}
+}
+
+// Interlock is an input, e.g. a photo-eye or a presence sensor in the doorway,
+// which prevents the door being operated while it is active.
+type Interlock struct {
+	Name      string
+	Pin       uint
+	ActiveLow bool
+	Policy    InterlockPolicy
+}
+
+// ParseInterlock parses an interlock specification of the form
+//
+//	name:pin:policy[:activeLow]
+//
+// e.g. photoeye:5:block-close:true
+func ParseInterlock(spec string) (Interlock, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Interlock{}, fmt.Errorf("invalid interlock specification: %s", spec)
+	}
+
+	i := Interlock{
+		Name: parts[0],
+	}
+
+	if !validName.MatchString(i.Name) {
+		return Interlock{}, fmt.Errorf("invalid interlock name: '%s'", i.Name)
+	}
+
+	var err error
+	i.Pin, err = parsePin(parts[1])
+	if err != nil {
+		return Interlock{}, err
+	}
+
+	i.Policy, err = ParseInterlockPolicy(parts[2])
+	if err != nil {
+		return Interlock{}, err
+	}
+
+	if len(parts) == 4 {
+		i.ActiveLow, err = strconv.ParseBool(parts[3])
+		if err != nil {
+			return Interlock{}, fmt.Errorf("invalid interlock activeLow: %s", parts[3])
+		}
+	}
+
+	return i, nil
+}
+
+// blocks returns true if the policy prevents a pulse which would put the door in next.
+func (p InterlockPolicy) blocks(next State) bool {
+	switch p {
+	case InterlockPolicyBlockAll:
+		return true
+	case InterlockPolicyBlockClose:
+		return next == StateClosing || next == StateUnknown
+	default:
+		return false
+	}
+}
+
+type InterlockStatus struct {
+	Name     string          `json:"name"`
+	Policy   InterlockPolicy `json:"policy"`
+	Active   bool            `json:"active"`
+	ErrorMsg string          `json:"errorMsg,omitempty"`
+}
+
+// InterlockError is returned when an active interlock prevents the door being operated.
+type InterlockError struct {
+	Interlocks []InterlockStatus
+}
+
+func (e *InterlockError) Error() string {
+	names := []string{}
+	for _, i := range e.Interlocks {
+		names = append(names, i.Name)
+	}
+	return fmt.Sprintf("door blocked by active interlock: %s", strings.Join(names, ", "))
+}
+
+type InterlockErrorResponse struct {
+	ErrorMsg   string            `json:"errorMsg"`
+	Interlocks []InterlockStatus `json:"interlocks"`
+}
+
+func renderInterlockError(w http.ResponseWriter, e *InterlockError) {
+	w.WriteHeader(http.StatusConflict)
+
+	b, _ := json.Marshal(InterlockErrorResponse{
+		ErrorMsg:   e.Error(),
+		Interlocks: e.Interlocks,
+	})
+	w.Write(b)
+}
+
+// readInterlocks returns the status of every interlock of the door.
+// An interlock which cannot be read is reported as active.
+func (h handler) readInterlocks() []InterlockStatus {
+	var statuses []InterlockStatus
+
+	for _, i := range h.config.Interlocks {
+		s := InterlockStatus{
+			Name:   i.Name,
+			Policy: i.Policy,
+		}
+
+		reading, err := h.gpio.Read(i.Pin)
+		if err == nil {
+			var level bool
+			level, err = strconv.ParseBool(strings.TrimSpace(reading))
+			s.Active = level != i.ActiveLow
+		}
+
+		if err != nil {
+			h.logger.Error("error reading interlock - treating as active", err, lager.Data{"interlock": i.Name})
+			s.Active = true
+			s.ErrorMsg = err.Error()
+		}
+
+		if h.readings.interlockChanged(i.Name, s.Active) {
+			state := "inactive"
+			if s.Active {
+				state = "active"
+			}
+
+			h.logger.Info("interlock changed", lager.Data{"interlock": i.Name, "state": state})
+			h.recorder.Record(events.Event{
+				Type:      events.TypeInterlock,
+				Door:      h.config.Name,
+				Interlock: i.Name,
+				State:     state,
+			})
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
+
+// checkInterlocks returns an *InterlockError if any active interlock
+// prevents a pulse which would put the door in next.
+func (h handler) checkInterlocks(next State) error {
+	var blocking []InterlockStatus
+
+	for _, s := range h.readInterlocks() {
+		if !s.Active {
+			continue
+		}
+
+		if !s.Policy.blocks(next) {
+			h.logger.Info("interlock active - operating door anyway", lager.Data{
+				"interlock": s.Name,
+				"policy":    s.Policy,
+				"next":      next,
+			})
+			continue
+		}
+
+		blocking = append(blocking, s)
+	}
+
+	if len(blocking) > 0 {
+		err := &InterlockError{Interlocks: blocking}
+		h.logger.Info("door operation blocked by interlock", lager.Data{
+			"interlocks": blocking,
+			"next":       next,
+		})
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package door_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+	audit_fakes "github.com/robdimsdale/garagepi/api/audit/fakes"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Interlocks", func() {
+	const interlockPin = uint(5)
+
+	var (
+		testLogger *lagertest.TestLogger
+		sensor     *door.Sensor
+		interlock  door.Interlock
+
+		doorReading      string
+		interlockReading string
+		interlockErr     error
+	)
+
+	BeforeEach(func() {
+		testLogger = lagertest.NewTestLogger("interlock test")
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeGpio = new(gpio_fakes.FakeGpio)
+		fakeRecorder = new(events_fakes.FakeRecorder)
+		fakeTrail = new(audit_fakes.FakeTrail)
+		dummyRequest = new(http.Request)
+
+		fakeOSHelper.NowReturns(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+
+		sensor = &door.Sensor{
+			Pin:     gpioDoorSensorPin,
+			Contact: door.SensorContactClosed,
+		}
+
+		interlock = door.Interlock{
+			Name:   "photoeye",
+			Pin:    interlockPin,
+			Policy: door.InterlockPolicyBlockClose,
+		}
+
+		// door is open and interlock is active
+		doorReading = "0"
+		interlockReading = "1"
+		interlockErr = nil
+
+		fakeGpio.ReadStub = func(pin uint) (string, error) {
+			if pin == interlockPin {
+				return interlockReading, interlockErr
+			}
+			return doorReading, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		dh = door.NewHandler(
+			testLogger,
+			fakeOSHelper,
+			fakeGpio,
+			door.Config{
+				Name:          doorName,
+				RelayPin:      gpioDoorPin,
+				PulseDuration: pulseDuration,
+				TravelTime:    travelTime,
+				Sensor:        sensor,
+				Interlocks:    []door.Interlock{interlock},
+			},
+			fakeRecorder,
+			fakeTrail,
+		)
+	})
+
+	move := func(position door.State) (*httptest.ResponseRecorder, door.MoveResponse) {
+		w := httptest.NewRecorder()
+		if position == door.StateOpen {
+			dh.HandleOpen(w, dummyRequest)
+		} else {
+			dh.HandleClose(w, dummyRequest)
+		}
+
+		var mr door.MoveResponse
+		err := json.Unmarshal(w.Body.Bytes(), &mr)
+		Expect(err).NotTo(HaveOccurred())
+		return w, mr
+	}
+
+	Describe("Parsing", func() {
+		It("Should parse an interlock specification", func() {
+			i, err := door.ParseInterlock("car:6:block-all:true")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(i).To(Equal(door.Interlock{
+				Name:      "car",
+				Pin:       6,
+				ActiveLow: true,
+				Policy:    door.InterlockPolicyBlockAll,
+			}))
+		})
+
+		It("Should default to active-high", func() {
+			i, err := door.ParseInterlock("photoeye:5:warn-only")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(i.ActiveLow).To(BeFalse())
+		})
+
+		It("Should return an error for an invalid specification", func() {
+			for _, spec := range []string{
+				"photoeye",
+				"photoeye:5",
+				"photo eye:5:block-close",
+				"photoeye:-1:block-close",
+				"photoeye:5:block-open",
+				"photoeye:5:block-close:maybe",
+			} {
+				_, err := door.ParseInterlock(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+
+	Describe("Reading state", func() {
+		It("Should report the status of each interlock", func() {
+			ds, err := dh.DiscoverDoorState()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ds.InterlockActive()).To(BeTrue())
+			Expect(ds.Interlocks).To(Equal([]door.InterlockStatus{
+				{Name: "photoeye", Policy: door.InterlockPolicyBlockClose, Active: true},
+			}))
+		})
+
+		It("Should record changes in the status of each interlock", func() {
+			interlockEvents := func() []events.Event {
+				recorded := []events.Event{}
+				for i := 0; i < fakeRecorder.RecordCallCount(); i++ {
+					if e := fakeRecorder.RecordArgsForCall(i); e.Type == events.TypeInterlock {
+						recorded = append(recorded, e)
+					}
+				}
+				return recorded
+			}
+
+			_, err := dh.DiscoverDoorState()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(interlockEvents()).To(BeEmpty())
+
+			interlockReading = "0"
+			_, err = dh.DiscoverDoorState()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(interlockEvents()).To(Equal([]events.Event{
+				{
+					Type:      events.TypeInterlock,
+					Door:      doorName,
+					Interlock: "photoeye",
+					State:     "inactive",
+				},
+			}))
+		})
+
+		Context("When the interlock is active-low", func() {
+			BeforeEach(func() {
+				interlock.ActiveLow = true
+			})
+
+			It("Should report the interlock as inactive when it reads high", func() {
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.InterlockActive()).To(BeFalse())
+			})
+		})
+
+		Context("When reading the interlock returns with error", func() {
+			BeforeEach(func() {
+				interlockErr = errors.New("gpio read error")
+			})
+
+			It("Should report the interlock as active", func() {
+				ds, err := dh.DiscoverDoorState()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ds.Interlocks[0].Active).To(BeTrue())
+				Expect(ds.Interlocks[0].ErrorMsg).To(Equal("gpio read error"))
+			})
+		})
+	})
+
+	Context("When the policy is block-close", func() {
+		It("Should not pulse the relay to close the door and respond with HTTP status code 409", func() {
+			w, mr := move(door.StateClosed)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+			Expect(mr.Result).To(Equal(door.MoveResultInterlocked))
+			Expect(mr.ErrorMsg).To(ContainSubstring("photoeye"))
+			Expect(mr.Interlocks).To(HaveLen(1))
+		})
+
+		It("Should log that the door was blocked", func() {
+			move(door.StateClosed)
+			Expect(testLogger).To(gbytes.Say("door operation blocked by interlock"))
+		})
+
+		It("Should release the door for the next operation", func() {
+			move(door.StateClosed)
+
+			interlockReading = "0"
+			_, mr := move(door.StateClosed)
+			Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+		})
+
+		It("Should not block the door opening", func() {
+			doorReading = "1"
+
+			w, mr := move(door.StateOpen)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+		})
+
+		It("Should not pulse the relay when toggling would close the door", func() {
+			w := httptest.NewRecorder()
+			dh.HandleToggle(w, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+
+			var r door.InterlockErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.ErrorMsg).To(Equal("door blocked by active interlock: photoeye"))
+			Expect(r.Interlocks).To(Equal([]door.InterlockStatus{
+				{Name: "photoeye", Policy: door.InterlockPolicyBlockClose, Active: true},
+			}))
+		})
+
+		Context("When the door has no sensor", func() {
+			BeforeEach(func() {
+				sensor = nil
+			})
+
+			It("Should not pulse the relay, as the door might close", func() {
+				w := httptest.NewRecorder()
+				dh.HandleToggle(w, dummyRequest)
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+				Expect(w.Code).To(Equal(http.StatusConflict))
+			})
+		})
+
+		Context("When the interlock is not active", func() {
+			BeforeEach(func() {
+				interlockReading = "0"
+			})
+
+			It("Should pulse the relay", func() {
+				w, mr := move(door.StateClosed)
+				Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+				Expect(w.Code).To(Equal(http.StatusAccepted))
+				Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+			})
+
+			Context("When another request tries to move the door while the interlocks are checked", func() {
+				var concurrent door.MoveResponse
+
+				BeforeEach(func() {
+					// The second read of the interlock is by the check before
+					// pulsing, once the operation lock is held.
+					interlockReads := 0
+					fakeGpio.ReadStub = func(pin uint) (string, error) {
+						if pin == interlockPin {
+							interlockReads++
+							if interlockReads == 2 {
+								_, concurrent = move(door.StateClosed)
+							}
+							return interlockReading, nil
+						}
+						return doorReading, nil
+					}
+				})
+
+				It("Should reject the other request and pulse the relay once", func() {
+					w, mr := move(door.StateClosed)
+					Expect(concurrent.Result).To(Equal(door.MoveResultBusy))
+					Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+					Expect(w.Code).To(Equal(http.StatusAccepted))
+					Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+				})
+			})
+		})
+	})
+
+	Context("When the policy is block-all", func() {
+		BeforeEach(func() {
+			interlock.Policy = door.InterlockPolicyBlockAll
+			doorReading = "1"
+		})
+
+		It("Should not pulse the relay to open the door", func() {
+			w, mr := move(door.StateOpen)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(w.Code).To(Equal(http.StatusConflict))
+			Expect(mr.Result).To(Equal(door.MoveResultInterlocked))
+		})
+	})
+
+	Context("When the policy is warn-only", func() {
+		BeforeEach(func() {
+			interlock.Policy = door.InterlockPolicyWarnOnly
+		})
+
+		It("Should pulse the relay and log that the interlock was active", func() {
+			w, mr := move(door.StateClosed)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(w.Code).To(Equal(http.StatusAccepted))
+			Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+			Expect(testLogger).To(gbytes.Say("interlock active - operating door anyway"))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package door
+
+import (
+	"os"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/tedsuo/ifrit"
+)
+
+type monitor struct {
+	logger   lager.Logger
+	handler  Handler
+	interval time.Duration
+}
+
+// NewMonitor returns a runner which periodically reads the door sensor and
+// interlocks, so that the state of the door is tracked between API requests.
+func NewMonitor(
+	logger lager.Logger,
+	handler Handler,
+	interval time.Duration,
+) ifrit.Runner {
+	return &monitor{
+		logger:   logger,
+		handler:  handler,
+		interval: interval,
+	}
+}
+
+func (m monitor) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			_, err := m.handler.DiscoverDoorState()
+			if err != nil {
+				m.logger.Error("error reading door state", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package door_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Monitor", func() {
+	var (
+		fakeHandler *door_fakes.FakeHandler
+		process     ifrit.Process
+	)
+
+	BeforeEach(func() {
+		fakeHandler = new(door_fakes.FakeHandler)
+		fakeHandler.DiscoverDoorStateReturns(nil, errors.New("gpio read error"))
+
+		process = ifrit.Invoke(door.NewMonitor(
+			lagertest.NewTestLogger("monitor test"),
+			fakeHandler,
+			time.Millisecond,
+		))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("Should repeatedly read the door state", func() {
+		Eventually(fakeHandler.DiscoverDoorStateCallCount).Should(BeNumerically(">", 1))
+	})
+})
@@ -0,0 +1,231 @@
+package door
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/audit"
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+type MoveResult string
+
+const (
+	// MoveResultPulsed means the relay was pulsed and the door is on its way.
+	MoveResultPulsed MoveResult = "pulsed"
+
+	// MoveResultInProgress means the door was already moving in the requested direction.
+	MoveResultInProgress MoveResult = "in-progress"
+
+	// MoveResultNoOp means the door was already in the requested position.
+	MoveResultNoOp MoveResult = "no-op"
+
+	// MoveResultRejected means a single pulse would not move the door
+	// towards the requested position, e.g. the door is moving the other way.
+	MoveResultRejected MoveResult = "rejected"
+
+	// MoveResultUnknownState means the position of the door is not known,
+	// so it cannot be moved to a position. This is always the case for a
+	// door without a sensor.
+	MoveResultUnknownState MoveResult = "unknown-state"
+
+	// MoveResultBusy means another operation on the door was in progress.
+	MoveResultBusy MoveResult = "busy"
+
+	// MoveResultCooldown means the door was operated too recently.
+	MoveResultCooldown MoveResult = "cooldown"
+
+	// MoveResultInterlocked means an active interlock prevented the door being operated.
+	MoveResultInterlocked MoveResult = "interlocked"
+
+	// MoveResultError means the state of the door could not be read,
+	// or the relay could not be pulsed.
+	MoveResultError MoveResult = "error"
+)
+
+var errUnknownState = errors.New("the door state is unknown - a door sensor is required to move the door to a position")
+
+type MoveResponse struct {
+	Result   MoveResult `json:"result"`
+	Door     *DoorState `json:"door"`
+	ErrorMsg string     `json:"errorMsg,omitempty"`
+
+	// NextAvailable is set if the result is busy or cooldown.
+	NextAvailable *time.Time `json:"nextAvailable,omitempty"`
+
+	// Interlocks is set if the result is interlocked.
+	Interlocks []InterlockStatus `json:"interlocks,omitempty"`
+}
+
+// HandleOpen and HandleClose move the door to a position, responding with the
+// result of the request: 202 if the relay was pulsed or the door is already
+// moving there, 200 if the door is already there, 409 if the door cannot be
+// moved there with a single pulse, is busy, is interlocked, or its state is
+// unknown because it has no sensor, 429 during the cooldown and 503 on error.
+func (h handler) HandleOpen(w http.ResponseWriter, r *http.Request) {
+	renderMoveResponse(w, h.MoveTo(StateOpen, events.RequestSource(r)))
+}
+
+func (h handler) HandleClose(w http.ResponseWriter, r *http.Request) {
+	renderMoveResponse(w, h.MoveTo(StateClosed, events.RequestSource(r)))
+}
+
+// MoveTo only pulses the relay if doing so will move the door towards
+// the requested position, so that retrying a request cannot undo it.
+// Every request is audited with its result, whether or not the relay was pulsed.
+func (h handler) MoveTo(position State, source events.Source) MoveResponse {
+	mr := h.moveTo(position, source)
+
+	action := audit.ActionDoorClose
+	if position == StateOpen {
+		action = audit.ActionDoorOpen
+	}
+	h.trail.Record(audit.NewEntry(source, action, h.config.Name, string(mr.Result)))
+
+	return mr
+}
+
+func (h handler) moveTo(position State, source events.Source) MoveResponse {
+	ds, err := h.DiscoverDoorState()
+	if err != nil {
+		h.logger.Error("error reading door state - not moving door", err, lager.Data{"position": position})
+		return MoveResponse{
+			Result:   MoveResultError,
+			Door:     ds,
+			ErrorMsg: err.Error(),
+		}
+	}
+
+	switch {
+	case ds.State == StateUnknown:
+		h.logger.Info("door state unknown - not moving door", lager.Data{"position": position})
+		return MoveResponse{
+			Result:   MoveResultUnknownState,
+			Door:     ds,
+			ErrorMsg: errUnknownState.Error(),
+		}
+
+	case ds.State == position:
+		h.logger.Info("door already in requested position", lager.Data{"position": position})
+		return MoveResponse{
+			Result: MoveResultNoOp,
+			Door:   ds,
+		}
+
+	case ds.State == towards(position):
+		h.logger.Info("door already moving to requested position", lager.Data{"position": position})
+		return MoveResponse{
+			Result: MoveResultInProgress,
+			Door:   ds,
+		}
+
+	case h.machine.NextOnPulse() == towards(position):
+		err := h.toggle(source, position)
+		interlocks := ds.Interlocks
+		ds := h.machine.Current()
+		ds.Name = h.config.Name
+		ds.Interlocks = interlocks
+		if notMoved, ok := err.(*notMovedError); ok {
+			mr := MoveResponse{
+				Result: notMoved.result,
+				Door:   &ds,
+			}
+			if notMoved.result == MoveResultUnknownState {
+				mr.ErrorMsg = errUnknownState.Error()
+			}
+			return mr
+		}
+		if rejected, ok := err.(*OperationRejectedError); ok {
+			result := MoveResultCooldown
+			if rejected.InProgress {
+				result = MoveResultBusy
+			}
+			return MoveResponse{
+				Result:        result,
+				Door:          &ds,
+				ErrorMsg:      err.Error(),
+				NextAvailable: &rejected.NextAvailable,
+			}
+		}
+		if interlocked, ok := err.(*InterlockError); ok {
+			return MoveResponse{
+				Result:     MoveResultInterlocked,
+				Door:       &ds,
+				ErrorMsg:   err.Error(),
+				Interlocks: interlocked.Interlocks,
+			}
+		}
+		if err != nil {
+			return MoveResponse{
+				Result:   MoveResultError,
+				Door:     &ds,
+				ErrorMsg: err.Error(),
+			}
+		}
+
+		h.logger.Info("door toggled", lager.Data{"position": position})
+		return MoveResponse{
+			Result: MoveResultPulsed,
+			Door:   &ds,
+		}
+
+	default:
+		h.logger.Info("pulsing would not move door to requested position", lager.Data{
+			"position": position,
+			"state":    ds.State,
+		})
+		return MoveResponse{
+			Result: MoveResultRejected,
+			Door:   ds,
+		}
+	}
+}
+
+// notMovedError is returned by pulse if the door no longer needs pulsing to
+// move it towards the requested position.
+type notMovedError struct {
+	result MoveResult
+}
+
+func (e *notMovedError) Error() string {
+	return fmt.Sprintf("door not moved: %s", e.result)
+}
+
+// movesTowards returns whether pulsing the relay now would move the door
+// towards position, and otherwise the result of a request to move it there.
+func (h handler) movesTowards(position State) (MoveResult, bool) {
+	switch state := h.machine.Current().State; {
+	case state == StateUnknown:
+		return MoveResultUnknownState, false
+	case state == position:
+		return MoveResultNoOp, false
+	case state == towards(position):
+		return MoveResultInProgress, false
+	case h.machine.NextOnPulse() != towards(position):
+		return MoveResultRejected, false
+	default:
+		return MoveResultPulsed, true
+	}
+}
+
+func renderMoveResponse(w http.ResponseWriter, mr MoveResponse) {
+	switch mr.Result {
+	case MoveResultPulsed, MoveResultInProgress:
+		w.WriteHeader(http.StatusAccepted)
+	case MoveResultNoOp:
+		w.WriteHeader(http.StatusOK)
+	case MoveResultRejected, MoveResultBusy, MoveResultInterlocked, MoveResultUnknownState:
+		w.WriteHeader(http.StatusConflict)
+	case MoveResultCooldown:
+		w.WriteHeader(429) // http.StatusTooManyRequests
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	b, _ := json.Marshal(mr)
+	w.Write(b)
+}
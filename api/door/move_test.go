@@ -0,0 +1,249 @@
+package door_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/audit"
+	audit_fakes "github.com/robdimsdale/garagepi/api/audit/fakes"
+	"github.com/robdimsdale/garagepi/api/door"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	test_helpers_fakes "github.com/robdimsdale/garagepi/fakes"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Moving to a position", func() {
+	var sensor *door.Sensor
+
+	moveResponse := func() door.MoveResponse {
+		Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
+
+		var mr door.MoveResponse
+		err := json.Unmarshal(fakeResponseWriter.WriteArgsForCall(0), &mr)
+		Expect(err).NotTo(HaveOccurred())
+		return mr
+	}
+
+	lastAuditEntry := func() audit.Entry {
+		Expect(fakeTrail.RecordCallCount()).To(BeNumerically(">", 0))
+		return fakeTrail.RecordArgsForCall(fakeTrail.RecordCallCount() - 1)
+	}
+
+	statusCode := func() int {
+		Expect(fakeResponseWriter.WriteHeaderCallCount()).To(Equal(1))
+		return fakeResponseWriter.WriteHeaderArgsForCall(0)
+	}
+
+	BeforeEach(func() {
+		fakeLogger = lagertest.NewTestLogger("move test")
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeGpio = new(gpio_fakes.FakeGpio)
+		fakeRecorder = new(events_fakes.FakeRecorder)
+		fakeTrail = new(audit_fakes.FakeTrail)
+		fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
+		dummyRequest = new(http.Request)
+
+		fakeOSHelper.NowReturns(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC))
+
+		sensor = &door.Sensor{
+			Pin:     gpioDoorSensorPin,
+			Contact: door.SensorContactClosed,
+		}
+
+		// door is closed
+		fakeGpio.ReadReturns("1", nil)
+	})
+
+	JustBeforeEach(func() {
+		dh = door.NewHandler(
+			fakeLogger,
+			fakeOSHelper,
+			fakeGpio,
+			door.Config{
+				Name:          doorName,
+				RelayPin:      gpioDoorPin,
+				PulseDuration: pulseDuration,
+				TravelTime:    travelTime,
+				Sensor:        sensor,
+			},
+			fakeRecorder,
+			fakeTrail,
+		)
+	})
+
+	Context("When reading door state returns with error", func() {
+		BeforeEach(func() {
+			fakeGpio.ReadReturns("", errors.New("gpio read error"))
+		})
+
+		It("Should not pulse the relay and respond with HTTP status code 503", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(statusCode()).To(Equal(http.StatusServiceUnavailable))
+			Expect(moveResponse().Result).To(Equal(door.MoveResultError))
+		})
+	})
+
+	Context("When the door has no sensor", func() {
+		BeforeEach(func() {
+			sensor = nil
+		})
+
+		It("Should not pulse the relay and respond with HTTP status code 409 and the unknown-state result", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(statusCode()).To(Equal(http.StatusConflict))
+
+			mr := moveResponse()
+			Expect(mr.Result).To(Equal(door.MoveResultUnknownState))
+			Expect(mr.ErrorMsg).To(ContainSubstring("sensor is required"))
+		})
+
+		It("Should not pulse the relay when closing", func() {
+			dh.HandleClose(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(moveResponse().Result).To(Equal(door.MoveResultUnknownState))
+		})
+	})
+
+	Context("When the door is already in the requested position", func() {
+		It("Should not pulse the relay and respond with HTTP status code 200", func() {
+			dh.HandleClose(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+			Expect(statusCode()).To(Equal(http.StatusOK))
+
+			mr := moveResponse()
+			Expect(mr.Result).To(Equal(door.MoveResultNoOp))
+			Expect(mr.Door.State).To(Equal(door.StateClosed))
+		})
+
+		It("Should audit the request with its result", func() {
+			dh.HandleClose(fakeResponseWriter, dummyRequest)
+
+			Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+			Expect(lastAuditEntry().Action).To(Equal(audit.ActionDoorClose))
+			Expect(lastAuditEntry().Target).To(Equal(doorName))
+			Expect(lastAuditEntry().Result).To(Equal(string(door.MoveResultNoOp)))
+		})
+	})
+
+	Context("When pulsing the relay moves the door to the requested position", func() {
+		It("Should pulse the relay and respond with HTTP status code 202", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(fakeGpio.WriteHighArgsForCall(0)).To(Equal(gpioDoorPin))
+			Expect(fakeGpio.WriteLowCallCount()).To(Equal(1))
+			Expect(statusCode()).To(Equal(http.StatusAccepted))
+
+			mr := moveResponse()
+			Expect(mr.Result).To(Equal(door.MoveResultPulsed))
+			Expect(mr.Door.State).To(Equal(door.StateOpening))
+		})
+
+		It("Should audit the request once with its result", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+
+			Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+			Expect(lastAuditEntry().Action).To(Equal(audit.ActionDoorOpen))
+			Expect(lastAuditEntry().Result).To(Equal(string(door.MoveResultPulsed)))
+		})
+
+		Context("When writing high returns with errors", func() {
+			BeforeEach(func() {
+				fakeGpio.WriteHighReturns(errors.New("gpio error"))
+			})
+
+			It("Should respond with HTTP status code 503", func() {
+				dh.HandleOpen(fakeResponseWriter, dummyRequest)
+				Expect(statusCode()).To(Equal(http.StatusServiceUnavailable))
+				Expect(moveResponse().Result).To(Equal(door.MoveResultError))
+				Expect(lastAuditEntry().Result).To(Equal(string(door.MoveResultError)))
+			})
+		})
+	})
+
+	Context("When the door was operated within the cooldown", func() {
+		var now time.Time
+
+		JustBeforeEach(func() {
+			now = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			dh = door.NewHandler(
+				fakeLogger,
+				fakeOSHelper,
+				fakeGpio,
+				door.Config{
+					Name:          doorName,
+					RelayPin:      gpioDoorPin,
+					PulseDuration: pulseDuration,
+					TravelTime:    travelTime,
+					Cooldown:      2 * travelTime,
+					Sensor:        sensor,
+				},
+				fakeRecorder,
+				fakeTrail,
+			)
+
+			// door is open
+			fakeGpio.ReadReturns("0", nil)
+
+			dh.HandleClose(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+
+			// door has finished closing
+			now = now.Add(travelTime / 2)
+			fakeOSHelper.NowReturns(now)
+			fakeGpio.ReadReturns("1", nil)
+
+			fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
+		})
+
+		It("Should not pulse the relay and respond with HTTP status code 429", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(statusCode()).To(Equal(429))
+
+			mr := moveResponse()
+			Expect(mr.Result).To(Equal(door.MoveResultCooldown))
+			Expect(mr.NextAvailable).NotTo(BeNil())
+			Expect(*mr.NextAvailable).To(BeTemporally(">", now))
+		})
+	})
+
+	Context("When the door is moving", func() {
+		JustBeforeEach(func() {
+			_, err := dh.DiscoverDoorState()
+			Expect(err).NotTo(HaveOccurred())
+
+			dh.HandleToggle(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+
+			fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
+		})
+
+		It("Should not pulse the relay again when retried and respond with HTTP status code 202", func() {
+			dh.HandleOpen(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(statusCode()).To(Equal(http.StatusAccepted))
+			Expect(moveResponse().Result).To(Equal(door.MoveResultInProgress))
+
+			Expect(fakeTrail.RecordCallCount()).To(Equal(2))
+			Expect(fakeTrail.RecordArgsForCall(0).Action).To(Equal(audit.ActionDoorToggle))
+			Expect(lastAuditEntry().Action).To(Equal(audit.ActionDoorOpen))
+			Expect(lastAuditEntry().Result).To(Equal(string(door.MoveResultInProgress)))
+		})
+
+		It("Should not pulse the relay when moving the other way and respond with HTTP status code 409", func() {
+			dh.HandleClose(fakeResponseWriter, dummyRequest)
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(1))
+			Expect(statusCode()).To(Equal(http.StatusConflict))
+			Expect(moveResponse().Result).To(Equal(door.MoveResultRejected))
+		})
+	})
+})
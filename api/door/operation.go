@@ -0,0 +1,96 @@
+package door
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OperationRejectedError is returned when the door is operated while a
+// previous operation is in progress, or before its cooldown has elapsed.
+type OperationRejectedError struct {
+	InProgress    bool
+	NextAvailable time.Time
+}
+
+func (e *OperationRejectedError) Error() string {
+	if e.InProgress {
+		return fmt.Sprintf("door operation in progress - next available at %s", e.NextAvailable.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("door cooling down - next available at %s", e.NextAvailable.Format(time.RFC3339))
+}
+
+// StatusCode is 409 if an operation is in progress and 429 otherwise.
+func (e *OperationRejectedError) StatusCode() int {
+	if e.InProgress {
+		return http.StatusConflict
+	}
+	return 429 // http.StatusTooManyRequests
+}
+
+type OperationRejectedResponse struct {
+	ErrorMsg      string    `json:"errorMsg"`
+	NextAvailable time.Time `json:"nextAvailable"`
+}
+
+func renderOperationRejected(w http.ResponseWriter, now time.Time, e *OperationRejectedError) {
+	retryAfter := int(e.NextAvailable.Sub(now)/time.Second) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(e.StatusCode())
+
+	b, _ := json.Marshal(OperationRejectedResponse{
+		ErrorMsg:      e.Error(),
+		NextAvailable: e.NextAvailable,
+	})
+	w.Write(b)
+}
+
+// operationLock allows one operation on a door at a time, and no operation
+// within cooldown of the previous one finishing.
+type operationLock struct {
+	cooldown time.Duration
+
+	mutex         sync.Mutex
+	inProgress    bool
+	nextAvailable time.Time
+}
+
+// acquire returns an *OperationRejectedError if the door cannot be operated at now.
+// expected is how long the operation is expected to take.
+func (l *operationLock) acquire(now time.Time, expected time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.inProgress {
+		return &OperationRejectedError{
+			InProgress:    true,
+			NextAvailable: l.nextAvailable,
+		}
+	}
+
+	if now.Before(l.nextAvailable) {
+		return &OperationRejectedError{
+			NextAvailable: l.nextAvailable,
+		}
+	}
+
+	l.inProgress = true
+	l.nextAvailable = now.Add(expected + l.cooldown)
+	return nil
+}
+
+// release starts the cooldown from now if the door was operated.
+func (l *operationLock) release(now time.Time, operated bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inProgress = false
+	if operated {
+		l.nextAvailable = now.Add(l.cooldown)
+	} else {
+		l.nextAvailable = now
+	}
+}
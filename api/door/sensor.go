@@ -0,0 +1,95 @@
+package door
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SensorContact is the door position at which the sensor contact is made,
+// e.g. a reed switch mounted so that the magnet meets it when the door is closed.
+type SensorContact string
+
+const (
+	SensorContactClosed SensorContact = "closed"
+	SensorContactOpen   SensorContact = "open"
+)
+
+type Sensor struct {
+	Pin       uint
+	ActiveLow bool
+	Contact   SensorContact
+}
+
+func ParseSensorContact(contact string) (SensorContact, error) {
+	switch SensorContact(contact) {
+	case SensorContactClosed, SensorContactOpen:
+		return SensorContact(contact), nil
+	default:
+		return "", fmt.Errorf("unknown sensor contact: %s", contact)
+	}
+}
+
+// observedState is the position of the door which the sensor reports directly.
+func (s Sensor) observedState() State {
+	if s.Contact == SensorContactOpen {
+		return StateOpen
+	}
+	return StateClosed
+}
+
+// stateForReading converts the raw value read from the sensor pin
+// into the position of the door.
+func (s Sensor) stateForReading(reading string) (State, error) {
+	level, err := strconv.ParseBool(strings.TrimSpace(reading))
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	active := level != s.ActiveLow
+
+	switch {
+	case active && s.Contact == SensorContactClosed:
+		return StateClosed, nil
+	case active && s.Contact == SensorContactOpen:
+		return StateOpen, nil
+	case s.Contact == SensorContactClosed:
+		return StateOpen, nil
+	default:
+		return StateClosed, nil
+	}
+}
+
+// sensorReadings tracks the last readings of the sensor and interlocks of a
+// door so that changes can be recorded. The first reading is not a change.
+type sensorReadings struct {
+	mutex      sync.Mutex
+	position   State
+	interlocks map[string]bool
+}
+
+func newSensorReadings() *sensorReadings {
+	return &sensorReadings{
+		position:   StateUnknown,
+		interlocks: map[string]bool{},
+	}
+}
+
+func (r *sensorReadings) positionChanged(position State) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changed := r.position != StateUnknown && r.position != position
+	r.position = position
+	return changed
+}
+
+func (r *sensorReadings) interlockChanged(name string, active bool) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	last, read := r.interlocks[name]
+	r.interlocks[name] = active
+	return read && last != active
+}
@@ -0,0 +1,56 @@
+package door
+
+import "time"
+
+type State string
+
+const (
+	StateUnknown State = "unknown"
+	StateOpen    State = "open"
+	StateClosed  State = "closed"
+	StateOpening State = "opening"
+	StateClosing State = "closing"
+	StateStopped State = "stopped"
+	StateStuck   State = "stuck"
+)
+
+type TransitionCause string
+
+const (
+	CausePulse   TransitionCause = "pulse"
+	CauseSensor  TransitionCause = "sensor"
+	CauseTimeout TransitionCause = "timeout"
+)
+
+type Transition struct {
+	From  State           `json:"from"`
+	To    State           `json:"to"`
+	Cause TransitionCause `json:"cause"`
+	At    time.Time       `json:"at"`
+}
+
+type DoorState struct {
+	Name           string      `json:"name"`
+	State          State       `json:"state"`
+	Since          time.Time   `json:"since"`
+	LastTransition *Transition `json:"lastTransition,omitempty"`
+
+	Interlocks []InterlockStatus `json:"interlocks,omitempty"`
+}
+
+func (d DoorState) StateKnown() bool {
+	return d.State != StateUnknown
+}
+
+func (d DoorState) Moving() bool {
+	return d.State == StateOpening || d.State == StateClosing
+}
+
+func (d DoorState) InterlockActive() bool {
+	for _, i := range d.Interlocks {
+		if i.Active {
+			return true
+		}
+	}
+	return false
+}
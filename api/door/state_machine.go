@@ -0,0 +1,258 @@
+package door
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/os"
+)
+
+// StateMachine tracks the door between its end positions.
+//
+// It is driven by relay pulses and by the positions reported by the sensor.
+// A single sensor only observes one end position directly (see SensorContact);
+// the other end position is inferred from the door having left the observed one.
+// A door which is moving becomes stuck if it has not left its starting position
+// within the travel time, and stopped if it has left but was not confirmed at its
+// target. Pulsing a moving door stops it; pulsing a stopped door reverses it.
+type StateMachine struct {
+	mutex sync.Mutex
+
+	logger     lager.Logger
+	clock      os.OSHelper
+	travelTime time.Duration
+	observed   State
+
+	state          State
+	since          time.Time
+	direction      State
+	deadline       time.Time
+	reading        State
+	lastTransition *Transition
+
+	onTransition func(Transition)
+}
+
+// NewStateMachine returns a state machine for a door whose sensor directly
+// observes the provided position (StateOpen or StateClosed).
+// observed should be StateUnknown if the door has no sensor.
+// onTransition, if not nil, is called with each transition; it must not
+// call the state machine.
+func NewStateMachine(
+	logger lager.Logger,
+	clock os.OSHelper,
+	travelTime time.Duration,
+	observed State,
+	onTransition func(Transition),
+) *StateMachine {
+	return &StateMachine{
+		logger:     logger,
+		clock:      clock,
+		travelTime: travelTime,
+		observed:   observed,
+		state:      StateUnknown,
+		since:      clock.Now(),
+		reading:    StateUnknown,
+
+		onTransition: onTransition,
+	}
+}
+
+func (m *StateMachine) Current() DoorState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.expire(m.clock.Now())
+
+	ds := DoorState{
+		State: m.state,
+		Since: m.since,
+	}
+
+	if m.lastTransition != nil {
+		t := *m.lastTransition
+		ds.LastTransition = &t
+	}
+
+	return ds
+}
+
+// Pulse records that the relay of the door has been pulsed.
+func (m *StateMachine) Pulse() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clock.Now()
+	m.expire(now)
+
+	next := m.next()
+	switch next {
+	case StateOpening, StateClosing:
+		m.startMoving(next, CausePulse, now)
+	case StateStopped:
+		m.direction = m.state
+		m.transition(StateStopped, CausePulse, now)
+	default:
+		m.logger.Debug("door pulsed in unknown state - cannot tell which way it will move")
+	}
+}
+
+// NextOnPulse returns the state the door would be in if the relay were pulsed now.
+func (m *StateMachine) NextOnPulse() State {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.expire(m.clock.Now())
+	return m.next()
+}
+
+// next must be called with the mutex held.
+func (m *StateMachine) next() State {
+	switch m.state {
+	case StateClosed:
+		return StateOpening
+	case StateOpen:
+		return StateClosing
+	case StateOpening, StateClosing:
+		return StateStopped
+	case StateStopped:
+		return reverse(m.direction)
+	case StateStuck:
+		return m.direction
+	default:
+		return StateUnknown
+	}
+}
+
+// Observe records the position of the door as reported by the sensor.
+// Only StateOpen and StateClosed are meaningful; anything else is ignored.
+func (m *StateMachine) Observe(position State) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.clock.Now()
+	m.expire(now)
+
+	if position != StateOpen && position != StateClosed {
+		return
+	}
+
+	previous := m.reading
+	m.reading = position
+
+	switch m.state {
+	case StateUnknown:
+		m.transition(position, CauseSensor, now)
+
+	case StateOpening, StateClosing:
+		if position == target(m.state) && m.isObserved(position) {
+			m.transition(position, CauseSensor, now)
+		} else if position == start(m.state) && m.isObserved(position) && previous != position {
+			// The door left and came back, e.g. the opener reversed it.
+			m.transition(position, CauseSensor, now)
+		}
+
+	default:
+		if position == previous {
+			return
+		}
+
+		if m.isObserved(position) {
+			m.transition(position, CauseSensor, now)
+		} else {
+			// The door has left its observed position without us pulsing the relay,
+			// e.g. someone used the wall button or a remote.
+			m.startMoving(towards(position), CauseSensor, now)
+		}
+	}
+}
+
+func (m *StateMachine) startMoving(direction State, cause TransitionCause, now time.Time) {
+	m.direction = direction
+	m.deadline = now.Add(m.travelTime)
+	m.transition(direction, cause, now)
+}
+
+// expire must be called with the mutex held.
+func (m *StateMachine) expire(now time.Time) {
+	if m.state != StateOpening && m.state != StateClosing {
+		return
+	}
+
+	if now.Before(m.deadline) {
+		return
+	}
+
+	var to State
+	switch {
+	case m.observed == StateUnknown:
+		to = StateUnknown
+	case m.reading == start(m.state) && m.isObserved(m.reading):
+		to = StateStuck
+	case m.reading == target(m.state) && !m.isObserved(m.reading):
+		to = target(m.state)
+	default:
+		to = StateStopped
+	}
+
+	m.transition(to, CauseTimeout, m.deadline)
+}
+
+// transition must be called with the mutex held.
+func (m *StateMachine) transition(to State, cause TransitionCause, at time.Time) {
+	if to == m.state {
+		return
+	}
+
+	m.logger.Info("door state changed", lager.Data{
+		"from":  m.state,
+		"to":    to,
+		"cause": cause,
+	})
+
+	m.lastTransition = &Transition{
+		From:  m.state,
+		To:    to,
+		Cause: cause,
+		At:    at,
+	}
+	m.state = to
+	m.since = at
+
+	if m.onTransition != nil {
+		m.onTransition(*m.lastTransition)
+	}
+}
+
+func (m *StateMachine) isObserved(position State) bool {
+	return m.observed != StateUnknown && position == m.observed
+}
+
+func target(direction State) State {
+	if direction == StateOpening {
+		return StateOpen
+	}
+	return StateClosed
+}
+
+func start(direction State) State {
+	if direction == StateOpening {
+		return StateClosed
+	}
+	return StateOpen
+}
+
+func towards(position State) State {
+	if position == StateOpen {
+		return StateOpening
+	}
+	return StateClosing
+}
+
+func reverse(direction State) State {
+	if direction == StateOpening {
+		return StateClosing
+	}
+	return StateOpening
+}
@@ -0,0 +1,194 @@
+package door_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("StateMachine", func() {
+	var (
+		clock    *os_fakes.FakeOSHelper
+		now      time.Time
+		observed door.State
+		machine  *door.StateMachine
+
+		transitions []door.Transition
+	)
+
+	BeforeEach(func() {
+		now = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+		clock = new(os_fakes.FakeOSHelper)
+		clock.NowStub = func() time.Time {
+			return now
+		}
+
+		observed = door.StateClosed
+		transitions = nil
+	})
+
+	JustBeforeEach(func() {
+		machine = door.NewStateMachine(
+			lagertest.NewTestLogger("state machine test"),
+			clock,
+			travelTime,
+			observed,
+			func(t door.Transition) {
+				transitions = append(transitions, t)
+			},
+		)
+	})
+
+	It("Should start in unknown state", func() {
+		Expect(machine.Current().State).To(Equal(door.StateUnknown))
+		Expect(machine.Current().Since).To(Equal(now))
+		Expect(machine.Current().LastTransition).To(BeNil())
+	})
+
+	It("Should notify each transition", func() {
+		machine.Observe(door.StateClosed)
+		machine.Pulse()
+
+		Expect(transitions).To(Equal([]door.Transition{
+			{From: door.StateUnknown, To: door.StateClosed, Cause: door.CauseSensor, At: now},
+			{From: door.StateClosed, To: door.StateOpening, Cause: door.CausePulse, At: now},
+		}))
+	})
+
+	It("Should ignore pulses in unknown state", func() {
+		machine.Pulse()
+		Expect(machine.Current().State).To(Equal(door.StateUnknown))
+	})
+
+	It("Should take the first position reported by the sensor", func() {
+		machine.Observe(door.StateOpen)
+		Expect(machine.Current().State).To(Equal(door.StateOpen))
+	})
+
+	Context("When the sensor observes the closed position", func() {
+		JustBeforeEach(func() {
+			machine.Observe(door.StateClosed)
+		})
+
+		Describe("Opening", func() {
+			JustBeforeEach(func() {
+				now = now.Add(time.Second)
+				machine.Pulse()
+			})
+
+			It("Should be opening after a pulse", func() {
+				ds := machine.Current()
+				Expect(ds.State).To(Equal(door.StateOpening))
+				Expect(ds.Since).To(Equal(now))
+				Expect(*ds.LastTransition).To(Equal(door.Transition{
+					From:  door.StateClosed,
+					To:    door.StateOpening,
+					Cause: door.CausePulse,
+					At:    now,
+				}))
+			})
+
+			It("Should be open once the door has left the closed position for the travel time", func() {
+				machine.Observe(door.StateOpen)
+				Expect(machine.Current().State).To(Equal(door.StateOpening))
+
+				pulsedAt := now
+				now = now.Add(travelTime)
+				ds := machine.Current()
+				Expect(ds.State).To(Equal(door.StateOpen))
+				Expect(ds.Since).To(Equal(pulsedAt.Add(travelTime)))
+				Expect(ds.LastTransition.Cause).To(Equal(door.CauseTimeout))
+			})
+
+			It("Should be stuck if the door never leaves the closed position", func() {
+				now = now.Add(travelTime)
+				Expect(machine.Current().State).To(Equal(door.StateStuck))
+			})
+
+			It("Should be closed if the door comes back to the closed position", func() {
+				machine.Observe(door.StateOpen)
+				machine.Observe(door.StateClosed)
+				Expect(machine.Current().State).To(Equal(door.StateClosed))
+			})
+
+			It("Should be stopped if pulsed again while moving", func() {
+				machine.Pulse()
+				Expect(machine.Current().State).To(Equal(door.StateStopped))
+			})
+
+			It("Should reverse if pulsed again once stopped", func() {
+				machine.Pulse()
+				machine.Pulse()
+				Expect(machine.Current().State).To(Equal(door.StateClosing))
+			})
+
+			It("Should retry in the same direction if pulsed again once stuck", func() {
+				now = now.Add(travelTime)
+				machine.Pulse()
+				Expect(machine.Current().State).To(Equal(door.StateOpening))
+			})
+		})
+
+		Describe("Closing", func() {
+			JustBeforeEach(func() {
+				machine.Observe(door.StateOpen)
+				now = now.Add(travelTime)
+				Expect(machine.Current().State).To(Equal(door.StateOpen))
+
+				machine.Pulse()
+			})
+
+			It("Should be closing after a pulse", func() {
+				Expect(machine.Current().State).To(Equal(door.StateClosing))
+			})
+
+			It("Should be closed once the sensor confirms it", func() {
+				now = now.Add(time.Second)
+				machine.Observe(door.StateClosed)
+
+				ds := machine.Current()
+				Expect(ds.State).To(Equal(door.StateClosed))
+				Expect(ds.Since).To(Equal(now))
+				Expect(ds.LastTransition.Cause).To(Equal(door.CauseSensor))
+			})
+
+			It("Should be stopped if the sensor does not confirm it within the travel time", func() {
+				now = now.Add(travelTime)
+				Expect(machine.Current().State).To(Equal(door.StateStopped))
+			})
+		})
+
+		It("Should be opening if the door leaves the closed position without a pulse", func() {
+			machine.Observe(door.StateOpen)
+			ds := machine.Current()
+			Expect(ds.State).To(Equal(door.StateOpening))
+			Expect(ds.LastTransition.Cause).To(Equal(door.CauseSensor))
+		})
+	})
+
+	Context("When the sensor observes the open position", func() {
+		BeforeEach(func() {
+			observed = door.StateOpen
+		})
+
+		JustBeforeEach(func() {
+			machine.Observe(door.StateOpen)
+			machine.Pulse()
+		})
+
+		It("Should be closed once the door has left the open position for the travel time", func() {
+			machine.Observe(door.StateClosed)
+			now = now.Add(travelTime)
+			Expect(machine.Current().State).To(Equal(door.StateClosed))
+		})
+
+		It("Should be stuck if the door never leaves the open position", func() {
+			now = now.Add(travelTime)
+			Expect(machine.Current().State).To(Equal(door.StateStuck))
+		})
+	})
+})
@@ -0,0 +1,154 @@
+package events
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/context"
+)
+
+type Type string
+
+const (
+	// TypeDoorToggle is recorded each time the relay of a door is to be pulsed.
+	// Result is pulsed unless the relay was not pulsed, e.g. busy or interlocked.
+	TypeDoorToggle Type = "door-toggle"
+
+	// TypeDoorState is recorded each time the state of a door changes.
+	TypeDoorState Type = "door-state"
+
+	// TypeLight is recorded each time the light is switched on or off.
+	TypeLight Type = "light"
+
+	// TypeSensor is recorded each time the position reported by a door sensor
+	// changes. State is the reported position.
+	TypeSensor Type = "sensor"
+
+	// TypeInterlock is recorded each time an interlock of a door becomes
+	// active or inactive.
+	TypeInterlock Type = "interlock"
+
+	// TypeLogin and TypeLoginFailed are recorded for each login attempt,
+	// and for each request with invalid basic auth credentials.
+	TypeLogin       Type = "login"
+	TypeLoginFailed Type = "login-failed"
+
+	// TypeNotification is recorded each time a notify action of an
+	// automation rule is performed.
+	TypeNotification Type = "notification"
+)
+
+// ParseType returns an error for an unknown type.
+func ParseType(s string) (Type, error) {
+	switch Type(s) {
+	case TypeDoorToggle, TypeDoorState, TypeLight, TypeSensor, TypeInterlock, TypeLogin, TypeLoginFailed, TypeNotification:
+		return Type(s), nil
+	default:
+		return "", fmt.Errorf("unknown event type: '%s'", s)
+	}
+}
+
+// Source identifies who caused an event. It is empty for events caused by
+// garagepi itself, e.g. by automation rules or the door sensor.
+type Source struct {
+	User     string `json:"user,omitempty"`
+	ClientIP string `json:"clientIP,omitempty"`
+}
+
+type contextKey int
+
+const (
+	sourceKey contextKey = iota
+	adminKey
+)
+
+// SetRequestSource stores the source of the request in its context, e.g. once
+// its user has been authenticated. The context must be cleared once the
+// request has been handled, as mux.Router does.
+func SetRequestSource(r *http.Request, s Source) {
+	context.Set(r, sourceKey, s)
+}
+
+// RequestSource returns the source stored in the context of the request.
+// If there is none, it returns the client IP of the request, and its user
+// if the request used basic auth.
+func RequestSource(r *http.Request) Source {
+	if s, ok := context.Get(r, sourceKey).(Source); ok {
+		return s
+	}
+
+	user, _, _ := r.BasicAuth()
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return Source{
+		User:     user,
+		ClientIP: ip,
+	}
+}
+
+// SetRequestAdmin stores in the context of the request that its user has
+// been authenticated as the admin.
+func SetRequestAdmin(r *http.Request) {
+	context.Set(r, adminKey, true)
+}
+
+// RequestAdmin returns whether the user of the request has been
+// authenticated as the admin.
+func RequestAdmin(r *http.Request) bool {
+	admin, _ := context.Get(r, adminKey).(bool)
+	return admin
+}
+
+type Event struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	Type Type      `json:"type"`
+
+	Door      string `json:"door,omitempty"`
+	Interlock string `json:"interlock,omitempty"`
+	State     string `json:"state,omitempty"`
+	Result    string `json:"result,omitempty"`
+	Cause     string `json:"cause,omitempty"`
+	Rule      string `json:"rule,omitempty"`
+	Message   string `json:"message,omitempty"`
+
+	Source
+}
+
+//go:generate counterfeiter . Recorder
+
+// Recorder records events. The ID and time of recorded events are assigned
+// by the recorder. Recording never fails; errors are logged by the recorder.
+type Recorder interface {
+	Record(e Event)
+}
+
+//go:generate counterfeiter . Subscriber
+
+// Subscriber delivers events as they are recorded.
+type Subscriber interface {
+	Subscribe() Subscription
+}
+
+//go:generate counterfeiter . Subscription
+
+// Subscription delivers the events recorded after it was created. The events
+// channel is closed once the subscription is stopped, or if the subscriber
+// falls behind, in which case events have been missed.
+type Subscription interface {
+	Events() <-chan Event
+	Stop()
+}
+
+type discard struct{}
+
+// Discard is a recorder which records nothing.
+var Discard Recorder = discard{}
+
+func (discard) Record(e Event) {}
@@ -0,0 +1,41 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+type FakeRecorder struct {
+	RecordStub        func(e events.Event)
+	recordMutex       sync.RWMutex
+	recordArgsForCall []struct {
+		e events.Event
+	}
+}
+
+func (fake *FakeRecorder) Record(e events.Event) {
+	fake.recordMutex.Lock()
+	fake.recordArgsForCall = append(fake.recordArgsForCall, struct {
+		e events.Event
+	}{e})
+	fake.recordMutex.Unlock()
+	if fake.RecordStub != nil {
+		fake.RecordStub(e)
+	}
+}
+
+func (fake *FakeRecorder) RecordCallCount() int {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return len(fake.recordArgsForCall)
+}
+
+func (fake *FakeRecorder) RecordArgsForCall(i int) events.Event {
+	fake.recordMutex.RLock()
+	defer fake.recordMutex.RUnlock()
+	return fake.recordArgsForCall[i].e
+}
+
+var _ events.Recorder = new(FakeRecorder)
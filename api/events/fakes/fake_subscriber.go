@@ -0,0 +1,43 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+type FakeSubscriber struct {
+	SubscribeStub        func() events.Subscription
+	subscribeMutex       sync.RWMutex
+	subscribeArgsForCall []struct{}
+	subscribeReturns     struct {
+		result1 events.Subscription
+	}
+}
+
+func (fake *FakeSubscriber) Subscribe() events.Subscription {
+	fake.subscribeMutex.Lock()
+	fake.subscribeArgsForCall = append(fake.subscribeArgsForCall, struct{}{})
+	fake.subscribeMutex.Unlock()
+	if fake.SubscribeStub != nil {
+		return fake.SubscribeStub()
+	} else {
+		return fake.subscribeReturns.result1
+	}
+}
+
+func (fake *FakeSubscriber) SubscribeCallCount() int {
+	fake.subscribeMutex.RLock()
+	defer fake.subscribeMutex.RUnlock()
+	return len(fake.subscribeArgsForCall)
+}
+
+func (fake *FakeSubscriber) SubscribeReturns(result1 events.Subscription) {
+	fake.SubscribeStub = nil
+	fake.subscribeReturns = struct {
+		result1 events.Subscription
+	}{result1}
+}
+
+var _ events.Subscriber = new(FakeSubscriber)
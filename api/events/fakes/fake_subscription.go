@@ -0,0 +1,61 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+type FakeSubscription struct {
+	EventsStub        func() <-chan events.Event
+	eventsMutex       sync.RWMutex
+	eventsArgsForCall []struct{}
+	eventsReturns     struct {
+		result1 <-chan events.Event
+	}
+	StopStub        func()
+	stopMutex       sync.RWMutex
+	stopArgsForCall []struct{}
+}
+
+func (fake *FakeSubscription) Events() <-chan events.Event {
+	fake.eventsMutex.Lock()
+	fake.eventsArgsForCall = append(fake.eventsArgsForCall, struct{}{})
+	fake.eventsMutex.Unlock()
+	if fake.EventsStub != nil {
+		return fake.EventsStub()
+	} else {
+		return fake.eventsReturns.result1
+	}
+}
+
+func (fake *FakeSubscription) EventsCallCount() int {
+	fake.eventsMutex.RLock()
+	defer fake.eventsMutex.RUnlock()
+	return len(fake.eventsArgsForCall)
+}
+
+func (fake *FakeSubscription) EventsReturns(result1 <-chan events.Event) {
+	fake.EventsStub = nil
+	fake.eventsReturns = struct {
+		result1 <-chan events.Event
+	}{result1}
+}
+
+func (fake *FakeSubscription) Stop() {
+	fake.stopMutex.Lock()
+	fake.stopArgsForCall = append(fake.stopArgsForCall, struct{}{})
+	fake.stopMutex.Unlock()
+	if fake.StopStub != nil {
+		fake.StopStub()
+	}
+}
+
+func (fake *FakeSubscription) StopCallCount() int {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return len(fake.stopArgsForCall)
+}
+
+var _ events.Subscription = new(FakeSubscription)
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// HandleList responds with a page of events, newest first. The events may be
+// filtered with the query parameters:
+//
+//	type   - comma-separated event types; may be repeated
+//	since  - RFC 3339 time
+//	until  - RFC 3339 time
+//	before - ID; use the next ID of the previous page
+//	limit  - maximum number of events
+func (s *store) HandleList(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		s.logger.Info("invalid event filter provided", lager.Data{"error": err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	b, _ := json.Marshal(s.Query(f))
+	w.Write(b)
+}
+
+func parseFilter(r *http.Request) (Filter, error) {
+	var f Filter
+
+	for _, types := range r.URL.Query()["type"] {
+		for _, t := range strings.Split(types, ",") {
+			parsed, err := ParseType(t)
+			if err != nil {
+				return Filter{}, err
+			}
+			f.Types = append(f.Types, parsed)
+		}
+	}
+
+	var err error
+	if since := r.URL.Query().Get("since"); since != "" {
+		f.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid since: %s", since)
+		}
+	}
+
+	if until := r.URL.Query().Get("until"); until != "" {
+		f.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid until: %s", until)
+		}
+	}
+
+	if before := r.URL.Query().Get("before"); before != "" {
+		f.Before, err = strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid before: %s", before)
+		}
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		f.Limit, err = strconv.Atoi(limit)
+		if err != nil || f.Limit <= 0 || f.Limit > MaxLimit {
+			return Filter{}, fmt.Errorf("invalid limit: %s must be between 1 and %d", limit, MaxLimit)
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,405 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+
+	// subscriptionBuffer is the number of events which may be pending
+	// delivery to a subscriber before it is considered to have fallen behind.
+	subscriptionBuffer = 64
+)
+
+// Store records events, and as an ifrit.Runner periodically removes those
+// which are no longer retained.
+type Store interface {
+	Recorder
+	Subscriber
+	ifrit.Runner
+	Query(f Filter) Page
+	HandleList(w http.ResponseWriter, r *http.Request)
+}
+
+// Retention limits the events which are kept. Zero values are unlimited.
+type Retention struct {
+	MaxAge    time.Duration
+	MaxEvents int
+}
+
+// Filter selects events. Zero values match all events.
+type Filter struct {
+	Types []Type
+
+	// Since and Until are inclusive.
+	Since time.Time
+	Until time.Time
+
+	// Before only matches events whose ID is less than Before.
+	Before uint64
+
+	// Limit is the maximum number of events returned.
+	// It defaults to DefaultLimit and may not exceed MaxLimit.
+	Limit int
+}
+
+// Page is a page of events, newest first.
+// Next is set if there are older matching events, which are
+// returned by repeating the query with Before set to Next.
+type Page struct {
+	Events []Event `json:"events"`
+	Next   *uint64 `json:"next,omitempty"`
+}
+
+type store struct {
+	logger          lager.Logger
+	clock           gpos.OSHelper
+	path            string
+	retention       Retention
+	compactInterval time.Duration
+
+	mutex  sync.Mutex
+	events []Event
+	nextID uint64
+	file   *os.File
+
+	subscriptions map[*subscription]struct{}
+
+	// stale is set once events have been removed from memory but are still in the file.
+	stale bool
+}
+
+// NewStore returns a store which appends events to the file at path, one JSON
+// object per line, and rewrites the file every compactInterval to remove events
+// which are no longer retained. Events are only kept in memory if path is empty.
+func NewStore(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	path string,
+	retention Retention,
+	compactInterval time.Duration,
+) (Store, error) {
+	s := &store{
+		logger:          logger,
+		clock:           clock,
+		path:            path,
+		retention:       retention,
+		compactInterval: compactInterval,
+		nextID:          1,
+		subscriptions:   map[*subscription]struct{}{},
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.prune()
+
+	err = s.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads the events from the file. Lines which cannot be decoded, e.g.
+// one which was only partially written before a power cut, are skipped.
+func (s *store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil || e.ID < s.nextID {
+			s.logger.Info("skipping invalid event", lager.Data{"path": s.path, "line": scanner.Text()})
+			s.stale = true
+			continue
+		}
+
+		s.events = append(s.events, e)
+		s.nextID = e.ID + 1
+	}
+
+	return scanner.Err()
+}
+
+func (s *store) Record(e Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e.ID = s.nextID
+	s.nextID++
+	e.Time = s.clock.Now()
+
+	s.events = append(s.events, e)
+
+	if s.retention.MaxEvents > 0 && len(s.events) > s.retention.MaxEvents {
+		s.prune()
+	}
+
+	s.publish(e)
+
+	if s.file == nil {
+		return
+	}
+
+	b, _ := json.Marshal(e)
+	_, err := s.file.Write(append(b, '\n'))
+	if err != nil {
+		s.logger.Error("error recording event", err, lager.Data{"path": s.path})
+	}
+}
+
+type subscription struct {
+	store  *store
+	events chan Event
+}
+
+func (s *store) Subscribe() Subscription {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub := &subscription{
+		store:  s,
+		events: make(chan Event, subscriptionBuffer),
+	}
+	s.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+func (sub *subscription) Events() <-chan Event {
+	return sub.events
+}
+
+func (sub *subscription) Stop() {
+	sub.store.mutex.Lock()
+	defer sub.store.mutex.Unlock()
+
+	sub.store.unsubscribe(sub)
+}
+
+// publish delivers e to every subscriber without blocking. A subscriber
+// whose buffer is full is unsubscribed rather than silently missing events.
+// publish must be called with the mutex held.
+func (s *store) publish(e Event) {
+	for sub := range s.subscriptions {
+		select {
+		case sub.events <- e:
+		default:
+			s.logger.Info("subscriber fell behind - unsubscribing")
+			s.unsubscribe(sub)
+		}
+	}
+}
+
+// unsubscribe must be called with the mutex held.
+func (s *store) unsubscribe(sub *subscription) {
+	if _, ok := s.subscriptions[sub]; !ok {
+		return
+	}
+	delete(s.subscriptions, sub)
+	close(sub.events)
+}
+
+func (s *store) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(s.compactInterval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+
+			if s.file == nil {
+				return nil
+			}
+
+			err := s.file.Close()
+			s.file = nil
+			return err
+
+		case <-ticker.C:
+			s.mutex.Lock()
+			s.prune()
+			if s.stale {
+				err := s.compact()
+				if err != nil {
+					s.logger.Error("error compacting events", err, lager.Data{"path": s.path})
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// prune removes events from memory which are no longer retained.
+// prune must be called with the mutex held.
+func (s *store) prune() {
+	first := 0
+
+	if s.retention.MaxAge > 0 {
+		oldest := s.clock.Now().Add(-s.retention.MaxAge)
+		for first < len(s.events) && s.events[first].Time.Before(oldest) {
+			first++
+		}
+	}
+
+	if s.retention.MaxEvents > 0 && len(s.events)-first > s.retention.MaxEvents {
+		first = len(s.events) - s.retention.MaxEvents
+	}
+
+	if first == 0 {
+		return
+	}
+
+	s.logger.Debug("removing events", lager.Data{"count": first})
+	s.events = s.events[first:]
+	s.stale = true
+}
+
+// compact rewrites the file with the events in memory, and opens it for appending.
+// compact must be called with the mutex held.
+func (s *store) compact() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	if s.stale {
+		err := s.rewrite()
+		if err != nil {
+			return err
+		}
+		s.stale = false
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.file = f
+	return nil
+}
+
+// rewrite must be called with the mutex held.
+func (s *store) rewrite() error {
+	// Write to a temporary file and rename it so the file is never
+	// left partially written.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range s.events {
+		b, _ := json.Marshal(e)
+		w.Write(append(b, '\n'))
+	}
+
+	err = w.Flush()
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *store) Query(f Filter) Page {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	page := Page{
+		Events: []Event{},
+	}
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		e := s.events[i]
+
+		if !f.matches(e) {
+			continue
+		}
+
+		if len(page.Events) == limit {
+			next := page.Events[limit-1].ID
+			page.Next = &next
+			break
+		}
+
+		page.Events = append(page.Events, e)
+	}
+
+	return page
+}
+
+func (f Filter) matches(e Event) bool {
+	if f.Before > 0 && e.ID >= f.Before {
+		return false
+	}
+
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	for _, t := range f.Types {
+		if e.Type == t {
+			return true
+		}
+	}
+	return false
+}
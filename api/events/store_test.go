@@ -0,0 +1,345 @@
+package events_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/events"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		fakeOSHelper *os_fakes.FakeOSHelper
+
+		tempDirPath     string
+		path            string
+		retention       events.Retention
+		compactInterval time.Duration
+
+		store   events.Store
+		process ifrit.Process
+
+		mutex sync.Mutex
+		now   time.Time
+	)
+
+	start := time.Date(2016, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	setNow := func(t time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = t
+	}
+
+	newStore := func() events.Store {
+		s, err := events.NewStore(
+			lagertest.NewTestLogger("events test"),
+			fakeOSHelper,
+			path,
+			retention,
+			compactInterval,
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	ids := func(page events.Page) []uint64 {
+		ids := []uint64{}
+		for _, e := range page.Events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	readLines := func() []string {
+		b, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+
+	BeforeEach(func() {
+		setNow(start)
+
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowStub = func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now
+		}
+
+		var err error
+		tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-events-test")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tempDirPath, "events.json")
+
+		retention = events.Retention{}
+		compactInterval = time.Hour
+	})
+
+	JustBeforeEach(func() {
+		store = newStore()
+		process = ifrit.Invoke(store)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+
+		err := os.RemoveAll(tempDirPath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("assigns IDs and times to recorded events", func() {
+		store.Record(events.Event{Type: events.TypeDoorToggle, Door: "garage", Result: "pulsed"})
+		setNow(start.Add(time.Minute))
+		store.Record(events.Event{Type: events.TypeLight, State: "on"})
+
+		page := store.Query(events.Filter{})
+		Expect(page.Next).To(BeNil())
+		Expect(page.Events).To(Equal([]events.Event{
+			{ID: 2, Time: start.Add(time.Minute), Type: events.TypeLight, State: "on"},
+			{ID: 1, Time: start, Type: events.TypeDoorToggle, Door: "garage", Result: "pulsed"},
+		}))
+	})
+
+	Context("when querying", func() {
+		JustBeforeEach(func() {
+			for i := 0; i < 10; i++ {
+				t := events.TypeDoorToggle
+				if i%2 == 1 {
+					t = events.TypeLight
+				}
+				setNow(start.Add(time.Duration(i) * time.Minute))
+				store.Record(events.Event{Type: t})
+			}
+		})
+
+		It("filters by type", func() {
+			page := store.Query(events.Filter{Types: []events.Type{events.TypeLight}})
+			Expect(ids(page)).To(Equal([]uint64{10, 8, 6, 4, 2}))
+
+			page = store.Query(events.Filter{Types: []events.Type{events.TypeLight, events.TypeDoorToggle}})
+			Expect(page.Events).To(HaveLen(10))
+		})
+
+		It("filters by time, inclusively", func() {
+			page := store.Query(events.Filter{
+				Since: start.Add(2 * time.Minute),
+				Until: start.Add(4 * time.Minute),
+			})
+			Expect(ids(page)).To(Equal([]uint64{5, 4, 3}))
+		})
+
+		It("returns pages which are continued with Before", func() {
+			page := store.Query(events.Filter{Limit: 4})
+			Expect(ids(page)).To(Equal([]uint64{10, 9, 8, 7}))
+			Expect(page.Next).NotTo(BeNil())
+			Expect(*page.Next).To(Equal(uint64(7)))
+
+			page = store.Query(events.Filter{Limit: 4, Before: *page.Next})
+			Expect(ids(page)).To(Equal([]uint64{6, 5, 4, 3}))
+
+			page = store.Query(events.Filter{Limit: 4, Before: *page.Next})
+			Expect(ids(page)).To(Equal([]uint64{2, 1}))
+			Expect(page.Next).To(BeNil())
+		})
+
+		It("does not set Next when the last page is exactly full", func() {
+			page := store.Query(events.Filter{Limit: 5, Before: 6})
+			Expect(ids(page)).To(Equal([]uint64{5, 4, 3, 2, 1}))
+			Expect(page.Next).To(BeNil())
+		})
+	})
+
+	It("limits pages to DefaultLimit events by default", func() {
+		for i := 0; i < events.DefaultLimit+1; i++ {
+			store.Record(events.Event{Type: events.TypeLight})
+		}
+
+		page := store.Query(events.Filter{})
+		Expect(page.Events).To(HaveLen(events.DefaultLimit))
+		Expect(page.Next).NotTo(BeNil())
+	})
+
+	It("reloads the events from the file", func() {
+		store.Record(events.Event{Type: events.TypeLogin, Source: events.Source{User: "some-user", ClientIP: "1.2.3.4"}})
+		store.Record(events.Event{Type: events.TypeLight, State: "off"})
+
+		reloaded := newStore()
+		Expect(reloaded.Query(events.Filter{})).To(Equal(store.Query(events.Filter{})))
+
+		reloaded.Record(events.Event{Type: events.TypeLight, State: "on"})
+		Expect(ids(reloaded.Query(events.Filter{}))).To(Equal([]uint64{3, 2, 1}))
+	})
+
+	Context("when the file contains an invalid line", func() {
+		BeforeEach(func() {
+			contents := `{"id":1,"time":"2016-01-04T11:00:00Z","type":"light","state":"on"}
+{"id":2,"time":"2016-01-04T11:01:00Z","ty
+{"id":3,"time":"2016-01-04T11:02:00Z","type":"light","state":"off"}
+`
+			err := ioutil.WriteFile(path, []byte(contents), 0600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("skips the line and removes it from the file", func() {
+			Expect(ids(store.Query(events.Filter{}))).To(Equal([]uint64{3, 1}))
+			Expect(readLines()).To(HaveLen(2))
+		})
+	})
+
+	Context("when MaxEvents is set", func() {
+		BeforeEach(func() {
+			retention.MaxEvents = 3
+		})
+
+		It("removes the oldest events", func() {
+			for i := 0; i < 5; i++ {
+				store.Record(events.Event{Type: events.TypeLight})
+			}
+
+			Expect(ids(store.Query(events.Filter{}))).To(Equal([]uint64{5, 4, 3}))
+		})
+	})
+
+	Context("when MaxAge is set", func() {
+		BeforeEach(func() {
+			retention.MaxAge = time.Hour
+			compactInterval = time.Millisecond
+		})
+
+		It("removes old events from memory and from the file", func() {
+			store.Record(events.Event{Type: events.TypeLight})
+			setNow(start.Add(30 * time.Minute))
+			store.Record(events.Event{Type: events.TypeLight})
+			Expect(readLines()).To(HaveLen(2))
+
+			setNow(start.Add(61 * time.Minute))
+
+			Eventually(func() []uint64 {
+				return ids(store.Query(events.Filter{}))
+			}).Should(Equal([]uint64{2}))
+			Eventually(readLines).Should(HaveLen(1))
+
+			store.Record(events.Event{Type: events.TypeLight})
+			Expect(readLines()).To(HaveLen(2))
+		})
+	})
+
+	Context("when the path is empty", func() {
+		BeforeEach(func() {
+			path = ""
+		})
+
+		It("keeps events in memory", func() {
+			store.Record(events.Event{Type: events.TypeLight})
+			Expect(ids(store.Query(events.Filter{}))).To(Equal([]uint64{1}))
+		})
+	})
+
+	Describe("subscribing", func() {
+		It("delivers events recorded after subscribing", func() {
+			store.Record(events.Event{Type: events.TypeLight, State: "on"})
+
+			sub := store.Subscribe()
+			defer sub.Stop()
+
+			store.Record(events.Event{Type: events.TypeLight, State: "off"})
+
+			var e events.Event
+			Eventually(sub.Events()).Should(Receive(&e))
+			Expect(e.ID).To(Equal(uint64(2)))
+			Expect(e.State).To(Equal("off"))
+			Consistently(sub.Events()).ShouldNot(Receive())
+		})
+
+		It("closes the events channel when stopped", func() {
+			sub := store.Subscribe()
+			sub.Stop()
+			sub.Stop()
+
+			Expect(sub.Events()).To(BeClosed())
+			store.Record(events.Event{Type: events.TypeLight})
+		})
+
+		It("closes the events channel of a subscriber which falls behind", func() {
+			slow := store.Subscribe()
+			fast := store.Subscribe()
+			defer fast.Stop()
+
+			for i := 0; i < 100; i++ {
+				store.Record(events.Event{Type: events.TypeLight})
+				Eventually(fast.Events()).Should(Receive())
+			}
+
+			count := 0
+			for range slow.Events() {
+				count++
+			}
+			Expect(count).To(BeNumerically("<", 100))
+		})
+	})
+
+	Describe("HandleList", func() {
+		get := func(query string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", "/events?"+query, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			w := httptest.NewRecorder()
+			store.HandleList(w, req)
+			return w
+		}
+
+		JustBeforeEach(func() {
+			store.Record(events.Event{Type: events.TypeDoorToggle})
+			setNow(start.Add(time.Minute))
+			store.Record(events.Event{Type: events.TypeLight})
+			setNow(start.Add(2 * time.Minute))
+			store.Record(events.Event{Type: events.TypeLogin})
+		})
+
+		It("responds with the filtered events", func() {
+			w := get("type=light,login&type=door-toggle&since=2016-01-04T12:01:00Z&limit=1")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var page events.Page
+			err := json.Unmarshal(w.Body.Bytes(), &page)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ids(page)).To(Equal([]uint64{3}))
+			Expect(page.Next).NotTo(BeNil())
+			Expect(*page.Next).To(Equal(uint64(3)))
+		})
+
+		invalidQueries := []string{
+			"type=unknown",
+			"since=yesterday",
+			"until=2016-01-04",
+			"before=-1",
+			"limit=0",
+			"limit=501",
+			"limit=some",
+		}
+
+		for _, q := range invalidQueries {
+			q := q
+
+			It("responds with 400 for "+q, func() {
+				w := get(q)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+			})
+		}
+	})
+})
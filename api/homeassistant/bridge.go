@@ -0,0 +1,335 @@
+// Package homeassistant bridges the doors and light to Home Assistant over MQTT.
+// Each door is a cover and the light is a light, announced with MQTT discovery.
+package homeassistant
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/light"
+	"github.com/robdimsdale/garagepi/mqtt"
+	"github.com/tedsuo/ifrit"
+)
+
+// Payloads of the command and state topics, as expected by Home Assistant.
+const (
+	PayloadOpen   = "OPEN"
+	PayloadClose  = "CLOSE"
+	PayloadToggle = "TOGGLE"
+	PayloadOn     = "ON"
+	PayloadOff    = "OFF"
+
+	// PayloadUnknown resets the state of an entity to unknown.
+	PayloadUnknown = "None"
+
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// Source is the source of events caused by MQTT commands.
+var Source = events.Source{User: "mqtt"}
+
+type Config struct {
+	// TopicPrefix is prepended to the state and command topics,
+	// e.g. garagepi/door/main/state.
+	TopicPrefix string
+
+	// DiscoveryPrefix is the discovery prefix configured in Home Assistant.
+	// Discovery payloads are not published if it is empty.
+	DiscoveryPrefix string
+
+	// NodeID identifies this garagepi in discovery topics and unique IDs.
+	NodeID string
+}
+
+// AvailabilityTopic is the topic to which online is published when connected.
+// The client should be configured with a will publishing offline to it.
+func (c Config) AvailabilityTopic() string {
+	return c.TopicPrefix + "/availability"
+}
+
+func (c Config) doorTopic(name string, suffix string) string {
+	return c.TopicPrefix + "/door/" + name + "/" + suffix
+}
+
+func (c Config) lightTopic(suffix string) string {
+	return c.TopicPrefix + "/light/" + suffix
+}
+
+type bridge struct {
+	logger       lager.Logger
+	client       mqtt.Client
+	config       Config
+	subscriber   events.Subscriber
+	lightHandler light.Handler
+	doors        door.Doors
+}
+
+// NewBridge returns a runner which publishes the state of the doors and light
+// each time it changes, and subscribes client to their command topics.
+// NewBridge must be called before client runs. All messages are retained, and
+// discovery payloads, availability and current state are published each time
+// client connects.
+func NewBridge(
+	logger lager.Logger,
+	client mqtt.Client,
+	config Config,
+	subscriber events.Subscriber,
+	lightHandler light.Handler,
+	doors door.Doors,
+) ifrit.Runner {
+	b := &bridge{
+		logger:       logger.Session("homeassistant"),
+		client:       client,
+		config:       config,
+		subscriber:   subscriber,
+		lightHandler: lightHandler,
+		doors:        doors,
+	}
+
+	for _, dh := range doors.All() {
+		client.Handle(config.doorTopic(dh.Name(), "set"), b.doorCommand(dh))
+	}
+	client.Handle(config.lightTopic("set"), b.lightCommand)
+	client.OnConnect(b.announce)
+
+	return b
+}
+
+func (b *bridge) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	sub := b.subscriber.Subscribe()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			sub.Stop()
+			return nil
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Events were missed, so publish the state of everything.
+				b.logger.Info("subscription ended - resubscribing")
+				sub = b.subscriber.Subscribe()
+				b.publishState()
+				continue
+			}
+
+			switch e.Type {
+			case events.TypeLight:
+				b.publishLight()
+			case events.TypeDoorState:
+				if dh, ok := b.doors.Get(e.Door); ok {
+					b.publishDoor(dh)
+				}
+			}
+		}
+	}
+}
+
+func (b *bridge) announce() {
+	b.publish(b.config.AvailabilityTopic(), PayloadOnline)
+
+	if b.config.DiscoveryPrefix != "" {
+		for _, dh := range b.doors.All() {
+			b.publishJSON(b.discoveryTopic("cover", dh.Name()), b.coverDiscovery(dh.Name()))
+		}
+		b.publishJSON(b.discoveryTopic("light", "light"), b.lightDiscovery())
+	}
+
+	b.publishState()
+}
+
+func (b *bridge) publishState() {
+	for _, dh := range b.doors.All() {
+		b.publishDoor(dh)
+	}
+	b.publishLight()
+}
+
+func (b *bridge) publishDoor(dh door.Handler) {
+	state := PayloadUnknown
+
+	ds, err := dh.DiscoverDoorState()
+	if err != nil {
+		b.logger.Error("error reading door state", err, lager.Data{"door": dh.Name()})
+	} else {
+		state = coverState(ds.State)
+	}
+
+	b.publish(b.config.doorTopic(dh.Name(), "state"), state)
+}
+
+func (b *bridge) publishLight() {
+	state := PayloadUnknown
+
+	ls, err := b.lightHandler.DiscoverLightState()
+	if err != nil {
+		b.logger.Error("error reading light state", err)
+	} else if ls.StateKnown {
+		state = PayloadOff
+		if ls.LightOn {
+			state = PayloadOn
+		}
+	}
+
+	b.publish(b.config.lightTopic("state"), state)
+}
+
+// coverState returns the Home Assistant cover state for s.
+func coverState(s door.State) string {
+	switch s {
+	case door.StateOpen, door.StateClosed, door.StateOpening, door.StateClosing:
+		return string(s)
+	case door.StateStopped, door.StateStuck:
+		return string(door.StateStopped)
+	default:
+		return PayloadUnknown
+	}
+}
+
+func (b *bridge) doorCommand(dh door.Handler) func(m mqtt.Message) {
+	return func(m mqtt.Message) {
+		command := strings.TrimSpace(string(m.Payload))
+		logger := b.logger.WithData(lager.Data{"door": dh.Name(), "command": command})
+		logger.Info("received door command")
+
+		var position door.State
+		switch command {
+		case PayloadOpen:
+			position = door.StateOpen
+		case PayloadClose:
+			position = door.StateClosed
+		case PayloadToggle:
+			err := dh.Toggle(Source)
+			if err != nil {
+				logger.Error("error toggling door", err)
+			}
+			return
+		default:
+			logger.Info("ignoring unknown door command")
+			return
+		}
+
+		resp := dh.MoveTo(position, Source)
+		if resp.Result == door.MoveResultError {
+			logger.Error("error moving door", nil, lager.Data{"errorMsg": resp.ErrorMsg})
+			return
+		}
+		logger.Info("door command completed", lager.Data{"result": resp.Result})
+	}
+}
+
+func (b *bridge) lightCommand(m mqtt.Message) {
+	command := strings.TrimSpace(string(m.Payload))
+	logger := b.logger.WithData(lager.Data{"command": command})
+	logger.Info("received light command")
+
+	var ls light.LightState
+	switch command {
+	case PayloadOn:
+		ls = b.lightHandler.TurnOn(0, Source)
+	case PayloadOff:
+		ls = b.lightHandler.TurnOff(Source)
+	default:
+		logger.Info("ignoring unknown light command")
+		return
+	}
+
+	if ls.ErrorMsg != "" {
+		logger.Error("error switching light", nil, lager.Data{"errorMsg": ls.ErrorMsg})
+	}
+}
+
+func (b *bridge) discoveryTopic(component string, objectID string) string {
+	return b.config.DiscoveryPrefix + "/" + component + "/" + b.config.NodeID + "/" + objectID + "/config"
+}
+
+type device struct {
+	Identifiers []string `json:"identifiers"`
+	Name        string   `json:"name"`
+	Model       string   `json:"model"`
+}
+
+type coverConfig struct {
+	Name              string  `json:"name"`
+	UniqueID          string  `json:"unique_id"`
+	DeviceClass       string  `json:"device_class"`
+	CommandTopic      string  `json:"command_topic"`
+	StateTopic        string  `json:"state_topic"`
+	AvailabilityTopic string  `json:"availability_topic"`
+	PayloadOpen       string  `json:"payload_open"`
+	PayloadClose      string  `json:"payload_close"`
+	PayloadStop       *string `json:"payload_stop"`
+	Device            device  `json:"device"`
+}
+
+type lightConfig struct {
+	Name              string `json:"name"`
+	UniqueID          string `json:"unique_id"`
+	CommandTopic      string `json:"command_topic"`
+	StateTopic        string `json:"state_topic"`
+	AvailabilityTopic string `json:"availability_topic"`
+	PayloadOn         string `json:"payload_on"`
+	PayloadOff        string `json:"payload_off"`
+	Device            device `json:"device"`
+}
+
+func (b *bridge) device() device {
+	return device{
+		Identifiers: []string{b.config.NodeID},
+		Name:        b.config.NodeID,
+		Model:       "garagepi",
+	}
+}
+
+func (b *bridge) coverDiscovery(name string) coverConfig {
+	return coverConfig{
+		Name:              name,
+		UniqueID:          b.config.NodeID + "_door_" + name,
+		DeviceClass:       "garage",
+		CommandTopic:      b.config.doorTopic(name, "set"),
+		StateTopic:        b.config.doorTopic(name, "state"),
+		AvailabilityTopic: b.config.AvailabilityTopic(),
+		PayloadOpen:       PayloadOpen,
+		PayloadClose:      PayloadClose,
+		// The door cannot be stopped, so Home Assistant should not offer to.
+		PayloadStop: nil,
+		Device:      b.device(),
+	}
+}
+
+func (b *bridge) lightDiscovery() lightConfig {
+	return lightConfig{
+		Name:              "light",
+		UniqueID:          b.config.NodeID + "_light",
+		CommandTopic:      b.config.lightTopic("set"),
+		StateTopic:        b.config.lightTopic("state"),
+		AvailabilityTopic: b.config.AvailabilityTopic(),
+		PayloadOn:         PayloadOn,
+		PayloadOff:        PayloadOff,
+		Device:            b.device(),
+	}
+}
+
+func (b *bridge) publishJSON(topic string, v interface{}) {
+	payload, _ := json.Marshal(v)
+	b.publish(topic, string(payload))
+}
+
+// publish logs errors rather than returning them; state is published
+// again each time the client connects.
+func (b *bridge) publish(topic string, payload string) {
+	err := b.client.Publish(mqtt.Message{
+		Topic:   topic,
+		Payload: []byte(payload),
+		Retain:  true,
+	})
+	if err != nil {
+		b.logger.Debug("error publishing", lager.Data{"topic": topic, "error": err.Error()})
+	}
+}
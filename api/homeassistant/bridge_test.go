@@ -0,0 +1,309 @@
+package homeassistant_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/homeassistant"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	"github.com/robdimsdale/garagepi/mqtt"
+	mqtt_fakes "github.com/robdimsdale/garagepi/mqtt/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Bridge", func() {
+	var (
+		fakeClient       *mqtt_fakes.FakeClient
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		fakeLightHandler *light_fakes.FakeHandler
+		fakeDoors        *door_fakes.FakeDoors
+		fakeDoorHandler  *door_fakes.FakeHandler
+
+		config   homeassistant.Config
+		recorded chan events.Event
+
+		publishedMutex sync.Mutex
+		published      map[string]string
+
+		process ifrit.Process
+	)
+
+	// payload returns the last payload published to topic.
+	payload := func(topic string) func() string {
+		return func() string {
+			publishedMutex.Lock()
+			defer publishedMutex.Unlock()
+			return published[topic]
+		}
+	}
+
+	handler := func(topic string) func(m mqtt.Message) {
+		for i := 0; i < fakeClient.HandleCallCount(); i++ {
+			t, h := fakeClient.HandleArgsForCall(i)
+			if t == topic {
+				return h
+			}
+		}
+		Fail("no handler for " + topic)
+		return nil
+	}
+
+	connect := func() {
+		Expect(fakeClient.OnConnectCallCount()).To(Equal(1))
+		fakeClient.OnConnectArgsForCall(0)()
+	}
+
+	BeforeEach(func() {
+		published = map[string]string{}
+
+		fakeClient = new(mqtt_fakes.FakeClient)
+		fakeClient.PublishStub = func(m mqtt.Message) error {
+			Expect(m.Retain).To(BeTrue())
+
+			publishedMutex.Lock()
+			defer publishedMutex.Unlock()
+			published[m.Topic] = string(m.Payload)
+			return nil
+		}
+
+		recorded = make(chan events.Event, 10)
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: false}, nil)
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosed}, nil)
+
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+		fakeDoors.GetStub = func(name string) (door.Handler, bool) {
+			return fakeDoorHandler, name == "garage"
+		}
+
+		config = homeassistant.Config{
+			TopicPrefix:     "garagepi",
+			DiscoveryPrefix: "homeassistant",
+			NodeID:          "garagepi",
+		}
+	})
+
+	JustBeforeEach(func() {
+		bridge := homeassistant.NewBridge(
+			lagertest.NewTestLogger("homeassistant test"),
+			fakeClient,
+			config,
+			fakeSubscriber,
+			fakeLightHandler,
+			fakeDoors,
+		)
+		process = ifrit.Invoke(bridge)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(fakeSubscription.StopCallCount()).To(Equal(1))
+	})
+
+	It("subscribes to the command topics", func() {
+		Expect(fakeClient.HandleCallCount()).To(Equal(2))
+
+		topic, _ := fakeClient.HandleArgsForCall(0)
+		Expect(topic).To(Equal("garagepi/door/garage/set"))
+
+		topic, _ = fakeClient.HandleArgsForCall(1)
+		Expect(topic).To(Equal("garagepi/light/set"))
+	})
+
+	Context("when the client connects", func() {
+		JustBeforeEach(func() {
+			connect()
+		})
+
+		It("publishes availability and the current state", func() {
+			Expect(payload("garagepi/availability")()).To(Equal("online"))
+			Expect(payload("garagepi/door/garage/state")()).To(Equal("closed"))
+			Expect(payload("garagepi/light/state")()).To(Equal("OFF"))
+		})
+
+		It("publishes a cover discovery payload for each door", func() {
+			var cover map[string]interface{}
+			err := json.Unmarshal([]byte(payload("homeassistant/cover/garagepi/garage/config")()), &cover)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cover).To(HaveKeyWithValue("name", "garage"))
+			Expect(cover).To(HaveKeyWithValue("unique_id", "garagepi_door_garage"))
+			Expect(cover).To(HaveKeyWithValue("device_class", "garage"))
+			Expect(cover).To(HaveKeyWithValue("command_topic", "garagepi/door/garage/set"))
+			Expect(cover).To(HaveKeyWithValue("state_topic", "garagepi/door/garage/state"))
+			Expect(cover).To(HaveKeyWithValue("availability_topic", "garagepi/availability"))
+			Expect(cover).To(HaveKeyWithValue("payload_open", "OPEN"))
+			Expect(cover).To(HaveKeyWithValue("payload_close", "CLOSE"))
+			Expect(cover).To(HaveKey("payload_stop"))
+			Expect(cover["payload_stop"]).To(BeNil())
+		})
+
+		It("publishes a light discovery payload", func() {
+			var l map[string]interface{}
+			err := json.Unmarshal([]byte(payload("homeassistant/light/garagepi/light/config")()), &l)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(l).To(HaveKeyWithValue("unique_id", "garagepi_light"))
+			Expect(l).To(HaveKeyWithValue("command_topic", "garagepi/light/set"))
+			Expect(l).To(HaveKeyWithValue("state_topic", "garagepi/light/state"))
+			Expect(l).To(HaveKeyWithValue("payload_on", "ON"))
+			Expect(l).To(HaveKeyWithValue("payload_off", "OFF"))
+		})
+
+		Context("when the discovery prefix is empty", func() {
+			BeforeEach(func() {
+				config.DiscoveryPrefix = ""
+			})
+
+			It("does not publish discovery payloads", func() {
+				Expect(fakeClient.PublishCallCount()).To(Equal(3))
+			})
+		})
+
+		Context("when the states cannot be read", func() {
+			BeforeEach(func() {
+				fakeDoorHandler.DiscoverDoorStateReturns(nil, errors.New("gpio error"))
+				fakeLightHandler.DiscoverLightStateReturns(nil, errors.New("gpio error"))
+			})
+
+			It("publishes unknown states", func() {
+				Expect(payload("garagepi/door/garage/state")()).To(Equal("None"))
+				Expect(payload("garagepi/light/state")()).To(Equal("None"))
+			})
+		})
+
+		Context("when the door is stuck", func() {
+			BeforeEach(func() {
+				fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateStuck}, nil)
+			})
+
+			It("publishes stopped", func() {
+				Expect(payload("garagepi/door/garage/state")()).To(Equal("stopped"))
+			})
+		})
+	})
+
+	Describe("state changes", func() {
+		It("publishes the door state when it changes", func() {
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateOpening}, nil)
+			recorded <- events.Event{Type: events.TypeDoorState, Door: "garage", State: "opening"}
+
+			Eventually(payload("garagepi/door/garage/state")).Should(Equal("opening"))
+		})
+
+		It("publishes the light state when it changes", func() {
+			fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: true}, nil)
+			recorded <- events.Event{Type: events.TypeLight, State: "on"}
+
+			Eventually(payload("garagepi/light/state")).Should(Equal("ON"))
+		})
+
+		It("ignores other events", func() {
+			recorded <- events.Event{Type: events.TypeLogin}
+			Consistently(fakeClient.PublishCallCount, 50*time.Millisecond).Should(Equal(0))
+		})
+
+		Context("when events are missed", func() {
+			var first *events_fakes.FakeSubscription
+
+			BeforeEach(func() {
+				first = new(events_fakes.FakeSubscription)
+				missed := make(chan events.Event)
+				close(missed)
+				first.EventsReturns(missed)
+
+				fakeSubscriber.SubscribeStub = func() events.Subscription {
+					if fakeSubscriber.SubscribeCallCount() == 1 {
+						return first
+					}
+					return fakeSubscription
+				}
+			})
+
+			It("resubscribes and publishes all state", func() {
+				Eventually(fakeSubscriber.SubscribeCallCount).Should(Equal(2))
+
+				Eventually(payload("garagepi/door/garage/state")).Should(Equal("closed"))
+				Eventually(payload("garagepi/light/state")).Should(Equal("OFF"))
+			})
+		})
+	})
+
+	Describe("door commands", func() {
+		BeforeEach(func() {
+			fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+		})
+
+		It("opens the door", func() {
+			handler("garagepi/door/garage/set")(mqtt.Message{Payload: []byte("OPEN")})
+
+			Expect(fakeDoorHandler.MoveToCallCount()).To(Equal(1))
+			position, source := fakeDoorHandler.MoveToArgsForCall(0)
+			Expect(position).To(Equal(door.StateOpen))
+			Expect(source).To(Equal(homeassistant.Source))
+		})
+
+		It("closes the door", func() {
+			handler("garagepi/door/garage/set")(mqtt.Message{Payload: []byte("CLOSE")})
+
+			Expect(fakeDoorHandler.MoveToCallCount()).To(Equal(1))
+			position, _ := fakeDoorHandler.MoveToArgsForCall(0)
+			Expect(position).To(Equal(door.StateClosed))
+		})
+
+		It("toggles the door", func() {
+			handler("garagepi/door/garage/set")(mqtt.Message{Payload: []byte("TOGGLE")})
+
+			Expect(fakeDoorHandler.ToggleCallCount()).To(Equal(1))
+			Expect(fakeDoorHandler.ToggleArgsForCall(0)).To(Equal(homeassistant.Source))
+		})
+
+		It("ignores unknown commands", func() {
+			handler("garagepi/door/garage/set")(mqtt.Message{Payload: []byte("STOP")})
+
+			Expect(fakeDoorHandler.MoveToCallCount()).To(Equal(0))
+			Expect(fakeDoorHandler.ToggleCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("light commands", func() {
+		It("turns the light on without a duration", func() {
+			handler("garagepi/light/set")(mqtt.Message{Payload: []byte("ON")})
+
+			Expect(fakeLightHandler.TurnOnCallCount()).To(Equal(1))
+			duration, source := fakeLightHandler.TurnOnArgsForCall(0)
+			Expect(duration).To(BeZero())
+			Expect(source).To(Equal(homeassistant.Source))
+		})
+
+		It("turns the light off", func() {
+			handler("garagepi/light/set")(mqtt.Message{Payload: []byte("OFF")})
+
+			Expect(fakeLightHandler.TurnOffCallCount()).To(Equal(1))
+			Expect(fakeLightHandler.TurnOffArgsForCall(0)).To(Equal(homeassistant.Source))
+		})
+	})
+})
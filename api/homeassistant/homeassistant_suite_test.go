@@ -0,0 +1,13 @@
+package homeassistant_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHomeassistant(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Home Assistant Suite")
+}
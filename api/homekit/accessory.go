@@ -0,0 +1,224 @@
+//go:build homekit
+// +build homekit
+
+// Package homekit exposes the doors and light as HomeKit services: a garage
+// door opener for each door and a lightbulb for the light.
+package homekit
+
+import (
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/light"
+	gphomekit "github.com/robdimsdale/garagepi/homekit"
+)
+
+// Accessory holds the services of the garagepi accessory.
+type Accessory struct {
+	Services []*gphomekit.Service
+
+	logger lager.Logger
+	light  *gphomekit.Characteristic
+	doors  map[string][]*gphomekit.Characteristic
+}
+
+// NewAccessory returns the accessory information service, followed by a
+// lightbulb service and a garage door opener service for each door.
+func NewAccessory(
+	logger lager.Logger,
+	name string,
+	version string,
+	lightHandler light.Handler,
+	doors door.Doors,
+) *Accessory {
+	a := &Accessory{
+		logger: logger.Session("homekit-accessory"),
+		doors:  map[string][]*gphomekit.Characteristic{},
+	}
+
+	a.Services = append(a.Services, gphomekit.InformationService(name, "garagepi", "garagepi", name, version, func() {
+		a.logger.Info("identify requested")
+	}))
+
+	a.light = a.lightOn(lightHandler)
+	a.Services = append(a.Services, &gphomekit.Service{
+		Type:    gphomekit.ServiceLightbulb,
+		Primary: len(doors.All()) == 0,
+		Characteristics: []*gphomekit.Characteristic{
+			a.light,
+			gphomekit.StaticCharacteristic(gphomekit.CharacteristicName, "Light"),
+		},
+	})
+
+	for i, dh := range doors.All() {
+		d := &doorCharacteristics{logger: a.logger.WithData(lager.Data{"door": dh.Name()}), handler: dh}
+		characteristics := []*gphomekit.Characteristic{
+			d.current(),
+			d.target(),
+			d.obstruction(),
+		}
+		a.doors[dh.Name()] = characteristics
+
+		a.Services = append(a.Services, &gphomekit.Service{
+			Type:    gphomekit.ServiceGarageDoorOpener,
+			Primary: i == 0,
+			Characteristics: append(
+				characteristics,
+				gphomekit.StaticCharacteristic(gphomekit.CharacteristicName, dh.Name()),
+			),
+		})
+	}
+
+	return a
+}
+
+func (a *Accessory) lightOn(lightHandler light.Handler) *gphomekit.Characteristic {
+	return &gphomekit.Characteristic{
+		Type:   gphomekit.CharacteristicOn,
+		Format: gphomekit.FormatBool,
+		Perms:  []string{gphomekit.PermRead, gphomekit.PermWrite, gphomekit.PermEvents},
+		Get: func() (interface{}, error) {
+			ls, err := lightHandler.DiscoverLightState()
+			if err != nil {
+				a.logger.Error("error reading light state", err)
+				return nil, gphomekit.StatusCommunicationFailure
+			}
+			if !ls.StateKnown {
+				return nil, gphomekit.StatusCommunicationFailure
+			}
+			return ls.LightOn, nil
+		},
+		Set: func(value interface{}, source events.Source) error {
+			var ls light.LightState
+			if value.(bool) {
+				ls = lightHandler.TurnOn(0, source)
+			} else {
+				ls = lightHandler.TurnOff(source)
+			}
+
+			if ls.ErrorMsg != "" {
+				a.logger.Error("error switching light", nil, lager.Data{"errorMsg": ls.ErrorMsg})
+				return gphomekit.StatusCommunicationFailure
+			}
+			return nil
+		},
+	}
+}
+
+type doorCharacteristics struct {
+	logger  lager.Logger
+	handler door.Handler
+
+	// requestedMutex guards requested, the target last written by a
+	// controller. It is reported as the target while the door is stopped.
+	requestedMutex sync.Mutex
+	requested      int
+}
+
+func (d *doorCharacteristics) state() (*door.DoorState, error) {
+	ds, err := d.handler.DiscoverDoorState()
+	if err != nil {
+		d.logger.Error("error reading door state", err)
+		return nil, gphomekit.StatusCommunicationFailure
+	}
+	if !ds.StateKnown() {
+		return nil, gphomekit.StatusCommunicationFailure
+	}
+	return ds, nil
+}
+
+func (d *doorCharacteristics) current() *gphomekit.Characteristic {
+	return &gphomekit.Characteristic{
+		Type:   gphomekit.CharacteristicCurrentDoorState,
+		Format: gphomekit.FormatUint8,
+		Perms:  []string{gphomekit.PermRead, gphomekit.PermEvents},
+		Get: func() (interface{}, error) {
+			ds, err := d.state()
+			if err != nil {
+				return nil, err
+			}
+
+			switch ds.State {
+			case door.StateOpen:
+				return gphomekit.DoorStateOpen, nil
+			case door.StateClosed:
+				return gphomekit.DoorStateClosed, nil
+			case door.StateOpening:
+				return gphomekit.DoorStateOpening, nil
+			case door.StateClosing:
+				return gphomekit.DoorStateClosing, nil
+			default:
+				return gphomekit.DoorStateStopped, nil
+			}
+		},
+	}
+}
+
+func (d *doorCharacteristics) target() *gphomekit.Characteristic {
+	d.requested = gphomekit.DoorStateClosed
+
+	return &gphomekit.Characteristic{
+		Type:        gphomekit.CharacteristicTargetDoorState,
+		Format:      gphomekit.FormatUint8,
+		Perms:       []string{gphomekit.PermRead, gphomekit.PermWrite, gphomekit.PermEvents},
+		ValidValues: []int{gphomekit.DoorStateOpen, gphomekit.DoorStateClosed},
+		Get: func() (interface{}, error) {
+			ds, err := d.state()
+			if err != nil {
+				return nil, err
+			}
+
+			switch ds.State {
+			case door.StateOpen, door.StateOpening:
+				return gphomekit.DoorStateOpen, nil
+			case door.StateClosed, door.StateClosing:
+				return gphomekit.DoorStateClosed, nil
+			default:
+				d.requestedMutex.Lock()
+				defer d.requestedMutex.Unlock()
+				return d.requested, nil
+			}
+		},
+		Set: func(value interface{}, source events.Source) error {
+			target := value.(int)
+			position := door.StateClosed
+			if target == gphomekit.DoorStateOpen {
+				position = door.StateOpen
+			}
+
+			d.requestedMutex.Lock()
+			d.requested = target
+			d.requestedMutex.Unlock()
+
+			resp := d.handler.MoveTo(position, source)
+			switch resp.Result {
+			case door.MoveResultPulsed, door.MoveResultInProgress, door.MoveResultNoOp:
+				return nil
+			case door.MoveResultBusy, door.MoveResultCooldown:
+				return gphomekit.StatusBusy
+			default:
+				d.logger.Error("error moving door", nil, lager.Data{"result": resp.Result, "errorMsg": resp.ErrorMsg})
+				return gphomekit.StatusCommunicationFailure
+			}
+		},
+	}
+}
+
+// obstruction reports an obstruction while the door is stuck or one of its
+// interlocks is active.
+func (d *doorCharacteristics) obstruction() *gphomekit.Characteristic {
+	return &gphomekit.Characteristic{
+		Type:   gphomekit.CharacteristicObstructionDetected,
+		Format: gphomekit.FormatBool,
+		Perms:  []string{gphomekit.PermRead, gphomekit.PermEvents},
+		Get: func() (interface{}, error) {
+			ds, err := d.state()
+			if err != nil {
+				return nil, err
+			}
+			return ds.State == door.StateStuck || ds.InterlockActive(), nil
+		},
+	}
+}
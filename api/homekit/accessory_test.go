@@ -0,0 +1,212 @@
+//go:build homekit
+// +build homekit
+
+package homekit_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/homekit"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	gphomekit "github.com/robdimsdale/garagepi/homekit"
+)
+
+var _ = Describe("Accessory", func() {
+	var (
+		fakeLightHandler *light_fakes.FakeHandler
+		fakeDoors        *door_fakes.FakeDoors
+		fakeDoorHandler  *door_fakes.FakeHandler
+
+		source events.Source
+
+		accessory *homekit.Accessory
+	)
+
+	BeforeEach(func() {
+		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: true}, nil)
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosed}, nil)
+
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+
+		source = events.Source{User: "homekit", ClientIP: "10.0.0.2"}
+	})
+
+	JustBeforeEach(func() {
+		accessory = homekit.NewAccessory(
+			lagertest.NewTestLogger("homekit test"),
+			"Garage",
+			"1.2.3",
+			fakeLightHandler,
+			fakeDoors,
+		)
+	})
+
+	It("has information, lightbulb and garage door opener services", func() {
+		Expect(accessory.Services).To(HaveLen(3))
+		Expect(accessory.Services[0].Type).To(Equal(gphomekit.ServiceAccessoryInformation))
+		Expect(accessory.Services[1].Type).To(Equal(gphomekit.ServiceLightbulb))
+		Expect(accessory.Services[2].Type).To(Equal(gphomekit.ServiceGarageDoorOpener))
+		Expect(accessory.Services[2].Primary).To(BeTrue())
+
+		name, err := accessory.Services[2].Characteristics[3].Get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("garage"))
+	})
+
+	Describe("the light", func() {
+		var on *gphomekit.Characteristic
+
+		JustBeforeEach(func() {
+			on = accessory.Services[1].Characteristics[0]
+		})
+
+		It("reads the state of the light", func() {
+			Expect(on.Get()).To(Equal(true))
+		})
+
+		Context("when the state of the light is unknown", func() {
+			BeforeEach(func() {
+				fakeLightHandler.DiscoverLightStateReturns(&light.LightState{}, nil)
+			})
+
+			It("returns a communication failure", func() {
+				_, err := on.Get()
+				Expect(err).To(Equal(gphomekit.StatusCommunicationFailure))
+			})
+		})
+
+		It("switches the light on and off", func() {
+			fakeLightHandler.TurnOnReturns(light.LightState{StateKnown: true, LightOn: true})
+			fakeLightHandler.TurnOffReturns(light.LightState{StateKnown: true})
+
+			Expect(on.Set(true, source)).To(Succeed())
+			Expect(fakeLightHandler.TurnOnCallCount()).To(Equal(1))
+			duration, s := fakeLightHandler.TurnOnArgsForCall(0)
+			Expect(duration).To(BeZero())
+			Expect(s).To(Equal(source))
+
+			Expect(on.Set(false, source)).To(Succeed())
+			Expect(fakeLightHandler.TurnOffCallCount()).To(Equal(1))
+			Expect(fakeLightHandler.TurnOffArgsForCall(0)).To(Equal(source))
+		})
+
+		It("returns a communication failure when the light cannot be switched", func() {
+			fakeLightHandler.TurnOnReturns(light.LightState{ErrorMsg: "gpio error"})
+			Expect(on.Set(true, source)).To(Equal(gphomekit.StatusCommunicationFailure))
+		})
+	})
+
+	Describe("a door", func() {
+		var current, target, obstruction *gphomekit.Characteristic
+
+		JustBeforeEach(func() {
+			current = accessory.Services[2].Characteristics[0]
+			target = accessory.Services[2].Characteristics[1]
+			obstruction = accessory.Services[2].Characteristics[2]
+		})
+
+		It("reports the current and target state of the door", func() {
+			states := []struct {
+				state   door.State
+				current int
+				target  int
+			}{
+				{door.StateOpen, gphomekit.DoorStateOpen, gphomekit.DoorStateOpen},
+				{door.StateClosed, gphomekit.DoorStateClosed, gphomekit.DoorStateClosed},
+				{door.StateOpening, gphomekit.DoorStateOpening, gphomekit.DoorStateOpen},
+				{door.StateClosing, gphomekit.DoorStateClosing, gphomekit.DoorStateClosed},
+				{door.StateStopped, gphomekit.DoorStateStopped, gphomekit.DoorStateClosed},
+				{door.StateStuck, gphomekit.DoorStateStopped, gphomekit.DoorStateClosed},
+			}
+
+			for _, tc := range states {
+				fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{State: tc.state}, nil)
+				Expect(current.Get()).To(Equal(tc.current), string(tc.state))
+				Expect(target.Get()).To(Equal(tc.target), string(tc.state))
+			}
+		})
+
+		It("reports the last requested target while the door is stopped", func() {
+			fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+			Expect(target.Set(gphomekit.DoorStateOpen, source)).To(Succeed())
+
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{State: door.StateStopped}, nil)
+			Expect(target.Get()).To(Equal(gphomekit.DoorStateOpen))
+		})
+
+		It("reports an obstruction while the door is stuck or interlocked", func() {
+			Expect(obstruction.Get()).To(Equal(false))
+
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{State: door.StateStuck}, nil)
+			Expect(obstruction.Get()).To(Equal(true))
+
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{
+				State:      door.StateOpen,
+				Interlocks: []door.InterlockStatus{{Name: "car", Active: true}},
+			}, nil)
+			Expect(obstruction.Get()).To(Equal(true))
+		})
+
+		Context("when the state of the door cannot be read", func() {
+			BeforeEach(func() {
+				fakeDoorHandler.DiscoverDoorStateReturns(nil, errors.New("gpio error"))
+			})
+
+			It("returns a communication failure", func() {
+				for _, c := range []*gphomekit.Characteristic{current, target, obstruction} {
+					_, err := c.Get()
+					Expect(err).To(Equal(gphomekit.StatusCommunicationFailure))
+				}
+			})
+		})
+
+		It("moves the door to the target state", func() {
+			fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+
+			Expect(target.Set(gphomekit.DoorStateOpen, source)).To(Succeed())
+			Expect(target.Set(gphomekit.DoorStateClosed, source)).To(Succeed())
+
+			Expect(fakeDoorHandler.MoveToCallCount()).To(Equal(2))
+			position, s := fakeDoorHandler.MoveToArgsForCall(0)
+			Expect(position).To(Equal(door.StateOpen))
+			Expect(s).To(Equal(source))
+			position, _ = fakeDoorHandler.MoveToArgsForCall(1)
+			Expect(position).To(Equal(door.StateClosed))
+		})
+
+		It("maps move results to statuses", func() {
+			results := map[door.MoveResult]error{
+				door.MoveResultPulsed:      nil,
+				door.MoveResultInProgress:  nil,
+				door.MoveResultNoOp:        nil,
+				door.MoveResultBusy:        gphomekit.StatusBusy,
+				door.MoveResultCooldown:    gphomekit.StatusBusy,
+				door.MoveResultRejected:    gphomekit.StatusCommunicationFailure,
+				door.MoveResultInterlocked: gphomekit.StatusCommunicationFailure,
+				door.MoveResultError:       gphomekit.StatusCommunicationFailure,
+			}
+
+			for result, expected := range results {
+				fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: result})
+				err := target.Set(gphomekit.DoorStateOpen, source)
+				if expected == nil {
+					Expect(err).NotTo(HaveOccurred(), string(result))
+				} else {
+					Expect(err).To(Equal(expected), string(result))
+				}
+			}
+		})
+	})
+})
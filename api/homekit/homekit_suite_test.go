@@ -0,0 +1,16 @@
+//go:build homekit
+// +build homekit
+
+package homekit_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHomekit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HomeKit Accessory Suite")
+}
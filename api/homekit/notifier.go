@@ -0,0 +1,74 @@
+//go:build homekit
+// +build homekit
+
+package homekit
+
+import (
+	"os"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+	gphomekit "github.com/robdimsdale/garagepi/homekit"
+	"github.com/tedsuo/ifrit"
+)
+
+type notifier struct {
+	logger     lager.Logger
+	server     gphomekit.Server
+	subscriber events.Subscriber
+	accessory  *Accessory
+}
+
+// NewNotifier returns a runner which notifies server each time the state of
+// a door or the light changes.
+func NewNotifier(
+	logger lager.Logger,
+	server gphomekit.Server,
+	subscriber events.Subscriber,
+	accessory *Accessory,
+) ifrit.Runner {
+	return &notifier{
+		logger:     logger.Session("homekit-notifier"),
+		server:     server,
+		subscriber: subscriber,
+		accessory:  accessory,
+	}
+}
+
+func (n *notifier) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	sub := n.subscriber.Subscribe()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			sub.Stop()
+			return nil
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Events were missed, so notify the state of everything.
+				n.logger.Info("subscription ended - resubscribing")
+				sub = n.subscriber.Subscribe()
+				n.server.Notify(n.accessory.light)
+				for name := range n.accessory.doors {
+					n.notifyDoor(name)
+				}
+				continue
+			}
+
+			switch e.Type {
+			case events.TypeLight:
+				n.server.Notify(n.accessory.light)
+			case events.TypeDoorState, events.TypeInterlock:
+				n.notifyDoor(e.Door)
+			}
+		}
+	}
+}
+
+func (n *notifier) notifyDoor(name string) {
+	for _, c := range n.accessory.doors[name] {
+		n.server.Notify(c)
+	}
+}
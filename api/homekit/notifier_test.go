@@ -0,0 +1,126 @@
+//go:build homekit
+// +build homekit
+
+package homekit_test
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/homekit"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	gphomekit "github.com/robdimsdale/garagepi/homekit"
+	homekit_fakes "github.com/robdimsdale/garagepi/homekit/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Notifier", func() {
+	var (
+		fakeServer       *homekit_fakes.FakeServer
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		recorded         chan events.Event
+
+		accessory *homekit.Accessory
+
+		process ifrit.Process
+	)
+
+	notified := func() []string {
+		var types []string
+		for i := 0; i < fakeServer.NotifyCallCount(); i++ {
+			types = append(types, fakeServer.NotifyArgsForCall(i).Type)
+		}
+		return types
+	}
+
+	BeforeEach(func() {
+		fakeServer = new(homekit_fakes.FakeServer)
+
+		recorded = make(chan events.Event, 10)
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		fakeDoorHandler := new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoors := new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+
+		accessory = homekit.NewAccessory(
+			lagertest.NewTestLogger("homekit test"),
+			"Garage",
+			"dev",
+			new(light_fakes.FakeHandler),
+			fakeDoors,
+		)
+	})
+
+	JustBeforeEach(func() {
+		notifier := homekit.NewNotifier(
+			lagertest.NewTestLogger("homekit test"),
+			fakeServer,
+			fakeSubscriber,
+			accessory,
+		)
+		process = ifrit.Invoke(notifier)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		Expect(fakeSubscription.StopCallCount()).To(Equal(1))
+	})
+
+	It("notifies the light when it is switched", func() {
+		recorded <- events.Event{Type: events.TypeLight, State: "on"}
+		Eventually(notified).Should(Equal([]string{gphomekit.CharacteristicOn}))
+	})
+
+	It("notifies the door when its state changes or an interlock changes", func() {
+		recorded <- events.Event{Type: events.TypeDoorState, Door: "garage", State: "opening"}
+		Eventually(notified).Should(Equal([]string{
+			gphomekit.CharacteristicCurrentDoorState,
+			gphomekit.CharacteristicTargetDoorState,
+			gphomekit.CharacteristicObstructionDetected,
+		}))
+
+		recorded <- events.Event{Type: events.TypeInterlock, Door: "garage", Interlock: "car"}
+		Eventually(fakeServer.NotifyCallCount).Should(Equal(6))
+	})
+
+	It("ignores other events", func() {
+		recorded <- events.Event{Type: events.TypeLogin}
+		recorded <- events.Event{Type: events.TypeDoorState, Door: "unknown"}
+		Consistently(fakeServer.NotifyCallCount).Should(BeZero())
+	})
+
+	Context("when the subscription ends", func() {
+		BeforeEach(func() {
+			closed := new(events_fakes.FakeSubscription)
+			closedEvents := make(chan events.Event)
+			close(closedEvents)
+			closed.EventsReturns(closedEvents)
+
+			subscriptions := []events.Subscription{closed, fakeSubscription}
+			fakeSubscriber.SubscribeStub = func() events.Subscription {
+				s := subscriptions[0]
+				subscriptions = subscriptions[1:]
+				return s
+			}
+		})
+
+		It("resubscribes and notifies everything", func() {
+			Eventually(fakeServer.NotifyCallCount).Should(Equal(4))
+			Expect(fakeSubscriber.SubscribeCallCount()).To(Equal(2))
+		})
+	})
+})
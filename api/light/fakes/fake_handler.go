@@ -3,12 +3,24 @@ package fakes
 
 import (
 	"net/http"
+	"os"
 	"sync"
+	"time"
 
+	"github.com/robdimsdale/garagepi/api/events"
 	"github.com/robdimsdale/garagepi/api/light"
 )
 
 type FakeHandler struct {
+	RunStub        func(signals <-chan os.Signal, ready chan<- struct{}) error
+	runMutex       sync.RWMutex
+	runArgsForCall []struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}
+	runReturns struct {
+		result1 error
+	}
 	HandleGetStub        func(w http.ResponseWriter, r *http.Request)
 	handleGetMutex       sync.RWMutex
 	handleGetArgsForCall []struct {
@@ -28,6 +40,56 @@ type FakeHandler struct {
 		result1 *light.LightState
 		result2 error
 	}
+	TurnOnStub        func(duration time.Duration, source events.Source) light.LightState
+	turnOnMutex       sync.RWMutex
+	turnOnArgsForCall []struct {
+		duration time.Duration
+		source   events.Source
+	}
+	turnOnReturns struct {
+		result1 light.LightState
+	}
+	TurnOffStub        func(source events.Source) light.LightState
+	turnOffMutex       sync.RWMutex
+	turnOffArgsForCall []struct {
+		source events.Source
+	}
+	turnOffReturns struct {
+		result1 light.LightState
+	}
+}
+
+func (fake *FakeHandler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	fake.runMutex.Lock()
+	fake.runArgsForCall = append(fake.runArgsForCall, struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}{signals, ready})
+	fake.runMutex.Unlock()
+	if fake.RunStub != nil {
+		return fake.RunStub(signals, ready)
+	} else {
+		return fake.runReturns.result1
+	}
+}
+
+func (fake *FakeHandler) RunCallCount() int {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return len(fake.runArgsForCall)
+}
+
+func (fake *FakeHandler) RunArgsForCall(i int) (<-chan os.Signal, chan<- struct{}) {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return fake.runArgsForCall[i].signals, fake.runArgsForCall[i].ready
+}
+
+func (fake *FakeHandler) RunReturns(result1 error) {
+	fake.RunStub = nil
+	fake.runReturns = struct {
+		result1 error
+	}{result1}
 }
 
 func (fake *FakeHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
@@ -103,4 +165,69 @@ func (fake *FakeHandler) DiscoverLightStateReturns(result1 *light.LightState, re
 	}{result1, result2}
 }
 
+func (fake *FakeHandler) TurnOn(duration time.Duration, source events.Source) light.LightState {
+	fake.turnOnMutex.Lock()
+	fake.turnOnArgsForCall = append(fake.turnOnArgsForCall, struct {
+		duration time.Duration
+		source   events.Source
+	}{duration, source})
+	fake.turnOnMutex.Unlock()
+	if fake.TurnOnStub != nil {
+		return fake.TurnOnStub(duration, source)
+	} else {
+		return fake.turnOnReturns.result1
+	}
+}
+
+func (fake *FakeHandler) TurnOnCallCount() int {
+	fake.turnOnMutex.RLock()
+	defer fake.turnOnMutex.RUnlock()
+	return len(fake.turnOnArgsForCall)
+}
+
+func (fake *FakeHandler) TurnOnArgsForCall(i int) (time.Duration, events.Source) {
+	fake.turnOnMutex.RLock()
+	defer fake.turnOnMutex.RUnlock()
+	return fake.turnOnArgsForCall[i].duration, fake.turnOnArgsForCall[i].source
+}
+
+func (fake *FakeHandler) TurnOnReturns(result1 light.LightState) {
+	fake.TurnOnStub = nil
+	fake.turnOnReturns = struct {
+		result1 light.LightState
+	}{result1}
+}
+
+func (fake *FakeHandler) TurnOff(source events.Source) light.LightState {
+	fake.turnOffMutex.Lock()
+	fake.turnOffArgsForCall = append(fake.turnOffArgsForCall, struct {
+		source events.Source
+	}{source})
+	fake.turnOffMutex.Unlock()
+	if fake.TurnOffStub != nil {
+		return fake.TurnOffStub(source)
+	} else {
+		return fake.turnOffReturns.result1
+	}
+}
+
+func (fake *FakeHandler) TurnOffCallCount() int {
+	fake.turnOffMutex.RLock()
+	defer fake.turnOffMutex.RUnlock()
+	return len(fake.turnOffArgsForCall)
+}
+
+func (fake *FakeHandler) TurnOffArgsForCall(i int) events.Source {
+	fake.turnOffMutex.RLock()
+	defer fake.turnOffMutex.RUnlock()
+	return fake.turnOffArgsForCall[i].source
+}
+
+func (fake *FakeHandler) TurnOffReturns(result1 light.LightState) {
+	fake.TurnOffStub = nil
+	fake.turnOffReturns = struct {
+		result1 light.LightState
+	}{result1}
+}
+
 var _ light.Handler = new(FakeHandler)
@@ -3,37 +3,81 @@ package light
 import (
 	"encoding/json"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/audit"
+	"github.com/robdimsdale/garagepi/api/events"
 	"github.com/robdimsdale/garagepi/gpio"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
 )
 
 //go:generate counterfeiter . Handler
 
+// Handler switches the light, and as an ifrit.Runner switches it off
+// again once its on-time has elapsed.
 type Handler interface {
+	ifrit.Runner
 	HandleGet(w http.ResponseWriter, r *http.Request)
 	HandleSet(w http.ResponseWriter, r *http.Request)
 	DiscoverLightState() (*LightState, error)
+	TurnOn(duration time.Duration, source events.Source) LightState
+	TurnOff(source events.Source) LightState
 }
 
 type handler struct {
 	logger       lager.Logger
+	clock        gpos.OSHelper
 	gpio         gpio.Gpio
 	gpioLightPin uint
+	maxOnTime    time.Duration
+	interval     time.Duration
+	recorder     events.Recorder
+	trail        audit.Trail
+
+	timer *offTimer
+}
+
+// offTimer is the time at which the light will be switched off.
+// It is zero if no switch-off is pending.
+type offTimer struct {
+	mutex sync.Mutex
+	offAt time.Time
 }
 
+// NewHandler returns a handler for the light on gpioLightPin.
+// If maxOnTime is positive the light is switched off once it has been on for
+// maxOnTime, however it was switched on; otherwise it is only switched off
+// automatically if it was switched on for a duration.
+// interval is how often the light is checked.
+// Each time the light is switched on or off it is recorded with recorder.
+// Each request to switch it on or off, and who made it, is recorded with trail.
 func NewHandler(
 	logger lager.Logger,
+	clock gpos.OSHelper,
 	gpio gpio.Gpio,
 	gpioLightPin uint,
+	maxOnTime time.Duration,
+	interval time.Duration,
+	recorder events.Recorder,
+	trail audit.Trail,
 ) Handler {
 
 	return &handler{
 		logger:       logger,
+		clock:        clock,
 		gpio:         gpio,
 		gpioLightPin: gpioLightPin,
+		maxOnTime:    maxOnTime,
+		interval:     interval,
+		recorder:     recorder,
+		trail:        trail,
+		timer:        &offTimer{},
 	}
 }
 
@@ -41,6 +85,11 @@ type LightState struct {
 	StateKnown bool
 	LightOn    bool
 	ErrorMsg   string
+
+	// OffAt and RemainingSeconds are only set if the light is on
+	// and will be switched off automatically.
+	OffAt            *time.Time `json:",omitempty"`
+	RemainingSeconds int        `json:",omitempty"`
 }
 
 func (l LightState) StateString() string {
@@ -54,6 +103,67 @@ func (l LightState) StateString() string {
 	return "off"
 }
 
+func (h handler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			h.check()
+		}
+	}
+}
+
+func (h handler) check() {
+	h.timer.mutex.Lock()
+	defer h.timer.mutex.Unlock()
+
+	lightOn, err := h.read()
+	if err != nil {
+		h.logger.Debug("error reading light state - not checking auto-off", lager.Data{"error": err.Error()})
+		return
+	}
+
+	now := h.clock.Now()
+
+	switch {
+	case !lightOn:
+		h.timer.offAt = time.Time{}
+
+	case h.timer.offAt.IsZero():
+		if h.maxOnTime > 0 {
+			h.logger.Info("light is on without auto-off - switching off after max on-time", lager.Data{"maxOnTime": h.maxOnTime.String()})
+			h.timer.offAt = now.Add(h.maxOnTime)
+		}
+
+	case !now.Before(h.timer.offAt):
+		h.logger.Info("auto-off time reached - turning light off", lager.Data{"offAt": h.timer.offAt})
+		h.timer.offAt = time.Time{}
+
+		// Automatic switch-offs, including after the max on-time, are
+		// attributed to the system by the empty source.
+		err := h.gpio.WriteLow(h.gpioLightPin)
+		if err != nil {
+			h.logger.Error("error turning light off - retrying", err)
+			h.trail.Record(audit.NewEntry(events.Source{}, audit.ActionLightOff, audit.TargetLight, audit.ResultError))
+			h.timer.offAt = now.Add(h.interval)
+			return
+		}
+
+		h.trail.Record(audit.NewEntry(events.Source{}, audit.ActionLightOff, audit.TargetLight, audit.ResultOK))
+		h.recorder.Record(events.Event{
+			Type:  events.TypeLight,
+			State: "off",
+			Cause: "auto-off",
+		})
+	}
+}
+
 func (h handler) HandleGet(w http.ResponseWriter, r *http.Request) {
 	ls, err := h.DiscoverLightState()
 	if err != nil {
@@ -65,14 +175,8 @@ func (h handler) HandleGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h handler) DiscoverLightState() (*LightState, error) {
-	h.logger.Info("reading light state")
-	state, err := h.gpio.Read(h.gpioLightPin)
-	if err != nil {
-		return &LightState{StateKnown: false, LightOn: false}, err
-	}
-	state = strings.TrimSpace(state)
-
-	lightOn, err := strconv.ParseBool(state)
+	h.logger.Debug("reading light state")
+	lightOn, err := h.read()
 	if err != nil {
 		return &LightState{StateKnown: false, LightOn: false}, err
 	}
@@ -81,16 +185,50 @@ func (h handler) DiscoverLightState() (*LightState, error) {
 		StateKnown: true,
 		LightOn:    lightOn,
 	}
+
+	if lightOn {
+		h.setRemaining(ls)
+	}
+
 	h.logger.Debug("light state discovered", lager.Data{"state": ls.StateString()})
 	return ls, nil
 }
 
+func (h handler) read() (bool, error) {
+	state, err := h.gpio.Read(h.gpioLightPin)
+	if err != nil {
+		return false, err
+	}
+	state = strings.TrimSpace(state)
+
+	return strconv.ParseBool(state)
+}
+
+// setRemaining sets the time at which the light will be switched off, if any.
+func (h handler) setRemaining(ls *LightState) {
+	h.timer.mutex.Lock()
+	offAt := h.timer.offAt
+	h.timer.mutex.Unlock()
+
+	if offAt.IsZero() {
+		return
+	}
+
+	remaining := offAt.Sub(h.clock.Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	ls.OffAt = &offAt
+	ls.RemainingSeconds = int((remaining + time.Second - 1) / time.Second)
+}
+
 func (h handler) HandleSet(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		h.logger.Error("error parsing form - assuming light should be turned on.", err)
 
-		ls := h.turnLightOn()
+		ls := h.TurnOn(0, events.RequestSource(r))
 		renderLightState(ls, w)
 
 		return
@@ -98,25 +236,38 @@ func (h handler) HandleSet(w http.ResponseWriter, r *http.Request) {
 
 	state := r.Form.Get("state")
 
+	var duration time.Duration
+	if d := r.Form.Get("duration"); d != "" && state != "off" {
+		duration, err = time.ParseDuration(d)
+		if err != nil || duration <= 0 {
+			h.logger.Info("invalid duration provided", lager.Data{"duration": d})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("invalid duration: " + d))
+			return
+		}
+	}
+
+	source := events.RequestSource(r)
+
 	if state == "" {
 		h.logger.Info("no state provided - assuming light should be turned on.")
-		ls := h.turnLightOn()
+		ls := h.TurnOn(duration, source)
 		renderLightState(ls, w)
 		return
 	}
 
 	switch state {
 	case "off":
-		ls := h.turnLightOff()
+		ls := h.TurnOff(source)
 		renderLightState(ls, w)
 		return
 	case "on":
-		ls := h.turnLightOn()
+		ls := h.TurnOn(duration, source)
 		renderLightState(ls, w)
 		return
 	default:
 		h.logger.Info("invalid state provided - assuming light should be turned on.", lager.Data{"state": state})
-		ls := h.turnLightOn()
+		ls := h.TurnOn(duration, source)
 		renderLightState(ls, w)
 		return
 	}
@@ -127,12 +278,36 @@ func renderLightState(ls LightState, w http.ResponseWriter) {
 	w.Write(b)
 }
 
-func (h handler) turnLightOn() LightState {
-	h.logger.Info("turning light on")
+// TurnOn switches the light off again after duration, or after the
+// max on-time if that is shorter or no duration is provided.
+// The light being switched on is recorded as caused by source.
+func (h handler) TurnOn(duration time.Duration, source events.Source) LightState {
+	if h.maxOnTime > 0 && (duration == 0 || duration > h.maxOnTime) {
+		if duration > h.maxOnTime {
+			h.logger.Info("duration exceeds max on-time - using max on-time", lager.Data{
+				"duration":  duration.String(),
+				"maxOnTime": h.maxOnTime.String(),
+			})
+		}
+		duration = h.maxOnTime
+	}
+
+	h.logger.Info("turning light on", lager.Data{"duration": duration.String()})
+
+	h.timer.mutex.Lock()
 	err := h.gpio.WriteHigh(h.gpioLightPin)
+	if err == nil {
+		if duration > 0 {
+			h.timer.offAt = h.clock.Now().Add(duration)
+		} else {
+			h.timer.offAt = time.Time{}
+		}
+	}
+	h.timer.mutex.Unlock()
 
 	if err != nil {
 		h.logger.Error("error turning light on", err)
+		h.trail.Record(audit.NewEntry(source, audit.ActionLightOn, audit.TargetLight, audit.ResultError))
 		return LightState{
 			StateKnown: false,
 			LightOn:    false,
@@ -141,18 +316,36 @@ func (h handler) turnLightOn() LightState {
 	}
 
 	h.logger.Info("light is turned on")
-	return LightState{
+	h.trail.Record(audit.NewEntry(source, audit.ActionLightOn, audit.TargetLight, audit.ResultOK))
+	h.recorder.Record(events.Event{
+		Type:   events.TypeLight,
+		State:  "on",
+		Source: source,
+	})
+
+	ls := LightState{
 		StateKnown: true,
 		LightOn:    true,
 	}
+	h.setRemaining(&ls)
+	return ls
 }
 
-func (h handler) turnLightOff() LightState {
+// TurnOff cancels any pending switch-off.
+func (h handler) TurnOff(source events.Source) LightState {
 	h.logger.Info("turning light off")
+
+	h.timer.mutex.Lock()
 	err := h.gpio.WriteLow(h.gpioLightPin)
+	if err == nil && !h.timer.offAt.IsZero() {
+		h.logger.Info("cancelling light auto-off", lager.Data{"offAt": h.timer.offAt})
+		h.timer.offAt = time.Time{}
+	}
+	h.timer.mutex.Unlock()
 
 	if err != nil {
 		h.logger.Error("error turning light off", err)
+		h.trail.Record(audit.NewEntry(source, audit.ActionLightOff, audit.TargetLight, audit.ResultError))
 		return LightState{
 			StateKnown: false,
 			LightOn:    false,
@@ -161,6 +354,13 @@ func (h handler) turnLightOff() LightState {
 	}
 
 	h.logger.Info("light is turned off")
+	h.trail.Record(audit.NewEntry(source, audit.ActionLightOff, audit.TargetLight, audit.ResultOK))
+	h.recorder.Record(events.Event{
+		Type:   events.TypeLight,
+		State:  "off",
+		Source: source,
+	})
+
 	return LightState{
 		StateKnown: true,
 		LightOn:    false,
@@ -6,14 +6,24 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"sync"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/audit"
+	audit_fakes "github.com/robdimsdale/garagepi/api/audit/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
 	"github.com/robdimsdale/garagepi/api/light"
 	test_helpers_fakes "github.com/robdimsdale/garagepi/fakes"
 	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/tedsuo/ifrit"
 )
 
 const (
@@ -23,6 +33,9 @@ const (
 var (
 	fakeLogger         lager.Logger
 	fakeGpio           *gpio_fakes.FakeGpio
+	fakeOSHelper       *os_fakes.FakeOSHelper
+	fakeRecorder       *events_fakes.FakeRecorder
+	fakeTrail          *audit_fakes.FakeTrail
 	fakeResponseWriter *test_helpers_fakes.FakeResponseWriter
 
 	dummyRequest *http.Request
@@ -42,12 +55,20 @@ var _ = Describe("Light", func() {
 
 		fakeLogger = lagertest.NewTestLogger("light test")
 		fakeGpio = new(gpio_fakes.FakeGpio)
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeRecorder = new(events_fakes.FakeRecorder)
+		fakeTrail = new(audit_fakes.FakeTrail)
 		fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
 
 		lh = light.NewHandler(
 			fakeLogger,
+			fakeOSHelper,
 			fakeGpio,
 			gpioLightPin,
+			0,
+			time.Millisecond,
+			fakeRecorder,
+			fakeTrail,
 		)
 
 		dummyRequest = new(http.Request)
@@ -263,6 +284,31 @@ var _ = Describe("Light", func() {
 					Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
 					Expect(fakeResponseWriter.WriteArgsForCall(0)).To(Equal(expectedReturn))
 				})
+
+				It("Should record the light being switched on with the client IP of the request", func() {
+					dummyRequest.RemoteAddr = "192.168.1.10:54321"
+					lh.HandleSet(fakeResponseWriter, dummyRequest)
+
+					Expect(fakeRecorder.RecordCallCount()).To(Equal(1))
+					Expect(fakeRecorder.RecordArgsForCall(0)).To(Equal(events.Event{
+						Type:   events.TypeLight,
+						State:  "on",
+						Source: events.Source{ClientIP: "192.168.1.10"},
+					}))
+				})
+
+				It("Should audit the request with its client IP", func() {
+					dummyRequest.RemoteAddr = "192.168.1.10:54321"
+					lh.HandleSet(fakeResponseWriter, dummyRequest)
+
+					Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+					Expect(fakeTrail.RecordArgsForCall(0)).To(Equal(audit.Entry{
+						ClientIP: "192.168.1.10",
+						Action:   audit.ActionLightOn,
+						Target:   audit.TargetLight,
+						Result:   audit.ResultOK,
+					}))
+				})
 			})
 		})
 
@@ -304,6 +350,19 @@ var _ = Describe("Light", func() {
 					Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
 					Expect(fakeResponseWriter.WriteArgsForCall(0)).To(Equal(expectedReturn))
 				})
+
+				It("Should not record the light being switched off", func() {
+					lh.HandleSet(fakeResponseWriter, dummyRequest)
+					Expect(fakeRecorder.RecordCallCount()).To(Equal(0))
+				})
+
+				It("Should audit the failed request", func() {
+					lh.HandleSet(fakeResponseWriter, dummyRequest)
+
+					Expect(fakeTrail.RecordCallCount()).To(Equal(1))
+					Expect(fakeTrail.RecordArgsForCall(0).Action).To(Equal(audit.ActionLightOff))
+					Expect(fakeTrail.RecordArgsForCall(0).Result).To(Equal(audit.ResultError))
+				})
 			})
 
 			Context("When turning off light command return sucessfully", func() {
@@ -324,4 +383,201 @@ var _ = Describe("Light", func() {
 			})
 		})
 	})
+
+	Describe("Switching off automatically", func() {
+		const maxOnTime = time.Hour
+
+		var (
+			start time.Time
+
+			mutex   sync.Mutex
+			now     time.Time
+			lightOn bool
+		)
+
+		setNow := func(t time.Time) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			now = t
+		}
+
+		setLightOn := func(on bool) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			lightOn = on
+		}
+
+		lightState := func() light.LightState {
+			Expect(fakeResponseWriter.WriteCallCount()).To(Equal(1))
+
+			var ls light.LightState
+			err := json.Unmarshal(fakeResponseWriter.WriteArgsForCall(0), &ls)
+			Expect(err).NotTo(HaveOccurred())
+			return ls
+		}
+
+		set := func(query string) light.LightState {
+			u, err := url.Parse("/?" + query)
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
+			lh.HandleSet(fakeResponseWriter, &http.Request{URL: u})
+			return lightState()
+		}
+
+		get := func() light.LightState {
+			fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
+			lh.HandleGet(fakeResponseWriter, dummyRequest)
+			return lightState()
+		}
+
+		BeforeEach(func() {
+			start = time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+			setNow(start)
+			fakeOSHelper.NowStub = func() time.Time {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return now
+			}
+
+			setLightOn(false)
+			fakeGpio.WriteHighStub = func(uint) error {
+				setLightOn(true)
+				return nil
+			}
+			fakeGpio.WriteLowStub = func(uint) error {
+				setLightOn(false)
+				return nil
+			}
+			fakeGpio.ReadStub = func(uint) (string, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				if lightOn {
+					return "1", nil
+				}
+				return "0", nil
+			}
+
+			lh = light.NewHandler(
+				fakeLogger,
+				fakeOSHelper,
+				fakeGpio,
+				gpioLightPin,
+				maxOnTime,
+				time.Millisecond,
+				fakeRecorder,
+				fakeTrail,
+			)
+		})
+
+		It("Should report the remaining time when turned on for a duration", func() {
+			ls := set("state=on&duration=10m")
+			Expect(ls.LightOn).To(BeTrue())
+			Expect(ls.RemainingSeconds).To(Equal(600))
+			Expect(*ls.OffAt).To(Equal(start.Add(10 * time.Minute)))
+
+			setNow(start.Add(4 * time.Minute))
+			Expect(get().RemainingSeconds).To(Equal(360))
+		})
+
+		It("Should limit the duration to the max on-time", func() {
+			ls := set("state=on&duration=2h")
+			Expect(*ls.OffAt).To(Equal(start.Add(maxOnTime)))
+		})
+
+		It("Should use the max on-time when no duration is provided", func() {
+			ls := set("state=on")
+			Expect(*ls.OffAt).To(Equal(start.Add(maxOnTime)))
+		})
+
+		It("Should reject an invalid duration without switching the light", func() {
+			u, err := url.Parse("/?state=on&duration=soon")
+			Expect(err).NotTo(HaveOccurred())
+
+			lh.HandleSet(fakeResponseWriter, &http.Request{URL: u})
+			Expect(fakeResponseWriter.WriteHeaderArgsForCall(0)).To(Equal(http.StatusBadRequest))
+			Expect(fakeGpio.WriteHighCallCount()).To(Equal(0))
+		})
+
+		It("Should not report a remaining time when the light is off", func() {
+			ls := get()
+			Expect(ls.OffAt).To(BeNil())
+			Expect(ls.RemainingSeconds).To(Equal(0))
+		})
+
+		It("Should cancel the pending switch-off when turned off by hand", func() {
+			set("state=on&duration=10m")
+			set("state=off")
+			Expect(fakeLogger.(*lagertest.TestLogger).Buffer()).To(gbytes.Say("cancelling light auto-off"))
+
+			set("state=on&duration=20m")
+			Expect(*get().OffAt).To(Equal(start.Add(20 * time.Minute)))
+		})
+
+		Context("When running", func() {
+			var process ifrit.Process
+
+			JustBeforeEach(func() {
+				process = ifrit.Invoke(lh)
+			})
+
+			AfterEach(func() {
+				process.Signal(os.Interrupt)
+				Eventually(process.Wait()).Should(Receive())
+			})
+
+			It("Should switch the light off once the duration has elapsed", func() {
+				set("state=on&duration=10m")
+				Consistently(fakeGpio.WriteLowCallCount).Should(Equal(0))
+
+				setNow(start.Add(10 * time.Minute))
+				Eventually(fakeGpio.WriteLowCallCount).Should(Equal(1))
+				Expect(get().LightOn).To(BeFalse())
+
+				Eventually(fakeRecorder.RecordCallCount).Should(Equal(2))
+				Expect(fakeRecorder.RecordArgsForCall(1)).To(Equal(events.Event{
+					Type:  events.TypeLight,
+					State: "off",
+					Cause: "auto-off",
+				}))
+
+				Eventually(fakeTrail.RecordCallCount).Should(Equal(2))
+				Expect(fakeTrail.RecordArgsForCall(1)).To(Equal(audit.Entry{
+					Action: audit.ActionLightOff,
+					Target: audit.TargetLight,
+					Result: audit.ResultOK,
+				}))
+			})
+
+			It("Should switch the light off after the max on-time when switched on by other means", func() {
+				setLightOn(true)
+				Eventually(func() *time.Time {
+					return get().OffAt
+				}).ShouldNot(BeNil())
+
+				setNow(start.Add(maxOnTime))
+				Eventually(fakeGpio.WriteLowCallCount).Should(Equal(1))
+
+				Eventually(fakeTrail.RecordCallCount).Should(Equal(1))
+				Expect(fakeTrail.RecordArgsForCall(0).Action).To(Equal(audit.ActionLightOff))
+				Expect(fakeTrail.RecordArgsForCall(0).Principal).To(BeEmpty())
+			})
+
+			Context("When switching the light off fails", func() {
+				BeforeEach(func() {
+					fakeGpio.WriteLowStub = nil
+					fakeGpio.WriteLowReturns(errors.New("gpio error"))
+				})
+
+				It("Should audit the failed switch-off", func() {
+					set("state=on&duration=10m")
+					setNow(start.Add(10 * time.Minute))
+
+					Eventually(fakeTrail.RecordCallCount).Should(BeNumerically(">=", 2))
+					Expect(fakeTrail.RecordArgsForCall(1).Action).To(Equal(audit.ActionLightOff))
+					Expect(fakeTrail.RecordArgsForCall(1).Result).To(Equal(audit.ResultError))
+				})
+			})
+		})
+	})
 })
@@ -0,0 +1,126 @@
+// Package metrics exposes the state of the doors and the light, and counts
+// door toggles, as metrics.
+package metrics
+
+import (
+	"os"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/light"
+	gpmetrics "github.com/robdimsdale/garagepi/metrics"
+	"github.com/tedsuo/ifrit"
+)
+
+// States are the values of the state label of garagepi_door_state.
+var States = []door.State{
+	door.StateUnknown,
+	door.StateOpen,
+	door.StateClosed,
+	door.StateOpening,
+	door.StateClosing,
+	door.StateStopped,
+	door.StateStuck,
+}
+
+type collector struct {
+	logger     lager.Logger
+	subscriber events.Subscriber
+	toggles    *gpmetrics.Counter
+}
+
+// NewCollector registers gauges of the state of doors and lightHandler with
+// registry, which are read each time the metrics are scraped. It returns a
+// runner which counts the toggles of each door by their result.
+func NewCollector(
+	logger lager.Logger,
+	registry *gpmetrics.Registry,
+	subscriber events.Subscriber,
+	doors door.Doors,
+	lightHandler light.Handler,
+) ifrit.Runner {
+	registry.NewGaugeFunc(
+		"garagepi_door_state",
+		"State of each door: 1 for its current state, otherwise 0.",
+		[]string{"door", "state"},
+		func() []gpmetrics.Sample {
+			return doorStates(doors)
+		},
+	)
+
+	registry.NewGaugeFunc(
+		"garagepi_light_on",
+		"Whether the light is on. Omitted if the light cannot be read.",
+		nil,
+		func() []gpmetrics.Sample {
+			ls, err := lightHandler.DiscoverLightState()
+			if err != nil || !ls.StateKnown {
+				return nil
+			}
+			return []gpmetrics.Sample{{Value: boolValue(ls.LightOn)}}
+		},
+	)
+
+	return &collector{
+		logger:     logger.Session("metrics"),
+		subscriber: subscriber,
+		toggles: registry.NewCounter(
+			"garagepi_door_toggles_total",
+			"Requests to toggle each door, by result.",
+			"door", "result",
+		),
+	}
+}
+
+func doorStates(doors door.Doors) []gpmetrics.Sample {
+	var samples []gpmetrics.Sample
+	for _, h := range doors.All() {
+		// The state machine's state is returned even if the sensor
+		// cannot be read.
+		current := door.StateUnknown
+		ds, _ := h.DiscoverDoorState()
+		if ds != nil {
+			current = ds.State
+		}
+
+		for _, s := range States {
+			samples = append(samples, gpmetrics.Sample{
+				LabelValues: []string{h.Name(), string(s)},
+				Value:       boolValue(s == current),
+			})
+		}
+	}
+	return samples
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (c *collector) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	sub := c.subscriber.Subscribe()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			sub.Stop()
+			return nil
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				c.logger.Error("subscription ended - door toggles were missed", nil)
+				sub = c.subscriber.Subscribe()
+				continue
+			}
+
+			if e.Type == events.TypeDoorToggle {
+				c.toggles.Inc(e.Door, e.Result)
+			}
+		}
+	}
+}
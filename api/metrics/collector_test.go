@@ -0,0 +1,116 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	"github.com/robdimsdale/garagepi/api/metrics"
+	gpmetrics "github.com/robdimsdale/garagepi/metrics"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Collector", func() {
+	var (
+		registry         *gpmetrics.Registry
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		recorded         chan events.Event
+		fakeDoorHandler  *door_fakes.FakeHandler
+		fakeLightHandler *light_fakes.FakeHandler
+
+		process ifrit.Process
+	)
+
+	scrape := func() string {
+		buf := new(bytes.Buffer)
+		Expect(registry.Write(buf)).To(Succeed())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		registry = gpmetrics.NewRegistry()
+
+		recorded = make(chan events.Event, 10)
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateOpen}, nil)
+		fakeDoors := new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+
+		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: true}, nil)
+
+		collector := metrics.NewCollector(
+			lagertest.NewTestLogger("metrics test"),
+			registry,
+			fakeSubscriber,
+			fakeDoors,
+			fakeLightHandler,
+		)
+		process = ifrit.Invoke(collector)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	})
+
+	It("exposes the current state of each door", func() {
+		output := scrape()
+		Expect(output).To(ContainSubstring(`garagepi_door_state{door="garage",state="open"} 1` + "\n"))
+		Expect(output).To(ContainSubstring(`garagepi_door_state{door="garage",state="closed"} 0` + "\n"))
+		Expect(output).To(ContainSubstring(`garagepi_door_state{door="garage",state="unknown"} 0` + "\n"))
+	})
+
+	It("exposes the state machine's state if the sensor cannot be read", func() {
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosing}, errors.New("read failed"))
+
+		Expect(scrape()).To(ContainSubstring(`garagepi_door_state{door="garage",state="closing"} 1` + "\n"))
+	})
+
+	It("exposes whether the light is on", func() {
+		Expect(scrape()).To(ContainSubstring("garagepi_light_on 1\n"))
+
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: false}, nil)
+		Expect(scrape()).To(ContainSubstring("garagepi_light_on 0\n"))
+	})
+
+	It("omits the light if its state is unknown", func() {
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: false}, errors.New("read failed"))
+
+		output := scrape()
+		Expect(output).To(ContainSubstring("# TYPE garagepi_light_on gauge\n"))
+		Expect(output).NotTo(ContainSubstring("garagepi_light_on 0"))
+	})
+
+	It("counts door toggles by result", func() {
+		recorded <- events.Event{Type: events.TypeDoorToggle, Door: "garage", Result: "pulsed"}
+		recorded <- events.Event{Type: events.TypeDoorToggle, Door: "garage", Result: "pulsed"}
+		recorded <- events.Event{Type: events.TypeDoorToggle, Door: "garage", Result: "busy"}
+		recorded <- events.Event{Type: events.TypeDoorState, Door: "garage", State: "opening"}
+
+		Eventually(scrape).Should(ContainSubstring(`garagepi_door_toggles_total{door="garage",result="pulsed"} 2` + "\n"))
+		Expect(scrape()).To(ContainSubstring(`garagepi_door_toggles_total{door="garage",result="busy"} 1` + "\n"))
+	})
+
+	It("resubscribes if the subscription ends", func() {
+		close(recorded)
+		Eventually(fakeSubscriber.SubscribeCallCount).Should(BeNumerically(">=", 2))
+	})
+})
@@ -0,0 +1,508 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/light"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
+)
+
+var ErrUnknownRule = errors.New("unknown rule")
+
+//go:generate counterfeiter . Engine
+
+// Engine evaluates rules when their triggers fire.
+type Engine interface {
+	ifrit.Runner
+	Statuses() []Status
+	SetEnabled(name string, enabled bool) (Status, error)
+	DryRun(name string) (Evaluation, error)
+	Evaluate(r Rule, cause string) Evaluation
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleSet(w http.ResponseWriter, r *http.Request)
+	HandleDryRun(w http.ResponseWriter, r *http.Request)
+}
+
+//go:generate counterfeiter . Notifier
+
+// Notifier delivers the messages of notify actions.
+type Notifier interface {
+	Notify(rule string, message string) error
+}
+
+type eventNotifier struct {
+	logger   lager.Logger
+	recorder events.Recorder
+}
+
+// NewEventNotifier returns a notifier which logs messages and records them as
+// notification events, which are delivered to the webhooks which want them.
+func NewEventNotifier(logger lager.Logger, recorder events.Recorder) Notifier {
+	return &eventNotifier{
+		logger:   logger,
+		recorder: recorder,
+	}
+}
+
+func (n eventNotifier) Notify(rule string, message string) error {
+	n.logger.Info("notification", lager.Data{"rule": rule, "message": message})
+	n.recorder.Record(events.Event{
+		Type:    events.TypeNotification,
+		Rule:    rule,
+		Message: message,
+	})
+	return nil
+}
+
+// Evaluation is the outcome of a trigger firing for a rule.
+type Evaluation struct {
+	At            time.Time         `json:"at"`
+	Cause         string            `json:"cause"`
+	DryRun        bool              `json:"dryRun"`
+	ConditionsMet bool              `json:"conditionsMet"`
+	Conditions    []ConditionResult `json:"conditions,omitempty"`
+	Actions       []ActionResult    `json:"actions,omitempty"`
+}
+
+type ConditionResult struct {
+	Condition Condition `json:"condition"`
+	Met       bool      `json:"met"`
+	ErrorMsg  string    `json:"errorMsg,omitempty"`
+}
+
+// ActionResult reports whether an action was performed. Actions are not
+// performed in dry-run mode, or if any condition was not met.
+type ActionResult struct {
+	Action    Action `json:"action"`
+	Performed bool   `json:"performed"`
+	Result    string `json:"result,omitempty"`
+	ErrorMsg  string `json:"errorMsg,omitempty"`
+}
+
+type Status struct {
+	Rule
+	Enabled        bool        `json:"enabled"`
+	LastEvaluation *Evaluation `json:"lastEvaluation,omitempty"`
+}
+
+type rule struct {
+	Rule
+	enabled        bool
+	lastEvaluation *Evaluation
+}
+
+type engine struct {
+	logger     lager.Logger
+	clock      gpos.OSHelper
+	doors      door.Doors
+	light      light.Handler
+	gpio       gpio.Gpio
+	subscriber events.Subscriber
+	notifier   Notifier
+	interval   time.Duration
+	dryRun     bool
+
+	mutex sync.Mutex
+	rules []*rule
+
+	// only accessed by Run
+	lightOn   *bool
+	lastCheck time.Time
+}
+
+type inputEvent struct {
+	rule  *rule
+	event gpio.Event
+}
+
+// NewEngine returns an engine which fires door and light triggers as their
+// events are delivered by the subscriber, input triggers as soon as a watched
+// input changes and time triggers when their time is passed at one of the
+// checks made every interval.
+// If dryRun is true, rules are evaluated but their actions are not performed.
+func NewEngine(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	doors door.Doors,
+	light light.Handler,
+	gpio gpio.Gpio,
+	subscriber events.Subscriber,
+	notifier Notifier,
+	rules []Rule,
+	interval time.Duration,
+	dryRun bool,
+) Engine {
+	e := &engine{
+		logger:     logger,
+		clock:      clock,
+		doors:      doors,
+		light:      light,
+		gpio:       gpio,
+		subscriber: subscriber,
+		notifier:   notifier,
+		interval:   interval,
+		dryRun:     dryRun,
+	}
+
+	for _, r := range rules {
+		e.rules = append(e.rules, &rule{
+			Rule:    r,
+			enabled: !r.Disabled,
+		})
+	}
+
+	return e
+}
+
+func (e *engine) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	inputs := make(chan inputEvent)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	for _, r := range e.rules {
+		if r.Trigger.Type != TriggerInput {
+			continue
+		}
+
+		edge := r.Trigger.Edge
+		if edge == "" {
+			edge = gpio.EdgeBoth
+		}
+
+		w, err := e.gpio.Watch(r.Trigger.Pin, edge, time.Duration(r.Trigger.Debounce))
+		if err != nil {
+			e.logger.Error("error watching input - rule will not fire", err, lager.Data{"rule": r.Name, "pin": r.Trigger.Pin})
+			continue
+		}
+		defer w.Stop()
+
+		go forwardInputs(r, w, inputs, stop)
+	}
+
+	sub := e.subscriber.Subscribe()
+	defer func() { sub.Stop() }()
+
+	e.lastCheck = e.clock.Now()
+
+	ls, err := e.light.DiscoverLightState()
+	if err == nil && ls.StateKnown {
+		e.lightOn = &ls.LightOn
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case in := <-inputs:
+			e.fire(in.rule, fmt.Sprintf("input %d %s", in.event.Pin, in.event.Edge))
+		case event, ok := <-sub.Events():
+			if !ok {
+				e.logger.Error("subscription ended - door and light triggers may have been missed", nil)
+				sub = e.subscriber.Subscribe()
+				continue
+			}
+			e.observe(event)
+		case <-ticker.C:
+			e.checkTimes()
+		}
+	}
+}
+
+func forwardInputs(r *rule, w gpio.Watch, inputs chan<- inputEvent, stop <-chan struct{}) {
+	for event := range w.Events() {
+		select {
+		case inputs <- inputEvent{rule: r, event: event}:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// observe fires the rules triggered by a change of the state of a door or
+// the light.
+func (e *engine) observe(event events.Event) {
+	switch event.Type {
+	case events.TypeDoorState:
+		for _, r := range e.rules {
+			t := r.Trigger
+			if t.Type == TriggerDoor &&
+				(t.Door == "" || t.Door == event.Door) &&
+				(t.State == "" || t.State == event.State) {
+				e.fire(r, fmt.Sprintf("door %s %s", event.Door, event.State))
+			}
+		}
+
+	case events.TypeLight:
+		on := event.State == LightOn
+
+		// Switching the light on when it is already on is not a change.
+		previous := e.lightOn
+		e.lightOn = &on
+		if previous != nil && *previous == on {
+			return
+		}
+
+		for _, r := range e.rules {
+			t := r.Trigger
+			if t.Type == TriggerLight && (t.State == "" || t.State == event.State) {
+				e.fire(r, fmt.Sprintf("light %s", event.State))
+			}
+		}
+	}
+}
+
+// checkTimes fires the rules whose time of day has passed since the last check.
+func (e *engine) checkTimes() {
+	now := e.clock.Now()
+	last := e.lastCheck
+	e.lastCheck = now
+
+	for _, r := range e.rules {
+		if r.Trigger.Type != TriggerTime {
+			continue
+		}
+
+		at := r.Trigger.At.On(now)
+		if last.Before(at) && !now.Before(at) {
+			e.fire(r, fmt.Sprintf("time %s", timeOfDay(*r.Trigger.At)))
+		}
+	}
+}
+
+func (e *engine) fire(r *rule, cause string) {
+	e.mutex.Lock()
+	enabled := r.enabled
+	e.mutex.Unlock()
+
+	if !enabled {
+		e.logger.Debug("rule disabled - not evaluating", lager.Data{"rule": r.Name, "cause": cause})
+		return
+	}
+
+	e.logger.Info("rule triggered", lager.Data{"rule": r.Name, "cause": cause})
+
+	evaluation := e.evaluate(r.Rule, cause, e.dryRun)
+
+	e.mutex.Lock()
+	r.lastEvaluation = &evaluation
+	e.mutex.Unlock()
+}
+
+// evaluate checks the conditions of the rule and, if they are all met
+// and dryRun is false, performs its actions.
+func (e *engine) evaluate(r Rule, cause string, dryRun bool) Evaluation {
+	logger := e.logger.WithData(lager.Data{"rule": r.Name})
+
+	evaluation := Evaluation{
+		At:            e.clock.Now(),
+		Cause:         cause,
+		DryRun:        dryRun,
+		ConditionsMet: true,
+	}
+
+	for _, c := range r.Conditions {
+		result := e.checkCondition(c, evaluation.At)
+		evaluation.Conditions = append(evaluation.Conditions, result)
+		if !result.Met {
+			evaluation.ConditionsMet = false
+		}
+	}
+
+	for _, a := range r.Actions {
+		result := ActionResult{Action: a}
+
+		switch {
+		case !evaluation.ConditionsMet:
+			result.Result = "conditions not met"
+		case dryRun:
+			result.Result = "dry-run"
+		default:
+			result = e.perform(r.Name, a)
+		}
+
+		evaluation.Actions = append(evaluation.Actions, result)
+	}
+
+	switch {
+	case !evaluation.ConditionsMet:
+		logger.Info("rule conditions not met - not performing actions")
+	case dryRun:
+		logger.Info("dry-run - not performing actions", lager.Data{"actions": r.Actions})
+	default:
+		logger.Info("rule actions performed", lager.Data{"actions": evaluation.Actions})
+	}
+
+	return evaluation
+}
+
+func (e *engine) checkCondition(c Condition, now time.Time) ConditionResult {
+	result := ConditionResult{Condition: c}
+
+	switch c.Type {
+	case ConditionDoor:
+		h, ok := e.doors.Get(c.Door)
+		if !ok {
+			result.ErrorMsg = fmt.Sprintf("unknown door: %s", c.Door)
+			return result
+		}
+
+		ds, err := h.DiscoverDoorState()
+		if err != nil {
+			result.ErrorMsg = err.Error()
+			return result
+		}
+		result.Met = ds.State == door.State(c.State)
+
+	case ConditionLight:
+		ls, err := e.light.DiscoverLightState()
+		if err != nil {
+			result.ErrorMsg = err.Error()
+			return result
+		}
+		result.Met = ls.StateKnown && lightState(ls.LightOn) == c.State
+
+	case ConditionTime:
+		result.Met = c.Window.Contains(now)
+	}
+
+	return result
+}
+
+func (e *engine) perform(rule string, a Action) ActionResult {
+	result := ActionResult{
+		Action:    a,
+		Performed: true,
+	}
+
+	switch a.Type {
+	case ActionDoor:
+		h, ok := e.doors.Get(a.Door)
+		if !ok {
+			result.ErrorMsg = fmt.Sprintf("unknown door: %s", a.Door)
+			return result
+		}
+
+		mr := h.MoveTo(door.State(a.State), events.Source{})
+		result.Result = string(mr.Result)
+		result.ErrorMsg = mr.ErrorMsg
+
+	case ActionLight:
+		var ls light.LightState
+		if a.State == LightOn {
+			ls = e.light.TurnOn(time.Duration(a.Duration), events.Source{})
+		} else {
+			ls = e.light.TurnOff(events.Source{})
+		}
+		result.Result = ls.StateString()
+		result.ErrorMsg = ls.ErrorMsg
+
+	case ActionNotify:
+		err := e.notifier.Notify(rule, a.Message)
+		if err != nil {
+			result.ErrorMsg = err.Error()
+		}
+	}
+
+	if result.ErrorMsg != "" {
+		e.logger.Error("rule action failed", errors.New(result.ErrorMsg), lager.Data{"rule": rule, "action": a})
+	}
+
+	return result
+}
+
+func (e *engine) Statuses() []Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	statuses := []Status{}
+	for _, r := range e.rules {
+		statuses = append(statuses, e.status(r))
+	}
+	return statuses
+}
+
+// status must be called with the mutex held.
+func (e *engine) status(r *rule) Status {
+	s := Status{
+		Rule:    r.Rule,
+		Enabled: r.enabled,
+	}
+
+	if r.lastEvaluation != nil {
+		evaluation := *r.lastEvaluation
+		s.LastEvaluation = &evaluation
+	}
+
+	return s
+}
+
+func (e *engine) SetEnabled(name string, enabled bool) (Status, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	r, ok := e.get(name)
+	if !ok {
+		return Status{}, ErrUnknownRule
+	}
+
+	r.enabled = enabled
+	e.logger.Info("rule setting changed", lager.Data{"rule": name, "enabled": enabled})
+
+	return e.status(r), nil
+}
+
+func (e *engine) DryRun(name string) (Evaluation, error) {
+	e.mutex.Lock()
+	r, ok := e.get(name)
+	e.mutex.Unlock()
+
+	if !ok {
+		return Evaluation{}, ErrUnknownRule
+	}
+
+	return e.evaluate(r.Rule, "dry-run requested", true), nil
+}
+
+// Evaluate checks the conditions of r and, unless the engine is in dry-run
+// mode, performs its actions. r need not be one of the engine's rules and
+// its trigger is ignored.
+func (e *engine) Evaluate(r Rule, cause string) Evaluation {
+	return e.evaluate(r, cause, e.dryRun)
+}
+
+// get must be called with the mutex held.
+func (e *engine) get(name string) (*rule, bool) {
+	for _, r := range e.rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func lightState(on bool) string {
+	if on {
+		return LightOn
+	}
+	return LightOff
+}
+
+func timeOfDay(t TimeOfDay) string {
+	b, _ := t.MarshalText()
+	return string(b)
+}
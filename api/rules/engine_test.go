@@ -0,0 +1,471 @@
+package rules_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	"github.com/robdimsdale/garagepi/api/rules"
+	rules_fakes "github.com/robdimsdale/garagepi/api/rules/fakes"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/robdimsdale/garagepi/timewindow"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Engine", func() {
+	var (
+		fakeOSHelper     *os_fakes.FakeOSHelper
+		fakeDoors        *door_fakes.FakeDoors
+		fakeDoorHandler  *door_fakes.FakeHandler
+		fakeLight        *light_fakes.FakeHandler
+		fakeGpio         *gpio_fakes.FakeGpio
+		fakeWatch        *gpio_fakes.FakeWatch
+		fakeNotifier     *rules_fakes.FakeNotifier
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+
+		inputEvents    chan gpio.Event
+		recordedEvents chan events.Event
+
+		automationRules []rules.Rule
+		dryRun          bool
+
+		engine  rules.Engine
+		process ifrit.Process
+
+		mutex     sync.Mutex
+		now       time.Time
+		doorState door.State
+		lightOn   bool
+	)
+
+	setNow := func(t time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = t
+	}
+
+	setDoorState := func(s door.State) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		doorState = s
+	}
+
+	setLightOn := func(on bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		lightOn = on
+	}
+
+	changeDoorState := func(s door.State) {
+		setDoorState(s)
+		recordedEvents <- events.Event{Type: events.TypeDoorState, Door: "garage", State: string(s)}
+	}
+
+	changeLight := func(on bool) {
+		setLightOn(on)
+		state := "off"
+		if on {
+			state = "on"
+		}
+		recordedEvents <- events.Event{Type: events.TypeLight, State: state}
+	}
+
+	status := func(name string) rules.Status {
+		for _, s := range engine.Statuses() {
+			if s.Name == name {
+				return s
+			}
+		}
+		Fail("unknown rule: " + name)
+		return rules.Status{}
+	}
+
+	lastEvaluation := func(name string) func() *rules.Evaluation {
+		return func() *rules.Evaluation {
+			return status(name).LastEvaluation
+		}
+	}
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		rtr := mux.NewRouter()
+		rtr.HandleFunc("/rules", engine.HandleList).Methods("GET")
+		rtr.HandleFunc("/rules/{name}", engine.HandleSet).Methods("POST")
+		rtr.HandleFunc("/rules/{name}/dry-run", engine.HandleDryRun).Methods("POST")
+
+		req, err := http.NewRequest(method, path, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, req)
+		return w
+	}
+
+	BeforeEach(func() {
+		setNow(time.Date(2016, 1, 2, 21, 59, 0, 0, time.UTC))
+		setDoorState(door.StateClosed)
+		setLightOn(false)
+
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowStub = func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now
+		}
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateStub = func() (*door.DoorState, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return &door.DoorState{Name: "garage", State: doorState}, nil
+		}
+		fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+		fakeDoors.GetStub = func(name string) (door.Handler, bool) {
+			return fakeDoorHandler, name == "garage"
+		}
+
+		fakeLight = new(light_fakes.FakeHandler)
+		fakeLight.DiscoverLightStateStub = func() (*light.LightState, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return &light.LightState{StateKnown: true, LightOn: lightOn}, nil
+		}
+		fakeLight.TurnOnReturns(light.LightState{StateKnown: true, LightOn: true})
+
+		inputEvents = make(chan gpio.Event)
+		fakeWatch = new(gpio_fakes.FakeWatch)
+		fakeWatch.EventsReturns(inputEvents)
+
+		fakeGpio = new(gpio_fakes.FakeGpio)
+		fakeGpio.WatchReturns(fakeWatch, nil)
+
+		fakeNotifier = new(rules_fakes.FakeNotifier)
+
+		recordedEvents = make(chan events.Event)
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recordedEvents)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		window, err := timewindow.Parse("21:00-06:00")
+		Expect(err).NotTo(HaveOccurred())
+		at := rules.TimeOfDay(22 * time.Hour)
+
+		automationRules = []rules.Rule{
+			{
+				Name:    "light-when-opening",
+				Trigger: rules.Trigger{Type: rules.TriggerDoor, Door: "garage", State: "opening"},
+				Conditions: []rules.Condition{
+					{Type: rules.ConditionTime, Window: &window},
+					{Type: rules.ConditionLight, State: "off"},
+				},
+				Actions: []rules.Action{
+					{Type: rules.ActionLight, State: "on", Duration: rules.Duration(10 * time.Minute)},
+				},
+			},
+			{
+				Name:    "close-at-ten",
+				Trigger: rules.Trigger{Type: rules.TriggerTime, At: &at},
+				Conditions: []rules.Condition{
+					{Type: rules.ConditionDoor, Door: "garage", State: "open"},
+				},
+				Actions: []rules.Action{
+					{Type: rules.ActionDoor, Door: "garage", State: "closed"},
+					{Type: rules.ActionNotify, Message: "closing the garage"},
+				},
+			},
+			{
+				Name:    "button",
+				Trigger: rules.Trigger{Type: rules.TriggerInput, Pin: 5, Edge: gpio.EdgeFalling},
+				Actions: []rules.Action{
+					{Type: rules.ActionLight, State: "off"},
+				},
+			},
+			{
+				Name:     "notify-on-light",
+				Disabled: true,
+				Trigger:  rules.Trigger{Type: rules.TriggerLight, State: "on"},
+				Actions: []rules.Action{
+					{Type: rules.ActionNotify, Message: "light switched on"},
+				},
+			},
+		}
+
+		dryRun = false
+	})
+
+	JustBeforeEach(func() {
+		engine = rules.NewEngine(
+			lagertest.NewTestLogger("rules test"),
+			fakeOSHelper,
+			fakeDoors,
+			fakeLight,
+			fakeGpio,
+			fakeSubscriber,
+			fakeNotifier,
+			automationRules,
+			time.Millisecond,
+			dryRun,
+		)
+
+		process = ifrit.Invoke(engine)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("Should watch the pins of input triggers", func() {
+		Expect(fakeGpio.WatchCallCount()).To(Equal(1))
+
+		pin, edge, debounce := fakeGpio.WatchArgsForCall(0)
+		Expect(pin).To(Equal(uint(5)))
+		Expect(edge).To(Equal(gpio.EdgeFalling))
+		Expect(debounce).To(Equal(time.Duration(0)))
+	})
+
+	It("Should stop watching pins when signalled", func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		Expect(fakeWatch.StopCallCount()).To(Equal(1))
+	})
+
+	It("Should subscribe to events, and stop the subscription when signalled", func() {
+		Expect(fakeSubscriber.SubscribeCallCount()).To(Equal(1))
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		Expect(fakeSubscription.StopCallCount()).To(Equal(1))
+	})
+
+	Context("When a door changes to the state of a door trigger", func() {
+		It("Should perform the actions of the rule if its conditions are met", func() {
+			changeDoorState(door.StateOpening)
+
+			Eventually(fakeLight.TurnOnCallCount).Should(Equal(1))
+			Expect(fakeLight.TurnOnArgsForCall(0)).To(Equal(10 * time.Minute))
+
+			evaluation := status("light-when-opening").LastEvaluation
+			Expect(evaluation).NotTo(BeNil())
+			Expect(evaluation.Cause).To(Equal("door garage opening"))
+			Expect(evaluation.ConditionsMet).To(BeTrue())
+			Expect(evaluation.Actions[0].Performed).To(BeTrue())
+		})
+
+		It("Should not perform the actions of the rule if its conditions are not met", func() {
+			setLightOn(true)
+			changeDoorState(door.StateOpening)
+
+			Eventually(lastEvaluation("light-when-opening")).ShouldNot(BeNil())
+			evaluation := status("light-when-opening").LastEvaluation
+			Expect(evaluation.ConditionsMet).To(BeFalse())
+			Expect(evaluation.Conditions[0].Met).To(BeTrue())
+			Expect(evaluation.Conditions[1].Met).To(BeFalse())
+			Expect(evaluation.Actions[0].Performed).To(BeFalse())
+			Expect(fakeLight.TurnOnCallCount()).To(Equal(0))
+		})
+
+		It("Should fire the rule even if the door has changed state again since", func() {
+			changeDoorState(door.StateOpening)
+			changeDoorState(door.StateOpen)
+
+			Eventually(fakeLight.TurnOnCallCount).Should(Equal(1))
+			Expect(status("light-when-opening").LastEvaluation.Cause).To(Equal("door garage opening"))
+		})
+	})
+
+	Context("When a door changes to a state other than that of a door trigger", func() {
+		It("Should not fire the rule", func() {
+			changeDoorState(door.StateStuck)
+
+			Consistently(lastEvaluation("light-when-opening")).Should(BeNil())
+		})
+	})
+
+	Context("When the time of a time trigger passes", func() {
+		BeforeEach(func() {
+			setDoorState(door.StateOpen)
+		})
+
+		It("Should perform the actions of the rule once", func() {
+			Consistently(fakeDoorHandler.MoveToCallCount).Should(Equal(0))
+
+			setNow(time.Date(2016, 1, 2, 22, 1, 0, 0, time.UTC))
+			Eventually(fakeDoorHandler.MoveToCallCount).Should(Equal(1))
+			Expect(fakeDoorHandler.MoveToArgsForCall(0)).To(Equal(door.StateClosed))
+
+			Eventually(fakeNotifier.NotifyCallCount).Should(Equal(1))
+			rule, message := fakeNotifier.NotifyArgsForCall(0)
+			Expect(rule).To(Equal("close-at-ten"))
+			Expect(message).To(Equal("closing the garage"))
+
+			Consistently(fakeDoorHandler.MoveToCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("When the time of a time trigger passes on the day daylight saving time starts", func() {
+		var location *time.Location
+
+		BeforeEach(func() {
+			var err error
+			location, err = time.LoadLocation("America/New_York")
+			Expect(err).NotTo(HaveOccurred())
+
+			at := rules.TimeOfDay(3*time.Hour + 30*time.Minute)
+			automationRules[1].Trigger.At = &at
+
+			setNow(time.Date(2016, 3, 13, 3, 29, 0, 0, location))
+			setDoorState(door.StateOpen)
+		})
+
+		It("Should fire the rule at the wall clock time of the trigger", func() {
+			Consistently(fakeDoorHandler.MoveToCallCount).Should(Equal(0))
+
+			setNow(time.Date(2016, 3, 13, 3, 31, 0, 0, location))
+			Eventually(fakeDoorHandler.MoveToCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("When an input trigger fires", func() {
+		It("Should perform the actions of the rule", func() {
+			inputEvents <- gpio.Event{Pin: 5, Edge: gpio.EdgeFalling}
+			Eventually(fakeLight.TurnOffCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("When a rule is disabled", func() {
+		It("Should not fire the rule", func() {
+			changeLight(true)
+			Consistently(fakeNotifier.NotifyCallCount).Should(Equal(0))
+		})
+
+		It("Should fire the rule once it is enabled", func() {
+			w := serve("POST", "/rules/notify-on-light?enabled=true")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var s rules.Status
+			err := json.Unmarshal(w.Body.Bytes(), &s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.Enabled).To(BeTrue())
+
+			changeLight(true)
+			Eventually(fakeNotifier.NotifyCallCount).Should(Equal(1))
+		})
+
+		It("Should not fire the rule again if the light is switched on while it is on", func() {
+			serve("POST", "/rules/notify-on-light?enabled=true")
+
+			changeLight(true)
+			changeLight(true)
+			Consistently(fakeNotifier.NotifyCallCount).Should(Equal(1))
+		})
+	})
+
+	Context("When the engine is in dry-run mode", func() {
+		BeforeEach(func() {
+			dryRun = true
+		})
+
+		It("Should evaluate rules without performing their actions", func() {
+			changeDoorState(door.StateOpening)
+
+			Eventually(lastEvaluation("light-when-opening")).ShouldNot(BeNil())
+			evaluation := status("light-when-opening").LastEvaluation
+			Expect(evaluation.DryRun).To(BeTrue())
+			Expect(evaluation.ConditionsMet).To(BeTrue())
+			Expect(evaluation.Actions[0].Performed).To(BeFalse())
+			Expect(fakeLight.TurnOnCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Listing rules", func() {
+		It("Should list each rule and whether it is enabled", func() {
+			w := serve("GET", "/rules")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var statuses []rules.Status
+			err := json.Unmarshal(w.Body.Bytes(), &statuses)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statuses).To(HaveLen(4))
+			Expect(statuses[0].Name).To(Equal("light-when-opening"))
+			Expect(statuses[0].Enabled).To(BeTrue())
+			Expect(statuses[0].Trigger).To(Equal(automationRules[0].Trigger))
+			Expect(statuses[3].Enabled).To(BeFalse())
+		})
+	})
+
+	Describe("Setting whether a rule is enabled", func() {
+		It("Should respond with HTTP status code 400 for an invalid setting", func() {
+			w := serve("POST", "/rules/button?enabled=maybe")
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Should respond with HTTP status code 404 for an unknown rule", func() {
+			w := serve("POST", "/rules/unknown?enabled=true")
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Dry-running a rule", func() {
+		It("Should evaluate the conditions of the rule without performing its actions", func() {
+			setDoorState(door.StateOpen)
+
+			w := serve("POST", "/rules/close-at-ten/dry-run")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var evaluation rules.Evaluation
+			err := json.Unmarshal(w.Body.Bytes(), &evaluation)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(evaluation.DryRun).To(BeTrue())
+			Expect(evaluation.ConditionsMet).To(BeTrue())
+			Expect(evaluation.Actions).To(HaveLen(2))
+			Expect(evaluation.Actions[0].Performed).To(BeFalse())
+			Expect(evaluation.Actions[0].Result).To(Equal("dry-run"))
+
+			Expect(fakeDoorHandler.MoveToCallCount()).To(Equal(0))
+			Expect(fakeNotifier.NotifyCallCount()).To(Equal(0))
+		})
+
+		It("Should respond with HTTP status code 404 for an unknown rule", func() {
+			w := serve("POST", "/rules/unknown/dry-run")
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+var _ = Describe("EventNotifier", func() {
+	It("Should record the message as a notification event", func() {
+		fakeRecorder := new(events_fakes.FakeRecorder)
+		notifier := rules.NewEventNotifier(lagertest.NewTestLogger("notifier test"), fakeRecorder)
+
+		Expect(notifier.Notify("close-at-ten", "closing the garage")).To(Succeed())
+
+		Expect(fakeRecorder.RecordCallCount()).To(Equal(1))
+		Expect(fakeRecorder.RecordArgsForCall(0)).To(Equal(events.Event{
+			Type:    events.TypeNotification,
+			Rule:    "close-at-ten",
+			Message: "closing the garage",
+		}))
+	})
+})
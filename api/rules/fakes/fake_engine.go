@@ -0,0 +1,305 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/rules"
+)
+
+type FakeEngine struct {
+	RunStub        func(signals <-chan os.Signal, ready chan<- struct{}) error
+	runMutex       sync.RWMutex
+	runArgsForCall []struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}
+	runReturns struct {
+		result1 error
+	}
+	StatusesStub        func() []rules.Status
+	statusesMutex       sync.RWMutex
+	statusesArgsForCall []struct{}
+	statusesReturns     struct {
+		result1 []rules.Status
+	}
+	SetEnabledStub        func(name string, enabled bool) (rules.Status, error)
+	setEnabledMutex       sync.RWMutex
+	setEnabledArgsForCall []struct {
+		name    string
+		enabled bool
+	}
+	setEnabledReturns struct {
+		result1 rules.Status
+		result2 error
+	}
+	DryRunStub        func(name string) (rules.Evaluation, error)
+	dryRunMutex       sync.RWMutex
+	dryRunArgsForCall []struct {
+		name string
+	}
+	dryRunReturns struct {
+		result1 rules.Evaluation
+		result2 error
+	}
+	EvaluateStub        func(r rules.Rule, cause string) rules.Evaluation
+	evaluateMutex       sync.RWMutex
+	evaluateArgsForCall []struct {
+		r     rules.Rule
+		cause string
+	}
+	evaluateReturns struct {
+		result1 rules.Evaluation
+	}
+	HandleListStub        func(w http.ResponseWriter, r *http.Request)
+	handleListMutex       sync.RWMutex
+	handleListArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleSetStub        func(w http.ResponseWriter, r *http.Request)
+	handleSetMutex       sync.RWMutex
+	handleSetArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleDryRunStub        func(w http.ResponseWriter, r *http.Request)
+	handleDryRunMutex       sync.RWMutex
+	handleDryRunArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeEngine) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	fake.runMutex.Lock()
+	fake.runArgsForCall = append(fake.runArgsForCall, struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}{signals, ready})
+	fake.runMutex.Unlock()
+	if fake.RunStub != nil {
+		return fake.RunStub(signals, ready)
+	} else {
+		return fake.runReturns.result1
+	}
+}
+
+func (fake *FakeEngine) RunCallCount() int {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return len(fake.runArgsForCall)
+}
+
+func (fake *FakeEngine) RunArgsForCall(i int) (<-chan os.Signal, chan<- struct{}) {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return fake.runArgsForCall[i].signals, fake.runArgsForCall[i].ready
+}
+
+func (fake *FakeEngine) RunReturns(result1 error) {
+	fake.RunStub = nil
+	fake.runReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeEngine) Statuses() []rules.Status {
+	fake.statusesMutex.Lock()
+	fake.statusesArgsForCall = append(fake.statusesArgsForCall, struct{}{})
+	fake.statusesMutex.Unlock()
+	if fake.StatusesStub != nil {
+		return fake.StatusesStub()
+	} else {
+		return fake.statusesReturns.result1
+	}
+}
+
+func (fake *FakeEngine) StatusesCallCount() int {
+	fake.statusesMutex.RLock()
+	defer fake.statusesMutex.RUnlock()
+	return len(fake.statusesArgsForCall)
+}
+
+func (fake *FakeEngine) StatusesReturns(result1 []rules.Status) {
+	fake.StatusesStub = nil
+	fake.statusesReturns = struct {
+		result1 []rules.Status
+	}{result1}
+}
+
+func (fake *FakeEngine) SetEnabled(name string, enabled bool) (rules.Status, error) {
+	fake.setEnabledMutex.Lock()
+	fake.setEnabledArgsForCall = append(fake.setEnabledArgsForCall, struct {
+		name    string
+		enabled bool
+	}{name, enabled})
+	fake.setEnabledMutex.Unlock()
+	if fake.SetEnabledStub != nil {
+		return fake.SetEnabledStub(name, enabled)
+	} else {
+		return fake.setEnabledReturns.result1, fake.setEnabledReturns.result2
+	}
+}
+
+func (fake *FakeEngine) SetEnabledCallCount() int {
+	fake.setEnabledMutex.RLock()
+	defer fake.setEnabledMutex.RUnlock()
+	return len(fake.setEnabledArgsForCall)
+}
+
+func (fake *FakeEngine) SetEnabledArgsForCall(i int) (string, bool) {
+	fake.setEnabledMutex.RLock()
+	defer fake.setEnabledMutex.RUnlock()
+	return fake.setEnabledArgsForCall[i].name, fake.setEnabledArgsForCall[i].enabled
+}
+
+func (fake *FakeEngine) SetEnabledReturns(result1 rules.Status, result2 error) {
+	fake.SetEnabledStub = nil
+	fake.setEnabledReturns = struct {
+		result1 rules.Status
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEngine) DryRun(name string) (rules.Evaluation, error) {
+	fake.dryRunMutex.Lock()
+	fake.dryRunArgsForCall = append(fake.dryRunArgsForCall, struct {
+		name string
+	}{name})
+	fake.dryRunMutex.Unlock()
+	if fake.DryRunStub != nil {
+		return fake.DryRunStub(name)
+	} else {
+		return fake.dryRunReturns.result1, fake.dryRunReturns.result2
+	}
+}
+
+func (fake *FakeEngine) DryRunCallCount() int {
+	fake.dryRunMutex.RLock()
+	defer fake.dryRunMutex.RUnlock()
+	return len(fake.dryRunArgsForCall)
+}
+
+func (fake *FakeEngine) DryRunArgsForCall(i int) string {
+	fake.dryRunMutex.RLock()
+	defer fake.dryRunMutex.RUnlock()
+	return fake.dryRunArgsForCall[i].name
+}
+
+func (fake *FakeEngine) DryRunReturns(result1 rules.Evaluation, result2 error) {
+	fake.DryRunStub = nil
+	fake.dryRunReturns = struct {
+		result1 rules.Evaluation
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeEngine) Evaluate(r rules.Rule, cause string) rules.Evaluation {
+	fake.evaluateMutex.Lock()
+	fake.evaluateArgsForCall = append(fake.evaluateArgsForCall, struct {
+		r     rules.Rule
+		cause string
+	}{r, cause})
+	fake.evaluateMutex.Unlock()
+	if fake.EvaluateStub != nil {
+		return fake.EvaluateStub(r, cause)
+	} else {
+		return fake.evaluateReturns.result1
+	}
+}
+
+func (fake *FakeEngine) EvaluateCallCount() int {
+	fake.evaluateMutex.RLock()
+	defer fake.evaluateMutex.RUnlock()
+	return len(fake.evaluateArgsForCall)
+}
+
+func (fake *FakeEngine) EvaluateArgsForCall(i int) (rules.Rule, string) {
+	fake.evaluateMutex.RLock()
+	defer fake.evaluateMutex.RUnlock()
+	return fake.evaluateArgsForCall[i].r, fake.evaluateArgsForCall[i].cause
+}
+
+func (fake *FakeEngine) EvaluateReturns(result1 rules.Evaluation) {
+	fake.EvaluateStub = nil
+	fake.evaluateReturns = struct {
+		result1 rules.Evaluation
+	}{result1}
+}
+
+func (fake *FakeEngine) HandleList(w http.ResponseWriter, r *http.Request) {
+	fake.handleListMutex.Lock()
+	fake.handleListArgsForCall = append(fake.handleListArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleListMutex.Unlock()
+	if fake.HandleListStub != nil {
+		fake.HandleListStub(w, r)
+	}
+}
+
+func (fake *FakeEngine) HandleListCallCount() int {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return len(fake.handleListArgsForCall)
+}
+
+func (fake *FakeEngine) HandleListArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleListMutex.RLock()
+	defer fake.handleListMutex.RUnlock()
+	return fake.handleListArgsForCall[i].w, fake.handleListArgsForCall[i].r
+}
+
+func (fake *FakeEngine) HandleSet(w http.ResponseWriter, r *http.Request) {
+	fake.handleSetMutex.Lock()
+	fake.handleSetArgsForCall = append(fake.handleSetArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleSetMutex.Unlock()
+	if fake.HandleSetStub != nil {
+		fake.HandleSetStub(w, r)
+	}
+}
+
+func (fake *FakeEngine) HandleSetCallCount() int {
+	fake.handleSetMutex.RLock()
+	defer fake.handleSetMutex.RUnlock()
+	return len(fake.handleSetArgsForCall)
+}
+
+func (fake *FakeEngine) HandleSetArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleSetMutex.RLock()
+	defer fake.handleSetMutex.RUnlock()
+	return fake.handleSetArgsForCall[i].w, fake.handleSetArgsForCall[i].r
+}
+
+func (fake *FakeEngine) HandleDryRun(w http.ResponseWriter, r *http.Request) {
+	fake.handleDryRunMutex.Lock()
+	fake.handleDryRunArgsForCall = append(fake.handleDryRunArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleDryRunMutex.Unlock()
+	if fake.HandleDryRunStub != nil {
+		fake.HandleDryRunStub(w, r)
+	}
+}
+
+func (fake *FakeEngine) HandleDryRunCallCount() int {
+	fake.handleDryRunMutex.RLock()
+	defer fake.handleDryRunMutex.RUnlock()
+	return len(fake.handleDryRunArgsForCall)
+}
+
+func (fake *FakeEngine) HandleDryRunArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleDryRunMutex.RLock()
+	defer fake.handleDryRunMutex.RUnlock()
+	return fake.handleDryRunArgsForCall[i].w, fake.handleDryRunArgsForCall[i].r
+}
+
+var _ rules.Engine = new(FakeEngine)
@@ -0,0 +1,55 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/rules"
+)
+
+type FakeNotifier struct {
+	NotifyStub        func(rule string, message string) error
+	notifyMutex       sync.RWMutex
+	notifyArgsForCall []struct {
+		rule    string
+		message string
+	}
+	notifyReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeNotifier) Notify(rule string, message string) error {
+	fake.notifyMutex.Lock()
+	fake.notifyArgsForCall = append(fake.notifyArgsForCall, struct {
+		rule    string
+		message string
+	}{rule, message})
+	fake.notifyMutex.Unlock()
+	if fake.NotifyStub != nil {
+		return fake.NotifyStub(rule, message)
+	} else {
+		return fake.notifyReturns.result1
+	}
+}
+
+func (fake *FakeNotifier) NotifyCallCount() int {
+	fake.notifyMutex.RLock()
+	defer fake.notifyMutex.RUnlock()
+	return len(fake.notifyArgsForCall)
+}
+
+func (fake *FakeNotifier) NotifyArgsForCall(i int) (string, string) {
+	fake.notifyMutex.RLock()
+	defer fake.notifyMutex.RUnlock()
+	return fake.notifyArgsForCall[i].rule, fake.notifyArgsForCall[i].message
+}
+
+func (fake *FakeNotifier) NotifyReturns(result1 error) {
+	fake.NotifyStub = nil
+	fake.notifyReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ rules.Notifier = new(FakeNotifier)
@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+)
+
+func (e *engine) HandleList(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(e.Statuses())
+	w.Write(b)
+}
+
+func (e *engine) HandleSet(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+	if err != nil {
+		e.logger.Info("invalid rule setting provided", lager.Data{"rule": name, "enabled": r.FormValue("enabled")})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s, err := e.SetEnabled(name, enabled)
+	if err != nil {
+		renderUnknownRule(w, name)
+		return
+	}
+
+	b, _ := json.Marshal(s)
+	w.Write(b)
+}
+
+func (e *engine) HandleDryRun(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	evaluation, err := e.DryRun(name)
+	if err != nil {
+		renderUnknownRule(w, name)
+		return
+	}
+
+	b, _ := json.Marshal(evaluation)
+	w.Write(b)
+}
+
+func renderUnknownRule(w http.ResponseWriter, name string) {
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintf(w, "unknown rule: %s", name)
+}
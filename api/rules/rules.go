@@ -0,0 +1,339 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/gpio"
+	"github.com/robdimsdale/garagepi/timewindow"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type TriggerType string
+
+const (
+	// TriggerDoor fires when the state of a door changes.
+	TriggerDoor TriggerType = "door"
+
+	// TriggerLight fires when the light is switched on or off.
+	TriggerLight TriggerType = "light"
+
+	// TriggerTime fires once a day at a time of day.
+	TriggerTime TriggerType = "time"
+
+	// TriggerInput fires on an edge of an input pin.
+	TriggerInput TriggerType = "input"
+)
+
+type ConditionType string
+
+const (
+	ConditionDoor  ConditionType = "door"
+	ConditionLight ConditionType = "light"
+	ConditionTime  ConditionType = "time"
+)
+
+type ActionType string
+
+const (
+	ActionDoor   ActionType = "door"
+	ActionLight  ActionType = "light"
+	ActionNotify ActionType = "notify"
+)
+
+const (
+	LightOn  = "on"
+	LightOff = "off"
+)
+
+// Rule performs its actions when its trigger fires, if all of its conditions are met.
+type Rule struct {
+	Name       string      `json:"name"`
+	Disabled   bool        `json:"disabled,omitempty"`
+	Trigger    Trigger     `json:"trigger"`
+	Conditions []Condition `json:"conditions,omitempty"`
+	Actions    []Action    `json:"actions"`
+}
+
+// Trigger is one of:
+//
+//	{"type": "door", "door": "garage", "state": "opening"}
+//	{"type": "light", "state": "on"}
+//	{"type": "time", "at": "22:00"}
+//	{"type": "input", "pin": 5, "edge": "rising", "debounce": "50ms"}
+//
+// The door and state of door triggers, and the state of light triggers,
+// may be omitted to fire on any change.
+type Trigger struct {
+	Type     TriggerType `json:"type"`
+	Door     string      `json:"door,omitempty"`
+	State    string      `json:"state,omitempty"`
+	At       *TimeOfDay  `json:"at,omitempty"`
+	Pin      uint        `json:"pin,omitempty"`
+	Edge     gpio.Edge   `json:"edge,omitempty"`
+	Debounce Duration    `json:"debounce,omitempty"`
+}
+
+// Condition is one of:
+//
+//	{"type": "door", "door": "garage", "state": "open"}
+//	{"type": "light", "state": "off"}
+//	{"type": "time", "window": "22:00-06:00"}
+type Condition struct {
+	Type   ConditionType          `json:"type"`
+	Door   string                 `json:"door,omitempty"`
+	State  string                 `json:"state,omitempty"`
+	Window *timewindow.TimeWindow `json:"window,omitempty"`
+}
+
+// Action is one of:
+//
+//	{"type": "door", "door": "garage", "state": "closed"}
+//	{"type": "light", "state": "on", "duration": "10m"}
+//	{"type": "notify", "message": "garage door left open"}
+//
+// The message of a notify action is delivered by the engine's Notifier.
+type Action struct {
+	Type     ActionType `json:"type"`
+	Door     string     `json:"door,omitempty"`
+	State    string     `json:"state,omitempty"`
+	Duration Duration   `json:"duration,omitempty"`
+	Message  string     `json:"message,omitempty"`
+}
+
+// Duration is a time.Duration which is encoded as a string, e.g. "10m".
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// TimeOfDay is an offset from midnight which is encoded as HH:MM.
+type TimeOfDay time.Duration
+
+// On returns the time of day on the day of now, in the location of now. The
+// wall clock time is used, so that the result is correct on the days on which
+// daylight saving time starts or ends.
+func (t TimeOfDay) On(now time.Time) time.Time {
+	d := time.Duration(t)
+	hour := int(d / time.Hour)
+	min := int(d % time.Hour / time.Minute)
+	return time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(timewindow.FormatTimeOfDay(time.Duration(t))), nil
+}
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	parsed, err := timewindow.ParseTimeOfDay(string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = TimeOfDay(parsed)
+	return nil
+}
+
+// Load reads rules from a JSON file containing an array of rules.
+// See Parse.
+func Load(path string, doorNames []string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, doorNames)
+}
+
+// Parse decodes and validates a JSON array of rules.
+// Doors referred to by the rules must be in doorNames.
+func Parse(r io.Reader, doorNames []string) ([]Rule, error) {
+	var rules []Rule
+
+	err := json.NewDecoder(r).Decode(&rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rules: %s", err)
+	}
+
+	err = Validate(rules, doorNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// Validate checks that rule names are unique, and that each rule has a valid
+// trigger, valid conditions and at least one valid action.
+func Validate(rules []Rule, doorNames []string) error {
+	doors := nameSet(doorNames)
+
+	names := map[string]bool{}
+	for _, r := range rules {
+		if !validName.MatchString(r.Name) {
+			return fmt.Errorf("invalid rule name: '%s'", r.Name)
+		}
+
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name: %s", r.Name)
+		}
+		names[r.Name] = true
+
+		err := validateTrigger(r.Trigger, doors)
+		if err != nil {
+			return fmt.Errorf("invalid trigger for rule %s: %s", r.Name, err)
+		}
+
+		for _, c := range r.Conditions {
+			err := validateCondition(c, doors)
+			if err != nil {
+				return fmt.Errorf("invalid condition for rule %s: %s", r.Name, err)
+			}
+		}
+
+		if len(r.Actions) == 0 {
+			return fmt.Errorf("no actions for rule: %s", r.Name)
+		}
+
+		for _, a := range r.Actions {
+			err := validateAction(a, doors)
+			if err != nil {
+				return fmt.Errorf("invalid action for rule %s: %s", r.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateCondition checks a condition, which may only refer to doors in doorNames.
+func ValidateCondition(c Condition, doorNames []string) error {
+	return validateCondition(c, nameSet(doorNames))
+}
+
+// ValidateAction checks an action, which may only refer to doors in doorNames.
+func ValidateAction(a Action, doorNames []string) error {
+	return validateAction(a, nameSet(doorNames))
+}
+
+func nameSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+func validateTrigger(t Trigger, doors map[string]bool) error {
+	switch t.Type {
+	case TriggerDoor:
+		if t.Door != "" && !doors[t.Door] {
+			return fmt.Errorf("unknown door: %s", t.Door)
+		}
+		if t.State != "" {
+			return validateDoorState(t.State)
+		}
+	case TriggerLight:
+		if t.State != "" {
+			return validateLightState(t.State)
+		}
+	case TriggerTime:
+		if t.At == nil {
+			return fmt.Errorf("at must be provided")
+		}
+	case TriggerInput:
+		if t.Edge != "" {
+			_, err := gpio.ParseEdge(string(t.Edge))
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown type: '%s'", t.Type)
+	}
+
+	return nil
+}
+
+func validateCondition(c Condition, doors map[string]bool) error {
+	switch c.Type {
+	case ConditionDoor:
+		if !doors[c.Door] {
+			return fmt.Errorf("unknown door: '%s'", c.Door)
+		}
+		return validateDoorState(c.State)
+	case ConditionLight:
+		return validateLightState(c.State)
+	case ConditionTime:
+		if c.Window == nil {
+			return fmt.Errorf("window must be provided")
+		}
+	default:
+		return fmt.Errorf("unknown type: '%s'", c.Type)
+	}
+
+	return nil
+}
+
+func validateAction(a Action, doors map[string]bool) error {
+	switch a.Type {
+	case ActionDoor:
+		if !doors[a.Door] {
+			return fmt.Errorf("unknown door: '%s'", a.Door)
+		}
+		if door.State(a.State) != door.StateOpen && door.State(a.State) != door.StateClosed {
+			return fmt.Errorf("door state must be open or closed: '%s'", a.State)
+		}
+	case ActionLight:
+		if a.Duration < 0 {
+			return fmt.Errorf("duration must not be negative")
+		}
+		return validateLightState(a.State)
+	case ActionNotify:
+		if a.Message == "" {
+			return fmt.Errorf("message must be provided")
+		}
+	default:
+		return fmt.Errorf("unknown type: '%s'", a.Type)
+	}
+
+	return nil
+}
+
+func validateDoorState(state string) error {
+	switch door.State(state) {
+	case door.StateOpen,
+		door.StateClosed,
+		door.StateOpening,
+		door.StateClosing,
+		door.StateStopped,
+		door.StateStuck,
+		door.StateUnknown:
+		return nil
+	default:
+		return fmt.Errorf("unknown door state: '%s'", state)
+	}
+}
+
+func validateLightState(state string) error {
+	if state != LightOn && state != LightOff {
+		return fmt.Errorf("light state must be on or off: '%s'", state)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package rules_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/api/rules"
+	"github.com/robdimsdale/garagepi/gpio"
+	"github.com/robdimsdale/garagepi/timewindow"
+)
+
+var _ = Describe("Parsing rules", func() {
+	doorNames := []string{"garage"}
+
+	parse := func(s string) ([]rules.Rule, error) {
+		return rules.Parse(strings.NewReader(s), doorNames)
+	}
+
+	It("Should parse rules", func() {
+		rs, err := parse(`[
+			{
+				"name": "light-when-opening",
+				"trigger": {"type": "door", "door": "garage", "state": "opening"},
+				"conditions": [
+					{"type": "time", "window": "18:00-06:00"},
+					{"type": "light", "state": "off"}
+				],
+				"actions": [{"type": "light", "state": "on", "duration": "10m"}]
+			},
+			{
+				"name": "close-at-night",
+				"disabled": true,
+				"trigger": {"type": "time", "at": "22:30"},
+				"conditions": [{"type": "door", "door": "garage", "state": "open"}],
+				"actions": [
+					{"type": "door", "door": "garage", "state": "closed"},
+					{"type": "notify", "message": "closing the garage"}
+				]
+			},
+			{
+				"name": "button",
+				"trigger": {"type": "input", "pin": 5, "edge": "falling", "debounce": "50ms"},
+				"actions": [{"type": "light", "state": "off"}]
+			}
+		]`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rs).To(HaveLen(3))
+
+		window, err := timewindow.Parse("18:00-06:00")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rs[0]).To(Equal(rules.Rule{
+			Name: "light-when-opening",
+			Trigger: rules.Trigger{
+				Type:  rules.TriggerDoor,
+				Door:  "garage",
+				State: "opening",
+			},
+			Conditions: []rules.Condition{
+				{Type: rules.ConditionTime, Window: &window},
+				{Type: rules.ConditionLight, State: "off"},
+			},
+			Actions: []rules.Action{
+				{Type: rules.ActionLight, State: "on", Duration: rules.Duration(10 * time.Minute)},
+			},
+		}))
+
+		Expect(rs[1].Disabled).To(BeTrue())
+		Expect(*rs[1].Trigger.At).To(Equal(rules.TimeOfDay(22*time.Hour + 30*time.Minute)))
+
+		Expect(rs[2].Trigger).To(Equal(rules.Trigger{
+			Type:     rules.TriggerInput,
+			Pin:      5,
+			Edge:     gpio.EdgeFalling,
+			Debounce: rules.Duration(50 * time.Millisecond),
+		}))
+	})
+
+	It("Should return an error for invalid JSON", func() {
+		_, err := parse(`[{"name": }]`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("invalid rules", func() {
+		invalid := []struct {
+			description string
+			rule        string
+		}{
+			{"invalid name", `{"name": "a rule", "trigger": {"type": "light"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"unknown trigger", `{"name": "r", "trigger": {"type": "weather"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"unknown trigger door", `{"name": "r", "trigger": {"type": "door", "door": "shed"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"unknown trigger door state", `{"name": "r", "trigger": {"type": "door", "state": "ajar"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"time trigger without at", `{"name": "r", "trigger": {"type": "time"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"invalid at", `{"name": "r", "trigger": {"type": "time", "at": "25:00"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"invalid edge", `{"name": "r", "trigger": {"type": "input", "pin": 5, "edge": "up"}, "actions": [{"type": "light", "state": "on"}]}`},
+			{"unknown condition", `{"name": "r", "trigger": {"type": "light"}, "conditions": [{"type": "weather"}], "actions": [{"type": "light", "state": "on"}]}`},
+			{"condition on unknown door", `{"name": "r", "trigger": {"type": "light"}, "conditions": [{"type": "door", "door": "shed", "state": "open"}], "actions": [{"type": "light", "state": "on"}]}`},
+			{"time condition without window", `{"name": "r", "trigger": {"type": "light"}, "conditions": [{"type": "time"}], "actions": [{"type": "light", "state": "on"}]}`},
+			{"no actions", `{"name": "r", "trigger": {"type": "light"}, "actions": []}`},
+			{"invalid light state", `{"name": "r", "trigger": {"type": "light"}, "actions": [{"type": "light", "state": "dim"}]}`},
+			{"invalid door action state", `{"name": "r", "trigger": {"type": "light"}, "actions": [{"type": "door", "door": "garage", "state": "opening"}]}`},
+			{"notify without message", `{"name": "r", "trigger": {"type": "light"}, "actions": [{"type": "notify"}]}`},
+		}
+
+		for _, i := range invalid {
+			rule := i.rule
+
+			It("Should return an error for "+i.description, func() {
+				_, err := parse("[" + rule + "]")
+				Expect(err).To(HaveOccurred())
+			})
+		}
+	})
+
+	It("Should return an error when rule names are duplicated", func() {
+		_, err := parse(`[
+			{"name": "r", "trigger": {"type": "light"}, "actions": [{"type": "light", "state": "on"}]},
+			{"name": "r", "trigger": {"type": "light"}, "actions": [{"type": "light", "state": "off"}]}
+		]`)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,101 @@
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+)
+
+func (s *scheduler) HandleList(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(s.Statuses())
+	w.Write(b)
+}
+
+func (s *scheduler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	st, err := s.Get(name)
+	if err != nil {
+		renderError(w, name, err)
+		return
+	}
+
+	b, _ := json.Marshal(st)
+	w.Write(b)
+}
+
+func (s *scheduler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var sch Schedule
+	err := json.NewDecoder(r.Body).Decode(&sch)
+	if err != nil {
+		s.logger.Info("invalid schedule provided", lager.Data{"error": err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "invalid schedule: %s", err)
+		return
+	}
+
+	st, err := s.Create(sch)
+	if err != nil {
+		renderError(w, sch.Name, err)
+		return
+	}
+
+	b, _ := json.Marshal(st)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+func (s *scheduler) HandleUpdate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var sch Schedule
+	err := json.NewDecoder(r.Body).Decode(&sch)
+	if err != nil {
+		s.logger.Info("invalid schedule provided", lager.Data{"schedule": name, "error": err.Error()})
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "invalid schedule: %s", err)
+		return
+	}
+
+	st, err := s.Update(name, sch)
+	if err != nil {
+		renderError(w, name, err)
+		return
+	}
+
+	b, _ := json.Marshal(st)
+	w.Write(b)
+}
+
+func (s *scheduler) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	err := s.Delete(name)
+	if err != nil {
+		renderError(w, name, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func renderError(w http.ResponseWriter, name string, err error) {
+	switch err {
+	case ErrUnknownSchedule:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "unknown schedule: %s", name)
+	case ErrScheduleExists:
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, "schedule already exists: %s", name)
+	default:
+		if _, ok := err.(persistError); ok {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(err.Error()))
+	}
+}
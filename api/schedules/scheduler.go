@@ -0,0 +1,319 @@
+package schedules
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/rules"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
+)
+
+var (
+	ErrUnknownSchedule       = errors.New("unknown schedule")
+	ErrScheduleExists        = errors.New("schedule already exists")
+	ErrScheduleNameImmutable = errors.New("schedule name cannot be changed")
+)
+
+// Scheduler performs the actions of schedules when they are due.
+type Scheduler interface {
+	ifrit.Runner
+	Statuses() []Status
+	Get(name string) (Status, error)
+	Create(s Schedule) (Status, error)
+	Update(name string, s Schedule) (Status, error)
+	Delete(name string) error
+	HandleList(w http.ResponseWriter, r *http.Request)
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleCreate(w http.ResponseWriter, r *http.Request)
+	HandleUpdate(w http.ResponseWriter, r *http.Request)
+	HandleDelete(w http.ResponseWriter, r *http.Request)
+}
+
+// Status is a schedule with the time at which it will next run, if it
+// is enabled, and the outcome of the last time it ran.
+type Status struct {
+	Schedule
+	NextRun        *time.Time        `json:"nextRun,omitempty"`
+	LastEvaluation *rules.Evaluation `json:"lastEvaluation,omitempty"`
+}
+
+// persistError is returned if changes to the schedules could not be saved.
+type persistError struct {
+	err error
+}
+
+func (e persistError) Error() string {
+	return fmt.Sprintf("error saving schedules: %s", e.err)
+}
+
+type schedule struct {
+	Schedule
+	nextRun        time.Time
+	lastEvaluation *rules.Evaluation
+}
+
+type scheduler struct {
+	logger    lager.Logger
+	clock     gpos.OSHelper
+	engine    rules.Engine
+	location  *time.Location
+	path      string
+	doorNames []string
+	interval  time.Duration
+
+	mutex     sync.Mutex
+	schedules []*schedule
+}
+
+// NewScheduler returns a scheduler which checks every interval whether any
+// schedules are due, evaluating cron expressions in location.
+// Schedules are performed by the rules engine, so are evaluated without
+// performing their actions if the engine is in dry-run mode.
+// Changes to the schedules are persisted to path, unless it is empty.
+func NewScheduler(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	engine rules.Engine,
+	location *time.Location,
+	path string,
+	doorNames []string,
+	schedules []Schedule,
+	interval time.Duration,
+) Scheduler {
+	s := &scheduler{
+		logger:    logger,
+		clock:     clock,
+		engine:    engine,
+		location:  location,
+		path:      path,
+		doorNames: doorNames,
+		interval:  interval,
+	}
+
+	now := s.now()
+	for _, sch := range schedules {
+		s.schedules = append(s.schedules, &schedule{
+			Schedule: sch,
+			nextRun:  sch.Cron.Next(now),
+		})
+	}
+
+	return s
+}
+
+func (s *scheduler) now() time.Time {
+	return s.clock.Now().In(s.location)
+}
+
+func (s *scheduler) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-ticker.C:
+			s.runDue()
+		}
+	}
+}
+
+// runDue performs the schedules whose next run time has passed.
+// Runs which were missed, e.g. because garagepi was not running, are skipped.
+func (s *scheduler) runDue() {
+	now := s.now()
+
+	s.mutex.Lock()
+	due := []*schedule{}
+	for _, sch := range s.schedules {
+		if sch.nextRun.IsZero() || now.Before(sch.nextRun) {
+			continue
+		}
+
+		if !sch.Disabled {
+			due = append(due, sch)
+		}
+		sch.nextRun = sch.Cron.Next(now)
+	}
+	s.mutex.Unlock()
+
+	for _, sch := range due {
+		s.logger.Info("schedule due", lager.Data{"schedule": sch.Name, "cron": sch.Cron.String()})
+
+		evaluation := s.engine.Evaluate(rules.Rule{
+			Name:       sch.Name,
+			Conditions: sch.Conditions,
+			Actions:    sch.Actions,
+		}, fmt.Sprintf("schedule %s", sch.Cron))
+
+		s.mutex.Lock()
+		sch.lastEvaluation = &evaluation
+		s.mutex.Unlock()
+	}
+}
+
+func (s *scheduler) Statuses() []Status {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := []Status{}
+	for _, sch := range s.schedules {
+		statuses = append(statuses, sch.status())
+	}
+	return statuses
+}
+
+func (s *scheduler) Get(name string) (Status, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.index(name)
+	if i < 0 {
+		return Status{}, ErrUnknownSchedule
+	}
+
+	return s.schedules[i].status(), nil
+}
+
+func (s *scheduler) Create(sch Schedule) (Status, error) {
+	err := Validate(sch, s.doorNames)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.index(sch.Name) >= 0 {
+		return Status{}, ErrScheduleExists
+	}
+
+	created := &schedule{
+		Schedule: sch,
+		nextRun:  sch.Cron.Next(s.now()),
+	}
+
+	err = s.replace(append(s.schedules, created))
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.logger.Info("schedule created", lager.Data{"schedule": sch.Name, "cron": sch.Cron.String()})
+	return created.status(), nil
+}
+
+func (s *scheduler) Update(name string, sch Schedule) (Status, error) {
+	if sch.Name == "" {
+		sch.Name = name
+	}
+
+	if sch.Name != name {
+		return Status{}, ErrScheduleNameImmutable
+	}
+
+	err := Validate(sch, s.doorNames)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.index(name)
+	if i < 0 {
+		return Status{}, ErrUnknownSchedule
+	}
+
+	updated := &schedule{
+		Schedule: sch,
+		nextRun:  sch.Cron.Next(s.now()),
+	}
+
+	schedules := append([]*schedule{}, s.schedules...)
+	schedules[i] = updated
+
+	err = s.replace(schedules)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.logger.Info("schedule updated", lager.Data{"schedule": name, "cron": sch.Cron.String()})
+	return updated.status(), nil
+}
+
+func (s *scheduler) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.index(name)
+	if i < 0 {
+		return ErrUnknownSchedule
+	}
+
+	schedules := append([]*schedule{}, s.schedules[:i]...)
+	schedules = append(schedules, s.schedules[i+1:]...)
+
+	err := s.replace(schedules)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("schedule deleted", lager.Data{"schedule": name})
+	return nil
+}
+
+// replace persists the schedules and, if successful, replaces the current schedules.
+// replace must be called with the mutex held.
+func (s *scheduler) replace(schedules []*schedule) error {
+	persisted := []Schedule{}
+	for _, sch := range schedules {
+		persisted = append(persisted, sch.Schedule)
+	}
+
+	err := save(s.path, persisted)
+	if err != nil {
+		s.logger.Error("error saving schedules", err, lager.Data{"path": s.path})
+		return persistError{err}
+	}
+
+	s.schedules = schedules
+	return nil
+}
+
+// index must be called with the mutex held.
+func (s *scheduler) index(name string) int {
+	for i, sch := range s.schedules {
+		if sch.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// status must be called with the mutex held.
+func (sch *schedule) status() Status {
+	st := Status{
+		Schedule: sch.Schedule,
+	}
+
+	if !sch.Disabled && !sch.nextRun.IsZero() {
+		nextRun := sch.nextRun
+		st.NextRun = &nextRun
+	}
+
+	if sch.lastEvaluation != nil {
+		evaluation := *sch.lastEvaluation
+		st.LastEvaluation = &evaluation
+	}
+
+	return st
+}
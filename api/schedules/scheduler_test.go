@@ -0,0 +1,383 @@
+package schedules_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/rules"
+	rules_fakes "github.com/robdimsdale/garagepi/api/rules/fakes"
+	"github.com/robdimsdale/garagepi/api/schedules"
+	"github.com/robdimsdale/garagepi/cron"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		fakeOSHelper *os_fakes.FakeOSHelper
+		fakeEngine   *rules_fakes.FakeEngine
+
+		location    *time.Location
+		tempDirPath string
+		path        string
+
+		initial   []schedules.Schedule
+		scheduler schedules.Scheduler
+		process   ifrit.Process
+
+		mutex sync.Mutex
+		now   time.Time
+	)
+
+	doorNames := []string{"garage"}
+
+	setNow := func(t time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = t
+	}
+
+	mustParse := func(expr string) cron.Expression {
+		e, err := cron.Parse(expr)
+		Expect(err).NotTo(HaveOccurred())
+		return e
+	}
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		rtr := mux.NewRouter()
+		rtr.HandleFunc("/schedules", scheduler.HandleList).Methods("GET")
+		rtr.HandleFunc("/schedules", scheduler.HandleCreate).Methods("POST")
+		rtr.HandleFunc("/schedules/{name}", scheduler.HandleGet).Methods("GET")
+		rtr.HandleFunc("/schedules/{name}", scheduler.HandleUpdate).Methods("PUT")
+		rtr.HandleFunc("/schedules/{name}", scheduler.HandleDelete).Methods("DELETE")
+
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, req)
+		return w
+	}
+
+	decodeStatus := func(w *httptest.ResponseRecorder) schedules.Status {
+		var s schedules.Status
+		err := json.Unmarshal(w.Body.Bytes(), &s)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	BeforeEach(func() {
+		var err error
+		location, err = time.LoadLocation("America/New_York")
+		Expect(err).NotTo(HaveOccurred())
+
+		// 2016-01-04 is a Monday.
+		setNow(time.Date(2016, 1, 4, 22, 59, 0, 0, location))
+
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowStub = func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return now.UTC()
+		}
+
+		fakeEngine = new(rules_fakes.FakeEngine)
+		fakeEngine.EvaluateReturns(rules.Evaluation{ConditionsMet: true, Cause: "schedule"})
+
+		tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-schedules-test")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(tempDirPath, "schedules.json")
+
+		initial = []schedules.Schedule{
+			{
+				Name: "close-at-night",
+				Cron: mustParse("0 23 * * mon-fri"),
+				Conditions: []rules.Condition{
+					{Type: rules.ConditionDoor, Door: "garage", State: "open"},
+				},
+				Actions: []rules.Action{
+					{Type: rules.ActionDoor, Door: "garage", State: "closed"},
+				},
+			},
+			{
+				Name:     "light-off",
+				Cron:     mustParse("0 23 * * *"),
+				Disabled: true,
+				Actions: []rules.Action{
+					{Type: rules.ActionLight, State: "off"},
+				},
+			},
+		}
+	})
+
+	JustBeforeEach(func() {
+		scheduler = schedules.NewScheduler(
+			lagertest.NewTestLogger("schedules test"),
+			fakeOSHelper,
+			fakeEngine,
+			location,
+			path,
+			doorNames,
+			initial,
+			time.Millisecond,
+		)
+
+		process = ifrit.Invoke(scheduler)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+
+		err := os.RemoveAll(tempDirPath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("Running schedules", func() {
+		It("Should not run schedules before they are due", func() {
+			Consistently(fakeEngine.EvaluateCallCount).Should(Equal(0))
+		})
+
+		It("Should evaluate enabled schedules once they are due", func() {
+			setNow(time.Date(2016, 1, 4, 23, 0, 0, 0, location))
+
+			Eventually(fakeEngine.EvaluateCallCount).Should(Equal(1))
+			r, cause := fakeEngine.EvaluateArgsForCall(0)
+			Expect(r).To(Equal(rules.Rule{
+				Name:       "close-at-night",
+				Conditions: initial[0].Conditions,
+				Actions:    initial[0].Actions,
+			}))
+			Expect(cause).To(Equal("schedule 0 23 * * mon-fri"))
+
+			Consistently(fakeEngine.EvaluateCallCount).Should(Equal(1))
+
+			s, err := scheduler.Get("close-at-night")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.LastEvaluation).NotTo(BeNil())
+			Expect(s.LastEvaluation.Cause).To(Equal("schedule"))
+			Expect(s.NextRun.Equal(time.Date(2016, 1, 5, 23, 0, 0, 0, location))).To(BeTrue())
+		})
+
+		It("Should skip runs which were missed", func() {
+			// Friday 23:30, so the runs from Monday to Friday were missed.
+			setNow(time.Date(2016, 1, 8, 23, 30, 0, 0, location))
+
+			Eventually(fakeEngine.EvaluateCallCount).Should(Equal(1))
+			Consistently(fakeEngine.EvaluateCallCount).Should(Equal(1))
+
+			s, err := scheduler.Get("close-at-night")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(s.NextRun.Equal(time.Date(2016, 1, 11, 23, 0, 0, 0, location))).To(BeTrue())
+		})
+	})
+
+	Describe("Listing schedules", func() {
+		It("Should list each schedule with the time at which it will next run", func() {
+			w := serve("GET", "/schedules", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			var statuses []schedules.Status
+			err := json.Unmarshal(w.Body.Bytes(), &statuses)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(statuses).To(HaveLen(2))
+
+			Expect(statuses[0].Name).To(Equal("close-at-night"))
+			Expect(statuses[0].Cron.String()).To(Equal("0 23 * * mon-fri"))
+			Expect(statuses[0].NextRun).NotTo(BeNil())
+			Expect(statuses[0].NextRun.Equal(time.Date(2016, 1, 4, 23, 0, 0, 0, location))).To(BeTrue())
+
+			Expect(statuses[1].Disabled).To(BeTrue())
+			Expect(statuses[1].NextRun).To(BeNil())
+		})
+
+		It("Should format the next run time in the location of the scheduler", func() {
+			w := serve("GET", "/schedules/close-at-night", "")
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(ContainSubstring(`"nextRun":"2016-01-04T23:00:00-05:00"`))
+		})
+
+		It("Should respond with HTTP status code 404 for an unknown schedule", func() {
+			w := serve("GET", "/schedules/unknown", "")
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Creating schedules", func() {
+		It("Should create and persist the schedule", func() {
+			w := serve("POST", "/schedules", `{"name": "light-on", "cron": "30 6 * * *", "actions": [{"type": "light", "state": "on", "duration": "1h"}]}`)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+
+			s := decodeStatus(w)
+			Expect(s.Name).To(Equal("light-on"))
+			Expect(s.NextRun.Equal(time.Date(2016, 1, 5, 6, 30, 0, 0, location))).To(BeTrue())
+
+			Expect(scheduler.Statuses()).To(HaveLen(3))
+
+			loaded, err := schedules.Load(path, doorNames)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(HaveLen(3))
+			Expect(loaded[2].Name).To(Equal("light-on"))
+			Expect(loaded[2].Actions[0].Duration).To(Equal(rules.Duration(time.Hour)))
+		})
+
+		It("Should run the schedule once it is due", func() {
+			w := serve("POST", "/schedules", `{"name": "soon", "cron": "0 23 * * *", "actions": [{"type": "light", "state": "off"}]}`)
+			Expect(w.Code).To(Equal(http.StatusCreated))
+
+			setNow(time.Date(2016, 1, 4, 23, 0, 0, 0, location))
+			Eventually(fakeEngine.EvaluateCallCount).Should(Equal(2))
+		})
+
+		It("Should respond with HTTP status code 409 if the schedule already exists", func() {
+			w := serve("POST", "/schedules", `{"name": "light-off", "cron": "0 1 * * *", "actions": [{"type": "light", "state": "off"}]}`)
+			Expect(w.Code).To(Equal(http.StatusConflict))
+		})
+
+		invalid := []struct {
+			description string
+			body        string
+		}{
+			{"malformed JSON", `{"name": `},
+			{"an invalid cron expression", `{"name": "s", "cron": "61 * * * *", "actions": [{"type": "light", "state": "off"}]}`},
+			{"a missing cron expression", `{"name": "s", "actions": [{"type": "light", "state": "off"}]}`},
+			{"an invalid name", `{"name": "a b", "cron": "* * * * *", "actions": [{"type": "light", "state": "off"}]}`},
+			{"no actions", `{"name": "s", "cron": "* * * * *"}`},
+			{"an unknown door", `{"name": "s", "cron": "* * * * *", "actions": [{"type": "door", "door": "shed", "state": "closed"}]}`},
+			{"an invalid condition", `{"name": "s", "cron": "* * * * *", "conditions": [{"type": "light"}], "actions": [{"type": "light", "state": "off"}]}`},
+		}
+
+		for _, tc := range invalid {
+			tc := tc
+
+			It("Should respond with HTTP status code 400 for "+tc.description, func() {
+				w := serve("POST", "/schedules", tc.body)
+				Expect(w.Code).To(Equal(http.StatusBadRequest))
+				Expect(scheduler.Statuses()).To(HaveLen(2))
+			})
+		}
+
+		Context("When the schedules cannot be saved", func() {
+			BeforeEach(func() {
+				path = filepath.Join(tempDirPath, "missing", "schedules.json")
+			})
+
+			It("Should respond with HTTP status code 500 and not create the schedule", func() {
+				w := serve("POST", "/schedules", `{"name": "light-on", "cron": "30 6 * * *", "actions": [{"type": "light", "state": "on"}]}`)
+				Expect(w.Code).To(Equal(http.StatusInternalServerError))
+				Expect(scheduler.Statuses()).To(HaveLen(2))
+			})
+		})
+	})
+
+	Describe("Updating schedules", func() {
+		It("Should update and persist the schedule", func() {
+			w := serve("PUT", "/schedules/light-off", `{"cron": "30 23 * * *", "actions": [{"type": "light", "state": "off"}]}`)
+			Expect(w.Code).To(Equal(http.StatusOK))
+
+			s := decodeStatus(w)
+			Expect(s.Name).To(Equal("light-off"))
+			Expect(s.Disabled).To(BeFalse())
+			Expect(s.NextRun.Equal(time.Date(2016, 1, 4, 23, 30, 0, 0, location))).To(BeTrue())
+
+			loaded, err := schedules.Load(path, doorNames)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded[1].Cron.String()).To(Equal("30 23 * * *"))
+			Expect(loaded[1].Disabled).To(BeFalse())
+		})
+
+		It("Should respond with HTTP status code 400 if the name is changed", func() {
+			w := serve("PUT", "/schedules/light-off", `{"name": "other", "cron": "30 23 * * *", "actions": [{"type": "light", "state": "off"}]}`)
+			Expect(w.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Should respond with HTTP status code 404 for an unknown schedule", func() {
+			w := serve("PUT", "/schedules/unknown", `{"cron": "30 23 * * *", "actions": [{"type": "light", "state": "off"}]}`)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("Deleting schedules", func() {
+		It("Should delete the schedule and persist the remaining schedules", func() {
+			w := serve("DELETE", "/schedules/close-at-night", "")
+			Expect(w.Code).To(Equal(http.StatusNoContent))
+
+			statuses := scheduler.Statuses()
+			Expect(statuses).To(HaveLen(1))
+			Expect(statuses[0].Name).To(Equal("light-off"))
+
+			loaded, err := schedules.Load(path, doorNames)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(HaveLen(1))
+		})
+
+		It("Should not run the deleted schedule", func() {
+			serve("DELETE", "/schedules/close-at-night", "")
+
+			setNow(time.Date(2016, 1, 4, 23, 0, 0, 0, location))
+			Consistently(fakeEngine.EvaluateCallCount).Should(Equal(0))
+		})
+
+		It("Should respond with HTTP status code 404 for an unknown schedule", func() {
+			w := serve("DELETE", "/schedules/unknown", "")
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+var _ = Describe("Loading schedules", func() {
+	var tempDirPath string
+
+	BeforeEach(func() {
+		var err error
+		tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-schedules-test")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(tempDirPath)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	write := func(contents string) string {
+		path := filepath.Join(tempDirPath, "schedules.json")
+		err := ioutil.WriteFile(path, []byte(contents), os.ModePerm)
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	It("Should load no schedules if the file does not exist", func() {
+		loaded, err := schedules.Load(filepath.Join(tempDirPath, "schedules.json"), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded).To(BeEmpty())
+	})
+
+	It("Should return an error for invalid JSON", func() {
+		_, err := schedules.Load(write(`{`), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should return an error for an invalid schedule", func() {
+		_, err := schedules.Load(write(`[{"name": "s", "cron": "* * * * *", "actions": []}]`), nil)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should return an error for duplicate names", func() {
+		_, err := schedules.Load(write(`[
+			{"name": "s", "cron": "* * * * *", "actions": [{"type": "light", "state": "off"}]},
+			{"name": "s", "cron": "0 * * * *", "actions": [{"type": "light", "state": "on"}]}
+		]`), nil)
+		Expect(err).To(MatchError("duplicate schedule name: s"))
+	})
+})
@@ -0,0 +1,130 @@
+package schedules
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/robdimsdale/garagepi/api/rules"
+	"github.com/robdimsdale/garagepi/cron"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Schedule performs its actions each time its cron expression matches,
+// if all of its conditions are met, e.g.
+//
+//	{
+//	  "name": "close-at-night",
+//	  "cron": "0 22 * * mon-fri",
+//	  "conditions": [{"type": "door", "door": "garage", "state": "open"}],
+//	  "actions": [{"type": "door", "door": "garage", "state": "closed"}]
+//	}
+//
+// Conditions and actions are those of rules.
+type Schedule struct {
+	Name       string            `json:"name"`
+	Cron       cron.Expression   `json:"cron"`
+	Disabled   bool              `json:"disabled,omitempty"`
+	Conditions []rules.Condition `json:"conditions,omitempty"`
+	Actions    []rules.Action    `json:"actions"`
+}
+
+// Validate checks that the schedule has a valid name, a cron expression,
+// valid conditions and at least one valid action.
+func Validate(s Schedule, doorNames []string) error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("invalid schedule name: '%s'", s.Name)
+	}
+
+	if s.Cron.String() == "" {
+		return fmt.Errorf("no cron expression for schedule: %s", s.Name)
+	}
+
+	for _, c := range s.Conditions {
+		err := rules.ValidateCondition(c, doorNames)
+		if err != nil {
+			return fmt.Errorf("invalid condition for schedule %s: %s", s.Name, err)
+		}
+	}
+
+	if len(s.Actions) == 0 {
+		return fmt.Errorf("no actions for schedule: %s", s.Name)
+	}
+
+	for _, a := range s.Actions {
+		err := rules.ValidateAction(a, doorNames)
+		if err != nil {
+			return fmt.Errorf("invalid action for schedule %s: %s", s.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Load reads schedules from a JSON file containing an array of schedules.
+// A file which does not exist contains no schedules.
+func Load(path string, doorNames []string) ([]Schedule, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []Schedule
+	err = json.Unmarshal(b, &schedules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedules in %s: %s", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, s := range schedules {
+		err := Validate(s, doorNames)
+		if err != nil {
+			return nil, err
+		}
+
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate schedule name: %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return schedules, nil
+}
+
+// save writes the schedules to path. The schedules are not persisted if path is empty.
+func save(path string, schedules []Schedule) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so the file is never
+	// left partially written.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,74 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/api/stream"
+)
+
+type FakeHandler struct {
+	HandleStreamStub        func(w http.ResponseWriter, r *http.Request)
+	handleStreamMutex       sync.RWMutex
+	handleStreamArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleWebSocketStub        func(w http.ResponseWriter, r *http.Request)
+	handleWebSocketMutex       sync.RWMutex
+	handleWebSocketArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeHandler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	fake.handleStreamMutex.Lock()
+	fake.handleStreamArgsForCall = append(fake.handleStreamArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleStreamMutex.Unlock()
+	if fake.HandleStreamStub != nil {
+		fake.HandleStreamStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleStreamCallCount() int {
+	fake.handleStreamMutex.RLock()
+	defer fake.handleStreamMutex.RUnlock()
+	return len(fake.handleStreamArgsForCall)
+}
+
+func (fake *FakeHandler) HandleStreamArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleStreamMutex.RLock()
+	defer fake.handleStreamMutex.RUnlock()
+	return fake.handleStreamArgsForCall[i].w, fake.handleStreamArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	fake.handleWebSocketMutex.Lock()
+	fake.handleWebSocketArgsForCall = append(fake.handleWebSocketArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleWebSocketMutex.Unlock()
+	if fake.HandleWebSocketStub != nil {
+		fake.HandleWebSocketStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleWebSocketCallCount() int {
+	fake.handleWebSocketMutex.RLock()
+	defer fake.handleWebSocketMutex.RUnlock()
+	return len(fake.handleWebSocketArgsForCall)
+}
+
+func (fake *FakeHandler) HandleWebSocketArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleWebSocketMutex.RLock()
+	defer fake.handleWebSocketMutex.RUnlock()
+	return fake.handleWebSocketArgsForCall[i].w, fake.handleWebSocketArgsForCall[i].r
+}
+
+var _ stream.Handler = new(FakeHandler)
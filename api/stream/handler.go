@@ -0,0 +1,194 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/light"
+)
+
+// Names of the server-sent events.
+const (
+	// EventDoor carries the door.DoorState of a door.
+	EventDoor = "door"
+
+	// EventLight carries the light.LightState of the light.
+	EventLight = "light"
+
+	// EventSensor carries the events.Event recorded when the reading of a
+	// door sensor or interlock changed.
+	EventSensor = "sensor"
+)
+
+//go:generate counterfeiter . Handler
+
+type Handler interface {
+	HandleStream(w http.ResponseWriter, r *http.Request)
+	HandleWebSocket(w http.ResponseWriter, r *http.Request)
+}
+
+type handler struct {
+	logger       lager.Logger
+	subscriber   events.Subscriber
+	lightHandler light.Handler
+	doors        door.Doors
+	keepAlive    time.Duration
+}
+
+// NewHandler returns a handler which streams the state of the doors and light
+// as server-sent events or over a WebSocket. The current state is sent once
+// the stream opens and again each time it changes. A comment or ping is sent
+// every keepAlive so that idle connections are not closed by proxies.
+func NewHandler(
+	logger lager.Logger,
+	subscriber events.Subscriber,
+	lightHandler light.Handler,
+	doors door.Doors,
+	keepAlive time.Duration,
+) Handler {
+	return &handler{
+		logger:       logger,
+		subscriber:   subscriber,
+		lightHandler: lightHandler,
+		doors:        doors,
+		keepAlive:    keepAlive,
+	}
+}
+
+func (h handler) HandleStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.logger.Error("streaming unsupported", nil)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("streaming unsupported"))
+		return
+	}
+
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+
+	// Subscribe before sending the current state so that no change is missed.
+	sub := h.subscriber.Subscribe()
+	defer sub.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	logger := h.logger.Session("stream", lager.Data{"remoteAddr": r.RemoteAddr})
+	logger.Debug("stream opened")
+	defer logger.Debug("stream closed")
+
+	err := writeEvents(w, h.current())
+	if err != nil {
+		return
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(h.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+
+		case <-ticker.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				// The client fell behind. Browsers reconnect, and are then
+				// sent the current state.
+				logger.Info("subscription ended")
+				return
+			}
+			err = writeEvents(w, h.changes(e))
+		}
+
+		if err != nil {
+			logger.Debug("error writing to stream", lager.Data{"error": err.Error()})
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// update is a message sent to clients, named by one of the Event constants.
+type update struct {
+	name string
+	data interface{}
+}
+
+// current returns the current state of the light and every door.
+func (h handler) current() []update {
+	updates := []update{h.lightUpdate()}
+	for _, dh := range h.doors.All() {
+		updates = append(updates, h.doorUpdate(dh))
+	}
+	return updates
+}
+
+// changes returns the state which e changed, if any.
+func (h handler) changes(e events.Event) []update {
+	var updates []update
+
+	switch e.Type {
+	case events.TypeLight:
+		return []update{h.lightUpdate()}
+
+	case events.TypeSensor, events.TypeInterlock:
+		updates = append(updates, update{name: EventSensor, data: e})
+		fallthrough
+
+	case events.TypeDoorState:
+		if dh, ok := h.doors.Get(e.Door); ok {
+			updates = append(updates, h.doorUpdate(dh))
+		}
+	}
+
+	return updates
+}
+
+func (h handler) lightUpdate() update {
+	ls, err := h.lightHandler.DiscoverLightState()
+	if err != nil {
+		h.logger.Error("error reading light state", err)
+		ls = &light.LightState{ErrorMsg: err.Error()}
+	}
+
+	return update{name: EventLight, data: ls}
+}
+
+func (h handler) doorUpdate(dh door.Handler) update {
+	ds, err := dh.DiscoverDoorState()
+	if err != nil {
+		h.logger.Error("error reading door state", err, lager.Data{"door": dh.Name()})
+		unknown := &door.DoorState{Name: dh.Name(), State: door.StateUnknown}
+		if ds != nil {
+			unknown.Interlocks = ds.Interlocks
+		}
+		ds = unknown
+	}
+
+	return update{name: EventDoor, data: ds}
+}
+
+func writeEvents(w io.Writer, updates []update) error {
+	for _, u := range updates {
+		b, _ := json.Marshal(u.data)
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", u.name, b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package stream_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	"github.com/robdimsdale/garagepi/api/stream"
+)
+
+type message struct {
+	name string
+	data string
+}
+
+var _ = Describe("Stream", func() {
+	var (
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		fakeLightHandler *light_fakes.FakeHandler
+		fakeDoors        *door_fakes.FakeDoors
+		fakeDoorHandler  *door_fakes.FakeHandler
+
+		recorded  chan events.Event
+		keepAlive time.Duration
+
+		server   *httptest.Server
+		resp     *http.Response
+		messages chan message
+	)
+
+	BeforeEach(func() {
+		recorded = make(chan events.Event, 10)
+		keepAlive = time.Hour
+
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: true}, nil)
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosed}, nil)
+
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+		fakeDoors.GetStub = func(name string) (door.Handler, bool) {
+			return fakeDoorHandler, name == "garage"
+		}
+	})
+
+	JustBeforeEach(func() {
+		h := stream.NewHandler(
+			lagertest.NewTestLogger("stream test"),
+			fakeSubscriber,
+			fakeLightHandler,
+			fakeDoors,
+			keepAlive,
+		)
+		server = httptest.NewServer(http.HandlerFunc(h.HandleStream))
+
+		var err error
+		resp, err = http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		messages = make(chan message, 100)
+		go func(messages chan<- message, r *bufio.Reader) {
+			defer GinkgoRecover()
+			defer close(messages)
+
+			var m message
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				line = strings.TrimSuffix(line, "\n")
+
+				switch {
+				case line == "":
+					messages <- m
+					m = message{}
+				case strings.HasPrefix(line, ":"):
+					m.name = "comment"
+				case strings.HasPrefix(line, "event: "):
+					m.name = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					m.data = strings.TrimPrefix(line, "data: ")
+				}
+			}
+		}(messages, bufio.NewReader(resp.Body))
+	})
+
+	AfterEach(func() {
+		resp.Body.Close()
+		server.Close()
+	})
+
+	receive := func(name string, v interface{}) {
+		var m message
+		Eventually(messages).Should(Receive(&m))
+		Expect(m.name).To(Equal(name))
+
+		err := json.Unmarshal([]byte(m.data), v)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	receiveInitialState := func() {
+		var ls light.LightState
+		receive(stream.EventLight, &ls)
+
+		var ds door.DoorState
+		receive(stream.EventDoor, &ds)
+	}
+
+	It("responds with an event stream", func() {
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+		Expect(resp.Header.Get("Cache-Control")).To(Equal("no-cache"))
+	})
+
+	It("sends the current state of the light and doors", func() {
+		var ls light.LightState
+		receive(stream.EventLight, &ls)
+		Expect(ls).To(Equal(light.LightState{StateKnown: true, LightOn: true}))
+
+		var ds door.DoorState
+		receive(stream.EventDoor, &ds)
+		Expect(ds.Name).To(Equal("garage"))
+		Expect(ds.State).To(Equal(door.StateClosed))
+	})
+
+	It("sends the state of the light when it changes", func() {
+		receiveInitialState()
+
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true, LightOn: false}, nil)
+		recorded <- events.Event{Type: events.TypeLight, State: "off"}
+
+		var ls light.LightState
+		receive(stream.EventLight, &ls)
+		Expect(ls.LightOn).To(BeFalse())
+	})
+
+	It("sends the state of a door when it changes", func() {
+		receiveInitialState()
+
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateOpening}, nil)
+		recorded <- events.Event{Type: events.TypeDoorState, Door: "garage", State: "opening"}
+
+		var ds door.DoorState
+		receive(stream.EventDoor, &ds)
+		Expect(ds.State).To(Equal(door.StateOpening))
+	})
+
+	It("sends sensor changes followed by the state of the door", func() {
+		receiveInitialState()
+
+		recorded <- events.Event{ID: 3, Type: events.TypeInterlock, Door: "garage", Interlock: "photoeye", State: "active"}
+
+		var e events.Event
+		receive(stream.EventSensor, &e)
+		Expect(e.Interlock).To(Equal("photoeye"))
+		Expect(e.State).To(Equal("active"))
+
+		var ds door.DoorState
+		receive(stream.EventDoor, &ds)
+	})
+
+	It("does not send other events", func() {
+		receiveInitialState()
+
+		recorded <- events.Event{Type: events.TypeLogin}
+		recorded <- events.Event{Type: events.TypeDoorToggle, Door: "garage"}
+
+		Consistently(messages).ShouldNot(Receive())
+	})
+
+	Context("when reading the door state fails", func() {
+		BeforeEach(func() {
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosed}, errors.New("read error"))
+		})
+
+		It("sends the door state as unknown", func() {
+			var ls light.LightState
+			receive(stream.EventLight, &ls)
+
+			var ds door.DoorState
+			receive(stream.EventDoor, &ds)
+			Expect(ds.State).To(Equal(door.StateUnknown))
+		})
+	})
+
+	Context("when reading the light state fails", func() {
+		BeforeEach(func() {
+			fakeLightHandler.DiscoverLightStateReturns(&light.LightState{}, errors.New("read error"))
+		})
+
+		It("sends the light state as unknown", func() {
+			var ls light.LightState
+			receive(stream.EventLight, &ls)
+			Expect(ls.StateKnown).To(BeFalse())
+			Expect(ls.ErrorMsg).To(Equal("read error"))
+		})
+	})
+
+	Context("when keepAlive elapses", func() {
+		BeforeEach(func() {
+			keepAlive = 10 * time.Millisecond
+		})
+
+		It("sends a comment", func() {
+			receiveInitialState()
+
+			var m message
+			Eventually(messages).Should(Receive(&m))
+			Expect(m.name).To(Equal("comment"))
+		})
+	})
+
+	It("ends the stream when the subscription ends", func() {
+		receiveInitialState()
+
+		close(recorded)
+
+		Eventually(messages).Should(BeClosed())
+		Expect(fakeSubscription.StopCallCount()).To(Equal(1))
+	})
+
+	It("stops the subscription when the client disconnects", func() {
+		receiveInitialState()
+
+		resp.Body.Close()
+
+		Eventually(fakeSubscription.StopCallCount).Should(Equal(1))
+	})
+})
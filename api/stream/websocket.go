@@ -0,0 +1,220 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/websocket"
+)
+
+// Commands which clients send over the WebSocket.
+const (
+	CommandToggle   = "toggle"
+	CommandOpen     = "open"
+	CommandClose    = "close"
+	CommandLightOn  = "light-on"
+	CommandLightOff = "light-off"
+)
+
+// MessageAck is the type of the message which acknowledges a command.
+const MessageAck = "ack"
+
+// Command is sent by clients over the WebSocket. Door defaults to the first
+// door, and Duration is only used by light-on.
+type Command struct {
+	ID       string `json:"id"`
+	Command  string `json:"command"`
+	Door     string `json:"door,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// Ack is sent in reply to each command, with the ID of the command.
+// Data is the door.MoveResponse of open and close,
+// and the light.LightState of light-on and light-off.
+type Ack struct {
+	Type     string      `json:"type"`
+	ID       string      `json:"id"`
+	OK       bool        `json:"ok"`
+	Data     interface{} `json:"data,omitempty"`
+	ErrorMsg string      `json:"errorMsg,omitempty"`
+}
+
+// updateMessage carries the same state as the server-sent event of its type.
+type updateMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// HandleWebSocket sends the same updates as HandleStream as JSON messages,
+// and executes the commands it receives, attributing them to the user and
+// client IP of the request.
+func (h handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// Subscribe before sending the current state so that no change is missed.
+	sub := h.subscriber.Subscribe()
+	defer sub.Stop()
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		h.logger.Info("websocket upgrade failed", lager.Data{"error": err.Error()})
+		return
+	}
+	defer conn.Close()
+
+	logger := h.logger.Session("websocket", lager.Data{"remoteAddr": r.RemoteAddr})
+	logger.Debug("websocket opened")
+	defer logger.Debug("websocket closed")
+
+	err = writeUpdates(conn, h.current())
+	if err != nil {
+		return
+	}
+
+	// The source is read from the request context here, as the context is
+	// cleared when this handler returns, which may be before the reader does.
+	source := events.RequestSource(r)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.readCommands(logger, conn, source)
+	}()
+
+	ticker := time.NewTicker(h.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+
+		case <-ticker.C:
+			err = conn.Ping()
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				logger.Info("subscription ended")
+				return
+			}
+			err = writeUpdates(conn, h.changes(e))
+		}
+
+		if err != nil {
+			logger.Debug("error writing to websocket", lager.Data{"error": err.Error()})
+			return
+		}
+	}
+}
+
+// readCommands returns once the connection is closed.
+func (h handler) readCommands(logger lager.Logger, conn *websocket.Conn, source events.Source) {
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			if err != websocket.ErrClosed {
+				logger.Info("error reading from websocket", lager.Data{"error": err.Error()})
+			}
+			return
+		}
+
+		var ack Ack
+		var c Command
+		err = json.Unmarshal(message, &c)
+		if err != nil {
+			ack = Ack{ErrorMsg: fmt.Sprintf("invalid command: %s", err.Error())}
+		} else {
+			logger.Info("executing command", lager.Data{"id": c.ID, "command": c.Command, "door": c.Door})
+			ack = h.execute(c, source)
+			ack.ID = c.ID
+		}
+		ack.Type = MessageAck
+
+		b, _ := json.Marshal(ack)
+		err = conn.WriteMessage(b)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (h handler) execute(c Command, source events.Source) Ack {
+	switch c.Command {
+	case CommandToggle, CommandOpen, CommandClose:
+		dh, err := h.findDoor(c.Door)
+		if err != nil {
+			return Ack{ErrorMsg: err.Error()}
+		}
+
+		if c.Command == CommandToggle {
+			err = dh.Toggle(source)
+			if err != nil {
+				return Ack{ErrorMsg: err.Error()}
+			}
+			return Ack{OK: true}
+		}
+
+		position := door.StateOpen
+		if c.Command == CommandClose {
+			position = door.StateClosed
+		}
+
+		mr := dh.MoveTo(position, source)
+		switch mr.Result {
+		case door.MoveResultPulsed, door.MoveResultInProgress, door.MoveResultNoOp:
+			return Ack{OK: true, Data: mr}
+		default:
+			errorMsg := mr.ErrorMsg
+			if errorMsg == "" {
+				errorMsg = fmt.Sprintf("door not moved: %s", mr.Result)
+			}
+			return Ack{Data: mr, ErrorMsg: errorMsg}
+		}
+
+	case CommandLightOn:
+		var duration time.Duration
+		if c.Duration != "" {
+			var err error
+			duration, err = time.ParseDuration(c.Duration)
+			if err != nil || duration <= 0 {
+				return Ack{ErrorMsg: fmt.Sprintf("invalid duration: %s", c.Duration)}
+			}
+		}
+
+		ls := h.lightHandler.TurnOn(duration, source)
+		return Ack{OK: ls.ErrorMsg == "", Data: ls, ErrorMsg: ls.ErrorMsg}
+
+	case CommandLightOff:
+		ls := h.lightHandler.TurnOff(source)
+		return Ack{OK: ls.ErrorMsg == "", Data: ls, ErrorMsg: ls.ErrorMsg}
+
+	default:
+		return Ack{ErrorMsg: fmt.Sprintf("unknown command: %s", c.Command)}
+	}
+}
+
+func (h handler) findDoor(name string) (door.Handler, error) {
+	if name == "" {
+		return h.doors.All()[0], nil
+	}
+
+	dh, ok := h.doors.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown door: %s", name)
+	}
+	return dh, nil
+}
+
+func writeUpdates(conn *websocket.Conn, updates []update) error {
+	for _, u := range updates {
+		b, _ := json.Marshal(updateMessage{Type: u.name, Data: u.data})
+		err := conn.WriteMessage(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
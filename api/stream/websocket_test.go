@@ -0,0 +1,241 @@
+package stream_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/light"
+	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
+	"github.com/robdimsdale/garagepi/api/stream"
+	"github.com/robdimsdale/garagepi/websocket"
+)
+
+type wsMessage struct {
+	Type     string          `json:"type"`
+	ID       string          `json:"id"`
+	OK       bool            `json:"ok"`
+	Data     json.RawMessage `json:"data"`
+	ErrorMsg string          `json:"errorMsg"`
+}
+
+var _ = Describe("WebSocket", func() {
+	var (
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		fakeLightHandler *light_fakes.FakeHandler
+		fakeDoors        *door_fakes.FakeDoors
+		fakeDoorHandler  *door_fakes.FakeHandler
+
+		recorded chan events.Event
+
+		server *httptest.Server
+		conn   *websocket.Conn
+	)
+
+	source := events.Source{User: "some-user", ClientIP: "127.0.0.1"}
+
+	BeforeEach(func() {
+		recorded = make(chan events.Event, 10)
+
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeLightHandler.DiscoverLightStateReturns(&light.LightState{StateKnown: true}, nil)
+
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateClosed}, nil)
+
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
+		fakeDoors.GetStub = func(name string) (door.Handler, bool) {
+			return fakeDoorHandler, name == "garage"
+		}
+	})
+
+	JustBeforeEach(func() {
+		h := stream.NewHandler(
+			lagertest.NewTestLogger("websocket test"),
+			fakeSubscriber,
+			fakeLightHandler,
+			fakeDoors,
+			time.Hour,
+		)
+		server = httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+
+		var err error
+		conn, err = websocket.Dial("ws://some-user:some-password@"+strings.TrimPrefix(server.URL, "http://"), nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		server.Close()
+	})
+
+	read := func() wsMessage {
+		message, err := conn.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+
+		var m wsMessage
+		err = json.Unmarshal(message, &m)
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	send := func(c string) wsMessage {
+		err := conn.WriteMessage([]byte(c))
+		Expect(err).NotTo(HaveOccurred())
+
+		for {
+			m := read()
+			if m.Type == stream.MessageAck {
+				return m
+			}
+		}
+	}
+
+	It("sends the current state of the light and doors", func() {
+		m := read()
+		Expect(m.Type).To(Equal(stream.EventLight))
+		Expect(string(m.Data)).To(ContainSubstring(`"StateKnown":true`))
+
+		m = read()
+		Expect(m.Type).To(Equal(stream.EventDoor))
+		Expect(string(m.Data)).To(ContainSubstring(`"state":"closed"`))
+	})
+
+	It("sends changes in state", func() {
+		read()
+		read()
+
+		fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{Name: "garage", State: door.StateOpening}, nil)
+		recorded <- events.Event{Type: events.TypeDoorState, Door: "garage"}
+
+		m := read()
+		Expect(m.Type).To(Equal(stream.EventDoor))
+		Expect(string(m.Data)).To(ContainSubstring(`"state":"opening"`))
+	})
+
+	It("toggles the door as the user of the request and acknowledges the command", func() {
+		ack := send(`{"id": "1", "command": "toggle"}`)
+		Expect(ack).To(Equal(wsMessage{Type: stream.MessageAck, ID: "1", OK: true}))
+
+		Expect(fakeDoorHandler.ToggleCallCount()).To(Equal(1))
+		Expect(fakeDoorHandler.ToggleArgsForCall(0)).To(Equal(source))
+	})
+
+	It("acknowledges a failed toggle with the error", func() {
+		fakeDoorHandler.ToggleReturns(errors.New("gpio error"))
+
+		ack := send(`{"id": "2", "command": "toggle", "door": "garage"}`)
+		Expect(ack.ID).To(Equal("2"))
+		Expect(ack.OK).To(BeFalse())
+		Expect(ack.ErrorMsg).To(Equal("gpio error"))
+	})
+
+	It("moves the door and acknowledges the command with the move response", func() {
+		fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultPulsed})
+
+		ack := send(`{"id": "3", "command": "open"}`)
+		Expect(ack.OK).To(BeTrue())
+		Expect(string(ack.Data)).To(ContainSubstring(`"result":"pulsed"`))
+
+		position, s := fakeDoorHandler.MoveToArgsForCall(0)
+		Expect(position).To(Equal(door.StateOpen))
+		Expect(s).To(Equal(source))
+	})
+
+	It("acknowledges a move which was not made as failed", func() {
+		fakeDoorHandler.MoveToReturns(door.MoveResponse{Result: door.MoveResultRejected})
+
+		ack := send(`{"id": "4", "command": "close"}`)
+		Expect(ack.OK).To(BeFalse())
+		Expect(ack.ErrorMsg).To(Equal("door not moved: rejected"))
+
+		position, _ := fakeDoorHandler.MoveToArgsForCall(0)
+		Expect(position).To(Equal(door.StateClosed))
+	})
+
+	It("switches the light on for a duration", func() {
+		fakeLightHandler.TurnOnReturns(light.LightState{StateKnown: true, LightOn: true})
+
+		ack := send(`{"id": "5", "command": "light-on", "duration": "10m"}`)
+		Expect(ack.OK).To(BeTrue())
+		Expect(string(ack.Data)).To(ContainSubstring(`"LightOn":true`))
+
+		duration, s := fakeLightHandler.TurnOnArgsForCall(0)
+		Expect(duration).To(Equal(10 * time.Minute))
+		Expect(s).To(Equal(source))
+	})
+
+	It("switches the light off", func() {
+		fakeLightHandler.TurnOffReturns(light.LightState{StateKnown: true})
+
+		ack := send(`{"id": "6", "command": "light-off"}`)
+		Expect(ack.OK).To(BeTrue())
+		Expect(fakeLightHandler.TurnOffArgsForCall(0)).To(Equal(source))
+	})
+
+	It("acknowledges a failure to switch the light", func() {
+		fakeLightHandler.TurnOffReturns(light.LightState{ErrorMsg: "gpio error"})
+
+		ack := send(`{"id": "7", "command": "light-off"}`)
+		Expect(ack.OK).To(BeFalse())
+		Expect(ack.ErrorMsg).To(Equal("gpio error"))
+	})
+
+	invalidCommands := map[string]string{
+		`{"id": "8", "command": "light-on", "duration": "forever"}`: "invalid duration: forever",
+		`{"id": "8", "command": "toggle", "door": "shed"}`:          "unknown door: shed",
+		`{"id": "8", "command": "explode"}`:                         "unknown command: explode",
+	}
+
+	for c, errorMsg := range invalidCommands {
+		c, errorMsg := c, errorMsg
+
+		It("rejects "+c, func() {
+			ack := send(c)
+			Expect(ack).To(Equal(wsMessage{Type: stream.MessageAck, ID: "8", ErrorMsg: errorMsg}))
+
+			Expect(fakeDoorHandler.ToggleCallCount()).To(Equal(0))
+			Expect(fakeLightHandler.TurnOnCallCount()).To(Equal(0))
+		})
+	}
+
+	It("rejects messages which are not commands", func() {
+		ack := send(`toggle`)
+		Expect(ack.OK).To(BeFalse())
+		Expect(ack.ErrorMsg).To(HavePrefix("invalid command"))
+	})
+
+	It("stops the subscription when the client disconnects", func() {
+		conn.Close()
+		Eventually(fakeSubscription.StopCallCount).Should(Equal(1))
+	})
+
+	It("closes the connection when the subscription ends", func() {
+		read()
+		read()
+
+		close(recorded)
+
+		_, err := conn.ReadMessage()
+		Expect(err).To(Equal(websocket.ErrClosed))
+	})
+})
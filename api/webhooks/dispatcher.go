@@ -0,0 +1,467 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
+)
+
+type Config struct {
+	// QueuePath is the file in which undelivered events are persisted.
+	// They are only kept in memory if it is empty.
+	QueuePath string
+
+	// QueueSize is the maximum number of undelivered events for each
+	// endpoint. The oldest is dropped to make room for a new event.
+	QueueSize int
+
+	// MaxAttempts is the number of failed attempts after which a delivery is
+	// abandoned. Zero retries until the delivery is dropped from the queue.
+	MaxAttempts int
+
+	// The delay before retrying a failed delivery starts at MinBackoff and
+	// doubles with each failed attempt, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout limits the time taken by each attempt.
+	Timeout time.Duration
+}
+
+// Status is the delivery status of an endpoint. Counts are since garagepi
+// started. Dropped counts deliveries which were abandoned or dropped from
+// a full queue.
+type Status struct {
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	Queued      int        `json:"queued"`
+	Delivered   uint64     `json:"delivered"`
+	Failures    uint64     `json:"failures"`
+	Dropped     uint64     `json:"dropped"`
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
+
+// Dispatcher delivers events to endpoints while it runs. Events are delivered
+// to each endpoint in order; a failed delivery is retried before later events
+// are delivered.
+type Dispatcher interface {
+	ifrit.Runner
+	Statuses() []Status
+	HandleList(w http.ResponseWriter, r *http.Request)
+}
+
+// delivery is the delivery of an event to an endpoint. Its ID is sent in
+// HeaderDelivery so that receivers can recognise a retried delivery. IDs are
+// unique across restarts when the queue is persisted, even if event IDs are
+// not.
+type delivery struct {
+	ID          uint64       `json:"id"`
+	Event       events.Event `json:"event"`
+	Attempts    int          `json:"attempts"`
+	NextAttempt time.Time    `json:"nextAttempt"`
+}
+
+// queueFile is the format of the file at QueuePath.
+type queueFile struct {
+	LastID uint64                `json:"lastID"`
+	Queues map[string][]delivery `json:"queues"`
+}
+
+type endpoint struct {
+	Endpoint
+	queue  []delivery
+	status Status
+
+	// wake is signalled when an event is queued.
+	wake chan struct{}
+}
+
+type dispatcher struct {
+	logger     lager.Logger
+	clock      gpos.OSHelper
+	subscriber events.Subscriber
+	config     Config
+	client     *http.Client
+
+	// mutex guards the queues and statuses of the endpoints, the ID of the
+	// last delivery and the file.
+	mutex     sync.Mutex
+	endpoints []*endpoint
+	lastID    uint64
+}
+
+// NewDispatcher returns a dispatcher which queues events from subscriber for
+// each endpoint which wants them. Events which were queued but not delivered
+// when garagepi last stopped are loaded from config.QueuePath.
+func NewDispatcher(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	subscriber events.Subscriber,
+	endpoints []Endpoint,
+	config Config,
+) (Dispatcher, error) {
+	if config.QueueSize < 1 {
+		return nil, fmt.Errorf("webhook queue size must be positive: %d", config.QueueSize)
+	}
+
+	d := &dispatcher{
+		logger:     logger.Session("webhooks"),
+		clock:      clock,
+		subscriber: subscriber,
+		config:     config,
+		client:     &http.Client{Timeout: config.Timeout},
+	}
+
+	for _, e := range endpoints {
+		d.endpoints = append(d.endpoints, &endpoint{
+			Endpoint: e,
+			wake:     make(chan struct{}, 1),
+		})
+	}
+
+	err := d.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *dispatcher) load() error {
+	if d.config.QueuePath == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(d.config.QueuePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var qf queueFile
+	err = json.Unmarshal(b, &qf)
+	if err != nil {
+		return fmt.Errorf("invalid webhook queue %s: %s", d.config.QueuePath, err)
+	}
+
+	d.lastID = qf.LastID
+	for _, queue := range qf.Queues {
+		for _, dl := range queue {
+			if dl.ID > d.lastID {
+				d.lastID = dl.ID
+			}
+		}
+	}
+
+	for _, e := range d.endpoints {
+		queue := qf.Queues[e.Name]
+		if len(queue) > d.config.QueueSize {
+			e.status.Dropped += uint64(len(queue) - d.config.QueueSize)
+			queue = queue[len(queue)-d.config.QueueSize:]
+		}
+		for i := range queue {
+			// Deliveries queued before deliveries had IDs.
+			if queue[i].ID == 0 {
+				d.lastID++
+				queue[i].ID = d.lastID
+			}
+		}
+		e.queue = queue
+		delete(qf.Queues, e.Name)
+	}
+
+	for name, queue := range qf.Queues {
+		d.logger.Info("discarding queue of unknown webhook", lager.Data{"webhook": name, "queued": len(queue)})
+	}
+
+	return nil
+}
+
+// save must be called with the mutex held. Errors are logged; the queue is
+// saved again when it next changes.
+func (d *dispatcher) save() {
+	if d.config.QueuePath == "" {
+		return
+	}
+
+	qf := queueFile{
+		LastID: d.lastID,
+		Queues: map[string][]delivery{},
+	}
+	for _, e := range d.endpoints {
+		if len(e.queue) > 0 {
+			qf.Queues[e.Name] = e.queue
+		}
+	}
+
+	b, _ := json.Marshal(qf)
+
+	err := writeFile(d.config.QueuePath, b)
+	if err != nil {
+		d.logger.Error("error saving webhook queue", err, lager.Data{"path": d.config.QueuePath})
+	}
+}
+
+func writeFile(path string, b []byte) error {
+	// Write to a temporary file and rename it so the file is never
+	// left partially written.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *dispatcher) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	sub := d.subscriber.Subscribe()
+
+	stop := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	for _, e := range d.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			d.deliver(e, stop)
+		}(e)
+	}
+
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			sub.Stop()
+			close(stop)
+			wg.Wait()
+			return nil
+
+		case ev, ok := <-sub.Events():
+			if !ok {
+				d.logger.Error("subscription ended - events were missed", nil)
+				sub = d.subscriber.Subscribe()
+				continue
+			}
+
+			d.enqueue(ev)
+		}
+	}
+}
+
+func (d *dispatcher) enqueue(ev events.Event) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	queued := false
+	for _, e := range d.endpoints {
+		if !e.wants(ev.Type) {
+			continue
+		}
+
+		if len(e.queue) >= d.config.QueueSize {
+			d.logger.Info("queue full - dropping oldest event", lager.Data{"webhook": e.Name, "id": e.queue[0].ID})
+			e.queue = e.queue[1:]
+			e.status.Dropped++
+		}
+
+		d.lastID++
+		e.queue = append(e.queue, delivery{ID: d.lastID, Event: ev})
+		queued = true
+
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	if queued {
+		d.save()
+	}
+}
+
+// deliver delivers the events queued for e, in order, until stop is closed.
+func (d *dispatcher) deliver(e *endpoint, stop <-chan struct{}) {
+	logger := d.logger.Session("deliver", lager.Data{"webhook": e.Name})
+
+	for {
+		d.mutex.Lock()
+		if len(e.queue) == 0 {
+			d.mutex.Unlock()
+
+			select {
+			case <-e.wake:
+				continue
+			case <-stop:
+				return
+			}
+		}
+		next := e.queue[0]
+		d.mutex.Unlock()
+
+		if wait := next.NextAttempt.Sub(d.clock.Now()); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return
+			}
+		}
+
+		err := d.post(e.Endpoint, next, stop)
+
+		select {
+		case <-stop:
+			// The attempt was cancelled, so it is not counted.
+			return
+		default:
+		}
+
+		d.mutex.Lock()
+		d.attempted(logger, e, next.ID, err)
+		d.save()
+		d.mutex.Unlock()
+	}
+}
+
+// attempted records the result of the attempt at the delivery with id.
+// attempted must be called with the mutex held.
+func (d *dispatcher) attempted(logger lager.Logger, e *endpoint, id uint64, err error) {
+	now := d.clock.Now()
+	e.status.LastAttempt = &now
+
+	// The event may have been dropped from a full queue during the attempt.
+	current := len(e.queue) > 0 && e.queue[0].ID == id
+
+	if err == nil {
+		logger.Debug("delivered", lager.Data{"id": id})
+		e.status.Delivered++
+		e.status.LastSuccess = &now
+		e.status.LastError = ""
+		if current {
+			e.queue = e.queue[1:]
+		}
+		return
+	}
+
+	e.status.Failures++
+	e.status.LastError = err.Error()
+
+	if !current {
+		return
+	}
+
+	head := &e.queue[0]
+	head.Attempts++
+
+	if d.config.MaxAttempts > 0 && head.Attempts >= d.config.MaxAttempts {
+		logger.Error("abandoning delivery", err, lager.Data{"id": id, "attempts": head.Attempts})
+		e.queue = e.queue[1:]
+		e.status.Dropped++
+		return
+	}
+
+	head.NextAttempt = now.Add(d.backoff(head.Attempts))
+	logger.Info("delivery failed - retrying", lager.Data{
+		"id":          id,
+		"attempts":    head.Attempts,
+		"error":       err.Error(),
+		"nextAttempt": head.NextAttempt,
+	})
+}
+
+// backoff returns the delay before the next attempt after attempts failures.
+func (d *dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.config.MinBackoff
+	for i := 1; i < attempts && backoff < d.config.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.config.MaxBackoff {
+		backoff = d.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (d *dispatcher) post(e Endpoint, dl delivery, stop <-chan struct{}) error {
+	ev := dl.Event
+	body, _ := json.Marshal(ev)
+	timestamp := d.clock.Now().Unix()
+
+	req, err := http.NewRequest("POST", e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Cancel = stop
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(ev.Type))
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(dl.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(e.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *dispatcher) Statuses() []Status {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := d.clock.Now()
+
+	statuses := []Status{}
+	for _, e := range d.endpoints {
+		st := e.status
+		st.Name = e.Name
+		st.URL = e.URL
+		st.Queued = len(e.queue)
+		if len(e.queue) > 0 && e.queue[0].NextAttempt.After(now) {
+			next := e.queue[0].NextAttempt
+			st.NextAttempt = &next
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses
+}
+
+func (d *dispatcher) HandleList(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(d.Statuses())
+	w.Write(b)
+}
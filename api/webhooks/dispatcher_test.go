@@ -0,0 +1,309 @@
+package webhooks_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/api/webhooks"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+var _ = Describe("Dispatcher", func() {
+	var (
+		fakeOSHelper     *os_fakes.FakeOSHelper
+		fakeSubscriber   *events_fakes.FakeSubscriber
+		fakeSubscription *events_fakes.FakeSubscription
+		recorded         chan events.Event
+
+		tempDirPath string
+		config      webhooks.Config
+		endpoints   []webhooks.Endpoint
+
+		receiver   *httptest.Server
+		requests   chan request
+		statusCode int
+		codeMutex  sync.Mutex
+
+		dispatcher webhooks.Dispatcher
+		process    ifrit.Process
+	)
+
+	now := time.Date(2016, 1, 4, 12, 0, 0, 0, time.UTC)
+
+	setStatusCode := func(code int) {
+		codeMutex.Lock()
+		defer codeMutex.Unlock()
+		statusCode = code
+	}
+
+	newDispatcher := func() webhooks.Dispatcher {
+		d, err := webhooks.NewDispatcher(
+			lagertest.NewTestLogger("webhooks test"),
+			fakeOSHelper,
+			fakeSubscriber,
+			endpoints,
+			config,
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return d
+	}
+
+	stop := func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	}
+
+	status := func() webhooks.Status {
+		return dispatcher.Statuses()[0]
+	}
+
+	BeforeEach(func() {
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowReturns(now)
+
+		recorded = make(chan events.Event, 10)
+		fakeSubscription = new(events_fakes.FakeSubscription)
+		fakeSubscription.EventsReturns(recorded)
+		fakeSubscriber = new(events_fakes.FakeSubscriber)
+		fakeSubscriber.SubscribeReturns(fakeSubscription)
+
+		setStatusCode(http.StatusOK)
+		requests = make(chan request, 10)
+		receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+
+			codeMutex.Lock()
+			code := statusCode
+			codeMutex.Unlock()
+
+			w.WriteHeader(code)
+
+			select {
+			case requests <- request{header: r.Header, body: body}:
+			default:
+			}
+		}))
+
+		var err error
+		tempDirPath, err = ioutil.TempDir("", "webhooks")
+		Expect(err).NotTo(HaveOccurred())
+
+		config = webhooks.Config{
+			QueuePath:   filepath.Join(tempDirPath, "queue.json"),
+			QueueSize:   10,
+			MaxAttempts: 5,
+			MinBackoff:  10 * time.Millisecond,
+			MaxBackoff:  40 * time.Millisecond,
+			Timeout:     time.Second,
+		}
+
+		endpoints = []webhooks.Endpoint{{
+			Name:   "alarm",
+			URL:    receiver.URL + "/garage",
+			Secret: "s3cret",
+			Events: []events.Type{events.TypeDoorState, events.TypeLoginFailed},
+		}}
+	})
+
+	JustBeforeEach(func() {
+		dispatcher = newDispatcher()
+		process = ifrit.Invoke(dispatcher)
+	})
+
+	AfterEach(func() {
+		stop()
+		receiver.Close()
+		os.RemoveAll(tempDirPath)
+	})
+
+	It("posts signed events which the endpoint wants", func() {
+		recorded <- events.Event{ID: 7, Type: events.TypeLight, State: "on"}
+		recorded <- events.Event{ID: 8, Type: events.TypeDoorState, Door: "garage", State: "opening"}
+
+		var req request
+		Eventually(requests).Should(Receive(&req))
+
+		Expect(req.header.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.header.Get(webhooks.HeaderEvent)).To(Equal("door-state"))
+		Expect(req.header.Get(webhooks.HeaderDelivery)).To(Equal("1"))
+		Expect(req.header.Get(webhooks.HeaderTimestamp)).To(Equal(strconv.FormatInt(now.Unix(), 10)))
+		Expect(req.header.Get(webhooks.HeaderSignature)).To(Equal(webhooks.Sign("s3cret", now.Unix(), req.body)))
+
+		var e events.Event
+		Expect(json.Unmarshal(req.body, &e)).To(Succeed())
+		Expect(e.ID).To(Equal(uint64(8)))
+		Expect(e.Door).To(Equal("garage"))
+
+		Eventually(func() uint64 { return status().Delivered }).Should(Equal(uint64(1)))
+		Expect(status().Queued).To(BeZero())
+		Expect(status().LastSuccess).To(Equal(&now))
+		Consistently(requests, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	Context("when the endpoint fails", func() {
+		BeforeEach(func() {
+			setStatusCode(http.StatusInternalServerError)
+			config.MaxAttempts = 0
+		})
+
+		It("retries with backoff, delivering events in order", func() {
+			recorded <- events.Event{ID: 1, Type: events.TypeDoorState}
+			recorded <- events.Event{ID: 2, Type: events.TypeLoginFailed}
+
+			var req request
+			Eventually(requests).Should(Receive(&req))
+			Expect(req.header.Get(webhooks.HeaderDelivery)).To(Equal("1"))
+
+			Eventually(func() uint64 { return status().Failures }).Should(BeNumerically(">=", 2))
+			Expect(status().LastError).To(Equal("unexpected status code: 500"))
+			Expect(status().Queued).To(Equal(2))
+			Expect(status().NextAttempt).NotTo(BeNil())
+
+			setStatusCode(http.StatusNoContent)
+
+			Eventually(func() int { return status().Queued }).Should(BeZero())
+			Expect(status().Delivered).To(Equal(uint64(2)))
+			Expect(status().Dropped).To(BeZero())
+			Expect(status().LastError).To(BeEmpty())
+
+			// Event 2 is only attempted once event 1 has been delivered.
+			ids := ""
+			for len(requests) > 0 {
+				req = <-requests
+				ids += req.header.Get(webhooks.HeaderDelivery)
+			}
+			Expect(ids).To(MatchRegexp("^1*2$"))
+		})
+
+		It("abandons a delivery after the maximum attempts", func() {
+			config.MaxAttempts = 5
+			stop()
+			dispatcher = newDispatcher()
+			process = ifrit.Invoke(dispatcher)
+
+			recorded <- events.Event{ID: 1, Type: events.TypeDoorState}
+
+			Eventually(func() uint64 { return status().Dropped }).Should(Equal(uint64(1)))
+			Expect(status().Failures).To(Equal(uint64(5)))
+			Expect(status().Queued).To(BeZero())
+		})
+
+		It("drops the oldest event when the queue is full", func() {
+			for i := 1; i <= 12; i++ {
+				recorded <- events.Event{ID: uint64(i), Type: events.TypeDoorState}
+			}
+
+			Eventually(func() uint64 { return status().Dropped }).Should(Equal(uint64(2)))
+			Expect(status().Queued).To(Equal(10))
+		})
+
+		It("persists undelivered events across restarts", func() {
+			recorded <- events.Event{ID: 1, Type: events.TypeDoorState}
+			Eventually(requests).Should(Receive())
+			stop()
+
+			b, err := ioutil.ReadFile(config.QueuePath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring(`"alarm"`))
+
+			setStatusCode(http.StatusOK)
+			for len(requests) > 0 {
+				<-requests
+			}
+
+			dispatcher = newDispatcher()
+			Expect(status().Queued).To(Equal(1))
+			process = ifrit.Invoke(dispatcher)
+
+			var req request
+			Eventually(requests).Should(Receive(&req))
+			Expect(req.header.Get(webhooks.HeaderDelivery)).To(Equal("1"))
+			Eventually(func() int { return status().Queued }).Should(BeZero())
+		})
+	})
+
+	It("does not reuse delivery IDs after a restart", func() {
+		recorded <- events.Event{ID: 1, Type: events.TypeDoorState}
+
+		var req request
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.header.Get(webhooks.HeaderDelivery)).To(Equal("1"))
+		Eventually(func() uint64 { return status().Delivered }).Should(Equal(uint64(1)))
+		stop()
+
+		dispatcher = newDispatcher()
+		process = ifrit.Invoke(dispatcher)
+
+		// Event IDs restart when events are not persisted.
+		recorded <- events.Event{ID: 1, Type: events.TypeDoorState}
+
+		Eventually(requests).Should(Receive(&req))
+		Expect(req.header.Get(webhooks.HeaderDelivery)).To(Equal("2"))
+	})
+
+	Context("when the queue file is invalid", func() {
+		It("returns an error", func() {
+			Expect(ioutil.WriteFile(config.QueuePath, []byte("{"), 0600)).To(Succeed())
+			_, err := webhooks.NewDispatcher(
+				lagertest.NewTestLogger("webhooks test"),
+				fakeOSHelper,
+				fakeSubscriber,
+				endpoints,
+				config,
+			)
+			Expect(err).To(MatchError(ContainSubstring("invalid webhook queue")))
+		})
+	})
+
+	It("requires a positive queue size", func() {
+		config.QueueSize = 0
+		_, err := webhooks.NewDispatcher(
+			lagertest.NewTestLogger("webhooks test"),
+			fakeOSHelper,
+			fakeSubscriber,
+			endpoints,
+			config,
+		)
+		Expect(err).To(MatchError("webhook queue size must be positive: 0"))
+	})
+
+	It("resubscribes when the subscription ends", func() {
+		close(recorded)
+		Eventually(fakeSubscriber.SubscribeCallCount).Should(BeNumerically(">=", 2))
+	})
+
+	Describe("HandleList", func() {
+		It("responds with the status of each endpoint", func() {
+			w := httptest.NewRecorder()
+			dispatcher.HandleList(w, nil)
+
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Body.String()).To(MatchJSON(`[{
+				"name": "alarm",
+				"url": "` + receiver.URL + `/garage",
+				"queued": 0,
+				"delivered": 0,
+				"failures": 0,
+				"dropped": 0
+			}]`))
+		})
+	})
+})
@@ -0,0 +1,144 @@
+// Package webhooks POSTs events to configured URLs. Each delivery is signed
+// with HMAC-SHA256 so that receivers can check it came from garagepi.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+// Headers of each delivery. The body is the JSON encoded event.
+// HeaderDelivery identifies the delivery; it is the same for each attempt.
+const (
+	HeaderEvent     = "X-Garagepi-Event"
+	HeaderDelivery  = "X-Garagepi-Delivery"
+	HeaderTimestamp = "X-Garagepi-Timestamp"
+	HeaderSignature = "X-Garagepi-Signature"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Types are the types of events which may be delivered.
+var Types = []events.Type{
+	events.TypeDoorToggle,
+	events.TypeDoorState,
+	events.TypeLight,
+	events.TypeLoginFailed,
+	events.TypeNotification,
+}
+
+// Endpoint receives events, e.g.
+//
+//	{"name": "alarm", "url": "https://alarm.local/garage", "secret": "s3cret", "events": ["door-state"]}
+//
+// Events may be omitted to deliver all Types.
+type Endpoint struct {
+	Name   string        `json:"name"`
+	URL    string        `json:"url"`
+	Secret string        `json:"secret"`
+	Events []events.Type `json:"events,omitempty"`
+}
+
+func (e Endpoint) wants(t events.Type) bool {
+	if len(e.Events) == 0 {
+		return isDeliverable(t)
+	}
+
+	for _, et := range e.Events {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isDeliverable(t events.Type) bool {
+	for _, dt := range Types {
+		if dt == t {
+			return true
+		}
+	}
+	return false
+}
+
+func Load(path string) ([]Endpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse decodes and validates a JSON array of endpoints.
+func Parse(r io.Reader) ([]Endpoint, error) {
+	var endpoints []Endpoint
+
+	err := json.NewDecoder(r).Decode(&endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhooks: %s", err)
+	}
+
+	err = Validate(endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// Validate checks that endpoint names are unique, and that each endpoint has
+// an http or https URL, a secret and only deliverable event types.
+func Validate(endpoints []Endpoint) error {
+	names := map[string]bool{}
+	for _, e := range endpoints {
+		if !validName.MatchString(e.Name) {
+			return fmt.Errorf("invalid webhook name: '%s'", e.Name)
+		}
+
+		if names[e.Name] {
+			return fmt.Errorf("duplicate webhook name: %s", e.Name)
+		}
+		names[e.Name] = true
+
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url for webhook %s: '%s'", e.Name, e.URL)
+		}
+
+		if e.Secret == "" {
+			return fmt.Errorf("no secret for webhook: %s", e.Name)
+		}
+
+		for _, t := range e.Events {
+			if !isDeliverable(t) {
+				return fmt.Errorf("invalid event type for webhook %s: '%s'", e.Name, t)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a delivery: the hex encoded HMAC-SHA256,
+// keyed with secret, of the timestamp header, a period and the body, prefixed
+// with sha256=. Receivers should compare signatures with hmac.Equal and
+// reject stale timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,88 @@
+package webhooks_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/webhooks"
+)
+
+var _ = Describe("Webhooks", func() {
+	Describe("Parse", func() {
+		It("parses endpoints", func() {
+			endpoints, err := webhooks.Parse(strings.NewReader(`[
+				{"name": "alarm", "url": "https://alarm.local/garage", "secret": "s3cret", "events": ["door-state", "light"]},
+				{"name": "log", "url": "http://logger:8080", "secret": "other"}
+			]`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(endpoints).To(Equal([]webhooks.Endpoint{
+				{
+					Name:   "alarm",
+					URL:    "https://alarm.local/garage",
+					Secret: "s3cret",
+					Events: []events.Type{events.TypeDoorState, events.TypeLight},
+				},
+				{
+					Name:   "log",
+					URL:    "http://logger:8080",
+					Secret: "other",
+				},
+			}))
+		})
+
+		It("returns an error for invalid JSON", func() {
+			_, err := webhooks.Parse(strings.NewReader(`{`))
+			Expect(err).To(MatchError(ContainSubstring("invalid webhooks")))
+		})
+	})
+
+	Describe("Validate", func() {
+		var endpoint webhooks.Endpoint
+
+		BeforeEach(func() {
+			endpoint = webhooks.Endpoint{Name: "alarm", URL: "https://alarm.local", Secret: "s3cret"}
+		})
+
+		It("accepts a valid endpoint", func() {
+			Expect(webhooks.Validate([]webhooks.Endpoint{endpoint})).To(Succeed())
+		})
+
+		It("rejects invalid and duplicate names", func() {
+			invalid := endpoint
+			invalid.Name = "an alarm"
+			Expect(webhooks.Validate([]webhooks.Endpoint{invalid})).To(MatchError("invalid webhook name: 'an alarm'"))
+			Expect(webhooks.Validate([]webhooks.Endpoint{endpoint, endpoint})).To(MatchError("duplicate webhook name: alarm"))
+		})
+
+		It("requires an http or https URL", func() {
+			for _, u := range []string{"", "alarm.local", "ftp://alarm.local", "http://"} {
+				endpoint.URL = u
+				Expect(webhooks.Validate([]webhooks.Endpoint{endpoint})).To(MatchError(ContainSubstring("invalid url for webhook alarm")), u)
+			}
+		})
+
+		It("requires a secret", func() {
+			endpoint.Secret = ""
+			Expect(webhooks.Validate([]webhooks.Endpoint{endpoint})).To(MatchError("no secret for webhook: alarm"))
+		})
+
+		It("only accepts deliverable event types", func() {
+			endpoint.Events = []events.Type{events.TypeDoorState, events.TypeLogin}
+			Expect(webhooks.Validate([]webhooks.Endpoint{endpoint})).To(MatchError("invalid event type for webhook alarm: 'login'"))
+		})
+	})
+
+	Describe("Sign", func() {
+		It("signs the timestamp and body with HMAC-SHA256", func() {
+			// echo -n '1451908800.{"id":1}' | openssl dgst -sha256 -hmac s3cret
+			Expect(webhooks.Sign("s3cret", 1451908800, []byte(`{"id":1}`))).To(Equal(
+				"sha256=df86a791bcbef011d410322f3023135ff99a2b07613d995caa30288fc135a71f",
+			))
+			Expect(webhooks.Sign("s3cret", 1451908801, []byte(`{"id":1}`))).NotTo(Equal(
+				webhooks.Sign("s3cret", 1451908800, []byte(`{"id":1}`)),
+			))
+		})
+	})
+})
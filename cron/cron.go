@@ -0,0 +1,221 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit bounds the search for the next matching time so that
+// expressions which can never match, e.g. 0 0 30 2 *, do not search forever.
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Expression is a standard five-field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field is *, a value, a range a-b, or a list of these separated by
+// commas, optionally followed by a step /n. Months and days of the week may
+// also be given by their three-letter English names. Sunday is 0 or 7.
+//
+// As with cron, if both day-of-month and day-of-week are restricted then
+// a day matches if either of them matches.
+type Expression struct {
+	expr string
+
+	minutes     []bool
+	hours       []bool
+	daysOfMonth []bool
+	months      []bool
+	daysOfWeek  []bool
+
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+// Parse parses a five-field cron expression.
+func Parse(expr string) (Expression, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Expression{}, fmt.Errorf("invalid cron expression: '%s' must have 5 fields", expr)
+	}
+
+	e := Expression{
+		expr:          strings.Join(fields, " "),
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+
+	var err error
+	if e.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Expression{}, fmt.Errorf("invalid minute in cron expression '%s': %s", expr, err)
+	}
+	if e.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Expression{}, fmt.Errorf("invalid hour in cron expression '%s': %s", expr, err)
+	}
+	if e.daysOfMonth, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Expression{}, fmt.Errorf("invalid day of month in cron expression '%s': %s", expr, err)
+	}
+	if e.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return Expression{}, fmt.Errorf("invalid month in cron expression '%s': %s", expr, err)
+	}
+	if e.daysOfWeek, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return Expression{}, fmt.Errorf("invalid day of week in cron expression '%s': %s", expr, err)
+	}
+
+	// 7 is an alias for Sunday.
+	if e.daysOfWeek[7] {
+		e.daysOfWeek[0] = true
+	}
+
+	if e.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return Expression{}, fmt.Errorf("invalid cron expression: '%s' never matches", expr)
+	}
+
+	return e, nil
+}
+
+func parseField(field string, min int, max int, names map[string]int) ([]bool, error) {
+	matches := make([]bool, max+1)
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step: '%s'", part[i+1:])
+			}
+			step = s
+			part = part[:i]
+		}
+
+		var start, end int
+		switch {
+		case part == "*":
+			start, end = min, max
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if start, err = parseValue(bounds[0], min, max, names); err != nil {
+				return nil, err
+			}
+			if end, err = parseValue(bounds[1], min, max, names); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid range: '%s'", part)
+			}
+		default:
+			v, err := parseValue(part, min, max, names)
+			if err != nil {
+				return nil, err
+			}
+			start = v
+			end = v
+			if step > 1 {
+				end = max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			matches[v] = true
+		}
+	}
+
+	return matches, nil
+}
+
+func parseValue(s string, min int, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("invalid value: '%s' must be between %d and %d", s, min, max)
+	}
+
+	return v, nil
+}
+
+// Next returns the first time after t which matches the expression, in the
+// location of t. Times which do not exist in that location, e.g. during
+// a daylight saving transition, are skipped.
+// Next returns the zero time if the expression does not match within
+// the next five years.
+func (e Expression) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(searchLimit)
+
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	for t.Before(limit) {
+		var next time.Time
+		switch {
+		case !e.months[t.Month()]:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !e.matchesDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !e.hours[t.Hour()]:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !e.minutes[t.Minute()]:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// time.Date may normalize a time which does not exist in loc to
+		// an earlier time, so step forward a minute instead.
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+
+	return time.Time{}
+}
+
+func (e Expression) matchesDay(t time.Time) bool {
+	dom := e.daysOfMonth[t.Day()]
+	dow := e.daysOfWeek[t.Weekday()]
+
+	switch {
+	case e.anyDayOfMonth && e.anyDayOfWeek:
+		return true
+	case e.anyDayOfMonth:
+		return dow
+	case e.anyDayOfWeek:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func (e Expression) String() string {
+	return e.expr
+}
+
+func (e Expression) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *Expression) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*e = parsed
+	return nil
+}
@@ -0,0 +1,136 @@
+package cron_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/cron"
+)
+
+var _ = Describe("Cron", func() {
+	// 2016-01-04 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2016, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	next := func(expr string, t time.Time) time.Time {
+		e, err := cron.Parse(expr)
+		Expect(err).NotTo(HaveOccurred())
+		return e.Next(t)
+	}
+
+	Describe("Parsing", func() {
+		It("Should normalize whitespace", func() {
+			e, err := cron.Parse("  30   23 * *  * ")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e.String()).To(Equal("30 23 * * *"))
+		})
+
+		invalid := []string{
+			"",
+			"* * * *",
+			"* * * * * *",
+			"60 * * * *",
+			"* 24 * * *",
+			"* * 0 * *",
+			"* * * 13 *",
+			"* * * * 8",
+			"5-1 * * * *",
+			"*/0 * * * *",
+			"a * * * *",
+			"* * * foo *",
+			"0 0 30 2 *",
+		}
+
+		for _, expr := range invalid {
+			expr := expr
+
+			It("Should return an error for '"+expr+"'", func() {
+				_, err := cron.Parse(expr)
+				Expect(err).To(HaveOccurred())
+			})
+		}
+
+		It("Should round-trip through JSON", func() {
+			e, err := cron.Parse("0 22 * * mon-fri")
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := json.Marshal(e)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(`"0 22 * * mon-fri"`))
+
+			var decoded cron.Expression
+			err = json.Unmarshal(b, &decoded)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded.Next(at(4, 0, 0))).To(Equal(e.Next(at(4, 0, 0))))
+		})
+	})
+
+	Describe("Finding the next time", func() {
+		It("Should find the next time later the same day", func() {
+			Expect(next("30 23 * * *", at(4, 12, 0))).To(Equal(at(4, 23, 30)))
+		})
+
+		It("Should find the next time on the following day once the time has passed", func() {
+			Expect(next("30 23 * * *", at(4, 23, 30))).To(Equal(at(5, 23, 30)))
+		})
+
+		It("Should ignore seconds", func() {
+			Expect(next("* * * * *", at(4, 12, 0).Add(30*time.Second))).To(Equal(at(4, 12, 1)))
+		})
+
+		It("Should support lists, ranges and steps", func() {
+			Expect(next("0,30 * * * *", at(4, 12, 10))).To(Equal(at(4, 12, 30)))
+			Expect(next("*/15 * * * *", at(4, 12, 31))).To(Equal(at(4, 12, 45)))
+			Expect(next("0 9-17/4 * * *", at(4, 14, 0))).To(Equal(at(4, 17, 0)))
+		})
+
+		It("Should skip days of the week which do not match", func() {
+			// Friday 22:30 -> Monday 22:00
+			Expect(next("0 22 * * 1-5", at(8, 22, 30))).To(Equal(at(11, 22, 0)))
+			Expect(next("0 22 * * MON-FRI", at(8, 22, 30))).To(Equal(at(11, 22, 0)))
+		})
+
+		It("Should accept 7 as Sunday", func() {
+			Expect(next("0 8 * * 7", at(4, 0, 0))).To(Equal(at(10, 8, 0)))
+		})
+
+		It("Should match either the day of the month or the day of the week if both are restricted", func() {
+			// Monday the 4th matches the day of the week; the 6th matches the day of the month.
+			Expect(next("0 8 6 * mon", at(4, 9, 0))).To(Equal(at(6, 8, 0)))
+		})
+
+		It("Should move on to matching months", func() {
+			Expect(next("0 0 1 mar *", at(4, 0, 0))).To(Equal(time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC)))
+		})
+
+		It("Should find leap days", func() {
+			Expect(next("0 0 29 2 *", at(4, 0, 0))).To(Equal(time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)))
+			Expect(next("0 0 29 2 *", time.Date(2016, 3, 1, 0, 0, 0, 0, time.UTC))).To(Equal(time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)))
+		})
+
+		Context("In a location with daylight saving time", func() {
+			var loc *time.Location
+
+			BeforeEach(func() {
+				var err error
+				loc, err = time.LoadLocation("America/New_York")
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("Should return times in that location", func() {
+				t := next("30 23 * * *", time.Date(2016, 7, 1, 12, 0, 0, 0, loc))
+				Expect(t).To(Equal(time.Date(2016, 7, 1, 23, 30, 0, 0, loc)))
+				Expect(t.UTC().Hour()).To(Equal(3))
+			})
+
+			It("Should skip times which do not exist", func() {
+				// Clocks went forward from 02:00 to 03:00 on 2016-03-13.
+				t := next("30 2 * * *", time.Date(2016, 3, 12, 12, 0, 0, 0, loc))
+				Expect(t).To(Equal(time.Date(2016, 3, 14, 2, 30, 0, 0, loc)))
+			})
+		})
+	})
+})
@@ -11,6 +11,7 @@ var (
 	allTemplates *template.Template
 
 	filenames = []string{
+		"/templates/devgpio.html.tmpl",
 		"/templates/head.html.tmpl",
 		"/templates/homepage.html.tmpl",
 		"/templates/login.html.tmpl",
@@ -0,0 +1,13 @@
+package gpio
+
+//go:generate counterfeiter . Backend
+
+// Backend provides raw access to GPIO pins. The driver opens the backend
+// once and serializes access to each pin, so backends need only be safe for
+// concurrent access to different pins.
+type Backend interface {
+	Open() error
+	Close() error
+	Read(pin uint) (bool, error)
+	Write(pin uint, high bool) error
+}
@@ -0,0 +1,266 @@
+package cdev
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/robdimsdale/garagepi/gpio"
+)
+
+const consumer = "garagepi"
+
+type line struct {
+	fd     int
+	output bool
+
+	// events is set while edge events are being read from the line.
+	events io.ReadCloser
+}
+
+type backend struct {
+	sys  Syscaller
+	path string
+
+	mutex  sync.Mutex
+	chipFd int
+	lines  map[uint]*line
+}
+
+// NewBackend returns a backend for the GPIO chip at path, e.g. /dev/gpiochip0.
+// Pins are line offsets on the chip. Each line is requested when first used
+// and held until the backend is closed.
+func NewBackend(sys Syscaller, path string) gpio.Backend {
+	return &backend{
+		sys:   sys,
+		path:  path,
+		lines: map[uint]*line{},
+	}
+}
+
+func (b *backend) Open() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	fd, err := b.sys.Open(b.path)
+	if err != nil {
+		return fmt.Errorf("opening gpio chip %s: %s", b.path, err)
+	}
+
+	b.chipFd = fd
+	return nil
+}
+
+func (b *backend) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for pin, l := range b.lines {
+		b.release(l)
+		delete(b.lines, pin)
+	}
+
+	return b.sys.Close(b.chipFd)
+}
+
+func (b *backend) Read(pin uint) (bool, error) {
+	l, err := b.line(pin, false, false)
+	if err != nil {
+		return false, err
+	}
+
+	values := LineValues{Mask: 1}
+	err = b.sys.Ioctl(l.fd, LineGetValuesIoctl, unsafe.Pointer(&values))
+	if err != nil {
+		return false, fmt.Errorf("reading gpio line %d: %s", pin, err)
+	}
+
+	return values.Bits&1 == 1, nil
+}
+
+func (b *backend) Write(pin uint, high bool) error {
+	l, err := b.line(pin, true, high)
+	if err != nil {
+		return err
+	}
+
+	values := LineValues{Mask: 1, Bits: bit(high)}
+	err = b.sys.Ioctl(l.fd, LineSetValuesIoctl, unsafe.Pointer(&values))
+	if err != nil {
+		return fmt.Errorf("writing gpio line %d: %s", pin, err)
+	}
+
+	return nil
+}
+
+// line returns the requested line for pin, requesting it if necessary.
+// If output is true the line is reconfigured as an output driven to high
+// if it was previously requested for reading. Lines are requested for
+// reading without changing their direction, so reading a line which is
+// driven as an output, e.g. a relay after a restart, does not let it float.
+func (b *backend) line(pin uint, output bool, high bool) (*line, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	l, ok := b.lines[pin]
+	if ok && (l.output || !output) {
+		return l, nil
+	}
+
+	if ok && l.events != nil {
+		return nil, fmt.Errorf("gpio line %d is being watched", pin)
+	}
+
+	config := lineConfig(output, high)
+
+	if ok {
+		err := b.sys.Ioctl(l.fd, LineSetConfigIoctl, unsafe.Pointer(&config))
+		if err != nil {
+			return nil, fmt.Errorf("configuring gpio line %d: %s", pin, err)
+		}
+		l.output = true
+		return l, nil
+	}
+
+	return b.request(pin, config)
+}
+
+// request must be called with the mutex held.
+func (b *backend) request(pin uint, config LineConfig) (*line, error) {
+	req := LineRequest{
+		NumLines: 1,
+		Config:   config,
+	}
+	req.Offsets[0] = uint32(pin)
+	copy(req.Consumer[:], consumer)
+
+	err := b.sys.Ioctl(b.chipFd, GetLineIoctl, unsafe.Pointer(&req))
+	if err != nil {
+		return nil, fmt.Errorf("requesting gpio line %d: %s", pin, err)
+	}
+
+	l := &line{
+		fd:     int(req.Fd),
+		output: config.Flags&LineFlagOutput != 0,
+	}
+	b.lines[pin] = l
+	return l, nil
+}
+
+// Interrupts requests edge detection on the line for pin and reads its edge
+// events until stopped. Stopping releases the line.
+func (b *backend) Interrupts(pin uint, levels chan<- bool) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	config := LineConfig{Flags: LineFlagInput | LineFlagEdgeRising | LineFlagEdgeFalling}
+
+	l, ok := b.lines[pin]
+	if ok {
+		if l.output || l.events != nil {
+			return nil, fmt.Errorf("gpio line %d is in use", pin)
+		}
+
+		err := b.sys.Ioctl(l.fd, LineSetConfigIoctl, unsafe.Pointer(&config))
+		if err != nil {
+			return nil, fmt.Errorf("configuring edge detection on gpio line %d: %s", pin, err)
+		}
+	} else {
+		var err error
+		l, err = b.request(pin, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events, err := b.sys.Events(l.fd)
+	if err != nil {
+		b.sys.Close(l.fd)
+		delete(b.lines, pin)
+		return nil, fmt.Errorf("reading events of gpio line %d: %s", pin, err)
+	}
+	l.events = events
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readEvents(events, levels)
+	}()
+
+	return func() {
+		b.mutex.Lock()
+		if b.lines[pin] == l {
+			delete(b.lines, pin)
+			b.release(l)
+		}
+		b.mutex.Unlock()
+
+		<-done
+	}, nil
+}
+
+func readEvents(r io.Reader, levels chan<- bool) {
+	var e LineEvent
+	buf := (*[LineEventLen]byte)(unsafe.Pointer(&e))[:]
+
+	for {
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			return
+		}
+
+		var level bool
+		switch e.ID {
+		case LineEventIDRisingEdge:
+			level = true
+		case LineEventIDFallingEdge:
+			level = false
+		default:
+			continue
+		}
+
+		select {
+		case levels <- level:
+		default:
+		}
+	}
+}
+
+// release must be called with the mutex held.
+func (b *backend) release(l *line) {
+	if l.events != nil {
+		l.events.Close()
+		return
+	}
+	b.sys.Close(l.fd)
+}
+
+// lineConfig returns the configuration of a line requested for writing high,
+// or for reading if output is false. Neither direction flag is set for
+// reading, which the kernel takes as leaving the line's direction as is.
+func lineConfig(output bool, high bool) LineConfig {
+	if !output {
+		return LineConfig{}
+	}
+
+	config := LineConfig{
+		Flags:    LineFlagOutput,
+		NumAttrs: 1,
+	}
+	config.Attrs[0] = LineConfigAttribute{
+		Attr: LineAttribute{
+			ID:    LineAttrIDOutputValues,
+			Value: bit(high),
+		},
+		Mask: 1,
+	}
+	return config
+}
+
+func bit(high bool) uint64 {
+	if high {
+		return 1
+	}
+	return 0
+}
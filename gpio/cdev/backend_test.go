@@ -0,0 +1,321 @@
+package cdev_test
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/gpio"
+	"github.com/robdimsdale/garagepi/gpio/cdev"
+	cdev_fakes "github.com/robdimsdale/garagepi/gpio/cdev/fakes"
+)
+
+const (
+	chipPath = "/dev/gpiochip0"
+	chipFd   = 3
+)
+
+// fakeChip emulates the kernel side of the GPIO character device uAPI.
+type fakeChip struct {
+	mutex    sync.Mutex
+	nextFd   int
+	requests []cdev.LineRequest
+	configs  []cdev.LineConfig
+	levels   map[uint32]bool
+	outputs  map[uint32]bool
+	lineFds  map[int]uint32
+	closed   []int
+}
+
+func newFakeChip() *fakeChip {
+	return &fakeChip{
+		nextFd:  10,
+		levels:  map[uint32]bool{},
+		outputs: map[uint32]bool{},
+		lineFds: map[int]uint32{},
+	}
+}
+
+func (c *fakeChip) ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	switch request {
+	case cdev.GetLineIoctl:
+		if fd != chipFd {
+			return syscall.EBADF
+		}
+		req := (*cdev.LineRequest)(arg)
+		c.requests = append(c.requests, *req)
+
+		offset := req.Offsets[0]
+		c.apply(offset, req.Config)
+
+		req.Fd = int32(c.nextFd)
+		c.lineFds[c.nextFd] = offset
+		c.nextFd++
+	case cdev.LineSetConfigIoctl:
+		offset, ok := c.lineFds[fd]
+		if !ok {
+			return syscall.EBADF
+		}
+		config := (*cdev.LineConfig)(arg)
+		c.configs = append(c.configs, *config)
+		c.apply(offset, *config)
+	case cdev.LineGetValuesIoctl:
+		offset, ok := c.lineFds[fd]
+		if !ok {
+			return syscall.EBADF
+		}
+		values := (*cdev.LineValues)(arg)
+		values.Bits = 0
+		if c.levels[offset] {
+			values.Bits = 1
+		}
+	case cdev.LineSetValuesIoctl:
+		offset, ok := c.lineFds[fd]
+		if !ok {
+			return syscall.EBADF
+		}
+		values := (*cdev.LineValues)(arg)
+		c.levels[offset] = values.Bits&1 == 1
+	default:
+		return syscall.ENOTTY
+	}
+
+	return nil
+}
+
+// apply configures the line at offset. Its direction is left as is unless
+// the input or output flag is set.
+func (c *fakeChip) apply(offset uint32, config cdev.LineConfig) {
+	switch {
+	case config.Flags&cdev.LineFlagOutput != 0:
+		c.outputs[offset] = true
+	case config.Flags&cdev.LineFlagInput != 0:
+		c.outputs[offset] = false
+	}
+
+	for i := uint32(0); i < config.NumAttrs; i++ {
+		attr := config.Attrs[i]
+		if attr.Attr.ID == cdev.LineAttrIDOutputValues && attr.Mask&1 == 1 {
+			c.levels[offset] = attr.Attr.Value&1 == 1
+		}
+	}
+}
+
+func (c *fakeChip) close(fd int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = append(c.closed, fd)
+	delete(c.lineFds, fd)
+	return nil
+}
+
+var _ = Describe("Backend", func() {
+	var (
+		fakeSyscaller *cdev_fakes.FakeSyscaller
+		chip          *fakeChip
+		backend       gpio.Backend
+	)
+
+	BeforeEach(func() {
+		chip = newFakeChip()
+
+		fakeSyscaller = new(cdev_fakes.FakeSyscaller)
+		fakeSyscaller.OpenReturns(chipFd, nil)
+		fakeSyscaller.IoctlStub = chip.ioctl
+		fakeSyscaller.CloseStub = chip.close
+
+		backend = cdev.NewBackend(fakeSyscaller, chipPath)
+		Expect(backend.Open()).To(Succeed())
+	})
+
+	It("Should match the kernel's structure sizes", func() {
+		Expect(unsafe.Sizeof(cdev.LineRequest{})).To(Equal(uintptr(592)))
+		Expect(unsafe.Sizeof(cdev.LineConfig{})).To(Equal(uintptr(272)))
+		Expect(unsafe.Sizeof(cdev.LineValues{})).To(Equal(uintptr(16)))
+		Expect(cdev.GetLineIoctl).To(Equal(uintptr(0xC250B407)))
+	})
+
+	It("Should open the chip", func() {
+		Expect(fakeSyscaller.OpenCallCount()).To(Equal(1))
+		Expect(fakeSyscaller.OpenArgsForCall(0)).To(Equal(chipPath))
+	})
+
+	It("Should return an error when opening the chip fails", func() {
+		fakeSyscaller.OpenReturns(-1, syscall.ENOENT)
+		Expect(backend.Open()).To(HaveOccurred())
+	})
+
+	Describe("Reading", func() {
+		It("Should request the line without changing its direction once", func() {
+			chip.levels[4] = true
+
+			Expect(backend.Read(4)).To(BeTrue())
+			Expect(backend.Read(4)).To(BeTrue())
+
+			Expect(chip.requests).To(HaveLen(1))
+			req := chip.requests[0]
+			Expect(req.NumLines).To(Equal(uint32(1)))
+			Expect(req.Offsets[0]).To(Equal(uint32(4)))
+			Expect(req.Config.Flags).To(BeZero())
+			Expect(string(req.Consumer[:8])).To(Equal("garagepi"))
+		})
+
+		It("Should not reconfigure a line which is driven as an output", func() {
+			chip.outputs[17] = true
+			chip.levels[17] = true
+
+			Expect(backend.Read(17)).To(BeTrue())
+
+			Expect(chip.outputs[17]).To(BeTrue())
+			Expect(chip.levels[17]).To(BeTrue())
+			Expect(chip.configs).To(BeEmpty())
+		})
+
+		It("Should read low", func() {
+			Expect(backend.Read(4)).To(BeFalse())
+		})
+
+		It("Should return an error when requesting the line fails", func() {
+			fakeSyscaller.IoctlReturns(syscall.EBUSY)
+			fakeSyscaller.IoctlStub = nil
+
+			_, err := backend.Read(4)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Writing", func() {
+		It("Should request the line as an output driven to the written level", func() {
+			Expect(backend.Write(17, true)).To(Succeed())
+
+			Expect(chip.requests).To(HaveLen(1))
+			req := chip.requests[0]
+			Expect(req.Offsets[0]).To(Equal(uint32(17)))
+			Expect(req.Config.Flags).To(Equal(cdev.LineFlagOutput))
+			Expect(req.Config.NumAttrs).To(Equal(uint32(1)))
+			Expect(req.Config.Attrs[0].Attr.ID).To(Equal(cdev.LineAttrIDOutputValues))
+			Expect(req.Config.Attrs[0].Attr.Value).To(Equal(uint64(1)))
+
+			Expect(chip.levels[17]).To(BeTrue())
+		})
+
+		It("Should reuse the line for subsequent writes and reads", func() {
+			Expect(backend.Write(17, true)).To(Succeed())
+			Expect(backend.Write(17, false)).To(Succeed())
+			Expect(chip.levels[17]).To(BeFalse())
+
+			Expect(backend.Read(17)).To(BeFalse())
+			Expect(chip.requests).To(HaveLen(1))
+		})
+
+		It("Should reconfigure a line previously read as an output", func() {
+			Expect(backend.Read(17)).To(BeFalse())
+			Expect(backend.Write(17, true)).To(Succeed())
+
+			Expect(chip.requests).To(HaveLen(1))
+			Expect(chip.configs).To(HaveLen(1))
+			Expect(chip.configs[0].Flags).To(Equal(cdev.LineFlagOutput))
+			Expect(chip.levels[17]).To(BeTrue())
+		})
+
+		It("Should return an error when setting values fails", func() {
+			Expect(backend.Write(17, true)).To(Succeed())
+
+			fakeSyscaller.IoctlStub = func(fd int, request uintptr, arg unsafe.Pointer) error {
+				return errors.New("ioctl error")
+			}
+			Expect(backend.Write(17, false)).To(HaveOccurred())
+		})
+	})
+
+	Describe("Interrupts", func() {
+		var (
+			eventsReader *io.PipeReader
+			eventsWriter *io.PipeWriter
+			levels       chan bool
+			interrupter  gpio.Interrupter
+		)
+
+		writeEvent := func(id uint32) {
+			e := cdev.LineEvent{ID: id, Offset: 27}
+			_, err := eventsWriter.Write((*[cdev.LineEventLen]byte)(unsafe.Pointer(&e))[:])
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			eventsReader, eventsWriter = io.Pipe()
+			fakeSyscaller.EventsReturns(eventsReader, nil)
+			levels = make(chan bool, 10)
+
+			var ok bool
+			interrupter, ok = backend.(gpio.Interrupter)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("Should request the line with edge detection and deliver levels from its events", func() {
+			stop, err := interrupter.Interrupts(27, levels)
+			Expect(err).NotTo(HaveOccurred())
+			defer stop()
+
+			Expect(chip.requests).To(HaveLen(1))
+			Expect(chip.requests[0].Config.Flags).To(Equal(cdev.LineFlagInput | cdev.LineFlagEdgeRising | cdev.LineFlagEdgeFalling))
+			Expect(fakeSyscaller.EventsArgsForCall(0)).To(Equal(10))
+
+			writeEvent(cdev.LineEventIDRisingEdge)
+			Eventually(levels).Should(Receive(BeTrue()))
+
+			writeEvent(cdev.LineEventIDFallingEdge)
+			Eventually(levels).Should(Receive(BeFalse()))
+		})
+
+		It("Should enable edge detection on a line already requested as an input", func() {
+			Expect(backend.Read(27)).To(BeFalse())
+
+			stop, err := interrupter.Interrupts(27, levels)
+			Expect(err).NotTo(HaveOccurred())
+			defer stop()
+
+			Expect(chip.requests).To(HaveLen(1))
+			Expect(chip.configs).To(HaveLen(1))
+			Expect(chip.configs[0].Flags).To(Equal(cdev.LineFlagInput | cdev.LineFlagEdgeRising | cdev.LineFlagEdgeFalling))
+		})
+
+		It("Should not watch an output line", func() {
+			Expect(backend.Write(27, true)).To(Succeed())
+
+			_, err := interrupter.Interrupts(27, levels)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should release the line when stopped", func() {
+			stop, err := interrupter.Interrupts(27, levels)
+			Expect(err).NotTo(HaveOccurred())
+
+			stop()
+
+			_, err = eventsWriter.Write([]byte{0})
+			Expect(err).To(Equal(io.ErrClosedPipe))
+
+			Expect(backend.Read(27)).To(BeFalse())
+			Expect(chip.requests).To(HaveLen(2))
+		})
+	})
+
+	Describe("Closing", func() {
+		It("Should release requested lines and close the chip", func() {
+			Expect(backend.Write(17, true)).To(Succeed())
+			Expect(backend.Read(4)).To(BeFalse())
+
+			Expect(backend.Close()).To(Succeed())
+			Expect(chip.closed).To(ConsistOf(10, 11, chipFd))
+		})
+	})
+})
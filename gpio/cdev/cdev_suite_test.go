@@ -0,0 +1,13 @@
+package cdev_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestCdev(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Cdev Suite")
+}
@@ -0,0 +1,183 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/robdimsdale/garagepi/gpio/cdev"
+)
+
+type FakeSyscaller struct {
+	OpenStub        func(path string) (int, error)
+	openMutex       sync.RWMutex
+	openArgsForCall []struct {
+		path string
+	}
+	openReturns struct {
+		result1 int
+		result2 error
+	}
+	CloseStub        func(fd int) error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct {
+		fd int
+	}
+	closeReturns struct {
+		result1 error
+	}
+	IoctlStub        func(fd int, request uintptr, arg unsafe.Pointer) error
+	ioctlMutex       sync.RWMutex
+	ioctlArgsForCall []struct {
+		fd      int
+		request uintptr
+		arg     unsafe.Pointer
+	}
+	ioctlReturns struct {
+		result1 error
+	}
+	EventsStub        func(fd int) (io.ReadCloser, error)
+	eventsMutex       sync.RWMutex
+	eventsArgsForCall []struct {
+		fd int
+	}
+	eventsReturns struct {
+		result1 io.ReadCloser
+		result2 error
+	}
+}
+
+func (fake *FakeSyscaller) Open(path string) (int, error) {
+	fake.openMutex.Lock()
+	fake.openArgsForCall = append(fake.openArgsForCall, struct {
+		path string
+	}{path})
+	fake.openMutex.Unlock()
+	if fake.OpenStub != nil {
+		return fake.OpenStub(path)
+	} else {
+		return fake.openReturns.result1, fake.openReturns.result2
+	}
+}
+
+func (fake *FakeSyscaller) OpenCallCount() int {
+	fake.openMutex.RLock()
+	defer fake.openMutex.RUnlock()
+	return len(fake.openArgsForCall)
+}
+
+func (fake *FakeSyscaller) OpenArgsForCall(i int) string {
+	fake.openMutex.RLock()
+	defer fake.openMutex.RUnlock()
+	return fake.openArgsForCall[i].path
+}
+
+func (fake *FakeSyscaller) OpenReturns(result1 int, result2 error) {
+	fake.OpenStub = nil
+	fake.openReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeSyscaller) Close(fd int) error {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct {
+		fd int
+	}{fd})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		return fake.CloseStub(fd)
+	} else {
+		return fake.closeReturns.result1
+	}
+}
+
+func (fake *FakeSyscaller) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeSyscaller) CloseArgsForCall(i int) int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return fake.closeArgsForCall[i].fd
+}
+
+func (fake *FakeSyscaller) CloseReturns(result1 error) {
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSyscaller) Ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	fake.ioctlMutex.Lock()
+	fake.ioctlArgsForCall = append(fake.ioctlArgsForCall, struct {
+		fd      int
+		request uintptr
+		arg     unsafe.Pointer
+	}{fd, request, arg})
+	fake.ioctlMutex.Unlock()
+	if fake.IoctlStub != nil {
+		return fake.IoctlStub(fd, request, arg)
+	} else {
+		return fake.ioctlReturns.result1
+	}
+}
+
+func (fake *FakeSyscaller) IoctlCallCount() int {
+	fake.ioctlMutex.RLock()
+	defer fake.ioctlMutex.RUnlock()
+	return len(fake.ioctlArgsForCall)
+}
+
+func (fake *FakeSyscaller) IoctlArgsForCall(i int) (int, uintptr, unsafe.Pointer) {
+	fake.ioctlMutex.RLock()
+	defer fake.ioctlMutex.RUnlock()
+	return fake.ioctlArgsForCall[i].fd, fake.ioctlArgsForCall[i].request, fake.ioctlArgsForCall[i].arg
+}
+
+func (fake *FakeSyscaller) IoctlReturns(result1 error) {
+	fake.IoctlStub = nil
+	fake.ioctlReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeSyscaller) Events(fd int) (io.ReadCloser, error) {
+	fake.eventsMutex.Lock()
+	fake.eventsArgsForCall = append(fake.eventsArgsForCall, struct {
+		fd int
+	}{fd})
+	fake.eventsMutex.Unlock()
+	if fake.EventsStub != nil {
+		return fake.EventsStub(fd)
+	} else {
+		return fake.eventsReturns.result1, fake.eventsReturns.result2
+	}
+}
+
+func (fake *FakeSyscaller) EventsCallCount() int {
+	fake.eventsMutex.RLock()
+	defer fake.eventsMutex.RUnlock()
+	return len(fake.eventsArgsForCall)
+}
+
+func (fake *FakeSyscaller) EventsArgsForCall(i int) int {
+	fake.eventsMutex.RLock()
+	defer fake.eventsMutex.RUnlock()
+	return fake.eventsArgsForCall[i].fd
+}
+
+func (fake *FakeSyscaller) EventsReturns(result1 io.ReadCloser, result2 error) {
+	fake.EventsStub = nil
+	fake.eventsReturns = struct {
+		result1 io.ReadCloser
+		result2 error
+	}{result1, result2}
+}
+
+var _ cdev.Syscaller = new(FakeSyscaller)
@@ -0,0 +1,54 @@
+package cdev
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+//go:generate counterfeiter . Syscaller
+
+// Syscaller performs the system calls needed by the backend, so that the
+// backend can be tested without a GPIO chip.
+type Syscaller interface {
+	Open(path string) (int, error)
+	Close(fd int) error
+	Ioctl(fd int, request uintptr, arg unsafe.Pointer) error
+
+	// Events returns a reader of the edge events of a line. Closing the
+	// reader releases the line.
+	Events(fd int) (io.ReadCloser, error)
+}
+
+type syscaller struct{}
+
+func NewSyscaller() Syscaller {
+	return &syscaller{}
+}
+
+func (s syscaller) Open(path string) (int, error) {
+	return syscall.Open(path, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+}
+
+func (s syscaller) Close(fd int) error {
+	return syscall.Close(fd)
+}
+
+func (s syscaller) Ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (s syscaller) Events(fd int) (io.ReadCloser, error) {
+	// A non-blocking file is read through the runtime poller, so closing
+	// it unblocks any pending read.
+	err := syscall.SetNonblock(fd, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), "gpio-line"), nil
+}
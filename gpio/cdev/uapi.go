@@ -0,0 +1,103 @@
+package cdev
+
+// Structures and constants of version 2 of the Linux GPIO character device
+// uAPI, from include/uapi/linux/gpio.h. Field order and sizes match the
+// kernel's layout on both 32 and 64-bit platforms.
+
+const (
+	MaxLines       = 64
+	MaxNameSize    = 32
+	MaxLineAttrs   = 10
+	lineRequestLen = 592
+	lineConfigLen  = 272
+	lineValuesLen  = 16
+	LineEventLen   = 48
+)
+
+const (
+	LineFlagUsed        uint64 = 1 << 0
+	LineFlagActiveLow   uint64 = 1 << 1
+	LineFlagInput       uint64 = 1 << 2
+	LineFlagOutput      uint64 = 1 << 3
+	LineFlagEdgeRising  uint64 = 1 << 4
+	LineFlagEdgeFalling uint64 = 1 << 5
+)
+
+const (
+	LineAttrIDFlags        uint32 = 1
+	LineAttrIDOutputValues uint32 = 2
+	LineAttrIDDebounce     uint32 = 3
+)
+
+// LineAttribute is struct gpio_v2_line_attribute. Value holds the flags,
+// values or debounce period (in microseconds) depending on ID.
+type LineAttribute struct {
+	ID      uint32
+	Padding uint32
+	Value   uint64
+}
+
+// LineConfigAttribute is struct gpio_v2_line_config_attribute.
+type LineConfigAttribute struct {
+	Attr LineAttribute
+	Mask uint64
+}
+
+// LineConfig is struct gpio_v2_line_config.
+type LineConfig struct {
+	Flags    uint64
+	NumAttrs uint32
+	Padding  [5]uint32
+	Attrs    [MaxLineAttrs]LineConfigAttribute
+}
+
+// LineRequest is struct gpio_v2_line_request.
+type LineRequest struct {
+	Offsets         [MaxLines]uint32
+	Consumer        [MaxNameSize]byte
+	Config          LineConfig
+	NumLines        uint32
+	EventBufferSize uint32
+	Padding         [5]uint32
+	Fd              int32
+}
+
+// LineValues is struct gpio_v2_line_values.
+type LineValues struct {
+	Bits uint64
+	Mask uint64
+}
+
+const (
+	LineEventIDRisingEdge  uint32 = 1
+	LineEventIDFallingEdge uint32 = 2
+)
+
+// LineEvent is struct gpio_v2_line_event, read from a line requested with
+// edge detection.
+type LineEvent struct {
+	TimestampNs uint64
+	ID          uint32
+	Offset      uint32
+	Seqno       uint32
+	LineSeqno   uint32
+	Padding     [6]uint32
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+
+	gpioIoctlType = 0xB4
+)
+
+func iowr(nr uintptr, size uintptr) uintptr {
+	return (iocRead|iocWrite)<<30 | size<<16 | gpioIoctlType<<8 | nr
+}
+
+var (
+	GetLineIoctl       = iowr(0x07, lineRequestLen)
+	LineSetConfigIoctl = iowr(0x0D, lineConfigLen)
+	LineGetValuesIoctl = iowr(0x0E, lineValuesLen)
+	LineSetValuesIoctl = iowr(0x0F, lineValuesLen)
+)
@@ -0,0 +1,157 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/gpio"
+)
+
+type FakeBackend struct {
+	OpenStub        func() error
+	openMutex       sync.RWMutex
+	openArgsForCall []struct{}
+	openReturns     struct {
+		result1 error
+	}
+	CloseStub        func() error
+	closeMutex       sync.RWMutex
+	closeArgsForCall []struct{}
+	closeReturns     struct {
+		result1 error
+	}
+	ReadStub        func(pin uint) (bool, error)
+	readMutex       sync.RWMutex
+	readArgsForCall []struct {
+		pin uint
+	}
+	readReturns struct {
+		result1 bool
+		result2 error
+	}
+	WriteStub        func(pin uint, high bool) error
+	writeMutex       sync.RWMutex
+	writeArgsForCall []struct {
+		pin  uint
+		high bool
+	}
+	writeReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeBackend) Open() error {
+	fake.openMutex.Lock()
+	fake.openArgsForCall = append(fake.openArgsForCall, struct{}{})
+	fake.openMutex.Unlock()
+	if fake.OpenStub != nil {
+		return fake.OpenStub()
+	} else {
+		return fake.openReturns.result1
+	}
+}
+
+func (fake *FakeBackend) OpenCallCount() int {
+	fake.openMutex.RLock()
+	defer fake.openMutex.RUnlock()
+	return len(fake.openArgsForCall)
+}
+
+func (fake *FakeBackend) OpenReturns(result1 error) {
+	fake.OpenStub = nil
+	fake.openReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBackend) Close() error {
+	fake.closeMutex.Lock()
+	fake.closeArgsForCall = append(fake.closeArgsForCall, struct{}{})
+	fake.closeMutex.Unlock()
+	if fake.CloseStub != nil {
+		return fake.CloseStub()
+	} else {
+		return fake.closeReturns.result1
+	}
+}
+
+func (fake *FakeBackend) CloseCallCount() int {
+	fake.closeMutex.RLock()
+	defer fake.closeMutex.RUnlock()
+	return len(fake.closeArgsForCall)
+}
+
+func (fake *FakeBackend) CloseReturns(result1 error) {
+	fake.CloseStub = nil
+	fake.closeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeBackend) Read(pin uint) (bool, error) {
+	fake.readMutex.Lock()
+	fake.readArgsForCall = append(fake.readArgsForCall, struct {
+		pin uint
+	}{pin})
+	fake.readMutex.Unlock()
+	if fake.ReadStub != nil {
+		return fake.ReadStub(pin)
+	} else {
+		return fake.readReturns.result1, fake.readReturns.result2
+	}
+}
+
+func (fake *FakeBackend) ReadCallCount() int {
+	fake.readMutex.RLock()
+	defer fake.readMutex.RUnlock()
+	return len(fake.readArgsForCall)
+}
+
+func (fake *FakeBackend) ReadArgsForCall(i int) uint {
+	fake.readMutex.RLock()
+	defer fake.readMutex.RUnlock()
+	return fake.readArgsForCall[i].pin
+}
+
+func (fake *FakeBackend) ReadReturns(result1 bool, result2 error) {
+	fake.ReadStub = nil
+	fake.readReturns = struct {
+		result1 bool
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeBackend) Write(pin uint, high bool) error {
+	fake.writeMutex.Lock()
+	fake.writeArgsForCall = append(fake.writeArgsForCall, struct {
+		pin  uint
+		high bool
+	}{pin, high})
+	fake.writeMutex.Unlock()
+	if fake.WriteStub != nil {
+		return fake.WriteStub(pin, high)
+	} else {
+		return fake.writeReturns.result1
+	}
+}
+
+func (fake *FakeBackend) WriteCallCount() int {
+	fake.writeMutex.RLock()
+	defer fake.writeMutex.RUnlock()
+	return len(fake.writeArgsForCall)
+}
+
+func (fake *FakeBackend) WriteArgsForCall(i int) (uint, bool) {
+	fake.writeMutex.RLock()
+	defer fake.writeMutex.RUnlock()
+	return fake.writeArgsForCall[i].pin, fake.writeArgsForCall[i].high
+}
+
+func (fake *FakeBackend) WriteReturns(result1 error) {
+	fake.WriteStub = nil
+	fake.writeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ gpio.Backend = new(FakeBackend)
@@ -3,6 +3,7 @@ package fakes
 
 import (
 	"sync"
+	"time"
 
 	"github.com/robdimsdale/garagepi/gpio"
 )
@@ -33,6 +34,17 @@ type FakeGpio struct {
 	writeHighReturns struct {
 		result1 error
 	}
+	WatchStub        func(pin uint, edge gpio.Edge, debounce time.Duration) (gpio.Watch, error)
+	watchMutex       sync.RWMutex
+	watchArgsForCall []struct {
+		pin      uint
+		edge     gpio.Edge
+		debounce time.Duration
+	}
+	watchReturns struct {
+		result1 gpio.Watch
+		result2 error
+	}
 }
 
 func (fake *FakeGpio) Read(pin uint) (string, error) {
@@ -132,4 +144,39 @@ func (fake *FakeGpio) WriteHighReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeGpio) Watch(pin uint, edge gpio.Edge, debounce time.Duration) (gpio.Watch, error) {
+	fake.watchMutex.Lock()
+	fake.watchArgsForCall = append(fake.watchArgsForCall, struct {
+		pin      uint
+		edge     gpio.Edge
+		debounce time.Duration
+	}{pin, edge, debounce})
+	fake.watchMutex.Unlock()
+	if fake.WatchStub != nil {
+		return fake.WatchStub(pin, edge, debounce)
+	} else {
+		return fake.watchReturns.result1, fake.watchReturns.result2
+	}
+}
+
+func (fake *FakeGpio) WatchCallCount() int {
+	fake.watchMutex.RLock()
+	defer fake.watchMutex.RUnlock()
+	return len(fake.watchArgsForCall)
+}
+
+func (fake *FakeGpio) WatchArgsForCall(i int) (uint, gpio.Edge, time.Duration) {
+	fake.watchMutex.RLock()
+	defer fake.watchMutex.RUnlock()
+	return fake.watchArgsForCall[i].pin, fake.watchArgsForCall[i].edge, fake.watchArgsForCall[i].debounce
+}
+
+func (fake *FakeGpio) WatchReturns(result1 gpio.Watch, result2 error) {
+	fake.WatchStub = nil
+	fake.watchReturns = struct {
+		result1 gpio.Watch
+		result2 error
+	}{result1, result2}
+}
+
 var _ gpio.Gpio = new(FakeGpio)
@@ -0,0 +1,61 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/robdimsdale/garagepi/gpio"
+)
+
+type FakeWatch struct {
+	EventsStub        func() <-chan gpio.Event
+	eventsMutex       sync.RWMutex
+	eventsArgsForCall []struct{}
+	eventsReturns     struct {
+		result1 <-chan gpio.Event
+	}
+	StopStub        func()
+	stopMutex       sync.RWMutex
+	stopArgsForCall []struct{}
+}
+
+func (fake *FakeWatch) Events() <-chan gpio.Event {
+	fake.eventsMutex.Lock()
+	fake.eventsArgsForCall = append(fake.eventsArgsForCall, struct{}{})
+	fake.eventsMutex.Unlock()
+	if fake.EventsStub != nil {
+		return fake.EventsStub()
+	} else {
+		return fake.eventsReturns.result1
+	}
+}
+
+func (fake *FakeWatch) EventsCallCount() int {
+	fake.eventsMutex.RLock()
+	defer fake.eventsMutex.RUnlock()
+	return len(fake.eventsArgsForCall)
+}
+
+func (fake *FakeWatch) EventsReturns(result1 <-chan gpio.Event) {
+	fake.EventsStub = nil
+	fake.eventsReturns = struct {
+		result1 <-chan gpio.Event
+	}{result1}
+}
+
+func (fake *FakeWatch) Stop() {
+	fake.stopMutex.Lock()
+	fake.stopArgsForCall = append(fake.stopArgsForCall, struct{}{})
+	fake.stopMutex.Unlock()
+	if fake.StopStub != nil {
+		fake.StopStub()
+	}
+}
+
+func (fake *FakeWatch) StopCallCount() int {
+	fake.stopMutex.RLock()
+	defer fake.stopMutex.RUnlock()
+	return len(fake.stopArgsForCall)
+}
+
+var _ gpio.Watch = new(FakeWatch)
@@ -1,12 +1,14 @@
 package gpio
 
 import (
-	"fmt"
-	"strconv"
+	"errors"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/pivotal-golang/lager"
-	"github.com/robdimsdale/garagepi/os"
-	"github.com/stianeikeland/go-rpio"
+	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/tedsuo/ifrit"
 )
 
 //go:generate counterfeiter . Gpio
@@ -15,70 +17,193 @@ type Gpio interface {
 	Read(pin uint) (string, error)
 	WriteLow(pin uint) error
 	WriteHigh(pin uint) error
+	Watch(pin uint, edge Edge, debounce time.Duration) (Watch, error)
 }
 
-type gpio struct {
-	osHelper os.OSHelper
-	logger   lager.Logger
+// Driver is a Gpio which holds its backend open for its lifetime.
+// Running the driver opens the backend; the backend is closed when the
+// driver is signalled or Close is called, after which all access fails
+// with ErrClosed.
+type Driver interface {
+	Gpio
+	ifrit.Runner
+	Close() error
 }
 
+var ErrClosed = errors.New("gpio driver closed")
+
+type driver struct {
+	logger  lager.Logger
+	backend Backend
+
+	// mutex is held for reading during pin access so that the backend
+	// cannot be closed while a pin is being accessed.
+	mutex  sync.RWMutex
+	open   bool
+	closed bool
+
+	pinsMutex sync.Mutex
+	pins      map[uint]*sync.Mutex
+
+	watchesMutex sync.Mutex
+	watches      map[*watch]struct{}
+}
+
+// NewGpio returns a driver using the rpio backend.
+// osHelper is not used; it is kept so that existing callers still compile.
 func NewGpio(
-	osHelper os.OSHelper,
+	osHelper gpos.OSHelper,
 	logger lager.Logger,
-) Gpio {
-	return &gpio{
-		osHelper: osHelper,
-		logger:   logger,
+) Driver {
+	return NewDriver(logger, NewRPIOBackend())
+}
+
+// NewDriver returns a driver for the provided backend. The backend is opened
+// when the driver is run, or on first access if that happens sooner.
+func NewDriver(logger lager.Logger, backend Backend) Driver {
+	return &driver{
+		logger:  logger,
+		backend: backend,
+		pins:    map[uint]*sync.Mutex{},
+		watches: map[*watch]struct{}{},
+	}
+}
+
+func (d *driver) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	err := d.ensureOpen()
+	if err != nil {
+		d.logger.Error("failed to open gpio - retrying on next access", err)
 	}
+
+	close(ready)
+
+	<-signals
+	return d.Close()
 }
 
-func (g gpio) Read(pin uint) (string, error) {
-	g.logger.Debug("reading from pin", lager.Data{"pin": pin})
+func (d *driver) Close() error {
+	d.stopWatches()
 
-	rpin := rpio.Pin(pin)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	err := rpio.Open()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	if !d.open {
+		return nil
+	}
+	d.open = false
+
+	d.logger.Info("closing gpio")
+	return d.backend.Close()
+}
+
+func (d *driver) Read(pin uint) (string, error) {
+	d.logger.Debug("reading from pin", lager.Data{"pin": pin})
+
+	high, err := d.readLevel(pin)
 	if err != nil {
 		return "", err
 	}
-	defer rpio.Close()
 
-	state := rpin.Read()
-	return fmt.Sprintf("%v", state), err
+	if high {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func (d *driver) WriteLow(pin uint) error {
+	d.logger.Debug("writing low to pin", lager.Data{"pin": pin})
+
+	return d.withPin(pin, func() error {
+		return d.backend.Write(pin, false)
+	})
 }
 
-func (g gpio) WriteLow(pin uint) error {
-	g.logger.Debug("writing low to pin", lager.Data{"pin": pin})
+func (d *driver) WriteHigh(pin uint) error {
+	d.logger.Debug("writing high to pin", lager.Data{"pin": pin})
 
-	rpin := rpio.Pin(pin)
+	return d.withPin(pin, func() error {
+		return d.backend.Write(pin, true)
+	})
+}
 
-	err := rpio.Open()
+func (d *driver) readLevel(pin uint) (bool, error) {
+	var high bool
+	err := d.withPin(pin, func() error {
+		var err error
+		high, err = d.backend.Read(pin)
+		return err
+	})
+	return high, err
+}
+
+func (d *driver) withPin(pin uint, f func() error) error {
+	err := d.ensureOpen()
 	if err != nil {
 		return err
 	}
-	defer rpio.Close()
 
-	rpin.Output()
-	rpin.Low()
-	return nil
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	// The driver may have been closed since ensureOpen released the lock.
+	if d.closed {
+		return ErrClosed
+	}
+
+	l := d.pinLock(pin)
+	l.Lock()
+	defer l.Unlock()
+
+	return f()
 }
 
-func (g gpio) WriteHigh(pin uint) error {
-	g.logger.Debug("writing high to pin", lager.Data{"pin": pin})
+func (d *driver) ensureOpen() error {
+	d.mutex.RLock()
+	open, closed := d.open, d.closed
+	d.mutex.RUnlock()
+
+	if closed {
+		return ErrClosed
+	}
+
+	if open {
+		return nil
+	}
 
-	rpin := rpio.Pin(pin)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 
-	err := rpio.Open()
+	if d.closed {
+		return ErrClosed
+	}
+
+	if d.open {
+		return nil
+	}
+
+	err := d.backend.Open()
 	if err != nil {
 		return err
 	}
-	defer rpio.Close()
+	d.open = true
 
-	rpin.Output()
-	rpin.High()
+	d.logger.Info("gpio opened")
 	return nil
 }
 
-func tostr(u uint) string {
-	return strconv.FormatUint(uint64(u), 10)
+func (d *driver) pinLock(pin uint) *sync.Mutex {
+	d.pinsMutex.Lock()
+	defer d.pinsMutex.Unlock()
+
+	l, ok := d.pins[pin]
+	if !ok {
+		l = &sync.Mutex{}
+		d.pins[pin] = l
+	}
+	return l
 }
@@ -0,0 +1,176 @@
+package gpio_test
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Driver", func() {
+	var (
+		fakeBackend *gpio_fakes.FakeBackend
+		driver      gpio.Driver
+	)
+
+	BeforeEach(func() {
+		fakeBackend = new(gpio_fakes.FakeBackend)
+		driver = gpio.NewDriver(lagertest.NewTestLogger("gpio test"), fakeBackend)
+	})
+
+	It("Should open the backend once across calls", func() {
+		Expect(driver.WriteHigh(1)).To(Succeed())
+		Expect(driver.WriteLow(1)).To(Succeed())
+		_, err := driver.Read(2)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeBackend.OpenCallCount()).To(Equal(1))
+		Expect(fakeBackend.CloseCallCount()).To(Equal(0))
+	})
+
+	It("Should write to the backend", func() {
+		Expect(driver.WriteHigh(3)).To(Succeed())
+		Expect(driver.WriteLow(4)).To(Succeed())
+
+		Expect(fakeBackend.WriteCallCount()).To(Equal(2))
+
+		pin, high := fakeBackend.WriteArgsForCall(0)
+		Expect(pin).To(Equal(uint(3)))
+		Expect(high).To(BeTrue())
+
+		pin, high = fakeBackend.WriteArgsForCall(1)
+		Expect(pin).To(Equal(uint(4)))
+		Expect(high).To(BeFalse())
+	})
+
+	It("Should read '1' for high and '0' for low", func() {
+		fakeBackend.ReadReturns(true, nil)
+		Expect(driver.Read(5)).To(Equal("1"))
+
+		fakeBackend.ReadReturns(false, nil)
+		Expect(driver.Read(5)).To(Equal("0"))
+
+		Expect(fakeBackend.ReadArgsForCall(0)).To(Equal(uint(5)))
+	})
+
+	It("Should return backend errors", func() {
+		fakeBackend.ReadReturns(false, errors.New("read error"))
+		_, err := driver.Read(5)
+		Expect(err).To(MatchError("read error"))
+
+		fakeBackend.WriteReturns(errors.New("write error"))
+		Expect(driver.WriteHigh(5)).To(MatchError("write error"))
+	})
+
+	Context("When opening the backend fails", func() {
+		BeforeEach(func() {
+			fakeBackend.OpenReturns(errors.New("open error"))
+		})
+
+		It("Should return the error and retry on the next access", func() {
+			Expect(driver.WriteHigh(1)).To(MatchError("open error"))
+			Expect(fakeBackend.WriteCallCount()).To(Equal(0))
+
+			fakeBackend.OpenReturns(nil)
+			Expect(driver.WriteHigh(1)).To(Succeed())
+			Expect(fakeBackend.OpenCallCount()).To(Equal(2))
+			Expect(fakeBackend.WriteCallCount()).To(Equal(1))
+		})
+	})
+
+	Describe("Close", func() {
+		It("Should close the backend once and reject further access", func() {
+			Expect(driver.WriteHigh(1)).To(Succeed())
+
+			Expect(driver.Close()).To(Succeed())
+			Expect(driver.Close()).To(Succeed())
+			Expect(fakeBackend.CloseCallCount()).To(Equal(1))
+
+			Expect(driver.WriteHigh(1)).To(Equal(gpio.ErrClosed))
+			_, err := driver.Read(1)
+			Expect(err).To(Equal(gpio.ErrClosed))
+			Expect(fakeBackend.WriteCallCount()).To(Equal(1))
+		})
+
+		It("Should not close a backend which was never opened", func() {
+			Expect(driver.Close()).To(Succeed())
+			Expect(fakeBackend.CloseCallCount()).To(Equal(0))
+		})
+	})
+
+	Describe("Running", func() {
+		var process ifrit.Process
+
+		BeforeEach(func() {
+			process = ifrit.Invoke(driver)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Kill)
+			Eventually(process.Wait()).Should(Receive())
+		})
+
+		It("Should open the backend on start and close it when signalled", func() {
+			Expect(fakeBackend.OpenCallCount()).To(Equal(1))
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(fakeBackend.CloseCallCount()).To(Equal(1))
+		})
+
+		Context("When opening the backend fails", func() {
+			BeforeEach(func() {
+				fakeBackend.OpenReturns(errors.New("open error"))
+			})
+
+			It("Should still become ready", func() {
+				Consistently(process.Wait()).ShouldNot(Receive())
+			})
+		})
+	})
+
+	It("Should serialize access to a pin", func() {
+		var (
+			mutex   sync.Mutex
+			active  int
+			maxSeen int
+		)
+
+		fakeBackend.WriteStub = func(pin uint, high bool) error {
+			mutex.Lock()
+			active++
+			if active > maxSeen {
+				maxSeen = active
+			}
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mutex.Lock()
+			active--
+			mutex.Unlock()
+			return nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(driver.WriteHigh(7)).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		Expect(maxSeen).To(Equal(1))
+		Expect(fakeBackend.WriteCallCount()).To(Equal(10))
+	})
+})
@@ -0,0 +1,56 @@
+package gpio
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/robdimsdale/garagepi/metrics"
+)
+
+type instrumented struct {
+	gpio   Gpio
+	errors *metrics.Counter
+}
+
+// NewInstrumentedGpio returns a Gpio which counts the errors of operations
+// on g by pin and operation.
+func NewInstrumentedGpio(g Gpio, registry *metrics.Registry) Gpio {
+	return &instrumented{
+		gpio: g,
+		errors: registry.NewCounter(
+			"garagepi_gpio_errors_total",
+			"Failed gpio operations by pin and operation.",
+			"pin", "operation",
+		),
+	}
+}
+
+func (i *instrumented) count(pin uint, operation string, err error) {
+	if err != nil {
+		i.errors.Inc(strconv.FormatUint(uint64(pin), 10), operation)
+	}
+}
+
+func (i *instrumented) Read(pin uint) (string, error) {
+	value, err := i.gpio.Read(pin)
+	i.count(pin, "read", err)
+	return value, err
+}
+
+func (i *instrumented) WriteLow(pin uint) error {
+	err := i.gpio.WriteLow(pin)
+	i.count(pin, "write", err)
+	return err
+}
+
+func (i *instrumented) WriteHigh(pin uint) error {
+	err := i.gpio.WriteHigh(pin)
+	i.count(pin, "write", err)
+	return err
+}
+
+func (i *instrumented) Watch(pin uint, edge Edge, debounce time.Duration) (Watch, error) {
+	w, err := i.gpio.Watch(pin, edge, debounce)
+	i.count(pin, "watch", err)
+	return w, err
+}
@@ -0,0 +1,66 @@
+package gpio_test
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+	"github.com/robdimsdale/garagepi/metrics"
+)
+
+var _ = Describe("InstrumentedGpio", func() {
+	var (
+		fakeGpio *gpio_fakes.FakeGpio
+		registry *metrics.Registry
+		g        gpio.Gpio
+	)
+
+	output := func() string {
+		buf := new(bytes.Buffer)
+		Expect(registry.Write(buf)).To(Succeed())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		fakeGpio = new(gpio_fakes.FakeGpio)
+		registry = metrics.NewRegistry()
+		g = gpio.NewInstrumentedGpio(fakeGpio, registry)
+	})
+
+	It("passes operations through", func() {
+		fakeGpio.ReadReturns("1", nil)
+
+		Expect(g.Read(3)).To(Equal("1"))
+		Expect(g.WriteHigh(4)).To(Succeed())
+		Expect(g.WriteLow(5)).To(Succeed())
+		_, err := g.Watch(6, gpio.EdgeRising, time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeGpio.ReadArgsForCall(0)).To(Equal(uint(3)))
+		Expect(fakeGpio.WriteHighArgsForCall(0)).To(Equal(uint(4)))
+		Expect(fakeGpio.WriteLowArgsForCall(0)).To(Equal(uint(5)))
+		Expect(output()).NotTo(ContainSubstring("garagepi_gpio_errors_total{"))
+	})
+
+	It("counts errors by pin and operation", func() {
+		fakeGpio.ReadReturns("", errors.New("read error"))
+		fakeGpio.WriteHighReturns(errors.New("write error"))
+		fakeGpio.WriteLowReturns(errors.New("write error"))
+		fakeGpio.WatchReturns(nil, errors.New("watch error"))
+
+		_, err := g.Read(3)
+		Expect(err).To(MatchError("read error"))
+		g.Read(3)
+		Expect(g.WriteHigh(4)).To(MatchError("write error"))
+		g.WriteLow(4)
+		g.Watch(6, gpio.EdgeRising, time.Millisecond)
+
+		Expect(output()).To(ContainSubstring(`garagepi_gpio_errors_total{pin="3",operation="read"} 2` + "\n"))
+		Expect(output()).To(ContainSubstring(`garagepi_gpio_errors_total{pin="4",operation="write"} 2` + "\n"))
+		Expect(output()).To(ContainSubstring(`garagepi_gpio_errors_total{pin="6",operation="watch"} 1` + "\n"))
+	})
+})
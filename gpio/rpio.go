@@ -0,0 +1,35 @@
+package gpio
+
+import "github.com/stianeikeland/go-rpio"
+
+type rpioBackend struct{}
+
+// NewRPIOBackend returns a backend which memory-maps the GPIO registers
+// of the Raspberry Pi via /dev/mem.
+func NewRPIOBackend() Backend {
+	return &rpioBackend{}
+}
+
+func (b rpioBackend) Open() error {
+	return rpio.Open()
+}
+
+func (b rpioBackend) Close() error {
+	return rpio.Close()
+}
+
+func (b rpioBackend) Read(pin uint) (bool, error) {
+	return rpio.Pin(pin).Read() == rpio.High, nil
+}
+
+func (b rpioBackend) Write(pin uint, high bool) error {
+	rpin := rpio.Pin(pin)
+	rpin.Output()
+
+	if high {
+		rpin.High()
+	} else {
+		rpin.Low()
+	}
+	return nil
+}
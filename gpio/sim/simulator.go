@@ -0,0 +1,213 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/gpio"
+)
+
+// ErrOutputPin is returned when attempting to set the level of an output pin
+// by hand; its level is controlled by garagepi.
+var ErrOutputPin = errors.New("pin is an output")
+
+type Pin struct {
+	Pin    uint `json:"pin"`
+	High   bool `json:"high"`
+	Output bool `json:"output"`
+}
+
+// Simulator is an in-memory gpio backend whose input pins can be set by hand.
+type Simulator interface {
+	gpio.Backend
+	gpio.Interrupter
+	Pins() []Pin
+	Set(pin uint, high bool) error
+}
+
+type simulator struct {
+	logger lager.Logger
+	path   string
+
+	mutex    sync.Mutex
+	pins     map[uint]Pin
+	watchers map[uint]map[chan<- bool]struct{}
+}
+
+// NewSimulator returns a simulator which persists pin levels to the JSON
+// file at path, loading them when opened. If path is empty pin levels are
+// not persisted.
+func NewSimulator(logger lager.Logger, path string) Simulator {
+	return &simulator{
+		logger:   logger,
+		path:     path,
+		pins:     map[uint]Pin{},
+		watchers: map[uint]map[chan<- bool]struct{}{},
+	}
+}
+
+func (s *simulator) Open() error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	b, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var pins []Pin
+	err = json.Unmarshal(b, &pins)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pins {
+		s.pins[p.Pin] = p
+	}
+
+	s.logger.Info("loaded simulated pins", lager.Data{"path": s.path, "pins": len(pins)})
+	return nil
+}
+
+func (s *simulator) Close() error {
+	return nil
+}
+
+func (s *simulator) Read(pin uint) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, ok := s.pins[pin]
+	if !ok {
+		p = Pin{Pin: pin}
+		s.pins[pin] = p
+		return false, s.save()
+	}
+
+	return p.High, nil
+}
+
+func (s *simulator) Write(pin uint, high bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pins[pin] = Pin{
+		Pin:    pin,
+		High:   high,
+		Output: true,
+	}
+
+	return s.save()
+}
+
+func (s *simulator) Pins() []Pin {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.sortedPins()
+}
+
+func (s *simulator) Set(pin uint, high bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.pins[pin]
+	if p.Output {
+		return ErrOutputPin
+	}
+
+	s.pins[pin] = Pin{
+		Pin:  pin,
+		High: high,
+	}
+
+	s.logger.Info("simulated pin set", lager.Data{"pin": pin, "high": high})
+
+	for levels := range s.watchers[pin] {
+		select {
+		case levels <- high:
+		default:
+		}
+	}
+
+	return s.save()
+}
+
+// Interrupts sends the level of pin on levels each time it is set by hand.
+func (s *simulator) Interrupts(pin uint, levels chan<- bool) (func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.watchers[pin] == nil {
+		s.watchers[pin] = map[chan<- bool]struct{}{}
+	}
+	s.watchers[pin][levels] = struct{}{}
+
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		delete(s.watchers[pin], levels)
+	}, nil
+}
+
+// sortedPins must be called with the mutex held.
+func (s *simulator) sortedPins() []Pin {
+	pins := []Pin{}
+	for _, p := range s.pins {
+		pins = append(pins, p)
+	}
+
+	sort.Sort(byPin(pins))
+	return pins
+}
+
+// save must be called with the mutex held.
+func (s *simulator) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(s.sortedPins())
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it so the file is never
+	// left partially written.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+type byPin []Pin
+
+func (p byPin) Len() int           { return len(p) }
+func (p byPin) Less(i, j int) bool { return p[i].Pin < p[j].Pin }
+func (p byPin) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
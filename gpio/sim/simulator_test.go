@@ -0,0 +1,129 @@
+package sim_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/gpio/sim"
+)
+
+var _ = Describe("Simulator", func() {
+	var (
+		simulator sim.Simulator
+	)
+
+	BeforeEach(func() {
+		simulator = sim.NewSimulator(lagertest.NewTestLogger("sim test"), "")
+		Expect(simulator.Open()).To(Succeed())
+	})
+
+	It("Should read unknown pins as low inputs", func() {
+		Expect(simulator.Read(4)).To(BeFalse())
+		Expect(simulator.Pins()).To(Equal([]sim.Pin{{Pin: 4}}))
+	})
+
+	It("Should read back written levels as outputs", func() {
+		Expect(simulator.Write(17, true)).To(Succeed())
+		Expect(simulator.Read(17)).To(BeTrue())
+
+		Expect(simulator.Pins()).To(Equal([]sim.Pin{{Pin: 17, High: true, Output: true}}))
+	})
+
+	It("Should return pins in order", func() {
+		Expect(simulator.Write(17, true)).To(Succeed())
+		Expect(simulator.Write(2, false)).To(Succeed())
+		_, err := simulator.Read(4)
+		Expect(err).NotTo(HaveOccurred())
+
+		pins := simulator.Pins()
+		Expect(pins).To(HaveLen(3))
+		Expect(pins[0].Pin).To(Equal(uint(2)))
+		Expect(pins[1].Pin).To(Equal(uint(4)))
+		Expect(pins[2].Pin).To(Equal(uint(17)))
+	})
+
+	Describe("Setting pins by hand", func() {
+		It("Should set the level of input pins", func() {
+			Expect(simulator.Set(4, true)).To(Succeed())
+			Expect(simulator.Read(4)).To(BeTrue())
+
+			Expect(simulator.Set(4, false)).To(Succeed())
+			Expect(simulator.Read(4)).To(BeFalse())
+		})
+
+		It("Should not set the level of output pins", func() {
+			Expect(simulator.Write(17, true)).To(Succeed())
+
+			Expect(simulator.Set(17, false)).To(Equal(sim.ErrOutputPin))
+			Expect(simulator.Read(17)).To(BeTrue())
+		})
+	})
+
+	Describe("Interrupts", func() {
+		It("Should send levels set by hand until stopped", func() {
+			levels := make(chan bool, 10)
+
+			stop, err := simulator.Interrupts(4, levels)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(simulator.Set(4, true)).To(Succeed())
+			Expect(levels).To(Receive(BeTrue()))
+
+			Expect(simulator.Set(5, true)).To(Succeed())
+			Expect(levels).NotTo(Receive())
+
+			stop()
+
+			Expect(simulator.Set(4, false)).To(Succeed())
+			Expect(levels).NotTo(Receive())
+		})
+	})
+
+	Context("When persisting to a file", func() {
+		var (
+			dir  string
+			path string
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "garagepi-sim")
+			Expect(err).NotTo(HaveOccurred())
+
+			path = filepath.Join(dir, "gpio.json")
+			simulator = sim.NewSimulator(lagertest.NewTestLogger("sim test"), path)
+			Expect(simulator.Open()).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("Should restore pin levels when reopened", func() {
+			Expect(simulator.Write(17, true)).To(Succeed())
+			Expect(simulator.Set(4, true)).To(Succeed())
+			Expect(simulator.Close()).To(Succeed())
+
+			Expect(ioutil.ReadFile(path)).To(MatchJSON(`[
+				{"pin":4,"high":true,"output":false},
+				{"pin":17,"high":true,"output":true}
+			]`))
+
+			reopened := sim.NewSimulator(lagertest.NewTestLogger("sim test"), path)
+			Expect(reopened.Open()).To(Succeed())
+			Expect(reopened.Pins()).To(Equal(simulator.Pins()))
+			Expect(reopened.Read(4)).To(BeTrue())
+		})
+
+		It("Should return an error when the file is invalid", func() {
+			Expect(ioutil.WriteFile(path, []byte("not json"), 0644)).To(Succeed())
+
+			simulator = sim.NewSimulator(lagertest.NewTestLogger("sim test"), path)
+			Expect(simulator.Open()).NotTo(Succeed())
+		})
+	})
+})
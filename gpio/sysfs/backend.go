@@ -0,0 +1,258 @@
+package sysfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpos "github.com/robdimsdale/garagepi/os"
+)
+
+const (
+	// DefaultRoot is the root of the sysfs gpio interface.
+	DefaultRoot = "/sys/class/gpio"
+
+	retryInterval = 50 * time.Millisecond
+	exportTimeout = 1 * time.Second
+)
+
+type backend struct {
+	logger   lager.Logger
+	osHelper gpos.OSHelper
+	root     string
+
+	mutex sync.Mutex
+	// pins maps pins in use to their configured direction, or to "" if
+	// they have not yet been configured.
+	pins map[uint]string
+	// exported records the pins exported by the backend, which are
+	// unexported on close.
+	exported map[uint]bool
+}
+
+// NewBackend returns a backend which controls pins through the sysfs gpio
+// files under root, typically DefaultRoot. Pins are exported when first used
+// and unexported when the backend is closed.
+func NewBackend(
+	logger lager.Logger,
+	osHelper gpos.OSHelper,
+	root string,
+) gpio.Backend {
+	return &backend{
+		logger:   logger,
+		osHelper: osHelper,
+		root:     root,
+		pins:     map[uint]string{},
+		exported: map[uint]bool{},
+	}
+}
+
+func (b *backend) Open() error {
+	_, err := os.Stat(filepath.Join(b.root, "export"))
+	return err
+}
+
+func (b *backend) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var firstErr error
+	for pin := range b.exported {
+		err := writeFile(filepath.Join(b.root, "unexport"), fmt.Sprintf("%d", pin))
+		if err != nil && firstErr == nil {
+			firstErr = &PinError{Op: "unexport", Pin: pin, Err: err}
+		}
+	}
+
+	b.pins = map[uint]string{}
+	b.exported = map[uint]bool{}
+
+	return firstErr
+}
+
+func (b *backend) Read(pin uint) (bool, error) {
+	err := b.configure(pin, "in", false)
+	if err != nil {
+		return false, err
+	}
+
+	contents, err := ioutil.ReadFile(b.pinFile(pin, "value"))
+	if err != nil {
+		return false, &PinError{Op: "read", Pin: pin, Err: err}
+	}
+
+	switch strings.TrimSpace(string(contents)) {
+	case "1":
+		return true, nil
+	case "0":
+		return false, nil
+	default:
+		return false, &PinError{Op: "read", Pin: pin, Err: ErrInvalidValue}
+	}
+}
+
+func (b *backend) Write(pin uint, high bool) error {
+	b.mutex.Lock()
+	direction := b.pins[pin]
+	b.mutex.Unlock()
+
+	if direction != "out" {
+		// Setting the direction of an output also sets its value.
+		return b.configure(pin, "out", high)
+	}
+
+	value := "0"
+	if high {
+		value = "1"
+	}
+
+	err := b.retry(func() error {
+		return writeFile(b.pinFile(pin, "value"), value)
+	})
+	if err != nil {
+		return &PinError{Op: "write", Pin: pin, Err: err}
+	}
+
+	return nil
+}
+
+// configure exports pin if necessary and sets its direction. Pins which are
+// already outputs, including pins left as outputs by a previous run, are not
+// reconfigured as inputs, so that their value can be read back and e.g. a
+// relay is not left floating.
+func (b *backend) configure(pin uint, direction string, high bool) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	current, ok := b.pins[pin]
+	if ok && (current == direction || current == "out") {
+		return nil
+	}
+
+	if !ok {
+		err := b.export(pin)
+		if err != nil {
+			return err
+		}
+		b.pins[pin] = ""
+	}
+
+	if direction == "in" {
+		var contents []byte
+		err := b.retry(func() error {
+			var err error
+			contents, err = ioutil.ReadFile(b.pinFile(pin, "direction"))
+			return err
+		})
+		if err != nil {
+			return &PinError{Op: "direction", Pin: pin, Err: err}
+		}
+
+		if strings.TrimSpace(string(contents)) == "out" {
+			b.pins[pin] = "out"
+			return nil
+		}
+	}
+
+	// Writing high or low to direction sets the pin as an output
+	// driven to that level without glitching its value.
+	value := direction
+	if direction == "out" {
+		value = "low"
+		if high {
+			value = "high"
+		}
+	}
+
+	// The direction file may not be writable until udev has applied
+	// permissions to the newly exported pin.
+	err := b.retry(func() error {
+		return writeFile(b.pinFile(pin, "direction"), value)
+	})
+	if err != nil {
+		return &PinError{Op: "direction", Pin: pin, Err: err}
+	}
+
+	b.pins[pin] = direction
+	b.logger.Debug("configured pin", lager.Data{"pin": pin, "direction": value})
+	return nil
+}
+
+// export must be called with the mutex held.
+func (b *backend) export(pin uint) error {
+	_, err := os.Stat(b.pinFile(pin, ""))
+	if err == nil {
+		return nil
+	}
+
+	err = writeFile(filepath.Join(b.root, "export"), fmt.Sprintf("%d", pin))
+
+	// EBUSY means the pin was exported by something else since we checked.
+	if isErrno(err, syscall.EBUSY) {
+		return nil
+	}
+
+	if err != nil {
+		return &PinError{Op: "export", Pin: pin, Err: err}
+	}
+
+	b.exported[pin] = true
+
+	b.logger.Debug("exported pin", lager.Data{"pin": pin})
+	return nil
+}
+
+// retry calls f until it succeeds or returns an error other than a missing
+// file or denied permission. ErrNotReady is returned if the export timeout
+// elapses first.
+func (b *backend) retry(f func() error) error {
+	for i := time.Duration(0); ; i += retryInterval {
+		err := f()
+		if err == nil {
+			return nil
+		}
+
+		if !os.IsNotExist(err) && !os.IsPermission(err) {
+			return err
+		}
+
+		if i >= exportTimeout {
+			return ErrNotReady
+		}
+
+		b.osHelper.Sleep(retryInterval)
+	}
+}
+
+func (b *backend) pinFile(pin uint, name string) string {
+	return filepath.Join(b.root, fmt.Sprintf("gpio%d", pin), name)
+}
+
+// writeFile writes to an existing file; sysfs files must not be created.
+func writeFile(path string, contents string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write([]byte(contents))
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == errno
+}
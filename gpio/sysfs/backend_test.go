@@ -0,0 +1,194 @@
+package sysfs_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/gpio"
+	"github.com/robdimsdale/garagepi/gpio/sysfs"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Backend", func() {
+	var (
+		root         string
+		fakeOSHelper *os_fakes.FakeOSHelper
+		backend      gpio.Backend
+	)
+
+	readFile := func(name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(root, name))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	writeFile := func(name string, contents string) {
+		err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	// createPin does what the kernel and udev do when a pin is exported.
+	createPin := func(pin uint) {
+		dir := fmt.Sprintf("gpio%d", pin)
+		Expect(os.MkdirAll(filepath.Join(root, dir), 0755)).To(Succeed())
+		writeFile(filepath.Join(dir, "direction"), "in\n")
+		writeFile(filepath.Join(dir, "value"), "0\n")
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "garagepi-sysfs")
+		Expect(err).NotTo(HaveOccurred())
+
+		writeFile("export", "")
+		writeFile("unexport", "")
+
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+
+		backend = sysfs.NewBackend(lagertest.NewTestLogger("sysfs test"), fakeOSHelper, root)
+		Expect(backend.Open()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should fail to open when root is not a gpio sysfs directory", func() {
+		backend = sysfs.NewBackend(lagertest.NewTestLogger("sysfs test"), fakeOSHelper, filepath.Join(root, "missing"))
+		Expect(backend.Open()).NotTo(Succeed())
+	})
+
+	Context("When the pin is already exported", func() {
+		BeforeEach(func() {
+			createPin(4)
+		})
+
+		It("Should not export it", func() {
+			_, err := backend.Read(4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readFile("export")).To(BeEmpty())
+		})
+
+		It("Should set it as an input and read its value", func() {
+			writeFile("gpio4/value", "1\n")
+
+			Expect(backend.Read(4)).To(BeTrue())
+			Expect(readFile("gpio4/direction")).To(Equal("in"))
+		})
+
+		It("Should set it as an output at the written level, then write its value", func() {
+			Expect(backend.Write(4, true)).To(Succeed())
+			Expect(readFile("gpio4/direction")).To(Equal("high"))
+
+			Expect(backend.Write(4, false)).To(Succeed())
+			Expect(readFile("gpio4/direction")).To(Equal("high"))
+			Expect(readFile("gpio4/value")).To(Equal("0"))
+		})
+
+		It("Should read back an output without reconfiguring it", func() {
+			Expect(backend.Write(4, false)).To(Succeed())
+			writeFile("gpio4/direction", "out")
+
+			_, err := backend.Read(4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(readFile("gpio4/direction")).To(Equal("out"))
+		})
+
+		It("Should not reconfigure an output left by a previous run", func() {
+			writeFile("gpio4/direction", "out\n")
+			writeFile("gpio4/value", "1\n")
+
+			Expect(backend.Read(4)).To(BeTrue())
+			Expect(readFile("gpio4/direction")).To(Equal("out\n"))
+
+			Expect(backend.Write(4, false)).To(Succeed())
+			Expect(readFile("gpio4/direction")).To(Equal("out\n"))
+			Expect(readFile("gpio4/value")).To(Equal("0"))
+		})
+
+		It("Should return a typed error for an invalid value", func() {
+			writeFile("gpio4/value", "x\n")
+
+			_, err := backend.Read(4)
+			Expect(err).To(BeAssignableToTypeOf(&sysfs.PinError{}))
+
+			pinErr := err.(*sysfs.PinError)
+			Expect(pinErr.Op).To(Equal("read"))
+			Expect(pinErr.Pin).To(Equal(uint(4)))
+			Expect(pinErr.Err).To(Equal(sysfs.ErrInvalidValue))
+		})
+
+		It("Should retry writing the value until it is writable", func() {
+			Expect(backend.Write(4, true)).To(Succeed())
+			Expect(os.Remove(filepath.Join(root, "gpio4/value"))).To(Succeed())
+
+			fakeOSHelper.SleepStub = func(time.Duration) {
+				writeFile("gpio4/value", "1\n")
+			}
+
+			Expect(backend.Write(4, false)).To(Succeed())
+			Expect(fakeOSHelper.SleepCallCount()).To(Equal(1))
+			Expect(readFile("gpio4/value")).To(Equal("0"))
+		})
+
+		It("Should not unexport it on close", func() {
+			_, err := backend.Read(4)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(backend.Close()).To(Succeed())
+			Expect(readFile("unexport")).To(BeEmpty())
+		})
+	})
+
+	Context("When the pin is not exported", func() {
+		It("Should export it and wait for its files to become writable", func() {
+			fakeOSHelper.SleepStub = func(time.Duration) {
+				if fakeOSHelper.SleepCallCount() == 3 {
+					createPin(17)
+				}
+			}
+
+			Expect(backend.Write(17, true)).To(Succeed())
+
+			Expect(readFile("export")).To(Equal("17"))
+			Expect(fakeOSHelper.SleepCallCount()).To(Equal(3))
+			Expect(readFile("gpio17/direction")).To(Equal("high"))
+		})
+
+		It("Should return ErrNotReady if its files never become writable", func() {
+			err := backend.Write(17, true)
+			Expect(err).To(BeAssignableToTypeOf(&sysfs.PinError{}))
+
+			pinErr := err.(*sysfs.PinError)
+			Expect(pinErr.Op).To(Equal("direction"))
+			Expect(pinErr.Err).To(Equal(sysfs.ErrNotReady))
+
+			Expect(fakeOSHelper.SleepCallCount()).To(Equal(20))
+		})
+
+		It("Should unexport it on close", func() {
+			fakeOSHelper.SleepStub = func(time.Duration) {
+				createPin(17)
+			}
+
+			Expect(backend.Write(17, true)).To(Succeed())
+
+			Expect(backend.Close()).To(Succeed())
+			Expect(readFile("unexport")).To(Equal("17"))
+		})
+
+		It("Should return a typed error when exporting fails", func() {
+			Expect(os.Remove(filepath.Join(root, "export"))).To(Succeed())
+
+			_, err := backend.Read(17)
+			Expect(err).To(BeAssignableToTypeOf(&sysfs.PinError{}))
+			Expect(err.(*sysfs.PinError).Op).To(Equal("export"))
+		})
+	})
+})
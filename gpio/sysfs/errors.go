@@ -0,0 +1,27 @@
+package sysfs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotReady is returned when the files of an exported pin do not
+	// become writable within the export timeout.
+	ErrNotReady = errors.New("pin not ready after export")
+
+	// ErrInvalidValue is returned when a value file contains anything
+	// other than 0 or 1.
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// PinError records the operation and pin that caused an error.
+type PinError struct {
+	Op  string
+	Pin uint
+	Err error
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("gpio%d %s: %s", e.Pin, e.Op, e.Err)
+}
@@ -0,0 +1,13 @@
+package sysfs_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSysfs(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sysfs Suite")
+}
@@ -0,0 +1,267 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+type Edge string
+
+const (
+	EdgeRising  Edge = "rising"
+	EdgeFalling Edge = "falling"
+	EdgeBoth    Edge = "both"
+)
+
+func ParseEdge(s string) (Edge, error) {
+	switch Edge(s) {
+	case EdgeRising, EdgeFalling, EdgeBoth:
+		return Edge(s), nil
+	default:
+		return "", fmt.Errorf("invalid edge: '%s'", s)
+	}
+}
+
+func (e Edge) matches(high bool) bool {
+	switch e {
+	case EdgeRising:
+		return high
+	case EdgeFalling:
+		return !high
+	default:
+		return true
+	}
+}
+
+// Event is a debounced change in the level of a watched pin.
+// Edge is either EdgeRising or EdgeFalling.
+type Event struct {
+	Pin  uint      `json:"pin"`
+	Edge Edge      `json:"edge"`
+	High bool      `json:"high"`
+	At   time.Time `json:"at"`
+}
+
+//go:generate counterfeiter . Watch
+
+// Watch delivers events for a watched pin. The events channel is closed once
+// the watch is stopped or the driver is closed.
+type Watch interface {
+	Events() <-chan Event
+	Stop()
+}
+
+// Interrupter is implemented by backends which can report level changes of
+// input pins as they happen. After each edge the new level of pin is sent on
+// levels, without blocking, until stop is called.
+type Interrupter interface {
+	Interrupts(pin uint, levels chan<- bool) (stop func(), err error)
+}
+
+// pollInterval is how often pins are read when watching pins of backends
+// which do not implement Interrupter.
+const pollInterval = 20 * time.Millisecond
+
+type watch struct {
+	events   chan Event
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func (w *watch) Events() <-chan Event {
+	return w.events
+}
+
+func (w *watch) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+// Watch delivers an event each time the level of pin changes to match edge
+// and then remains unchanged for debounce. Edge interrupts are used if the
+// backend supports them for pin; otherwise the pin is polled.
+func (d *driver) Watch(pin uint, edge Edge, debounce time.Duration) (Watch, error) {
+	_, err := ParseEdge(string(edge))
+	if err != nil {
+		return nil, err
+	}
+
+	initial, err := d.readLevel(pin)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make(chan bool, 16)
+
+	stopSource, err := d.interrupts(pin, levels)
+	if err != nil {
+		d.logger.Info("edge interrupts unavailable - polling pin", lager.Data{"pin": pin, "error": err.Error()})
+		stopSource = d.poll(pin, levels)
+	}
+
+	w := &watch{
+		events: make(chan Event),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	d.watchesMutex.Lock()
+	d.watches[w] = struct{}{}
+	d.watchesMutex.Unlock()
+
+	go func() {
+		defer func() {
+			stopSource()
+
+			d.watchesMutex.Lock()
+			delete(d.watches, w)
+			d.watchesMutex.Unlock()
+
+			close(w.events)
+			close(w.done)
+		}()
+
+		d.debounce(w, pin, edge, debounce, initial, levels)
+	}()
+
+	d.logger.Debug("watching pin", lager.Data{"pin": pin, "edge": edge, "debounce": debounce.String()})
+	return w, nil
+}
+
+// debounce returns once the watch is stopped or the driver is closed.
+func (d *driver) debounce(
+	w *watch,
+	pin uint,
+	edge Edge,
+	debounce time.Duration,
+	initial bool,
+	levels <-chan bool,
+) {
+	// last is the last debounced level and prev is the last raw level.
+	last, prev := initial, initial
+	var settled <-chan time.Time
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case level := <-levels:
+			if level == prev {
+				continue
+			}
+			prev = level
+			settled = time.After(debounce)
+		case <-settled:
+			settled = nil
+
+			level, err := d.readLevel(pin)
+			if err == ErrClosed {
+				return
+			}
+			if err != nil {
+				d.logger.Error("error reading watched pin", err, lager.Data{"pin": pin})
+				continue
+			}
+
+			prev = level
+			if level == last {
+				continue
+			}
+			last = level
+
+			if !edge.matches(level) {
+				continue
+			}
+
+			e := Event{
+				Pin:  pin,
+				Edge: EdgeFalling,
+				High: level,
+				At:   time.Now(),
+			}
+			if level {
+				e.Edge = EdgeRising
+			}
+
+			select {
+			case w.events <- e:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+func (d *driver) interrupts(pin uint, levels chan<- bool) (func(), error) {
+	i, ok := d.backend.(Interrupter)
+	if !ok {
+		return nil, fmt.Errorf("backend does not support edge interrupts")
+	}
+
+	var stop func()
+	err := d.withPin(pin, func() error {
+		var err error
+		stop, err = i.Interrupts(pin, levels)
+		return err
+	})
+	return stop, err
+}
+
+func (d *driver) poll(pin uint, levels chan<- bool) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
+			level, err := d.readLevel(pin)
+			if err == ErrClosed {
+				return
+			}
+			if err != nil {
+				continue
+			}
+
+			select {
+			case levels <- level:
+			default:
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// stopWatches must not be called with the mutex held, as watches may be
+// reading their pin.
+func (d *driver) stopWatches() {
+	d.watchesMutex.Lock()
+	watches := []*watch{}
+	for w := range d.watches {
+		watches = append(watches, w)
+	}
+	d.watchesMutex.Unlock()
+
+	for _, w := range watches {
+		w.Stop()
+	}
+}
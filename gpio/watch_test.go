@@ -0,0 +1,201 @@
+package gpio_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/gpio"
+	gpio_fakes "github.com/robdimsdale/garagepi/gpio/fakes"
+)
+
+// interruptingBackend is a backend which supports edge interrupts.
+type interruptingBackend struct {
+	*gpio_fakes.FakeBackend
+
+	mutex   sync.Mutex
+	levels  chan<- bool
+	stopped bool
+	err     error
+}
+
+func (b *interruptingBackend) Interrupts(pin uint, levels chan<- bool) (func(), error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	b.levels = levels
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		b.stopped = true
+	}, nil
+}
+
+var _ = Describe("Watch", func() {
+	const debounce = 50 * time.Millisecond
+
+	var (
+		fakeBackend *gpio_fakes.FakeBackend
+		driver      gpio.Driver
+
+		mutex sync.Mutex
+		level bool
+	)
+
+	setLevel := func(high bool) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		level = high
+	}
+
+	BeforeEach(func() {
+		level = false
+
+		fakeBackend = new(gpio_fakes.FakeBackend)
+		fakeBackend.ReadStub = func(pin uint) (bool, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return level, nil
+		}
+
+		driver = gpio.NewDriver(lagertest.NewTestLogger("watch test"), fakeBackend)
+	})
+
+	It("Should return an error for an invalid edge", func() {
+		_, err := driver.Watch(4, gpio.Edge("sideways"), debounce)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Should return an error when the pin cannot be read", func() {
+		fakeBackend.ReadStub = nil
+		fakeBackend.ReadReturns(false, errors.New("read error"))
+
+		_, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+		Expect(err).To(MatchError("read error"))
+	})
+
+	Context("When the backend does not support interrupts", func() {
+		var watch gpio.Watch
+
+		AfterEach(func() {
+			watch.Stop()
+		})
+
+		It("Should poll the pin and deliver debounced events", func() {
+			var err error
+			watch, err = driver.Watch(4, gpio.EdgeBoth, debounce)
+			Expect(err).NotTo(HaveOccurred())
+
+			setLevel(true)
+
+			var e gpio.Event
+			Eventually(watch.Events()).Should(Receive(&e))
+			Expect(e.Pin).To(Equal(uint(4)))
+			Expect(e.Edge).To(Equal(gpio.EdgeRising))
+			Expect(e.High).To(BeTrue())
+
+			setLevel(false)
+
+			Eventually(watch.Events()).Should(Receive(&e))
+			Expect(e.Edge).To(Equal(gpio.EdgeFalling))
+			Expect(e.High).To(BeFalse())
+		})
+
+		It("Should not deliver events for changes shorter than the debounce period", func() {
+			var err error
+			watch, err = driver.Watch(4, gpio.EdgeBoth, time.Second)
+			Expect(err).NotTo(HaveOccurred())
+
+			setLevel(true)
+			time.Sleep(100 * time.Millisecond)
+			setLevel(false)
+
+			Consistently(watch.Events(), 1500*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("Should only deliver events for the watched edge", func() {
+			var err error
+			watch, err = driver.Watch(4, gpio.EdgeFalling, debounce)
+			Expect(err).NotTo(HaveOccurred())
+
+			setLevel(true)
+			Consistently(watch.Events(), 3*debounce).ShouldNot(Receive())
+
+			setLevel(false)
+
+			var e gpio.Event
+			Eventually(watch.Events()).Should(Receive(&e))
+			Expect(e.Edge).To(Equal(gpio.EdgeFalling))
+		})
+	})
+
+	Context("When the backend supports interrupts", func() {
+		var backend *interruptingBackend
+
+		BeforeEach(func() {
+			backend = &interruptingBackend{FakeBackend: fakeBackend}
+			driver = gpio.NewDriver(lagertest.NewTestLogger("watch test"), backend)
+		})
+
+		It("Should deliver debounced events from interrupts without polling", func() {
+			watch, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+			Expect(err).NotTo(HaveOccurred())
+			defer watch.Stop()
+
+			readsBefore := fakeBackend.ReadCallCount()
+			Consistently(fakeBackend.ReadCallCount, 3*debounce).Should(Equal(readsBefore))
+
+			setLevel(true)
+			backend.mutex.Lock()
+			backend.levels <- true
+			backend.mutex.Unlock()
+
+			var e gpio.Event
+			Eventually(watch.Events()).Should(Receive(&e))
+			Expect(e.High).To(BeTrue())
+		})
+
+		It("Should stop interrupts when the watch is stopped", func() {
+			watch, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+			Expect(err).NotTo(HaveOccurred())
+
+			watch.Stop()
+			Expect(backend.stopped).To(BeTrue())
+			Eventually(watch.Events()).Should(BeClosed())
+		})
+
+		It("Should fall back to polling when interrupts are unavailable for the pin", func() {
+			backend.err = errors.New("line busy")
+
+			watch, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+			Expect(err).NotTo(HaveOccurred())
+			defer watch.Stop()
+
+			setLevel(true)
+			Eventually(watch.Events()).Should(Receive())
+		})
+	})
+
+	It("Should close the events channel when stopped", func() {
+		watch, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+		Expect(err).NotTo(HaveOccurred())
+
+		watch.Stop()
+		Eventually(watch.Events()).Should(BeClosed())
+	})
+
+	It("Should stop watches when the driver is closed", func() {
+		watch, err := driver.Watch(4, gpio.EdgeBoth, debounce)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(driver.Close()).To(Succeed())
+		Eventually(watch.Events()).Should(BeClosed())
+	})
+})
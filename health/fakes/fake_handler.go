@@ -0,0 +1,104 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/health"
+)
+
+type FakeHandler struct {
+	ReadyStub        func() health.Report
+	readyMutex       sync.RWMutex
+	readyArgsForCall []struct{}
+	readyReturns     struct {
+		result1 health.Report
+	}
+	HandleHealthzStub        func(w http.ResponseWriter, r *http.Request)
+	handleHealthzMutex       sync.RWMutex
+	handleHealthzArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleReadyzStub        func(w http.ResponseWriter, r *http.Request)
+	handleReadyzMutex       sync.RWMutex
+	handleReadyzArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeHandler) Ready() health.Report {
+	fake.readyMutex.Lock()
+	fake.readyArgsForCall = append(fake.readyArgsForCall, struct{}{})
+	fake.readyMutex.Unlock()
+	if fake.ReadyStub != nil {
+		return fake.ReadyStub()
+	} else {
+		return fake.readyReturns.result1
+	}
+}
+
+func (fake *FakeHandler) ReadyCallCount() int {
+	fake.readyMutex.RLock()
+	defer fake.readyMutex.RUnlock()
+	return len(fake.readyArgsForCall)
+}
+
+func (fake *FakeHandler) ReadyReturns(result1 health.Report) {
+	fake.ReadyStub = nil
+	fake.readyReturns = struct {
+		result1 health.Report
+	}{result1}
+}
+
+func (fake *FakeHandler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	fake.handleHealthzMutex.Lock()
+	fake.handleHealthzArgsForCall = append(fake.handleHealthzArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleHealthzMutex.Unlock()
+	if fake.HandleHealthzStub != nil {
+		fake.HandleHealthzStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleHealthzCallCount() int {
+	fake.handleHealthzMutex.RLock()
+	defer fake.handleHealthzMutex.RUnlock()
+	return len(fake.handleHealthzArgsForCall)
+}
+
+func (fake *FakeHandler) HandleHealthzArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleHealthzMutex.RLock()
+	defer fake.handleHealthzMutex.RUnlock()
+	return fake.handleHealthzArgsForCall[i].w, fake.handleHealthzArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	fake.handleReadyzMutex.Lock()
+	fake.handleReadyzArgsForCall = append(fake.handleReadyzArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleReadyzMutex.Unlock()
+	if fake.HandleReadyzStub != nil {
+		fake.HandleReadyzStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleReadyzCallCount() int {
+	fake.handleReadyzMutex.RLock()
+	defer fake.handleReadyzMutex.RUnlock()
+	return len(fake.handleReadyzArgsForCall)
+}
+
+func (fake *FakeHandler) HandleReadyzArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleReadyzMutex.RLock()
+	defer fake.handleReadyzMutex.RUnlock()
+	return fake.handleReadyzArgsForCall[i].w, fake.handleReadyzArgsForCall[i].r
+}
+
+var _ health.Handler = new(FakeHandler)
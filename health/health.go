@@ -0,0 +1,154 @@
+// Package health reports whether garagepi is alive, and whether it is ready
+// to serve requests because the hardware and services it depends on can be
+// reached.
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	gpos "github.com/robdimsdale/garagepi/os"
+)
+
+// Check probes a dependency. Probe must return within a bounded time, as
+// readiness is not reported until every probe has returned.
+// The error of a failed probe is logged, and Failure is reported in its
+// place so that readiness probes do not disclose paths or addresses.
+type Check struct {
+	Name    string
+	Probe   func() error
+	Failure string
+}
+
+// DefaultFailure is reported for a failed check which has no Failure.
+const DefaultFailure = "check failed"
+
+type Result struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latencyMs"`
+}
+
+// Report is the result of each check, in the order of the checks.
+type Report struct {
+	Ready     bool      `json:"ready"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Checks    []Result  `json:"checks"`
+}
+
+//go:generate counterfeiter . Handler
+
+type Handler interface {
+	Ready() Report
+	HandleHealthz(w http.ResponseWriter, r *http.Request)
+	HandleReadyz(w http.ResponseWriter, r *http.Request)
+}
+
+type handler struct {
+	logger   lager.Logger
+	clock    gpos.OSHelper
+	checks   []Check
+	cacheFor time.Duration
+
+	// mutex is held while the checks run so that concurrent requests wait
+	// for, and share, a single run.
+	mutex  sync.Mutex
+	report *Report
+}
+
+// NewHandler returns a handler which runs checks when readiness is requested,
+// at most once every cacheFor, so that frequent probes do not repeatedly
+// access the hardware.
+func NewHandler(
+	logger lager.Logger,
+	clock gpos.OSHelper,
+	checks []Check,
+	cacheFor time.Duration,
+) Handler {
+	return &handler{
+		logger:   logger.Session("health"),
+		clock:    clock,
+		checks:   checks,
+		cacheFor: cacheFor,
+	}
+}
+
+func (h *handler) Ready() Report {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.report != nil && h.clock.Now().Sub(h.report.CheckedAt) < h.cacheFor {
+		return *h.report
+	}
+
+	report := Report{
+		Ready:     true,
+		CheckedAt: h.clock.Now(),
+		Checks:    make([]Result, len(h.checks)),
+	}
+
+	wg := new(sync.WaitGroup)
+	for i, c := range h.checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			report.Checks[i] = h.run(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		if !r.Healthy {
+			report.Ready = false
+		}
+	}
+
+	h.report = &report
+	return report
+}
+
+func (h *handler) run(c Check) Result {
+	start := h.clock.Now()
+	err := c.Probe()
+	latency := h.clock.Now().Sub(start)
+
+	result := Result{
+		Name:      c.Name,
+		Healthy:   err == nil,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+	}
+
+	if err != nil {
+		h.logger.Info("check failed", lager.Data{"check": c.Name, "error": err.Error()})
+
+		result.Error = c.Failure
+		if result.Error == "" {
+			result.Error = DefaultFailure
+		}
+	}
+
+	return result
+}
+
+// HandleHealthz always succeeds, as garagepi is alive if it can respond.
+func (h *handler) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// HandleReadyz responds with the report, with status 503 if any check failed.
+func (h *handler) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := h.Ready()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	b, _ := json.Marshal(report)
+	w.Write(b)
+}
@@ -0,0 +1,163 @@
+package health_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/health"
+	os_fakes "github.com/robdimsdale/garagepi/os/fakes"
+)
+
+var _ = Describe("Health", func() {
+	var (
+		fakeOSHelper *os_fakes.FakeOSHelper
+		now          time.Time
+		nowMutex     sync.Mutex
+
+		gpioErr    error
+		webcamErr  error
+		gpioProbes int
+		probeMutex sync.Mutex
+
+		logger  *lagertest.TestLogger
+		handler health.Handler
+	)
+
+	setNow := func(t time.Time) {
+		nowMutex.Lock()
+		defer nowMutex.Unlock()
+		now = t
+	}
+
+	BeforeEach(func() {
+		setNow(time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC))
+		fakeOSHelper = new(os_fakes.FakeOSHelper)
+		fakeOSHelper.NowStub = func() time.Time {
+			nowMutex.Lock()
+			defer nowMutex.Unlock()
+			return now
+		}
+
+		gpioErr = nil
+		webcamErr = nil
+		gpioProbes = 0
+
+		checks := []health.Check{
+			{
+				Name: "gpio",
+				Probe: func() error {
+					probeMutex.Lock()
+					defer probeMutex.Unlock()
+					gpioProbes++
+					return gpioErr
+				},
+				Failure: "read failed",
+			},
+			{
+				Name: "webcam",
+				Probe: func() error {
+					setNow(now.Add(250 * time.Millisecond))
+					return webcamErr
+				},
+			},
+		}
+
+		logger = lagertest.NewTestLogger("health test")
+		handler = health.NewHandler(
+			logger,
+			fakeOSHelper,
+			checks,
+			5*time.Second,
+		)
+	})
+
+	Describe("HandleHealthz", func() {
+		It("responds with ok", func() {
+			rec := httptest.NewRecorder()
+			handler.HandleHealthz(rec, new(http.Request))
+
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(rec.Body.String()).To(MatchJSON(`{"status":"ok"}`))
+		})
+	})
+
+	Describe("HandleReadyz", func() {
+		readyz := func() (int, health.Report) {
+			rec := httptest.NewRecorder()
+			handler.HandleReadyz(rec, new(http.Request))
+
+			var report health.Report
+			Expect(json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+			return rec.Code, report
+		}
+
+		It("reports each check with its latency", func() {
+			code, report := readyz()
+
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(report.Ready).To(BeTrue())
+			Expect(report.Checks).To(HaveLen(2))
+			Expect(report.Checks[0].Name).To(Equal("gpio"))
+			Expect(report.Checks[0].Healthy).To(BeTrue())
+			Expect(report.Checks[1].Name).To(Equal("webcam"))
+			Expect(report.Checks[1].Healthy).To(BeTrue())
+			Expect(report.Checks[1].LatencyMS).To(BeNumerically(">=", 250))
+		})
+
+		It("responds with 503 and the failure of the check if a check fails", func() {
+			gpioErr = errors.New("open /dev/gpiomem: permission denied")
+
+			code, report := readyz()
+
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(report.Ready).To(BeFalse())
+			Expect(report.Checks[0].Healthy).To(BeFalse())
+			Expect(report.Checks[0].Error).To(Equal("read failed"))
+			Expect(report.Checks[1].Healthy).To(BeTrue())
+		})
+
+		It("logs the error of a failed check", func() {
+			gpioErr = errors.New("open /dev/gpiomem: permission denied")
+
+			readyz()
+
+			Expect(logger.Buffer()).To(gbytes.Say("open /dev/gpiomem: permission denied"))
+		})
+
+		It("reports the default failure for a failed check without one", func() {
+			webcamErr = errors.New("dial tcp 10.0.0.5:8080: connection refused")
+
+			_, report := readyz()
+
+			Expect(report.Checks[1].Healthy).To(BeFalse())
+			Expect(report.Checks[1].Error).To(Equal(health.DefaultFailure))
+		})
+
+		It("caches the report", func() {
+			_, first := readyz()
+			_, second := readyz()
+
+			Expect(gpioProbes).To(Equal(1))
+			Expect(second.CheckedAt).To(Equal(first.CheckedAt))
+		})
+
+		It("runs the checks again once the report has expired", func() {
+			readyz()
+
+			setNow(now.Add(5 * time.Second))
+			gpioErr = errors.New("read failed")
+
+			code, _ := readyz()
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+			Expect(gpioProbes).To(Equal(2))
+		})
+	})
+})
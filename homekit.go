@@ -0,0 +1,43 @@
+//go:build homekit
+// +build homekit
+
+package main
+
+import (
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	apihomekit "github.com/robdimsdale/garagepi/api/homekit"
+	"github.com/robdimsdale/garagepi/api/light"
+	"github.com/robdimsdale/garagepi/homekit"
+	"github.com/tedsuo/ifrit/grouper"
+)
+
+func init() {
+	newHomekitMembers = func(
+		logger lager.Logger,
+		lh light.Handler,
+		doors door.Doors,
+		subscriber events.Subscriber,
+	) ([]grouper.Member, error) {
+		accessory := apihomekit.NewAccessory(logger, *homekitName, version, lh, doors)
+		homekitServer, err := homekit.NewServer(logger, homekit.Config{
+			Name:        *homekitName,
+			Category:    homekit.CategoryGarageDoorOpener,
+			SetupCode:   *homekitSetupCode,
+			Port:        *homekitPort,
+			StateFile:   *homekitFile,
+			MDNSAddress: homekit.DefaultMDNSAddress,
+		}, accessory.Services)
+		if err != nil {
+			return nil, err
+		}
+
+		notifier := apihomekit.NewNotifier(logger, homekitServer, subscriber, accessory)
+
+		return []grouper.Member{
+			{Name: "homekit-notifier", Runner: notifier},
+			{Name: "homekit", Runner: homekitServer},
+		}, nil
+	}
+}
@@ -0,0 +1,209 @@
+//go:build homekit
+// +build homekit
+
+package homekit
+
+import (
+	"fmt"
+
+	"github.com/robdimsdale/garagepi/api/events"
+)
+
+// Service and characteristic types, in their short form.
+const (
+	ServiceAccessoryInformation = "3E"
+	ServiceProtocolInformation  = "A2"
+	ServiceGarageDoorOpener     = "41"
+	ServiceLightbulb            = "43"
+
+	CharacteristicIdentify            = "14"
+	CharacteristicManufacturer        = "20"
+	CharacteristicModel               = "21"
+	CharacteristicName                = "23"
+	CharacteristicSerialNumber        = "30"
+	CharacteristicFirmwareRevision    = "52"
+	CharacteristicVersion             = "37"
+	CharacteristicCurrentDoorState    = "0E"
+	CharacteristicTargetDoorState     = "32"
+	CharacteristicObstructionDetected = "24"
+	CharacteristicOn                  = "25"
+)
+
+// Characteristic formats.
+const (
+	FormatBool   = "bool"
+	FormatUint8  = "uint8"
+	FormatString = "string"
+)
+
+// Characteristic permissions.
+const (
+	PermRead   = "pr"
+	PermWrite  = "pw"
+	PermEvents = "ev"
+)
+
+// Values of CurrentDoorState and TargetDoorState.
+const (
+	DoorStateOpen    = 0
+	DoorStateClosed  = 1
+	DoorStateOpening = 2
+	DoorStateClosing = 3
+	DoorStateStopped = 4
+)
+
+// Status is a HAP status code, returned to controllers for
+// characteristics which could not be read or written.
+type Status int
+
+const (
+	StatusSuccess                Status = 0
+	StatusInsufficientPrivileges Status = -70401
+	StatusCommunicationFailure   Status = -70402
+	StatusBusy                   Status = -70403
+	StatusReadOnly               Status = -70404
+	StatusWriteOnly              Status = -70405
+	StatusNotificationsDisabled  Status = -70406
+	StatusNotFound               Status = -70409
+	StatusInvalidValue           Status = -70410
+)
+
+func (s Status) Error() string {
+	return fmt.Sprintf("HAP status %d", int(s))
+}
+
+// Characteristic is a value of a service. Get must be set if the
+// characteristic is readable, and Set if it is writable. Set is called with a
+// bool for FormatBool, an int for FormatUint8 and a string for FormatString.
+// Errors which are not a Status are returned to controllers as
+// StatusCommunicationFailure.
+type Characteristic struct {
+	Type        string
+	Format      string
+	Perms       []string
+	ValidValues []int
+
+	Get func() (interface{}, error)
+	Set func(value interface{}, source events.Source) error
+
+	iid int
+}
+
+type Service struct {
+	Type            string
+	Primary         bool
+	Characteristics []*Characteristic
+
+	iid int
+}
+
+func (c *Characteristic) can(perm string) bool {
+	for _, p := range c.Perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// StaticCharacteristic returns a read-only string characteristic.
+func StaticCharacteristic(typ string, value string) *Characteristic {
+	return &Characteristic{
+		Type:   typ,
+		Format: FormatString,
+		Perms:  []string{PermRead},
+		Get: func() (interface{}, error) {
+			return value, nil
+		},
+	}
+}
+
+// InformationService returns the accessory information service. identify is
+// called when a controller asks the accessory to identify itself.
+func InformationService(name, manufacturer, model, serialNumber, firmwareRevision string, identify func()) *Service {
+	return &Service{
+		Type: ServiceAccessoryInformation,
+		Characteristics: []*Characteristic{
+			{
+				Type:   CharacteristicIdentify,
+				Format: FormatBool,
+				Perms:  []string{PermWrite},
+				Set: func(value interface{}, source events.Source) error {
+					identify()
+					return nil
+				},
+			},
+			StaticCharacteristic(CharacteristicManufacturer, manufacturer),
+			StaticCharacteristic(CharacteristicModel, model),
+			StaticCharacteristic(CharacteristicName, name),
+			StaticCharacteristic(CharacteristicSerialNumber, serialNumber),
+			StaticCharacteristic(CharacteristicFirmwareRevision, firmwareRevision),
+		},
+	}
+}
+
+// normalize converts a value decoded from JSON to the format of c.
+// Controllers may write bools as numbers.
+func (c *Characteristic) normalize(value interface{}) (interface{}, error) {
+	switch c.Format {
+	case FormatBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+
+	case FormatUint8:
+		if v, ok := value.(float64); ok && v >= 0 && v <= 255 && v == float64(int(v)) {
+			if len(c.ValidValues) == 0 {
+				return int(v), nil
+			}
+			for _, valid := range c.ValidValues {
+				if int(v) == valid {
+					return valid, nil
+				}
+			}
+		}
+
+	case FormatString:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	}
+
+	return nil, StatusInvalidValue
+}
+
+// statusOf returns the status for an error returned by Get or Set.
+func statusOf(err error) Status {
+	if err == nil {
+		return StatusSuccess
+	}
+	if s, ok := err.(Status); ok {
+		return s
+	}
+	return StatusCommunicationFailure
+}
+
+// assignIDs numbers the services and their characteristics from 1,
+// in the order provided, and returns the characteristics by instance ID.
+func assignIDs(services []*Service) map[int]*Characteristic {
+	characteristics := map[int]*Characteristic{}
+
+	iid := 1
+	for _, s := range services {
+		s.iid = iid
+		iid++
+
+		for _, c := range s.Characteristics {
+			c.iid = iid
+			characteristics[iid] = c
+			iid++
+		}
+	}
+
+	return characteristics
+}
@@ -0,0 +1,87 @@
+//go:build homekit
+// +build homekit
+
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"os"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/homekit"
+)
+
+type FakeServer struct {
+	RunStub        func(signals <-chan os.Signal, ready chan<- struct{}) error
+	runMutex       sync.RWMutex
+	runArgsForCall []struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}
+	runReturns struct {
+		result1 error
+	}
+	NotifyStub        func(c *homekit.Characteristic)
+	notifyMutex       sync.RWMutex
+	notifyArgsForCall []struct {
+		c *homekit.Characteristic
+	}
+}
+
+func (fake *FakeServer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	fake.runMutex.Lock()
+	fake.runArgsForCall = append(fake.runArgsForCall, struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}{signals, ready})
+	fake.runMutex.Unlock()
+	if fake.RunStub != nil {
+		return fake.RunStub(signals, ready)
+	} else {
+		return fake.runReturns.result1
+	}
+}
+
+func (fake *FakeServer) RunCallCount() int {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return len(fake.runArgsForCall)
+}
+
+func (fake *FakeServer) RunArgsForCall(i int) (<-chan os.Signal, chan<- struct{}) {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return fake.runArgsForCall[i].signals, fake.runArgsForCall[i].ready
+}
+
+func (fake *FakeServer) RunReturns(result1 error) {
+	fake.RunStub = nil
+	fake.runReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeServer) Notify(c *homekit.Characteristic) {
+	fake.notifyMutex.Lock()
+	fake.notifyArgsForCall = append(fake.notifyArgsForCall, struct {
+		c *homekit.Characteristic
+	}{c})
+	fake.notifyMutex.Unlock()
+	if fake.NotifyStub != nil {
+		fake.NotifyStub(c)
+	}
+}
+
+func (fake *FakeServer) NotifyCallCount() int {
+	fake.notifyMutex.RLock()
+	defer fake.notifyMutex.RUnlock()
+	return len(fake.notifyArgsForCall)
+}
+
+func (fake *FakeServer) NotifyArgsForCall(i int) *homekit.Characteristic {
+	fake.notifyMutex.RLock()
+	defer fake.notifyMutex.RUnlock()
+	return fake.notifyArgsForCall[i].c
+}
+
+var _ homekit.Server = new(FakeServer)
@@ -0,0 +1,34 @@
+//go:build homekit
+// +build homekit
+
+package hap
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// KeySize is the size of ChaCha20-Poly1305 keys.
+const KeySize = chacha20poly1305.KeySize
+
+// NewAEAD returns ChaCha20-Poly1305 as specified by RFC 8439.
+func NewAEAD(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(key)
+}
+
+// Nonce returns the 96-bit nonce used by HAP: the 64-bit little-endian
+// counter, or up to 8 bytes of label, preceded by four zero bytes.
+func Nonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// LabelNonce returns the nonce for a pairing message, e.g. PS-Msg05.
+func LabelNonce(label string) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	copy(nonce[chacha20poly1305.NonceSize-len(label):], label)
+	return nonce
+}
@@ -0,0 +1,58 @@
+//go:build homekit
+// +build homekit
+
+package hap_test
+
+import (
+	"encoding/hex"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
+
+var _ = Describe("AEAD", func() {
+	// The test vector of RFC 8439 section 2.8.2.
+	var (
+		key       []byte
+		nonce     []byte
+		aad       []byte
+		plaintext []byte
+		sealed    []byte
+	)
+
+	BeforeEach(func() {
+		key = unhex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+		nonce = unhex("070000004041424344454647")
+		aad = unhex("50515253c0c1c2c3c4c5c6c7")
+		plaintext = []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+		sealed = unhex("d31a8d34648e60db7b86afbc53ef7ec2 a4aded51296e08fea9e2b5a736ee62d6" +
+			"3dbea45e8ca9671282fafb69da92728b 1a71de0a9e060b2905d6a5b67ecd3b36" +
+			"92ddbd7f2d778b8c9803aee328091b58 fab324e4fad675945585808b4831d7bc" +
+			"3ff4def08e4b7a9de576d26586cec64b 6116" +
+			"1ae10b594f09e26a7e902ecbd0600691")
+	})
+
+	It("seals and opens the RFC 8439 test vector", func() {
+		aead, err := hap.NewAEAD(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(aead.Seal(nil, nonce, plaintext, aad)).To(Equal(sealed))
+
+		opened, err := aead.Open(nil, nonce, sealed, aad)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(Equal(plaintext))
+	})
+
+	It("builds HAP nonces", func() {
+		Expect(hap.Nonce(1)).To(Equal([]byte{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}))
+		Expect(hap.LabelNonce("PS-Msg05")).To(Equal(append([]byte{0, 0, 0, 0}, "PS-Msg05"...)))
+	})
+})
@@ -0,0 +1,117 @@
+//go:build homekit
+// +build homekit
+
+package hap
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// maxFrameSize is the maximum length of the plaintext of a frame.
+const maxFrameSize = 1024
+
+var errFrameSize = errors.New("frame exceeds the maximum size")
+
+// SecureConn encrypts a connection once pair verify has completed. Each frame
+// is a 2-byte little-endian length, which is authenticated as additional
+// data, followed by the encrypted data and its tag. Writes are safe for
+// concurrent use, reads are not.
+type SecureConn struct {
+	net.Conn
+
+	readMutex   sync.Mutex
+	readCipher  cipher.AEAD
+	readCounter uint64
+	readBuffer  []byte
+
+	writeMutex   sync.Mutex
+	writeCipher  cipher.AEAD
+	writeCounter uint64
+}
+
+// NewSecureConn returns a connection which decrypts with readKey and encrypts with writeKey.
+func NewSecureConn(conn net.Conn, readKey []byte, writeKey []byte) (*SecureConn, error) {
+	readCipher, err := NewAEAD(readKey)
+	if err != nil {
+		return nil, err
+	}
+
+	writeCipher, err := NewAEAD(writeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecureConn{
+		Conn:        conn,
+		readCipher:  readCipher,
+		writeCipher: writeCipher,
+	}, nil
+}
+
+func (c *SecureConn) Read(b []byte) (int, error) {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if len(c.readBuffer) == 0 {
+		var length [2]byte
+		_, err := io.ReadFull(c.Conn, length[:])
+		if err != nil {
+			return 0, err
+		}
+
+		n := int(binary.LittleEndian.Uint16(length[:]))
+		if n > maxFrameSize {
+			return 0, errFrameSize
+		}
+
+		frame := make([]byte, n+c.readCipher.Overhead())
+		_, err = io.ReadFull(c.Conn, frame)
+		if err != nil {
+			return 0, err
+		}
+
+		c.readBuffer, err = c.readCipher.Open(nil, Nonce(c.readCounter), frame, length[:])
+		if err != nil {
+			return 0, err
+		}
+		c.readCounter++
+	}
+
+	n := copy(b, c.readBuffer)
+	c.readBuffer = c.readBuffer[n:]
+	return n, nil
+}
+
+func (c *SecureConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	var written int
+	for len(b) > 0 {
+		n := len(b)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+
+		var length [2]byte
+		binary.LittleEndian.PutUint16(length[:], uint16(n))
+
+		frame := c.writeCipher.Seal(length[:], Nonce(c.writeCounter), b[:n], length[:])
+		c.writeCounter++
+
+		_, err := c.Conn.Write(frame)
+		if err != nil {
+			return written, err
+		}
+
+		written += n
+		b = b[n:]
+	}
+
+	return written, nil
+}
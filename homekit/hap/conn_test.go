@@ -0,0 +1,69 @@
+//go:build homekit
+// +build homekit
+
+package hap_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+var _ = Describe("SecureConn", func() {
+	var (
+		accessory  *hap.SecureConn
+		controller *hap.SecureConn
+	)
+
+	BeforeEach(func() {
+		readKey := hap.HKDF([]byte("shared secret"), hap.ControlSalt, hap.ControlReadEncryptionKey)
+		writeKey := hap.HKDF([]byte("shared secret"), hap.ControlSalt, hap.ControlWriteEncryptionKey)
+		Expect(readKey).NotTo(Equal(writeKey))
+
+		a, c := net.Pipe()
+
+		var err error
+		accessory, err = hap.NewSecureConn(a, writeKey, readKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		controller, err = hap.NewSecureConn(c, readKey, writeKey)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		accessory.Close()
+		controller.Close()
+	})
+
+	It("exchanges messages longer than a frame", func() {
+		message := bytes.Repeat([]byte("0123456789"), 300)
+
+		go func(controller *hap.SecureConn) {
+			defer GinkgoRecover()
+			_, err := controller.Write(message)
+			Expect(err).NotTo(HaveOccurred())
+		}(controller)
+
+		received := make([]byte, len(message))
+		_, err := io.ReadFull(accessory, received)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(received).To(Equal(message))
+	})
+
+	It("fails to read frames encrypted with another key", func() {
+		wrongKey := hap.HKDF([]byte("other secret"), hap.ControlSalt, hap.ControlWriteEncryptionKey)
+		impostor, err := hap.NewSecureConn(controller.Conn, wrongKey, wrongKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		go func(impostor *hap.SecureConn) {
+			impostor.Write([]byte("hello"))
+		}(impostor)
+
+		_, err = accessory.Read(make([]byte, 5))
+		Expect(err).To(HaveOccurred())
+	})
+})
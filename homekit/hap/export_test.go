@@ -0,0 +1,18 @@
+//go:build homekit
+// +build homekit
+
+package hap
+
+import "math/big"
+
+// NewSRPServerWithKey returns a server with the given salt and private key,
+// for known-answer tests.
+func NewSRPServerWithKey(username string, password string, salt []byte, b []byte) *SRPServer {
+	return newSRPServer(username, password, salt, new(big.Int).SetBytes(b))
+}
+
+// NewSRPClientWithKey returns a client with the given private key, for
+// known-answer tests.
+func NewSRPClientWithKey(username string, password string, a []byte) *SRPClient {
+	return newSRPClient(username, password, new(big.Int).SetBytes(a))
+}
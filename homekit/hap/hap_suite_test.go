@@ -0,0 +1,16 @@
+//go:build homekit
+// +build homekit
+
+package hap_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHap(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HAP Suite")
+}
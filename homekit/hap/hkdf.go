@@ -0,0 +1,37 @@
+//go:build homekit
+// +build homekit
+
+package hap
+
+import (
+	"crypto/sha512"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Key derivation parameters of pair setup and pair verify.
+const (
+	PairSetupEncryptSalt        = "Pair-Setup-Encrypt-Salt"
+	PairSetupEncryptInfo        = "Pair-Setup-Encrypt-Info"
+	PairSetupControllerSignSalt = "Pair-Setup-Controller-Sign-Salt"
+	PairSetupControllerSignInfo = "Pair-Setup-Controller-Sign-Info"
+	PairSetupAccessorySignSalt  = "Pair-Setup-Accessory-Sign-Salt"
+	PairSetupAccessorySignInfo  = "Pair-Setup-Accessory-Sign-Info"
+	PairVerifyEncryptSalt       = "Pair-Verify-Encrypt-Salt"
+	PairVerifyEncryptInfo       = "Pair-Verify-Encrypt-Info"
+)
+
+// Session key derivation parameters, used once pair verify has completed.
+const (
+	ControlSalt               = "Control-Salt"
+	ControlReadEncryptionKey  = "Control-Read-Encryption-Key"
+	ControlWriteEncryptionKey = "Control-Write-Encryption-Key"
+)
+
+// HKDF derives a key of KeySize bytes with HKDF-SHA-512, as specified by RFC 5869.
+func HKDF(secret []byte, salt string, info string) []byte {
+	key := make([]byte, KeySize)
+	io.ReadFull(hkdf.New(sha512.New, secret, []byte(salt), []byte(info)), key)
+	return key
+}
@@ -0,0 +1,239 @@
+//go:build homekit
+// +build homekit
+
+package hap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"math/big"
+)
+
+// SRPUsername is the username used by HAP pair setup.
+const SRPUsername = "Pair-Setup"
+
+// ErrSRPAuthentication is returned if the proof of the peer is incorrect.
+var ErrSRPAuthentication = errors.New("SRP authentication failed")
+
+var errSRPPublicKey = errors.New("invalid SRP public key")
+
+// The 3072-bit group of RFC 5054.
+var (
+	srpN = mustHex(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+			"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+			"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+			"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+			"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+			"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+			"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+			"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF")
+	srpG = big.NewInt(5)
+
+	srpK = hashInt(srpN.Bytes(), pad(srpG))
+)
+
+func mustHex(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("hap: invalid hex: " + s)
+	}
+	return n
+}
+
+// pad returns n as a big-endian byte slice of the length of N.
+func pad(n *big.Int) []byte {
+	b := n.Bytes()
+	return append(make([]byte, len(srpN.Bytes())-len(b)), b...)
+}
+
+func hash(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func hashInt(parts ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(hash(parts...))
+}
+
+func randomInt() (*big.Int, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// proofs returns the proofs M1 of the client and M2 of the server.
+func proofs(username string, salt []byte, A []byte, B []byte, key []byte) ([]byte, []byte) {
+	hN := hash(srpN.Bytes())
+	hG := hash(srpG.Bytes())
+	for i := range hN {
+		hN[i] ^= hG[i]
+	}
+
+	m1 := hash(hN, hash([]byte(username)), salt, A, B, key)
+	m2 := hash(A, m1, key)
+	return m1, m2
+}
+
+// SRPServer is the accessory side of SRP-6a, with the 3072-bit group
+// of RFC 5054 and SHA-512.
+type SRPServer struct {
+	username string
+	salt     []byte
+	verifier *big.Int
+	b        *big.Int
+	B        *big.Int
+}
+
+// NewSRPServer generates a random salt and ephemeral key for the password.
+func NewSRPServer(username string, password string) (*SRPServer, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := randomInt()
+	if err != nil {
+		return nil, err
+	}
+
+	return newSRPServer(username, password, salt, b), nil
+}
+
+func newSRPServer(username string, password string, salt []byte, b *big.Int) *SRPServer {
+	x := hashInt(salt, hash([]byte(username+":"+password)))
+	v := new(big.Int).Exp(srpG, x, srpN)
+
+	// B = kv + g^b
+	B := new(big.Int).Mul(srpK, v)
+	B.Add(B, new(big.Int).Exp(srpG, b, srpN))
+	B.Mod(B, srpN)
+
+	return &SRPServer{
+		username: username,
+		salt:     salt,
+		verifier: v,
+		b:        b,
+		B:        B,
+	}
+}
+
+func (s *SRPServer) Salt() []byte {
+	return s.salt
+}
+
+func (s *SRPServer) PublicKey() []byte {
+	return pad(s.B)
+}
+
+// Verify checks the proof of the client, and returns the proof of the
+// server and the shared session key.
+func (s *SRPServer) Verify(clientPublicKey []byte, clientProof []byte) ([]byte, []byte, error) {
+	A := new(big.Int).SetBytes(clientPublicKey)
+	if new(big.Int).Mod(A, srpN).Sign() == 0 {
+		return nil, nil, errSRPPublicKey
+	}
+
+	u := hashInt(pad(A), pad(s.B))
+	if u.Sign() == 0 {
+		return nil, nil, errSRPPublicKey
+	}
+
+	// S = (Av^u)^b
+	S := new(big.Int).Exp(s.verifier, u, srpN)
+	S.Mul(S, A)
+	S.Exp(S, s.b, srpN)
+	key := hash(pad(S))
+
+	m1, m2 := proofs(s.username, s.salt, pad(A), pad(s.B), key)
+	if subtle.ConstantTimeCompare(m1, clientProof) != 1 {
+		return nil, nil, ErrSRPAuthentication
+	}
+
+	return m2, key, nil
+}
+
+// SRPClient is the controller side of SRP-6a.
+type SRPClient struct {
+	username string
+	password string
+	a        *big.Int
+	A        *big.Int
+
+	proof []byte
+	key   []byte
+}
+
+func NewSRPClient(username string, password string) (*SRPClient, error) {
+	a, err := randomInt()
+	if err != nil {
+		return nil, err
+	}
+
+	return newSRPClient(username, password, a), nil
+}
+
+func newSRPClient(username string, password string, a *big.Int) *SRPClient {
+	return &SRPClient{
+		username: username,
+		password: password,
+		a:        a,
+		A:        new(big.Int).Exp(srpG, a, srpN),
+	}
+}
+
+func (c *SRPClient) PublicKey() []byte {
+	return pad(c.A)
+}
+
+// Proof returns the proof of the client for the salt and public key of the server.
+func (c *SRPClient) Proof(salt []byte, serverPublicKey []byte) ([]byte, error) {
+	B := new(big.Int).SetBytes(serverPublicKey)
+	if new(big.Int).Mod(B, srpN).Sign() == 0 {
+		return nil, errSRPPublicKey
+	}
+
+	u := hashInt(pad(c.A), pad(B))
+	if u.Sign() == 0 {
+		return nil, errSRPPublicKey
+	}
+
+	x := hashInt(salt, hash([]byte(c.username+":"+c.password)))
+
+	// S = (B - kg^x)^(a + ux)
+	S := new(big.Int).Exp(srpG, x, srpN)
+	S.Mul(S, srpK)
+	S.Sub(B, S)
+	S.Mod(S, srpN)
+	exponent := new(big.Int).Mul(u, x)
+	exponent.Add(exponent, c.a)
+	S.Exp(S, exponent, srpN)
+
+	c.key = hash(pad(S))
+
+	var m1 []byte
+	m1, c.proof = proofs(c.username, salt, pad(c.A), pad(B), c.key)
+	return m1, nil
+}
+
+// Verify checks the proof of the server, and returns the shared session key.
+func (c *SRPClient) Verify(serverProof []byte) ([]byte, error) {
+	if c.proof == nil || !bytes.Equal(c.proof, serverProof) {
+		return nil, ErrSRPAuthentication
+	}
+	return c.key, nil
+}
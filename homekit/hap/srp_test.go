@@ -0,0 +1,152 @@
+//go:build homekit
+// +build homekit
+
+package hap_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+var _ = Describe("SRP", func() {
+	var server *hap.SRPServer
+
+	BeforeEach(func() {
+		var err error
+		server, err = hap.NewSRPServer(hap.SRPUsername, "123-45-679")
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.Salt()).To(HaveLen(16))
+		Expect(server.PublicKey()).To(HaveLen(384))
+	})
+
+	It("agrees on a key when the passwords match", func() {
+		client, err := hap.NewSRPClient(hap.SRPUsername, "123-45-679")
+		Expect(err).NotTo(HaveOccurred())
+
+		clientProof, err := client.Proof(server.Salt(), server.PublicKey())
+		Expect(err).NotTo(HaveOccurred())
+
+		serverProof, serverKey, err := server.Verify(client.PublicKey(), clientProof)
+		Expect(err).NotTo(HaveOccurred())
+
+		clientKey, err := client.Verify(serverProof)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clientKey).To(Equal(serverKey))
+		Expect(clientKey).To(HaveLen(64))
+	})
+
+	It("fails when the passwords differ", func() {
+		client, err := hap.NewSRPClient(hap.SRPUsername, "123-45-678")
+		Expect(err).NotTo(HaveOccurred())
+
+		clientProof, err := client.Proof(server.Salt(), server.PublicKey())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = server.Verify(client.PublicKey(), clientProof)
+		Expect(err).To(Equal(hap.ErrSRPAuthentication))
+	})
+
+	It("rejects a zero public key", func() {
+		_, _, err := server.Verify(make([]byte, 384), make([]byte, 64))
+		Expect(err).To(HaveOccurred())
+		Expect(err).NotTo(Equal(hap.ErrSRPAuthentication))
+	})
+
+	It("rejects an incorrect server proof", func() {
+		client, err := hap.NewSRPClient(hap.SRPUsername, "123-45-679")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Proof(server.Salt(), server.PublicKey())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.Verify(make([]byte, 64))
+		Expect(err).To(Equal(hap.ErrSRPAuthentication))
+	})
+})
+
+var _ = Describe("SRP known answers", func() {
+	// The inputs of the test vectors of RFC 5054 appendix B, with the 3072-bit
+	// group and SHA-512, as in the HAP specification.
+	const (
+		username = "alice"
+		password = "password123"
+
+		salt = "BEB25379D1A8581EB5A727673A2441EE"
+		a    = "60975527035CF2AD1989806F0407210BC81EDC04E2762A56AFD529DDDA2D4393"
+		b    = "E487CB59D31AC550471E81F00F6928E01DDA08E974A004F49E61F5D105284D20"
+		A    = "FAB6F5D2615D1E323512E7991CC37443F487DA604CA8C9230FCB04E541DCE628" +
+			"0B27CA4680B0374F179DC3BDC7553FE62459798C701AD864A91390A28C93B644" +
+			"ADBF9C00745B942B79F9012A21B9B78782319D83A1F8362866FBD6F46BFC0DDB" +
+			"2E1AB6E4B45A9906B82E37F05D6F97F6A3EB6E182079759C4F6847837B62321A" +
+			"C1B4FA68641FCB4BB98DD697A0C73641385F4BAB25B793584CC39FC8D48D4BD8" +
+			"67A9A3C10F8EA12170268E34FE3BBE6FF89998D60DA2F3E4283CBEC1393D52AF" +
+			"724A57230C604E9FBCE583D7613E6BFFD67596AD121A8707EEC4694495703368" +
+			"6A155F644D5C5863B48F61BDBF19A53EAB6DAD0A186B8C152E5F5D8CAD4B0EF8" +
+			"AA4EA5008834C3CD342E5E0F167AD04592CD8BD279639398EF9E114DFAAAB919" +
+			"E14E850989224DDD98576D79385D2210902E9F9B1F2D86CFA47EE244635465F7" +
+			"1058421A0184BE51DD10CC9D079E6F1604E7AA9B7CF7883C7D4CE12B06EBE160" +
+			"81E23F27A231D18432D7D1BB55C28AE21FFCF005F57528D15A88881BB3BBB7FE"
+		B = "40F57088A482D4C7733384FE0D301FDDCA9080AD7D4F6FDF09A01006C3CB6D56" +
+			"2E41639AE8FA21DE3B5DBA7585B275589BDB279863C562807B2B99083CD1429C" +
+			"DBE89E25BFBD7E3CAD3173B2E3C5A0B174DA6D5391E6A06E465F037A40062548" +
+			"39A56BF76DA84B1C94E0AE208576156FE5C140A4BA4FFC9E38C3B07B88845FC6" +
+			"F7DDDA93381FE0CA6084C4CD2D336E5451C464CCB6EC65E7D16E548A273E8262" +
+			"84AF2559B6264274215960FFF47BDD63D3AFF064D6137AF769661C9D4FEE4738" +
+			"2603C88EAA0980581D07758461B777E4356DDA5835198B51FEEA308D70F75450" +
+			"B71675C08C7D8302FD7539DD1FF2A11CB4258AA70D234436AA42B6A0615F3F91" +
+			"5D55CC3B966B2716B36E4D1A06CE5E5D2EA3BEE5A1270E8751DA45B60B997B0F" +
+			"FDB0F9962FEE4F03BEE780BA0A845B1D9271421783AE6601A61EA2E342E4F2E8" +
+			"BC935A409EAD19F221BD1B74E2964DD19FC845F60EFC09338B60B6B256D8CAC8" +
+			"89CCA306CC370A0B18C8B886E95DA0AF5235FEF4393020D2B7F3056904759042"
+		key = "5CBC219DB052138EE1148C71CD4498963D682549CE91CA24F098468F06015BEB" +
+			"6AF245C2093F98C3651BCA83AB8CAB2B580BBF02184FEFDF26142F73DF95AC50"
+		clientProof = "5F7C14AB57ED0E94FD1D78C6B4DD09ED7E340B7E05D419A9FD760F6B35E523D1" +
+			"310777A1AE1D2826F596F3A85116CC457C7C964D4F44DED5559DA818C88B617F"
+		serverProof = "2FA0E81F5CB73B88FA0964270F321DD641F2227A5D805C40F1BFE96AAF6A19FF" +
+			"CE8E23287965A39EAB9D5A02215F89E128177ED2C4F103E655A045531BCBF7AD"
+	)
+
+	check := func(b string, key string, clientProof string, serverProof string) {
+		server := hap.NewSRPServerWithKey(username, password, unhex(salt), unhex(b))
+		client := hap.NewSRPClientWithKey(username, password, unhex(a))
+		Expect(client.PublicKey()).To(Equal(unhex(A)))
+
+		m1, err := client.Proof(unhex(salt), server.PublicKey())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m1).To(Equal(unhex(clientProof)))
+
+		m2, serverKey, err := server.Verify(client.PublicKey(), m1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(m2).To(Equal(unhex(serverProof)))
+		Expect(serverKey).To(Equal(unhex(key)))
+
+		clientKey, err := client.Verify(m2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(clientKey).To(Equal(unhex(key)))
+	}
+
+	It("derives the keys and proofs of the test vector", func() {
+		server := hap.NewSRPServerWithKey(username, password, unhex(salt), unhex(b))
+		Expect(server.PublicKey()).To(Equal(unhex(B)))
+
+		check(b, key, clientProof, serverProof)
+	})
+
+	Context("when the premaster secret has a leading zero byte", func() {
+		It("pads it to the length of N before hashing it", func() {
+			const (
+				b2   = "E487CB59D31AC550471E81F00F6928E01DDA08E974A004F49E61F5D105284D48"
+				key2 = "C21D444C1AB7474F406488DEB3374F869E098609AE2025D62C6B269BFBA65D9C" +
+					"100BB58C8D8CBC2C9AFACA07542B81DBDB2F9B5A99BA4C559EA3AEF2BB2CC05D"
+				clientProof2 = "EBF08D72E29B3A138859E65F31C48F3A3681D7DEBBC37D854438746F169F8565" +
+					"57C285D6337F0A838F1C5A971BBDA69C22311C8381BABDDF66069C9DC5DF7865"
+				serverProof2 = "6616A4941D10459D28F7904E911EE0C186D1E28012984ED13F190EA6D5D3A40A" +
+					"C5AA19BF66E7A86D6C5B27A3A0049207B3AD88F0495C2F394F10F2A9200827CD"
+			)
+
+			check(b2, key2, clientProof2, serverProof2)
+		})
+	})
+})
@@ -0,0 +1,131 @@
+//go:build homekit
+// +build homekit
+
+// Package hap implements the encodings and cryptography of the HomeKit
+// Accessory Protocol which are shared by accessories and controllers.
+package hap
+
+import (
+	"bytes"
+	"errors"
+)
+
+// TLV8 item types used by pairing.
+const (
+	TypeMethod        byte = 0x00
+	TypeIdentifier    byte = 0x01
+	TypeSalt          byte = 0x02
+	TypePublicKey     byte = 0x03
+	TypeProof         byte = 0x04
+	TypeEncryptedData byte = 0x05
+	TypeState         byte = 0x06
+	TypeError         byte = 0x07
+	TypeRetryDelay    byte = 0x08
+	TypeSignature     byte = 0x0a
+	TypePermissions   byte = 0x0b
+	TypeFlags         byte = 0x13
+	TypeSeparator     byte = 0xff
+)
+
+// Pairing methods.
+const (
+	MethodPairSetup     byte = 0x00
+	MethodPairVerify    byte = 0x02
+	MethodAddPairing    byte = 0x03
+	MethodRemovePairing byte = 0x04
+	MethodListPairings  byte = 0x05
+)
+
+// Pairing permissions.
+const (
+	PermissionUser  byte = 0x00
+	PermissionAdmin byte = 0x01
+)
+
+// Pairing errors.
+const (
+	ErrorUnknown        byte = 0x01
+	ErrorAuthentication byte = 0x02
+	ErrorBackoff        byte = 0x03
+	ErrorMaxPeers       byte = 0x04
+	ErrorMaxTries       byte = 0x05
+	ErrorUnavailable    byte = 0x06
+	ErrorBusy           byte = 0x07
+)
+
+var errMalformedTLV = errors.New("malformed TLV8")
+
+// Item is a single TLV8 item. Values longer than 255 bytes are
+// split into fragments when encoded.
+type Item struct {
+	Type  byte
+	Value []byte
+}
+
+// TLV is a sequence of items. Items of the same type may be repeated if
+// separated by another item, e.g. when listing pairings.
+type TLV []Item
+
+// Get returns the value of the first item of type typ.
+func (t TLV) Get(typ byte) ([]byte, bool) {
+	for _, item := range t {
+		if item.Type == typ {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Byte returns the single-byte value of the first item of type typ.
+func (t TLV) Byte(typ byte) (byte, bool) {
+	v, ok := t.Get(typ)
+	if !ok || len(v) != 1 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+func (t TLV) Encode() []byte {
+	var b bytes.Buffer
+	for _, item := range t {
+		v := item.Value
+		for {
+			n := len(v)
+			if n > 255 {
+				n = 255
+			}
+			b.WriteByte(item.Type)
+			b.WriteByte(byte(n))
+			b.Write(v[:n])
+			v = v[n:]
+			if len(v) == 0 {
+				break
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// DecodeTLV joins consecutive fragments of the same type.
+func DecodeTLV(b []byte) (TLV, error) {
+	var t TLV
+	fragmented := false
+
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, errMalformedTLV
+		}
+		typ, n := b[0], int(b[1])
+		value := b[2 : 2+n]
+		b = b[2+n:]
+
+		if fragmented && t[len(t)-1].Type == typ {
+			t[len(t)-1].Value = append(t[len(t)-1].Value, value...)
+		} else {
+			t = append(t, Item{Type: typ, Value: append([]byte{}, value...)})
+		}
+		fragmented = n == 255
+	}
+
+	return t, nil
+}
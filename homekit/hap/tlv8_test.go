@@ -0,0 +1,66 @@
+//go:build homekit
+// +build homekit
+
+package hap_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+var _ = Describe("TLV8", func() {
+	It("encodes and decodes items", func() {
+		t := hap.TLV{
+			{Type: hap.TypeState, Value: []byte{1}},
+			{Type: hap.TypeIdentifier, Value: []byte("some-id")},
+		}
+
+		b := t.Encode()
+		Expect(b).To(Equal(append([]byte{6, 1, 1, 1, 7}, "some-id"...)))
+
+		decoded, err := hap.DecodeTLV(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(t))
+
+		state, ok := decoded.Byte(hap.TypeState)
+		Expect(ok).To(BeTrue())
+		Expect(state).To(Equal(byte(1)))
+
+		_, ok = decoded.Get(hap.TypeProof)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("fragments and joins values longer than 255 bytes", func() {
+		key := bytes.Repeat([]byte{0xab}, 384)
+		b := hap.TLV{{Type: hap.TypePublicKey, Value: key}}.Encode()
+
+		Expect(b).To(HaveLen(384 + 4))
+		Expect(b[:2]).To(Equal([]byte{3, 255}))
+		Expect(b[257:259]).To(Equal([]byte{3, 129}))
+
+		decoded, err := hap.DecodeTLV(b)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(HaveLen(1))
+		Expect(decoded[0].Value).To(Equal(key))
+	})
+
+	It("keeps separated items of the same type", func() {
+		t := hap.TLV{
+			{Type: hap.TypeIdentifier, Value: []byte("a")},
+			{Type: hap.TypeSeparator, Value: []byte{}},
+			{Type: hap.TypeIdentifier, Value: []byte("b")},
+		}
+
+		decoded, err := hap.DecodeTLV(t.Encode())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(HaveLen(3))
+	})
+
+	It("returns an error for truncated items", func() {
+		_, err := hap.DecodeTLV([]byte{6, 2, 1})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,406 @@
+//go:build homekit
+// +build homekit
+
+// Package haptest provides a HAP controller for testing accessories.
+package haptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+const contentTypeTLV8 = "application/pairing+tlv8"
+
+// PairingError is the error returned by the accessory during pairing.
+type PairingError byte
+
+func (e PairingError) Error() string {
+	return fmt.Sprintf("pairing error %d", byte(e))
+}
+
+// Controller is the long-term identity of a controller.
+type Controller struct {
+	ID         string
+	PublicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+
+	// AccessoryID and AccessoryKey are set once the controller has paired.
+	AccessoryID  string
+	AccessoryKey ed25519.PublicKey
+}
+
+func NewController(id string) (*Controller, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Controller{
+		ID:         id,
+		PublicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+}
+
+type Response struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Conn is a connection to an accessory. Requests are made one at a time.
+// Once verified, events sent by the accessory are delivered on Events.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	mutex     sync.Mutex
+	secure    *hap.SecureConn
+	responses chan Response
+	events    chan []byte
+	readErr   error
+}
+
+func Dial(addr string) (*Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		responses: make(chan Response),
+		events:    make(chan []byte, 100),
+	}, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Events is closed once the connection is closed.
+func (c *Conn) Events() <-chan []byte {
+	return c.events
+}
+
+func (c *Conn) Do(method string, path string, contentType string, body []byte) (*Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "%s %s HTTP/1.1\r\nHost: accessory\r\n", method, path)
+	if contentType != "" {
+		fmt.Fprintf(&req, "Content-Type: %s\r\n", contentType)
+	}
+	fmt.Fprintf(&req, "Content-Length: %d\r\n\r\n", len(body))
+	req.Write(body)
+
+	var w io.Writer = c.conn
+	if c.secure != nil {
+		w = c.secure
+	}
+
+	_, err := w.Write(req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if c.secure == nil {
+		_, resp, err := readMessage(c.reader)
+		return resp, err
+	}
+
+	resp, ok := <-c.responses
+	if !ok {
+		return nil, c.readErr
+	}
+	return &resp, nil
+}
+
+// Get returns the response body if its status is 200.
+func (c *Conn) Get(path string) ([]byte, error) {
+	resp, err := c.Do("GET", path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, resp.Body)
+	}
+	return resp.Body, nil
+}
+
+// Put writes characteristics, e.g. {"characteristics": [{"aid": 1, "iid": 10, "value": 1}]}.
+func (c *Conn) Put(path string, v interface{}) (*Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do("PUT", path, "application/hap+json", body)
+}
+
+// readMessage reads a response or event.
+func readMessage(r *bufio.Reader) (bool, *Response, error) {
+	tr := textproto.NewReader(r)
+
+	line, err := tr.ReadLine()
+	if err != nil {
+		return false, nil, err
+	}
+
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return false, nil, fmt.Errorf("malformed status line: %s", line)
+	}
+	code, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false, nil, fmt.Errorf("malformed status line: %s", line)
+	}
+
+	header, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return false, nil, err
+	}
+
+	length, _ := strconv.Atoi(header.Get("Content-Length"))
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return strings.HasPrefix(parts[0], "EVENT/"), &Response{StatusCode: code, Body: body}, nil
+}
+
+func (c *Conn) read() {
+	defer close(c.events)
+	defer close(c.responses)
+
+	for {
+		event, resp, err := readMessage(c.reader)
+		if err != nil {
+			c.readErr = err
+			return
+		}
+
+		if event {
+			c.events <- resp.Body
+		} else {
+			c.responses <- *resp
+		}
+	}
+}
+
+func (c *Conn) pair(path string, state byte, request hap.TLV) (hap.TLV, error) {
+	resp, err := c.Do("POST", path, contentTypeTLV8, request.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	t, err := hap.DecodeTLV(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if code, ok := t.Byte(hap.TypeError); ok {
+		return nil, PairingError(code)
+	}
+
+	if s, _ := t.Byte(hap.TypeState); s != state {
+		return nil, fmt.Errorf("unexpected state %d", s)
+	}
+
+	return t, nil
+}
+
+// PairSetup pairs the controller with the accessory using the setup code.
+func (c *Conn) PairSetup(controller *Controller, setupCode string) error {
+	m2, err := c.pair("/pair-setup", 2, hap.TLV{
+		{Type: hap.TypeState, Value: []byte{1}},
+		{Type: hap.TypeMethod, Value: []byte{hap.MethodPairSetup}},
+	})
+	if err != nil {
+		return err
+	}
+
+	salt, _ := m2.Get(hap.TypeSalt)
+	serverPublicKey, _ := m2.Get(hap.TypePublicKey)
+
+	srp, err := hap.NewSRPClient(hap.SRPUsername, setupCode)
+	if err != nil {
+		return err
+	}
+
+	proof, err := srp.Proof(salt, serverPublicKey)
+	if err != nil {
+		return err
+	}
+
+	m4, err := c.pair("/pair-setup", 4, hap.TLV{
+		{Type: hap.TypeState, Value: []byte{3}},
+		{Type: hap.TypePublicKey, Value: srp.PublicKey()},
+		{Type: hap.TypeProof, Value: proof},
+	})
+	if err != nil {
+		return err
+	}
+
+	serverProof, _ := m4.Get(hap.TypeProof)
+	key, err := srp.Verify(serverProof)
+	if err != nil {
+		return err
+	}
+
+	aead, _ := hap.NewAEAD(hap.HKDF(key, hap.PairSetupEncryptSalt, hap.PairSetupEncryptInfo))
+
+	controllerX := hap.HKDF(key, hap.PairSetupControllerSignSalt, hap.PairSetupControllerSignInfo)
+	info := append(append(controllerX, controller.ID...), controller.PublicKey...)
+
+	sealed := aead.Seal(nil, hap.LabelNonce("PS-Msg05"), hap.TLV{
+		{Type: hap.TypeIdentifier, Value: []byte(controller.ID)},
+		{Type: hap.TypePublicKey, Value: controller.PublicKey},
+		{Type: hap.TypeSignature, Value: ed25519.Sign(controller.privateKey, info)},
+	}.Encode(), nil)
+
+	m6, err := c.pair("/pair-setup", 6, hap.TLV{
+		{Type: hap.TypeState, Value: []byte{5}},
+		{Type: hap.TypeEncryptedData, Value: sealed},
+	})
+	if err != nil {
+		return err
+	}
+
+	encrypted, _ := m6.Get(hap.TypeEncryptedData)
+	plaintext, err := aead.Open(nil, hap.LabelNonce("PS-Msg06"), encrypted, nil)
+	if err != nil {
+		return err
+	}
+
+	sub, err := hap.DecodeTLV(plaintext)
+	if err != nil {
+		return err
+	}
+
+	accessoryID, _ := sub.Get(hap.TypeIdentifier)
+	accessoryKey, _ := sub.Get(hap.TypePublicKey)
+	signature, _ := sub.Get(hap.TypeSignature)
+
+	accessoryX := hap.HKDF(key, hap.PairSetupAccessorySignSalt, hap.PairSetupAccessorySignInfo)
+	info = append(append(accessoryX, accessoryID...), accessoryKey...)
+	if len(accessoryKey) != ed25519.PublicKeySize || !ed25519.Verify(accessoryKey, info, signature) {
+		return errors.New("invalid accessory signature")
+	}
+
+	controller.AccessoryID = string(accessoryID)
+	controller.AccessoryKey = accessoryKey
+	return nil
+}
+
+// PairVerify establishes an encrypted session for a paired controller.
+func (c *Conn) PairVerify(controller *Controller) error {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	controllerKey := privateKey.PublicKey().Bytes()
+
+	m2, err := c.pair("/pair-verify", 2, hap.TLV{
+		{Type: hap.TypeState, Value: []byte{1}},
+		{Type: hap.TypePublicKey, Value: controllerKey},
+	})
+	if err != nil {
+		return err
+	}
+
+	accessoryKey, _ := m2.Get(hap.TypePublicKey)
+	accessoryPublicKey, err := ecdh.X25519().NewPublicKey(accessoryKey)
+	if err != nil {
+		return err
+	}
+
+	sharedSecret, err := privateKey.ECDH(accessoryPublicKey)
+	if err != nil {
+		return err
+	}
+
+	aead, _ := hap.NewAEAD(hap.HKDF(sharedSecret, hap.PairVerifyEncryptSalt, hap.PairVerifyEncryptInfo))
+
+	encrypted, _ := m2.Get(hap.TypeEncryptedData)
+	plaintext, err := aead.Open(nil, hap.LabelNonce("PV-Msg02"), encrypted, nil)
+	if err != nil {
+		return err
+	}
+
+	sub, err := hap.DecodeTLV(plaintext)
+	if err != nil {
+		return err
+	}
+
+	accessoryID, _ := sub.Get(hap.TypeIdentifier)
+	signature, _ := sub.Get(hap.TypeSignature)
+	info := append(append(append([]byte{}, accessoryKey...), accessoryID...), controllerKey...)
+	if string(accessoryID) != controller.AccessoryID || !ed25519.Verify(controller.AccessoryKey, info, signature) {
+		return errors.New("invalid accessory signature")
+	}
+
+	info = append(append(append([]byte{}, controllerKey...), controller.ID...), accessoryKey...)
+	sealed := aead.Seal(nil, hap.LabelNonce("PV-Msg03"), hap.TLV{
+		{Type: hap.TypeIdentifier, Value: []byte(controller.ID)},
+		{Type: hap.TypeSignature, Value: ed25519.Sign(controller.privateKey, info)},
+	}.Encode(), nil)
+
+	_, err = c.pair("/pair-verify", 4, hap.TLV{
+		{Type: hap.TypeState, Value: []byte{3}},
+		{Type: hap.TypeEncryptedData, Value: sealed},
+	})
+	if err != nil {
+		return err
+	}
+
+	readKey := hap.HKDF(sharedSecret, hap.ControlSalt, hap.ControlReadEncryptionKey)
+	writeKey := hap.HKDF(sharedSecret, hap.ControlSalt, hap.ControlWriteEncryptionKey)
+	secure, err := hap.NewSecureConn(c.conn, readKey, writeKey)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.secure = secure
+	c.reader = bufio.NewReader(secure)
+	c.mutex.Unlock()
+
+	go c.read()
+	return nil
+}
+
+// Connect dials the accessory and verifies the session.
+func Connect(addr string, controller *Controller) (*Conn, error) {
+	c, err := Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.PairVerify(controller)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,34 @@
+//go:build homekit
+// +build homekit
+
+package homekit_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestHomekit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "HomeKit Suite")
+}
+
+func freeTCPPort() uint {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer l.Close()
+
+	return uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+func freeUDPPort() int {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	Expect(err).NotTo(HaveOccurred())
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
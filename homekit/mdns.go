@@ -0,0 +1,379 @@
+//go:build homekit
+// +build homekit
+
+package homekit
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// DefaultMDNSAddress is the multicast DNS group and port.
+const DefaultMDNSAddress = "224.0.0.251:5353"
+
+const (
+	serviceType  = "_hap._tcp.local"
+	servicesType = "_services._dns-sd._udp.local"
+
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN = 1
+
+	// dnsCacheFlush is set in the class of records which are unique to this host.
+	dnsCacheFlush = 0x8000
+
+	mdnsPort = 5353
+
+	// legacyTTL is the TTL of records in responses to one-shot queries,
+	// which are not from port 5353.
+	legacyTTL = 10
+)
+
+var errMalformedDNS = errors.New("malformed DNS message")
+
+// advertiser answers mDNS queries for the HAP service, and announces it when
+// it starts and whenever its TXT records change.
+type advertiser struct {
+	logger  lager.Logger
+	address string
+	txt     func() []string
+	updates chan struct{}
+}
+
+func newAdvertiser(logger lager.Logger, address string, txt func() []string) *advertiser {
+	if address == "" {
+		address = DefaultMDNSAddress
+	}
+
+	return &advertiser{
+		logger:  logger.Session("mdns", lager.Data{"address": address}),
+		address: address,
+		txt:     txt,
+		updates: make(chan struct{}, 1),
+	}
+}
+
+// update announces the current TXT records.
+func (a *advertiser) update() {
+	select {
+	case a.updates <- struct{}{}:
+	default:
+	}
+}
+
+type query struct {
+	from      *net.UDPAddr
+	id        uint16
+	questions []byte
+	names     []string
+}
+
+type service struct {
+	instance string
+	host     string
+	port     uint16
+}
+
+// run advertises the service until stop is closed. It logs rather than
+// returns errors, as the server can still be used by controllers which
+// already know its address.
+func (a *advertiser) run(name string, host string, port uint, stop <-chan struct{}) {
+	addr, err := net.ResolveUDPAddr("udp4", a.address)
+	if err != nil {
+		a.logger.Error("error advertising", err)
+		<-stop
+		return
+	}
+
+	var conn *net.UDPConn
+	multicast := addr.IP.IsMulticast()
+	if multicast {
+		conn, err = net.ListenMulticastUDP("udp4", nil, addr)
+	} else {
+		conn, err = net.ListenUDP("udp4", addr)
+	}
+	if err != nil {
+		a.logger.Error("error advertising", err)
+		<-stop
+		return
+	}
+	defer conn.Close()
+
+	svc := service{
+		instance: name + "." + serviceType,
+		host:     host + ".local",
+		port:     uint16(port),
+	}
+
+	queries := make(chan query)
+	go a.read(conn, queries, stop)
+
+	if multicast {
+		a.send(conn, addr, 0, nil, a.records(svc, false, false, false))
+	}
+
+	for {
+		select {
+		case <-stop:
+			if multicast {
+				a.send(conn, addr, 0, nil, a.records(svc, false, false, true))
+			}
+			return
+
+		case <-a.updates:
+			if multicast {
+				a.send(conn, addr, 0, nil, a.records(svc, false, false, false))
+			}
+
+		case q := <-queries:
+			services := false
+			matched := false
+			for _, n := range q.names {
+				switch strings.ToLower(n) {
+				case servicesType:
+					services = true
+					matched = true
+				case serviceType, strings.ToLower(svc.instance), strings.ToLower(svc.host):
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+
+			if q.from.Port == mdnsPort && multicast {
+				a.send(conn, addr, 0, nil, a.records(svc, services, false, false))
+			} else {
+				a.send(conn, q.from, q.id, q.questions, a.records(svc, services, true, false))
+			}
+		}
+	}
+}
+
+func (a *advertiser) read(conn *net.UDPConn, queries chan<- query, stop <-chan struct{}) {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		q, err := parseQuery(buf[:n])
+		if err != nil {
+			a.logger.Debug("ignoring message", lager.Data{"from": from.String(), "error": err.Error()})
+			continue
+		}
+		q.from = from
+
+		select {
+		case queries <- q:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (a *advertiser) send(conn *net.UDPConn, to *net.UDPAddr, id uint16, questions []byte, records [][]byte) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x8400) // response, authoritative
+	if questions != nil {
+		binary.BigEndian.PutUint16(msg[4:], 1)
+		msg = append(msg, questions...)
+	}
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(records)))
+
+	for _, r := range records {
+		msg = append(msg, r...)
+	}
+
+	_, err := conn.WriteToUDP(msg, to)
+	if err != nil {
+		a.logger.Debug("error sending response", lager.Data{"to": to.String(), "error": err.Error()})
+	}
+}
+
+// records returns the PTR, SRV, TXT and A records of the service. TTLs are
+// zero in goodbye announcements.
+func (a *advertiser) records(svc service, services bool, legacy bool, goodbye bool) [][]byte {
+	ttl := func(t uint32) uint32 {
+		switch {
+		case goodbye:
+			return 0
+		case legacy:
+			return legacyTTL
+		default:
+			return t
+		}
+	}
+
+	unique := uint16(dnsClassIN)
+	if !legacy {
+		unique |= dnsCacheFlush
+	}
+
+	var records [][]byte
+	if services {
+		records = append(records, record(servicesType, dnsTypePTR, dnsClassIN, ttl(4500), encodeName(serviceType)))
+	}
+
+	records = append(records, record(serviceType, dnsTypePTR, dnsClassIN, ttl(4500), encodeName(svc.instance)))
+
+	srv := make([]byte, 6)
+	binary.BigEndian.PutUint16(srv[4:], svc.port)
+	records = append(records, record(svc.instance, dnsTypeSRV, unique, ttl(120), append(srv, encodeName(svc.host)...)))
+
+	var txt []byte
+	for _, t := range a.txt() {
+		txt = append(txt, byte(len(t)))
+		txt = append(txt, t...)
+	}
+	records = append(records, record(svc.instance, dnsTypeTXT, unique, ttl(4500), txt))
+
+	for _, ip := range localAddresses() {
+		records = append(records, record(svc.host, dnsTypeA, unique, ttl(120), ip))
+	}
+
+	return records
+}
+
+// localAddresses returns the IPv4 addresses of the host, or the loopback
+// addresses if it has no others.
+func localAddresses() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	var ips, loopback []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		if ipNet.IP.IsLoopback() {
+			loopback = append(loopback, ipNet.IP.To4())
+		} else {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+
+	if len(ips) == 0 {
+		return loopback
+	}
+	return ips
+}
+
+func record(name string, typ uint16, class uint16, ttl uint32, data []byte) []byte {
+	r := encodeName(name)
+
+	header := make([]byte, 10)
+	binary.BigEndian.PutUint16(header[0:], typ)
+	binary.BigEndian.PutUint16(header[2:], class)
+	binary.BigEndian.PutUint32(header[4:], ttl)
+	binary.BigEndian.PutUint16(header[8:], uint16(len(data)))
+
+	r = append(r, header...)
+	return append(r, data...)
+}
+
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(name, ".") {
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// parseQuery returns the names of the questions of a query.
+func parseQuery(msg []byte) (query, error) {
+	if len(msg) < 12 {
+		return query{}, errMalformedDNS
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 != 0 {
+		return query{}, errors.New("not a query")
+	}
+
+	q := query{id: binary.BigEndian.Uint16(msg[0:])}
+
+	count := int(binary.BigEndian.Uint16(msg[4:]))
+	offset := 12
+	for i := 0; i < count; i++ {
+		name, next, compressed, err := decodeName(msg, offset)
+		if err != nil {
+			return query{}, err
+		}
+		if next+4 > len(msg) {
+			return query{}, errMalformedDNS
+		}
+
+		qtype := binary.BigEndian.Uint16(msg[next:])
+		if qtype == dnsTypePTR || qtype == dnsTypeSRV || qtype == dnsTypeTXT || qtype == dnsTypeA || qtype == dnsTypeANY {
+			q.names = append(q.names, name)
+		}
+
+		// Only the first question is echoed in responses to one-shot
+		// queries, unless it is compressed and so refers to the query.
+		if i == 0 && !compressed {
+			q.questions = append([]byte{}, msg[offset:next+4]...)
+		}
+		offset = next + 4
+	}
+
+	return q, nil
+}
+
+// decodeName returns the name at offset, the offset following it, and
+// whether the name is compressed.
+func decodeName(msg []byte, offset int) (string, int, bool, error) {
+	var labels []string
+	next := -1
+
+	for jumps := 0; jumps < 10; {
+		if offset >= len(msg) {
+			return "", 0, false, errMalformedDNS
+		}
+
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, jumps > 0, nil
+
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, false, errMalformedDNS
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			jumps++
+
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, false, errMalformedDNS
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+
+	return "", 0, false, errMalformedDNS
+}
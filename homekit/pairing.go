@@ -0,0 +1,424 @@
+//go:build homekit
+// +build homekit
+
+package homekit
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+)
+
+// maxPairSetupAttempts is the number of failed pair setup attempts after
+// which pairing is refused until the server restarts.
+const maxPairSetupAttempts = 100
+
+// pairSetup is the state of the pair setup in progress. Only one
+// controller may pair at a time.
+type pairSetup struct {
+	session *session
+	srp     *hap.SRPServer
+	key     []byte
+}
+
+// pairVerify is the state of a session between the first and second
+// pair verify requests.
+type pairVerify struct {
+	privateKey          *ecdh.PrivateKey
+	controllerPublicKey []byte
+	sharedSecret        []byte
+}
+
+func tlvResponse(t hap.TLV) response {
+	return response{status: http.StatusOK, contentType: contentTypeTLV8, body: t.Encode()}
+}
+
+func tlvError(state byte, code byte) response {
+	return tlvResponse(hap.TLV{
+		{Type: hap.TypeState, Value: []byte{state}},
+		{Type: hap.TypeError, Value: []byte{code}},
+	})
+}
+
+func (sess *session) handlePairSetup(body []byte) response {
+	req, err := hap.DecodeTLV(body)
+	if err != nil {
+		return response{status: http.StatusBadRequest}
+	}
+
+	state, _ := req.Byte(hap.TypeState)
+	switch state {
+	case 1:
+		return sess.pairSetupStart(req)
+	case 3:
+		return sess.pairSetupVerify(req)
+	case 5:
+		return sess.pairSetupExchange(req)
+	default:
+		return response{status: http.StatusBadRequest}
+	}
+}
+
+// pairSetupStart handles M1, and responds with the SRP salt and public key.
+func (sess *session) pairSetupStart(req hap.TLV) response {
+	s := sess.server
+
+	if s.store.paired() {
+		sess.logger.Info("pair setup refused - already paired")
+		return tlvError(2, hap.ErrorUnavailable)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failedSetups >= maxPairSetupAttempts {
+		sess.logger.Info("pair setup refused - too many attempts")
+		return tlvError(2, hap.ErrorMaxTries)
+	}
+
+	if s.setup != nil && s.setup.session != sess {
+		sess.logger.Info("pair setup refused - busy")
+		return tlvError(2, hap.ErrorBusy)
+	}
+
+	srp, err := hap.NewSRPServer(hap.SRPUsername, s.config.SetupCode)
+	if err != nil {
+		sess.logger.Error("error starting pair setup", err)
+		return tlvError(2, hap.ErrorUnknown)
+	}
+
+	s.setup = &pairSetup{session: sess, srp: srp}
+	sess.logger.Info("pair setup started")
+
+	return tlvResponse(hap.TLV{
+		{Type: hap.TypeState, Value: []byte{2}},
+		{Type: hap.TypePublicKey, Value: srp.PublicKey()},
+		{Type: hap.TypeSalt, Value: srp.Salt()},
+	})
+}
+
+// currentSetup returns the pair setup of the session.
+func (sess *session) currentSetup() *pairSetup {
+	s := sess.server
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.setup == nil || s.setup.session != sess {
+		return nil
+	}
+	return s.setup
+}
+
+func (sess *session) endSetup(failed bool) {
+	s := sess.server
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.setup = nil
+	if failed {
+		s.failedSetups++
+	}
+}
+
+// pairSetupVerify handles M3, verifying the proof that the controller knows the setup code.
+func (sess *session) pairSetupVerify(req hap.TLV) response {
+	setup := sess.currentSetup()
+	if setup == nil {
+		return tlvError(4, hap.ErrorUnknown)
+	}
+
+	publicKey, ok := req.Get(hap.TypePublicKey)
+	proof, ok2 := req.Get(hap.TypeProof)
+	if !ok || !ok2 {
+		sess.endSetup(false)
+		return tlvError(4, hap.ErrorUnknown)
+	}
+
+	serverProof, key, err := setup.srp.Verify(publicKey, proof)
+	if err != nil {
+		sess.logger.Info("pair setup failed - incorrect setup code")
+		sess.endSetup(true)
+		return tlvError(4, hap.ErrorAuthentication)
+	}
+	setup.key = key
+
+	return tlvResponse(hap.TLV{
+		{Type: hap.TypeState, Value: []byte{4}},
+		{Type: hap.TypeProof, Value: serverProof},
+	})
+}
+
+// pairSetupExchange handles M5, saving the long-term public key of the
+// controller and responding with that of the accessory.
+func (sess *session) pairSetupExchange(req hap.TLV) response {
+	s := sess.server
+
+	setup := sess.currentSetup()
+	if setup == nil || setup.key == nil {
+		return tlvError(6, hap.ErrorUnknown)
+	}
+	defer sess.endSetup(false)
+
+	encrypted, _ := req.Get(hap.TypeEncryptedData)
+	sessionKey := hap.HKDF(setup.key, hap.PairSetupEncryptSalt, hap.PairSetupEncryptInfo)
+	aead, _ := hap.NewAEAD(sessionKey)
+
+	plaintext, err := aead.Open(nil, hap.LabelNonce("PS-Msg05"), encrypted, nil)
+	if err != nil {
+		return tlvError(6, hap.ErrorAuthentication)
+	}
+
+	sub, err := hap.DecodeTLV(plaintext)
+	if err != nil {
+		return tlvError(6, hap.ErrorUnknown)
+	}
+
+	id, _ := sub.Get(hap.TypeIdentifier)
+	publicKey, _ := sub.Get(hap.TypePublicKey)
+	signature, _ := sub.Get(hap.TypeSignature)
+	if len(id) == 0 || len(publicKey) != ed25519.PublicKeySize {
+		return tlvError(6, hap.ErrorUnknown)
+	}
+
+	controllerX := hap.HKDF(setup.key, hap.PairSetupControllerSignSalt, hap.PairSetupControllerSignInfo)
+	info := append(append(controllerX, id...), publicKey...)
+	if !ed25519.Verify(publicKey, info, signature) {
+		sess.logger.Info("pair setup failed - invalid controller signature")
+		return tlvError(6, hap.ErrorAuthentication)
+	}
+
+	_, err = s.store.addPairing(Pairing{ID: string(id), PublicKey: publicKey, Admin: true})
+	if err != nil {
+		sess.logger.Error("error saving pairing", err)
+		return tlvError(6, hap.ErrorUnknown)
+	}
+
+	accessoryID := []byte(s.store.pairingID())
+	privateKey := s.store.privateKey()
+	accessoryPublicKey := privateKey.Public().(ed25519.PublicKey)
+
+	accessoryX := hap.HKDF(setup.key, hap.PairSetupAccessorySignSalt, hap.PairSetupAccessorySignInfo)
+	info = append(append(accessoryX, accessoryID...), accessoryPublicKey...)
+
+	sealed := aead.Seal(nil, hap.LabelNonce("PS-Msg06"), hap.TLV{
+		{Type: hap.TypeIdentifier, Value: accessoryID},
+		{Type: hap.TypePublicKey, Value: accessoryPublicKey},
+		{Type: hap.TypeSignature, Value: ed25519.Sign(privateKey, info)},
+	}.Encode(), nil)
+
+	sess.logger.Info("paired", lager.Data{"controller": string(id)})
+	s.advertiser.update()
+
+	return tlvResponse(hap.TLV{
+		{Type: hap.TypeState, Value: []byte{6}},
+		{Type: hap.TypeEncryptedData, Value: sealed},
+	})
+}
+
+func (sess *session) handlePairVerify(body []byte) response {
+	req, err := hap.DecodeTLV(body)
+	if err != nil {
+		return response{status: http.StatusBadRequest}
+	}
+
+	state, _ := req.Byte(hap.TypeState)
+	switch state {
+	case 1:
+		return sess.pairVerifyStart(req)
+	case 3:
+		return sess.pairVerifyFinish(req)
+	default:
+		return response{status: http.StatusBadRequest}
+	}
+}
+
+// pairVerifyStart handles M1, proving the identity of the accessory with an
+// ephemeral key exchange signed by its long-term key.
+func (sess *session) pairVerifyStart(req hap.TLV) response {
+	s := sess.server
+
+	controllerKey, _ := req.Get(hap.TypePublicKey)
+	controllerPublicKey, err := ecdh.X25519().NewPublicKey(controllerKey)
+	if err != nil {
+		return tlvError(2, hap.ErrorUnknown)
+	}
+
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return tlvError(2, hap.ErrorUnknown)
+	}
+
+	sharedSecret, err := privateKey.ECDH(controllerPublicKey)
+	if err != nil {
+		return tlvError(2, hap.ErrorUnknown)
+	}
+
+	accessoryKey := privateKey.PublicKey().Bytes()
+	accessoryID := []byte(s.store.pairingID())
+	info := append(append(append([]byte{}, accessoryKey...), accessoryID...), controllerKey...)
+
+	sessionKey := hap.HKDF(sharedSecret, hap.PairVerifyEncryptSalt, hap.PairVerifyEncryptInfo)
+	aead, _ := hap.NewAEAD(sessionKey)
+	sealed := aead.Seal(nil, hap.LabelNonce("PV-Msg02"), hap.TLV{
+		{Type: hap.TypeIdentifier, Value: accessoryID},
+		{Type: hap.TypeSignature, Value: ed25519.Sign(s.store.privateKey(), info)},
+	}.Encode(), nil)
+
+	sess.mutex.Lock()
+	sess.verify = &pairVerify{
+		privateKey:          privateKey,
+		controllerPublicKey: controllerKey,
+		sharedSecret:        sharedSecret,
+	}
+	sess.mutex.Unlock()
+
+	return tlvResponse(hap.TLV{
+		{Type: hap.TypeState, Value: []byte{2}},
+		{Type: hap.TypePublicKey, Value: accessoryKey},
+		{Type: hap.TypeEncryptedData, Value: sealed},
+	})
+}
+
+// pairVerifyFinish handles M3, checking that the controller is paired, and
+// encrypts the session once the response has been sent.
+func (sess *session) pairVerifyFinish(req hap.TLV) response {
+	sess.mutex.Lock()
+	verify := sess.verify
+	sess.verify = nil
+	sess.mutex.Unlock()
+
+	if verify == nil {
+		return tlvError(4, hap.ErrorUnknown)
+	}
+
+	encrypted, _ := req.Get(hap.TypeEncryptedData)
+	sessionKey := hap.HKDF(verify.sharedSecret, hap.PairVerifyEncryptSalt, hap.PairVerifyEncryptInfo)
+	aead, _ := hap.NewAEAD(sessionKey)
+
+	plaintext, err := aead.Open(nil, hap.LabelNonce("PV-Msg03"), encrypted, nil)
+	if err != nil {
+		return tlvError(4, hap.ErrorAuthentication)
+	}
+
+	sub, err := hap.DecodeTLV(plaintext)
+	if err != nil {
+		return tlvError(4, hap.ErrorUnknown)
+	}
+
+	id, _ := sub.Get(hap.TypeIdentifier)
+	signature, _ := sub.Get(hap.TypeSignature)
+
+	pairing, ok := sess.server.store.pairing(string(id))
+	if !ok {
+		sess.logger.Info("pair verify failed - unknown controller", lager.Data{"controller": string(id)})
+		return tlvError(4, hap.ErrorAuthentication)
+	}
+
+	accessoryKey := verify.privateKey.PublicKey().Bytes()
+	info := append(append(append([]byte{}, verify.controllerPublicKey...), id...), accessoryKey...)
+	if !ed25519.Verify(pairing.PublicKey, info, signature) {
+		sess.logger.Info("pair verify failed - invalid signature", lager.Data{"controller": pairing.ID})
+		return tlvError(4, hap.ErrorAuthentication)
+	}
+
+	readKey := hap.HKDF(verify.sharedSecret, hap.ControlSalt, hap.ControlWriteEncryptionKey)
+	writeKey := hap.HKDF(verify.sharedSecret, hap.ControlSalt, hap.ControlReadEncryptionKey)
+	secure, _ := hap.NewSecureConn(sess.conn, readKey, writeKey)
+
+	sess.mutex.Lock()
+	sess.id = pairing.ID
+	sess.admin = pairing.Admin
+	sess.mutex.Unlock()
+
+	resp := tlvResponse(hap.TLV{{Type: hap.TypeState, Value: []byte{4}}})
+	resp.upgrade = secure
+	return resp
+}
+
+// handlePairings adds, removes and lists pairings. Only admin controllers may manage pairings.
+func (sess *session) handlePairings(body []byte) response {
+	s := sess.server
+
+	req, err := hap.DecodeTLV(body)
+	if err != nil {
+		return response{status: http.StatusBadRequest}
+	}
+
+	sess.mutex.Lock()
+	admin := sess.admin
+	sess.mutex.Unlock()
+
+	if !admin {
+		return tlvError(2, hap.ErrorAuthentication)
+	}
+
+	method, _ := req.Byte(hap.TypeMethod)
+	id, _ := req.Get(hap.TypeIdentifier)
+
+	switch method {
+	case hap.MethodAddPairing:
+		publicKey, _ := req.Get(hap.TypePublicKey)
+		permissions, _ := req.Byte(hap.TypePermissions)
+		if len(id) == 0 || len(publicKey) != ed25519.PublicKeySize {
+			return tlvError(2, hap.ErrorUnknown)
+		}
+
+		added, err := s.store.addPairing(Pairing{
+			ID:        string(id),
+			PublicKey: publicKey,
+			Admin:     permissions == hap.PermissionAdmin,
+		})
+		if err != nil {
+			sess.logger.Error("error saving pairing", err)
+			return tlvError(2, hap.ErrorUnknown)
+		}
+		if !added {
+			return tlvError(2, hap.ErrorUnknown)
+		}
+		sess.logger.Info("pairing added", lager.Data{"controller": string(id)})
+
+	case hap.MethodRemovePairing:
+		removed, err := s.store.removePairing(string(id))
+		if err != nil {
+			sess.logger.Error("error saving pairings", err)
+			return tlvError(2, hap.ErrorUnknown)
+		}
+		sess.logger.Info("pairings removed", lager.Data{"controllers": removed})
+		s.advertiser.update()
+
+		resp := tlvResponse(hap.TLV{{Type: hap.TypeState, Value: []byte{2}}})
+		resp.then = func() {
+			s.closeSessions(removed)
+		}
+		return resp
+
+	case hap.MethodListPairings:
+		resp := hap.TLV{{Type: hap.TypeState, Value: []byte{2}}}
+		for i, p := range s.store.pairings() {
+			if i > 0 {
+				resp = append(resp, hap.Item{Type: hap.TypeSeparator, Value: []byte{}})
+			}
+			permissions := hap.PermissionUser
+			if p.Admin {
+				permissions = hap.PermissionAdmin
+			}
+			resp = append(resp,
+				hap.Item{Type: hap.TypeIdentifier, Value: []byte(p.ID)},
+				hap.Item{Type: hap.TypePublicKey, Value: p.PublicKey},
+				hap.Item{Type: hap.TypePermissions, Value: []byte{permissions}},
+			)
+		}
+		return tlvResponse(resp)
+
+	default:
+		return tlvError(2, hap.ErrorUnknown)
+	}
+
+	return tlvResponse(hap.TLV{{Type: hap.TypeState, Value: []byte{2}}})
+}
@@ -0,0 +1,666 @@
+//go:build homekit
+// +build homekit
+
+// Package homekit implements a HomeKit Accessory Protocol (HAP) server for a
+// single accessory over IP, advertised with multicast DNS. Controllers pair
+// using the setup code, after which their sessions are encrypted.
+package homekit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	// CategoryGarageDoorOpener is the accessory category shown while pairing.
+	CategoryGarageDoorOpener = 4
+
+	// accessoryID is the ID of the only accessory.
+	accessoryID = 1
+
+	contentTypeJSON = "application/hap+json"
+	contentTypeTLV8 = "application/pairing+tlv8"
+
+	// statusConnectionAuthorizationRequired is returned for requests which
+	// require a verified session.
+	statusConnectionAuthorizationRequired = 470
+)
+
+var setupCodePattern = regexp.MustCompile(`^\d{3}-\d{2}-\d{3}$`)
+
+// ValidateSetupCode returns an error if code is not of the form 123-45-678,
+// or is one of the trivial codes which HAP forbids.
+func ValidateSetupCode(code string) error {
+	if !setupCodePattern.MatchString(code) {
+		return fmt.Errorf("invalid HomeKit setup code: '%s' must be of the form 123-45-678", code)
+	}
+
+	digits := strings.Replace(code, "-", "", -1)
+	if digits == "12345678" || digits == "87654321" || strings.Count(digits, digits[:1]) == len(digits) {
+		return fmt.Errorf("invalid HomeKit setup code: '%s' is too easily guessed", code)
+	}
+
+	return nil
+}
+
+type Config struct {
+	// Name is advertised and suggested as the name of the accessory.
+	Name     string
+	Category int
+
+	SetupCode string
+	Port      uint
+
+	// StateFile persists the identity of the accessory and its pairings.
+	StateFile string
+
+	// MDNSAddress is the address on which mDNS queries are answered,
+	// normally DefaultMDNSAddress. Announcements are only sent if it is
+	// a multicast address.
+	MDNSAddress string
+}
+
+//go:generate counterfeiter . Server
+
+// Server serves the accessory while it runs.
+type Server interface {
+	ifrit.Runner
+
+	// Notify sends the value of c to controllers which have enabled
+	// events for it.
+	Notify(c *Characteristic)
+}
+
+type server struct {
+	logger   lager.Logger
+	config   Config
+	store    *store
+	services []*Service
+
+	characteristics map[int]*Characteristic
+	advertiser      *advertiser
+
+	mutex    sync.Mutex
+	sessions map[*session]struct{}
+
+	setup        *pairSetup
+	failedSetups int
+}
+
+// NewServer returns a server for the accessory with services, which should
+// include an InformationService. The state file is created if it does
+// not exist.
+func NewServer(logger lager.Logger, config Config, services []*Service) (Server, error) {
+	err := ValidateSetupCode(config.SetupCode)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := loadStore(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		logger:          logger.Session("homekit"),
+		config:          config,
+		store:           st,
+		services:        services,
+		characteristics: assignIDs(services),
+		sessions:        map[*session]struct{}{},
+	}
+
+	err = st.updateConfig(s.configHash())
+	if err != nil {
+		return nil, err
+	}
+
+	s.advertiser = newAdvertiser(s.logger, config.MDNSAddress, s.txtRecords)
+
+	return s, nil
+}
+
+// configHash identifies the structure of the accessory database, ignoring values.
+func (s *server) configHash() string {
+	b, _ := json.Marshal(s.accessories(false))
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// txtRecords returns the TXT records advertised with mDNS.
+func (s *server) txtRecords() []string {
+	unpaired := 1
+	if s.store.paired() {
+		unpaired = 0
+	}
+
+	return []string{
+		"c#=" + strconv.Itoa(s.store.configNumber()),
+		"ff=0",
+		"id=" + s.store.pairingID(),
+		"md=" + s.config.Name,
+		"pv=1.1",
+		"s#=1",
+		"sf=" + strconv.Itoa(unpaired),
+		"ci=" + strconv.Itoa(s.config.Category),
+	}
+}
+
+func (s *server) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.Port))
+	if err != nil {
+		return err
+	}
+
+	port := uint(listener.Addr().(*net.TCPAddr).Port)
+	host := "garagepi-" + strings.Replace(s.store.pairingID(), ":", "", -1)
+
+	stopAdvertising := make(chan struct{})
+	advertised := make(chan struct{})
+	go func() {
+		s.advertiser.run(s.config.Name, host, port, stopAdvertising)
+		close(advertised)
+	}()
+
+	go s.accept(listener)
+
+	s.logger.Info("started", lager.Data{
+		"port":      port,
+		"pairingID": s.store.pairingID(),
+		"paired":    s.store.paired(),
+	})
+	close(ready)
+
+	<-signals
+
+	listener.Close()
+	close(stopAdvertising)
+	<-advertised
+
+	s.mutex.Lock()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.mutex.Unlock()
+
+	return nil
+}
+
+func (s *server) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		sess := &session{
+			server: s,
+			conn:   conn,
+			logger: s.logger.Session("session", lager.Data{"remoteAddr": conn.RemoteAddr().String()}),
+			events: map[int]bool{},
+		}
+
+		s.mutex.Lock()
+		s.sessions[sess] = struct{}{}
+		s.mutex.Unlock()
+
+		go sess.serve()
+	}
+}
+
+func (s *server) removeSession(sess *session) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, sess)
+	if s.setup != nil && s.setup.session == sess {
+		s.setup = nil
+	}
+}
+
+// closeSessions closes the sessions of the controllers with ids.
+func (s *server) closeSessions(ids []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for sess := range s.sessions {
+		for _, id := range ids {
+			if sess.controllerID() == id {
+				sess.conn.Close()
+			}
+		}
+	}
+}
+
+func (s *server) Notify(c *Characteristic) {
+	if c.Get == nil {
+		return
+	}
+
+	value, err := c.Get()
+	if err != nil {
+		s.logger.Debug("not notifying", lager.Data{"iid": c.iid, "error": err.Error()})
+		return
+	}
+
+	body, _ := json.Marshal(characteristicsBody{
+		Characteristics: []characteristicValue{{AID: accessoryID, IID: c.iid, Value: value}},
+	})
+
+	s.mutex.Lock()
+	var subscribed []*session
+	for sess := range s.sessions {
+		if sess.subscribed(c.iid) {
+			subscribed = append(subscribed, sess)
+		}
+	}
+	s.mutex.Unlock()
+
+	for _, sess := range subscribed {
+		sess.writeMessage("EVENT/1.0 200 OK", contentTypeJSON, body)
+	}
+}
+
+type session struct {
+	server *server
+	logger lager.Logger
+	conn   net.Conn
+
+	mutex  sync.Mutex
+	secure *hap.SecureConn
+	id     string
+	admin  bool
+	events map[int]bool
+	verify *pairVerify
+}
+
+func (sess *session) controllerID() string {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+
+	return sess.id
+}
+
+func (sess *session) subscribed(iid int) bool {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+
+	return sess.events[iid]
+}
+
+type response struct {
+	status      int
+	contentType string
+	body        []byte
+
+	// upgrade is set once pair verify succeeds. The session is encrypted
+	// after the response is written.
+	upgrade *hap.SecureConn
+
+	// then is called after the response is written.
+	then func()
+}
+
+func (sess *session) serve() {
+	defer sess.server.removeSession(sess)
+	defer sess.conn.Close()
+
+	sess.logger.Debug("connected")
+	defer sess.logger.Debug("disconnected")
+
+	r := bufio.NewReader(sess.conn)
+	for {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return
+		}
+
+		resp := sess.handle(req, body)
+
+		status := fmt.Sprintf("HTTP/1.1 %d %s", resp.status, statusText(resp.status))
+		err = sess.writeMessage(status, resp.contentType, resp.body)
+		if err != nil {
+			return
+		}
+
+		if resp.then != nil {
+			resp.then()
+		}
+
+		if resp.upgrade != nil {
+			sess.mutex.Lock()
+			sess.secure = resp.upgrade
+			sess.mutex.Unlock()
+
+			r = bufio.NewReader(resp.upgrade)
+			sess.logger.Info("session verified", lager.Data{"controller": sess.controllerID()})
+		}
+	}
+}
+
+func statusText(code int) string {
+	if code == statusConnectionAuthorizationRequired {
+		return "Connection Authorization Required"
+	}
+	return http.StatusText(code)
+}
+
+// writeMessage writes a response or event in a single write, so that
+// events are never interleaved with responses.
+func (sess *session) writeMessage(status string, contentType string, body []byte) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\r\n", status)
+	if contentType != "" {
+		fmt.Fprintf(&b, "Content-Type: %s\r\n", contentType)
+	}
+	fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n", len(body))
+	b.Write(body)
+
+	sess.mutex.Lock()
+	var w net.Conn = sess.conn
+	if sess.secure != nil {
+		w = sess.secure
+	}
+	sess.mutex.Unlock()
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (sess *session) verified() bool {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+
+	return sess.secure != nil
+}
+
+func (sess *session) handle(req *http.Request, body []byte) response {
+	sess.logger.Debug("request", lager.Data{"method": req.Method, "path": req.URL.Path})
+
+	route := req.Method + " " + req.URL.Path
+	switch route {
+	case "POST /pair-setup":
+		return sess.handlePairSetup(body)
+	case "POST /pair-verify":
+		return sess.handlePairVerify(body)
+	case "POST /identify":
+		return sess.handleIdentify()
+	}
+
+	if !sess.verified() {
+		return jsonStatus(statusConnectionAuthorizationRequired, StatusInsufficientPrivileges)
+	}
+
+	switch route {
+	case "GET /accessories":
+		b, _ := json.Marshal(sess.server.accessories(true))
+		return response{status: http.StatusOK, contentType: contentTypeJSON, body: b}
+	case "GET /characteristics":
+		return sess.handleGetCharacteristics(req.URL.Query().Get("id"))
+	case "PUT /characteristics":
+		return sess.handlePutCharacteristics(body)
+	case "POST /pairings":
+		return sess.handlePairings(body)
+	}
+
+	return response{status: http.StatusNotFound}
+}
+
+func jsonStatus(code int, status Status) response {
+	b, _ := json.Marshal(map[string]Status{"status": status})
+	return response{status: code, contentType: contentTypeJSON, body: b}
+}
+
+// handleIdentify is only allowed while the accessory is unpaired.
+func (sess *session) handleIdentify() response {
+	if sess.server.store.paired() {
+		return jsonStatus(http.StatusBadRequest, StatusInsufficientPrivileges)
+	}
+
+	for _, s := range sess.server.services {
+		for _, c := range s.Characteristics {
+			if c.Type == CharacteristicIdentify && c.Set != nil {
+				c.Set(true, events.Source{User: "homekit"})
+			}
+		}
+	}
+
+	return response{status: http.StatusNoContent}
+}
+
+type accessoriesBody struct {
+	Accessories []accessoryBody `json:"accessories"`
+}
+
+type accessoryBody struct {
+	AID      int           `json:"aid"`
+	Services []serviceBody `json:"services"`
+}
+
+type serviceBody struct {
+	IID             int                  `json:"iid"`
+	Type            string               `json:"type"`
+	Primary         bool                 `json:"primary,omitempty"`
+	Characteristics []characteristicBody `json:"characteristics"`
+}
+
+type characteristicBody struct {
+	IID         int         `json:"iid"`
+	Type        string      `json:"type"`
+	Format      string      `json:"format"`
+	Perms       []string    `json:"perms"`
+	ValidValues []int       `json:"valid-values,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+}
+
+// accessories returns the accessory database, with the values of
+// readable characteristics if values is true.
+func (s *server) accessories(values bool) accessoriesBody {
+	a := accessoryBody{AID: accessoryID}
+
+	for _, svc := range s.services {
+		sb := serviceBody{IID: svc.iid, Type: svc.Type, Primary: svc.Primary}
+
+		for _, c := range svc.Characteristics {
+			cb := characteristicBody{
+				IID:         c.iid,
+				Type:        c.Type,
+				Format:      c.Format,
+				Perms:       c.Perms,
+				ValidValues: c.ValidValues,
+			}
+
+			if values && c.can(PermRead) && c.Get != nil {
+				value, err := c.Get()
+				if err == nil {
+					cb.Value = value
+				}
+			}
+
+			sb.Characteristics = append(sb.Characteristics, cb)
+		}
+
+		a.Services = append(a.Services, sb)
+	}
+
+	return accessoriesBody{Accessories: []accessoryBody{a}}
+}
+
+type characteristicsBody struct {
+	Characteristics []characteristicValue `json:"characteristics"`
+}
+
+type characteristicValue struct {
+	AID    int         `json:"aid"`
+	IID    int         `json:"iid"`
+	Value  interface{} `json:"value,omitempty"`
+	Events *bool       `json:"ev,omitempty"`
+	Status *Status     `json:"status,omitempty"`
+}
+
+// parseIDs parses ids of the form 1.10,1.11.
+func parseIDs(ids string) ([]characteristicValue, error) {
+	var parsed []characteristicValue
+
+	for _, id := range strings.Split(ids, ",") {
+		parts := strings.Split(id, ".")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid characteristic id: '%s'", id)
+		}
+
+		aid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid characteristic id: '%s'", id)
+		}
+
+		iid, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid characteristic id: '%s'", id)
+		}
+
+		parsed = append(parsed, characteristicValue{AID: aid, IID: iid})
+	}
+
+	return parsed, nil
+}
+
+func (s *server) characteristic(aid int, iid int) (*Characteristic, bool) {
+	if aid != accessoryID {
+		return nil, false
+	}
+	c, ok := s.characteristics[iid]
+	return c, ok
+}
+
+// multiStatus returns 200 or 204 if every status is success, and otherwise 207
+// with the status of every characteristic.
+func multiStatus(values []characteristicValue, statuses []Status, successCode int) response {
+	failed := false
+	for _, st := range statuses {
+		failed = failed || st != StatusSuccess
+	}
+
+	if !failed && successCode == http.StatusNoContent {
+		return response{status: http.StatusNoContent}
+	}
+
+	if failed {
+		for i := range values {
+			st := statuses[i]
+			values[i].Status = &st
+		}
+	}
+
+	b, _ := json.Marshal(characteristicsBody{Characteristics: values})
+	code := successCode
+	if failed {
+		code = http.StatusMultiStatus
+	}
+	return response{status: code, contentType: contentTypeJSON, body: b}
+}
+
+func (sess *session) handleGetCharacteristics(ids string) response {
+	values, err := parseIDs(ids)
+	if err != nil {
+		return jsonStatus(http.StatusBadRequest, StatusInvalidValue)
+	}
+
+	statuses := make([]Status, len(values))
+	for i, v := range values {
+		c, ok := sess.server.characteristic(v.AID, v.IID)
+		switch {
+		case !ok:
+			statuses[i] = StatusNotFound
+		case !c.can(PermRead) || c.Get == nil:
+			statuses[i] = StatusWriteOnly
+		default:
+			values[i].Value, err = c.Get()
+			statuses[i] = statusOf(err)
+		}
+	}
+
+	return multiStatus(values, statuses, http.StatusOK)
+}
+
+func (sess *session) handlePutCharacteristics(body []byte) response {
+	var req characteristicsBody
+	err := json.Unmarshal(body, &req)
+	if err != nil || len(req.Characteristics) == 0 {
+		return jsonStatus(http.StatusBadRequest, StatusInvalidValue)
+	}
+
+	// Writes are attributed to the paired controller which made them.
+	source := events.Source{User: "homekit:" + sess.controllerID(), ClientIP: sess.clientIP()}
+
+	var values []characteristicValue
+	statuses := make([]Status, len(req.Characteristics))
+	for i, v := range req.Characteristics {
+		values = append(values, characteristicValue{AID: v.AID, IID: v.IID})
+		statuses[i] = sess.put(v, source)
+	}
+
+	return multiStatus(values, statuses, http.StatusNoContent)
+}
+
+func (sess *session) put(v characteristicValue, source events.Source) Status {
+	c, ok := sess.server.characteristic(v.AID, v.IID)
+	if !ok {
+		return StatusNotFound
+	}
+
+	if v.Events != nil {
+		if !c.can(PermEvents) {
+			return StatusNotificationsDisabled
+		}
+
+		sess.mutex.Lock()
+		sess.events[c.iid] = *v.Events
+		sess.mutex.Unlock()
+	}
+
+	if v.Value == nil {
+		return StatusSuccess
+	}
+
+	if !c.can(PermWrite) || c.Set == nil {
+		return StatusReadOnly
+	}
+
+	value, err := c.normalize(v.Value)
+	if err != nil {
+		return statusOf(err)
+	}
+
+	sess.logger.Info("writing characteristic", lager.Data{"iid": c.iid, "type": c.Type, "value": value})
+	return statusOf(c.Set(value, source))
+}
+
+func (sess *session) clientIP() string {
+	ip, _, err := net.SplitHostPort(sess.conn.RemoteAddr().String())
+	if err != nil {
+		return sess.conn.RemoteAddr().String()
+	}
+	return ip
+}
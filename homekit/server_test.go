@@ -0,0 +1,534 @@
+//go:build homekit
+// +build homekit
+
+package homekit_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/homekit"
+	"github.com/robdimsdale/garagepi/homekit/hap"
+	"github.com/robdimsdale/garagepi/homekit/haptest"
+	"github.com/tedsuo/ifrit"
+)
+
+const setupCode = "031-45-154"
+
+type characteristics struct {
+	Characteristics []struct {
+		AID    int         `json:"aid"`
+		IID    int         `json:"iid"`
+		Value  interface{} `json:"value"`
+		Status *int        `json:"status"`
+	} `json:"characteristics"`
+}
+
+var _ = Describe("Server", func() {
+	var (
+		tempDir  string
+		config   homekit.Config
+		services []*homekit.Service
+		addr     string
+
+		valueMutex sync.Mutex
+		on         bool
+		setErr     error
+		sources    []events.Source
+		identified int
+
+		onCharacteristic *homekit.Characteristic
+
+		server  homekit.Server
+		process ifrit.Process
+
+		controller *haptest.Controller
+	)
+
+	startServer := func() {
+		var err error
+		server, err = homekit.NewServer(lagertest.NewTestLogger("homekit test"), config, services)
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(server)
+	}
+
+	stopServer := func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+	}
+
+	pair := func() *haptest.Conn {
+		conn, err := haptest.Dial(addr)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		Expect(conn.PairSetup(controller, setupCode)).To(Succeed())
+
+		verified, err := haptest.Connect(addr, controller)
+		Expect(err).NotTo(HaveOccurred())
+		return verified
+	}
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = ioutil.TempDir("", "homekit")
+		Expect(err).NotTo(HaveOccurred())
+
+		port := freeTCPPort()
+		addr = fmt.Sprintf("127.0.0.1:%d", port)
+
+		config = homekit.Config{
+			Name:        "Garage",
+			Category:    homekit.CategoryGarageDoorOpener,
+			SetupCode:   setupCode,
+			Port:        port,
+			StateFile:   filepath.Join(tempDir, "homekit.json"),
+			MDNSAddress: fmt.Sprintf("127.0.0.1:%d", freeUDPPort()),
+		}
+
+		on = false
+		setErr = nil
+		sources = nil
+		identified = 0
+
+		onCharacteristic = &homekit.Characteristic{
+			Type:   homekit.CharacteristicOn,
+			Format: homekit.FormatBool,
+			Perms:  []string{homekit.PermRead, homekit.PermWrite, homekit.PermEvents},
+			Get: func() (interface{}, error) {
+				valueMutex.Lock()
+				defer valueMutex.Unlock()
+				return on, nil
+			},
+			Set: func(value interface{}, source events.Source) error {
+				valueMutex.Lock()
+				defer valueMutex.Unlock()
+				if setErr != nil {
+					return setErr
+				}
+				on = value.(bool)
+				sources = append(sources, source)
+				return nil
+			},
+		}
+
+		services = []*homekit.Service{
+			homekit.InformationService("Garage", "garagepi", "garagepi", "some-serial", "1.0", func() {
+				valueMutex.Lock()
+				defer valueMutex.Unlock()
+				identified++
+			}),
+			{
+				Type:    homekit.ServiceLightbulb,
+				Primary: true,
+				Characteristics: []*homekit.Characteristic{
+					onCharacteristic,
+					{
+						Type:   homekit.CharacteristicName,
+						Format: homekit.FormatString,
+						Perms:  []string{homekit.PermRead},
+						Get: func() (interface{}, error) {
+							return nil, errors.New("unreadable")
+						},
+					},
+				},
+			},
+		}
+
+		controller, err = haptest.NewController("controller-1")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		startServer()
+	})
+
+	AfterEach(func() {
+		stopServer()
+		os.RemoveAll(tempDir)
+	})
+
+	Describe("NewServer", func() {
+		It("returns an error for an invalid setup code", func() {
+			config.SetupCode = "111-11-111"
+			_, err := homekit.NewServer(lagertest.NewTestLogger("homekit test"), config, services)
+			Expect(err).To(MatchError(ContainSubstring("too easily guessed")))
+		})
+
+		It("persists the identity of the accessory", func() {
+			b, err := ioutil.ReadFile(config.StateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(ContainSubstring(`"pairingID"`))
+		})
+	})
+
+	Describe("pair setup", func() {
+		It("pairs with the setup code", func() {
+			conn, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			Expect(conn.PairSetup(controller, setupCode)).To(Succeed())
+			Expect(controller.AccessoryID).To(MatchRegexp(`^([0-9A-F]{2}:){5}[0-9A-F]{2}$`))
+		})
+
+		It("fails with an incorrect setup code", func() {
+			conn, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			err = conn.PairSetup(controller, "031-45-155")
+			Expect(err).To(Equal(haptest.PairingError(hap.ErrorAuthentication)))
+		})
+
+		It("refuses to pair again once paired", func() {
+			pair().Close()
+
+			other, err := haptest.NewController("controller-2")
+			Expect(err).NotTo(HaveOccurred())
+
+			conn, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			err = conn.PairSetup(other, setupCode)
+			Expect(err).To(Equal(haptest.PairingError(hap.ErrorUnavailable)))
+		})
+
+		It("identifies the accessory only while unpaired", func() {
+			conn, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			resp, err := conn.Do("POST", "/identify", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(204))
+			Expect(identified).To(Equal(1))
+
+			pair().Close()
+
+			resp, err = conn.Do("POST", "/identify", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(400))
+		})
+	})
+
+	Describe("pair verify", func() {
+		It("requires a verified session for accessory requests", func() {
+			conn, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			resp, err := conn.Do("GET", "/accessories", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(470))
+		})
+
+		It("fails for a controller which has not paired", func() {
+			pair().Close()
+
+			other, err := haptest.NewController("controller-2")
+			Expect(err).NotTo(HaveOccurred())
+			other.AccessoryID = controller.AccessoryID
+			other.AccessoryKey = controller.AccessoryKey
+
+			_, err = haptest.Connect(addr, other)
+			Expect(err).To(Equal(haptest.PairingError(hap.ErrorAuthentication)))
+		})
+
+		It("verifies pairings after a restart", func() {
+			pair().Close()
+			stopServer()
+			startServer()
+
+			var conn *haptest.Conn
+			Eventually(func() error {
+				var err error
+				conn, err = haptest.Connect(addr, controller)
+				return err
+			}).Should(Succeed())
+			defer conn.Close()
+
+			_, err := conn.Get("/accessories")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when verified", func() {
+		var conn *haptest.Conn
+
+		JustBeforeEach(func() {
+			conn = pair()
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("lists the accessory with the values of its characteristics", func() {
+			body, err := conn.Get("/accessories")
+			Expect(err).NotTo(HaveOccurred())
+
+			var accessories struct {
+				Accessories []struct {
+					AID      int `json:"aid"`
+					Services []struct {
+						IID             int    `json:"iid"`
+						Type            string `json:"type"`
+						Characteristics []struct {
+							IID    int         `json:"iid"`
+							Type   string      `json:"type"`
+							Format string      `json:"format"`
+							Perms  []string    `json:"perms"`
+							Value  interface{} `json:"value"`
+						} `json:"characteristics"`
+					} `json:"services"`
+				} `json:"accessories"`
+			}
+			Expect(json.Unmarshal(body, &accessories)).To(Succeed())
+
+			Expect(accessories.Accessories).To(HaveLen(1))
+			a := accessories.Accessories[0]
+			Expect(a.AID).To(Equal(1))
+			Expect(a.Services).To(HaveLen(2))
+
+			Expect(a.Services[0].IID).To(Equal(1))
+			Expect(a.Services[0].Type).To(Equal("3E"))
+			Expect(a.Services[0].Characteristics[3].Type).To(Equal("23"))
+			Expect(a.Services[0].Characteristics[3].Value).To(Equal("Garage"))
+
+			Expect(a.Services[1].IID).To(Equal(8))
+			Expect(a.Services[1].Type).To(Equal("43"))
+			Expect(a.Services[1].Characteristics[0].IID).To(Equal(9))
+			Expect(a.Services[1].Characteristics[0].Perms).To(Equal([]string{"pr", "pw", "ev"}))
+			Expect(a.Services[1].Characteristics[0].Value).To(Equal(false))
+		})
+
+		It("reads characteristics", func() {
+			body, err := conn.Get("/characteristics?id=1.9")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(MatchJSON(`{"characteristics":[{"aid":1,"iid":9,"value":false}]}`))
+		})
+
+		It("returns the status of characteristics which cannot be read", func() {
+			resp, err := conn.Do("GET", "/characteristics?id=1.9,1.10,1.99", "", nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(207))
+
+			var c characteristics
+			Expect(json.Unmarshal(resp.Body, &c)).To(Succeed())
+			Expect(*c.Characteristics[0].Status).To(Equal(0))
+			Expect(*c.Characteristics[1].Status).To(Equal(-70402))
+			Expect(*c.Characteristics[2].Status).To(Equal(-70409))
+		})
+
+		It("writes characteristics, accepting numbers for bools", func() {
+			resp, err := conn.Put("/characteristics", map[string]interface{}{
+				"characteristics": []map[string]interface{}{{"aid": 1, "iid": 9, "value": 1}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(204))
+
+			valueMutex.Lock()
+			defer valueMutex.Unlock()
+			Expect(on).To(BeTrue())
+			Expect(sources).To(Equal([]events.Source{{User: "homekit:controller-1", ClientIP: "127.0.0.1"}}))
+		})
+
+		It("returns the status of characteristics which cannot be written", func() {
+			valueMutex.Lock()
+			setErr = homekit.StatusBusy
+			valueMutex.Unlock()
+
+			resp, err := conn.Put("/characteristics", map[string]interface{}{
+				"characteristics": []map[string]interface{}{
+					{"aid": 1, "iid": 9, "value": true},
+					{"aid": 1, "iid": 10, "value": "name"},
+					{"aid": 1, "iid": 9, "value": "invalid"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(207))
+
+			var c characteristics
+			Expect(json.Unmarshal(resp.Body, &c)).To(Succeed())
+			Expect(*c.Characteristics[0].Status).To(Equal(-70403))
+			Expect(*c.Characteristics[1].Status).To(Equal(-70404))
+			Expect(*c.Characteristics[2].Status).To(Equal(-70410))
+		})
+
+		It("sends events for characteristics with events enabled", func() {
+			resp, err := conn.Put("/characteristics", map[string]interface{}{
+				"characteristics": []map[string]interface{}{{"aid": 1, "iid": 9, "ev": true}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(204))
+
+			valueMutex.Lock()
+			on = true
+			valueMutex.Unlock()
+			server.Notify(onCharacteristic)
+
+			var event []byte
+			Eventually(conn.Events()).Should(Receive(&event))
+			Expect(string(event)).To(MatchJSON(`{"characteristics":[{"aid":1,"iid":9,"value":true}]}`))
+		})
+
+		It("does not send events unless enabled", func() {
+			server.Notify(onCharacteristic)
+			Consistently(conn.Events(), 100*time.Millisecond).ShouldNot(Receive())
+		})
+
+		Describe("pairings", func() {
+			pairings := func(t hap.TLV) hap.TLV {
+				resp, err := conn.Do("POST", "/pairings", "application/pairing+tlv8", t.Encode())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+
+				decoded, err := hap.DecodeTLV(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				_, failed := decoded.Get(hap.TypeError)
+				Expect(failed).To(BeFalse())
+				return decoded
+			}
+
+			It("adds, lists and removes pairings", func() {
+				other, err := haptest.NewController("controller-2")
+				Expect(err).NotTo(HaveOccurred())
+
+				pairings(hap.TLV{
+					{Type: hap.TypeState, Value: []byte{1}},
+					{Type: hap.TypeMethod, Value: []byte{hap.MethodAddPairing}},
+					{Type: hap.TypeIdentifier, Value: []byte(other.ID)},
+					{Type: hap.TypePublicKey, Value: other.PublicKey},
+					{Type: hap.TypePermissions, Value: []byte{hap.PermissionUser}},
+				})
+
+				list := pairings(hap.TLV{
+					{Type: hap.TypeState, Value: []byte{1}},
+					{Type: hap.TypeMethod, Value: []byte{hap.MethodListPairings}},
+				})
+				var ids []string
+				for _, item := range list {
+					if item.Type == hap.TypeIdentifier {
+						ids = append(ids, string(item.Value))
+					}
+				}
+				Expect(ids).To(Equal([]string{"controller-1", "controller-2"}))
+
+				other.AccessoryID = controller.AccessoryID
+				other.AccessoryKey = controller.AccessoryKey
+				otherConn, err := haptest.Connect(addr, other)
+				Expect(err).NotTo(HaveOccurred())
+				defer otherConn.Close()
+
+				// Only admins may manage pairings.
+				resp, err := otherConn.Do("POST", "/pairings", "application/pairing+tlv8", hap.TLV{
+					{Type: hap.TypeState, Value: []byte{1}},
+					{Type: hap.TypeMethod, Value: []byte{hap.MethodListPairings}},
+				}.Encode())
+				Expect(err).NotTo(HaveOccurred())
+				decoded, err := hap.DecodeTLV(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				code, ok := decoded.Byte(hap.TypeError)
+				Expect(ok).To(BeTrue())
+				Expect(code).To(Equal(hap.ErrorAuthentication))
+
+				pairings(hap.TLV{
+					{Type: hap.TypeState, Value: []byte{1}},
+					{Type: hap.TypeMethod, Value: []byte{hap.MethodRemovePairing}},
+					{Type: hap.TypeIdentifier, Value: []byte(other.ID)},
+				})
+
+				// The session of the removed controller is closed.
+				Eventually(otherConn.Events()).Should(BeClosed())
+				_, err = haptest.Connect(addr, other)
+				Expect(err).To(Equal(haptest.PairingError(hap.ErrorAuthentication)))
+			})
+
+			It("unpairs once the last admin is removed", func() {
+				pairings(hap.TLV{
+					{Type: hap.TypeState, Value: []byte{1}},
+					{Type: hap.TypeMethod, Value: []byte{hap.MethodRemovePairing}},
+					{Type: hap.TypeIdentifier, Value: []byte(controller.ID)},
+				})
+
+				Eventually(conn.Events()).Should(BeClosed())
+
+				other, err := haptest.NewController("controller-2")
+				Expect(err).NotTo(HaveOccurred())
+
+				setup, err := haptest.Dial(addr)
+				Expect(err).NotTo(HaveOccurred())
+				defer setup.Close()
+				Expect(setup.PairSetup(other, setupCode)).To(Succeed())
+			})
+		})
+	})
+
+	Describe("mDNS", func() {
+		query := func(name string) string {
+			conn, err := net.Dial("udp4", config.MDNSAddress)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			msg := []byte{0x12, 0x34, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0}
+			for _, label := range []string{"_hap", "_tcp", "local"} {
+				msg = append(msg, byte(len(label)))
+				msg = append(msg, label...)
+			}
+			msg = append(msg, 0)
+			msg = append(msg, 0, 12, 0, 1) // PTR, IN
+
+			var resp []byte
+			Eventually(func() error {
+				_, err := conn.Write(msg)
+				if err != nil {
+					return err
+				}
+				conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				buf := make([]byte, 1500)
+				n, err := conn.Read(buf)
+				resp = buf[:n]
+				return err
+			}).Should(Succeed())
+
+			Expect(binary.BigEndian.Uint16(resp)).To(Equal(uint16(0x1234)))
+			return string(resp)
+		}
+
+		It("answers queries for the HAP service", func() {
+			resp := query("_hap._tcp.local")
+			Expect(resp).To(ContainSubstring("\x06Garage\x04_hap\x04_tcp\x05local"))
+			Expect(resp).To(ContainSubstring("sf=1"))
+			Expect(resp).To(ContainSubstring("ci=4"))
+			Expect(resp).To(ContainSubstring("c#=1"))
+
+			pair().Close()
+			Eventually(func() string {
+				return query("_hap._tcp.local")
+			}).Should(ContainSubstring("sf=0"))
+		})
+	})
+
+	Describe("ValidateSetupCode", func() {
+		It("requires the form 123-45-678", func() {
+			Expect(homekit.ValidateSetupCode("031-45-154")).To(Succeed())
+			Expect(homekit.ValidateSetupCode("03145154")).NotTo(Succeed())
+			Expect(homekit.ValidateSetupCode("123-45-678")).NotTo(Succeed())
+			Expect(homekit.ValidateSetupCode("000-00-000")).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,226 @@
+//go:build homekit
+// +build homekit
+
+package homekit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Pairing is a controller which has paired with the accessory.
+type Pairing struct {
+	ID        string            `json:"id"`
+	PublicKey ed25519.PublicKey `json:"publicKey"`
+	Admin     bool              `json:"admin"`
+}
+
+// state is persisted so that the accessory keeps its identity and
+// pairings across restarts.
+type state struct {
+	PairingID  string             `json:"pairingID"`
+	PrivateKey ed25519.PrivateKey `json:"privateKey"`
+	Pairings   []Pairing          `json:"pairings"`
+
+	// ConfigNumber is incremented each time the accessory database changes,
+	// which is detected by comparing its hash.
+	ConfigNumber int    `json:"configNumber"`
+	ConfigHash   string `json:"configHash"`
+}
+
+type store struct {
+	path string
+
+	mutex sync.Mutex
+	state state
+}
+
+// loadStore reads the state from path, generating a new identity if the
+// file does not exist.
+func loadStore(path string) (*store, error) {
+	s := &store{path: path}
+
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(b, &s.state)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HomeKit state in %s: %s", path, err)
+		}
+		if len(s.state.PrivateKey) != ed25519.PrivateKeySize || s.state.PairingID == "" {
+			return nil, fmt.Errorf("invalid HomeKit state in %s: missing identity", path)
+		}
+		return s, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 6)
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.state = state{
+		PairingID: fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X",
+			id[0], id[1], id[2], id[3], id[4], id[5]),
+		PrivateKey:   privateKey,
+		ConfigNumber: 1,
+	}
+
+	return s, s.save()
+}
+
+func (s *store) pairingID() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.PairingID
+}
+
+func (s *store) privateKey() ed25519.PrivateKey {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.PrivateKey
+}
+
+func (s *store) configNumber() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state.ConfigNumber
+}
+
+// updateConfig increments the config number if hash differs from the
+// hash of the accessory database when the config number was last updated.
+func (s *store) updateConfig(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.state.ConfigHash == hash {
+		return nil
+	}
+
+	if s.state.ConfigHash != "" {
+		s.state.ConfigNumber++
+	}
+	s.state.ConfigHash = hash
+	return s.save()
+}
+
+func (s *store) paired() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.state.Pairings) > 0
+}
+
+func (s *store) pairings() []Pairing {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Pairing{}, s.state.Pairings...)
+}
+
+func (s *store) pairing(id string) (Pairing, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range s.state.Pairings {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Pairing{}, false
+}
+
+// addPairing replaces the permissions of an existing pairing with the same
+// ID and public key. It returns false if the public key differs.
+func (s *store) addPairing(p Pairing) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, existing := range s.state.Pairings {
+		if existing.ID != p.ID {
+			continue
+		}
+		if !existing.PublicKey.Equal(p.PublicKey) {
+			return false, nil
+		}
+		s.state.Pairings[i].Admin = p.Admin
+		return true, s.save()
+	}
+
+	s.state.Pairings = append(s.state.Pairings, p)
+	return true, s.save()
+}
+
+// removePairing removes every pairing if no admin pairing would remain.
+// It returns the IDs of the removed pairings.
+func (s *store) removePairing(id string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var removed []string
+	var remaining []Pairing
+	admin := false
+
+	for _, p := range s.state.Pairings {
+		if p.ID == id {
+			removed = append(removed, p.ID)
+			continue
+		}
+		remaining = append(remaining, p)
+		admin = admin || p.Admin
+	}
+
+	if !admin {
+		for _, p := range remaining {
+			removed = append(removed, p.ID)
+		}
+		remaining = nil
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	s.state.Pairings = remaining
+	return removed, s.save()
+}
+
+// save must be called with the mutex held.
+func (s *store) save() error {
+	b, _ := json.MarshalIndent(s.state, "", "  ")
+
+	// Write to a temporary file and rename it so the file is never
+	// left partially written.
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(b)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
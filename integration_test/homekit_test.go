@@ -0,0 +1,110 @@
+//go:build homekit
+// +build homekit
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/robdimsdale/garagepi/homekit/haptest"
+)
+
+func init() {
+	buildArgs = append(buildArgs, "-tags", "homekit")
+}
+
+var _ = Describe("GaragepiExecutable", func() {
+	var (
+		args    []string
+		session *gexec.Session
+	)
+
+	BeforeEach(func() {
+		args = []string{}
+	})
+
+	AfterEach(func() {
+		session.Terminate()
+	})
+
+	Describe("homekit", func() {
+		var tempDirPath string
+
+		BeforeEach(func() {
+			var err error
+			tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+			Expect(err).NotTo(HaveOccurred())
+
+			args = append(args, "-dev")
+			args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			args = append(args, fmt.Sprintf("-homekitPort=%d", homekitPort))
+			args = append(args, fmt.Sprintf("-homekitFile=%s", filepath.Join(tempDirPath, "homekit.json")))
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(tempDirPath)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("exits with an invalid setup code", func() {
+			args = append(args, "-homekitSetupCode=123-45-678")
+			session = startMainWithArgs(args...)
+			Eventually(session).Should(gexec.Exit(2))
+		})
+
+		It("pairs, switches the light and remembers the pairing after a restart", func() {
+			args = append(args, "-homekitSetupCode=031-45-154")
+			session = startMainWithArgs(args...)
+			Eventually(session).Should(gbytes.Say("garagepi started"))
+
+			addr := fmt.Sprintf("127.0.0.1:%d", homekitPort)
+			controller, err := haptest.NewController("integration-test")
+			Expect(err).NotTo(HaveOccurred())
+
+			setup, err := haptest.Dial(addr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(setup.PairSetup(controller, "031-45-154")).To(Succeed())
+			setup.Close()
+
+			conn, err := haptest.Connect(addr, controller)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The light is the second service; its On characteristic has iid 9.
+			resp, err := conn.Put("/characteristics", map[string]interface{}{
+				"characteristics": []map[string]interface{}{{"aid": 1, "iid": 9, "value": true}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(204))
+			conn.Close()
+
+			lightResp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort))
+			Expect(err).NotTo(HaveOccurred())
+			body, err := ioutil.ReadAll(lightResp.Body)
+			lightResp.Body.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring(`"LightOn":true`))
+
+			session.Interrupt()
+			Eventually(session).Should(gexec.Exit())
+
+			session = startMainWithArgs(args...)
+			Eventually(session).Should(gbytes.Say("garagepi started"))
+
+			conn, err = haptest.Connect(addr, controller)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			body, err = conn.Get("/characteristics?id=1.9")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(MatchJSON(`{"characteristics":[{"aid":1,"iid":9,"value":false}]}`))
+		})
+	})
+})
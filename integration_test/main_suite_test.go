@@ -18,7 +18,11 @@ func TestGaragepi(t *testing.T) {
 var (
 	httpPort        uint
 	httpsPort       uint
+	homekitPort     uint
 	garagepiBinPath string
+
+	// buildArgs are the arguments with which garagepi is built.
+	buildArgs = []string{"-race"}
 )
 
 var _ = BeforeSuite(func() {
@@ -27,11 +31,12 @@ var _ = BeforeSuite(func() {
 	SetDefaultEventuallyTimeout(10 * time.Second)
 
 	var err error
-	garagepiBinPath, err = gexec.Build("github.com/robdimsdale/garagepi", "-race")
+	garagepiBinPath, err = gexec.Build("github.com/robdimsdale/garagepi", buildArgs...)
 	Expect(err).ShouldNot(HaveOccurred())
 
 	httpPort = uint(59990 + 2*GinkgoParallelNode())
 	httpsPort = uint(59991 + 2*GinkgoParallelNode())
+	homekitPort = uint(59970 + GinkgoParallelNode())
 })
 
 var _ = AfterSuite(func() {
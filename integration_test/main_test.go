@@ -4,9 +4,13 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
@@ -18,6 +22,9 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
+	"github.com/robdimsdale/garagepi/api/webhooks"
+	"github.com/robdimsdale/garagepi/mqtt/mqtttest"
+	"github.com/robdimsdale/garagepi/websocket"
 )
 
 func startMainWithArgs(args ...string) *gexec.Session {
@@ -105,40 +112,878 @@ var _ = Describe("GaragepiExecutable", func() {
 				validateSuccessNonZeroLengthBody(resp)
 			})
 
+			It("Should accept GET requests to /api/v1/door", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/door", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+
+			It("Should accept POST requests to /api/v1/door/open", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/door/open", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			})
+
+			It("Should accept POST requests to /api/v1/door/close", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/door/close", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			})
+
 			It("Should accept GET requests to /api/v1/light", func() {
 				session = startMainWithArgs(args...)
 				Eventually(session).Should(gbytes.Say("garagepi started"))
 
-				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort))
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+
+			It("Should accept POST requests to /api/v1/light", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+
+			It("Should accept GET requests to /webcam", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/webcam", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+			})
+
+			It("Should serve static files", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/static/css/application.css", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			})
+		})
+
+		Describe("light auto-off", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			It("exits with error when -lightMaxOnTime is negative", func() {
+				args = append(args, "-lightMaxOnTime=-1m")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("reports the remaining time when the light is turned on for a duration", func() {
+				args = append(args, "-lightMaxOnTime=1h")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/light?state=on&duration=10m", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"RemainingSeconds":600`))
+			})
+		})
+
+		Describe("state stream", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			It("streams changes in the light state", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/stream", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+				stream := gbytes.NewBuffer()
+				go io.Copy(stream, resp.Body)
+
+				Eventually(stream).Should(gbytes.Say(`event: light\ndata: {"StateKnown":true,"LightOn":false`))
+				Eventually(stream).Should(gbytes.Say(`event: door\n`))
+
+				resp, err = http.Post(fmt.Sprintf("http://localhost:%d/api/v1/light?state=on", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				Eventually(stream).Should(gbytes.Say(`event: light\ndata: {"StateKnown":true,"LightOn":true`))
+			})
+		})
+
+		Describe("websocket", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			It("acknowledges commands and sends the resulting state", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				conn, err := websocket.Dial(fmt.Sprintf("ws://localhost:%d/api/v1/ws", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+				defer conn.Close()
+
+				err = conn.WriteMessage([]byte(`{"id": "some-id", "command": "light-on"}`))
+				Expect(err).NotTo(HaveOccurred())
+
+				var messages []string
+				for len(messages) < 4 {
+					message, err := conn.ReadMessage()
+					Expect(err).NotTo(HaveOccurred())
+					messages = append(messages, string(message))
+				}
+
+				Expect(messages).To(ContainElement(HavePrefix(`{"type":"ack","id":"some-id","ok":true`)))
+				Expect(messages).To(ContainElement(HavePrefix(`{"type":"light","data":{"StateKnown":true,"LightOn":true`)))
+			})
+		})
+
+		Describe("mqtt", func() {
+			var broker *mqtttest.Broker
+
+			BeforeEach(func() {
+				var err error
+				broker, err = mqtttest.NewBroker()
+				Expect(err).NotTo(HaveOccurred())
+
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			AfterEach(func() {
+				broker.Close()
+			})
+
+			retained := func(topic string) func() string {
+				return func() string {
+					m, _ := broker.Retained(topic)
+					return m.Payload
+				}
+			}
+
+			It("exits with an invalid broker", func() {
+				args = append(args, "-mqttBroker=http://localhost")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("publishes discovery and state, and handles commands", func() {
+				args = append(args, fmt.Sprintf("-mqttBroker=%s", broker.URL()))
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				Eventually(retained("garagepi/availability")).Should(Equal("online"))
+				Eventually(retained("homeassistant/cover/garagepi/door/config")).Should(ContainSubstring(`"device_class":"garage"`))
+				Eventually(retained("homeassistant/light/garagepi/light/config")).Should(ContainSubstring(`"command_topic":"garagepi/light/set"`))
+				Eventually(retained("garagepi/light/state")).Should(Equal("OFF"))
+
+				Eventually(func() bool {
+					return broker.Subscribed("garagepi/light/set")
+				}).Should(BeTrue())
+				broker.Publish(mqtttest.Message{Topic: "garagepi/light/set", Payload: "ON"})
+
+				Eventually(retained("garagepi/light/state")).Should(Equal("ON"))
+			})
+		})
+
+		Describe("webhooks", func() {
+			var (
+				tempDirPath string
+				receiver    *httptest.Server
+				deliveries  chan *http.Request
+			)
+
+			BeforeEach(func() {
+				var err error
+				tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+				Expect(err).NotTo(HaveOccurred())
+
+				deliveries = make(chan *http.Request, 10)
+				receiver = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					deliveries <- r
+				}))
+
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+				args = append(args, fmt.Sprintf("-webhooksQueueFile=%s", filepath.Join(tempDirPath, "queue.json")))
+			})
+
+			AfterEach(func() {
+				receiver.Close()
+				err := os.RemoveAll(tempDirPath)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			writeWebhooks := func(contents string) string {
+				path := filepath.Join(tempDirPath, "webhooks.json")
+				err := ioutil.WriteFile(path, []byte(contents), os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+				return path
+			}
+
+			It("exits with error when the webhooks are invalid", func() {
+				path := writeWebhooks(`[{"name": "alarm", "url": "ftp://alarm"}]`)
+				args = append(args, fmt.Sprintf("-webhooksFile=%s", path))
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("delivers signed events and reports the status of each webhook", func() {
+				path := writeWebhooks(fmt.Sprintf(`[{"name": "alarm", "url": "%s", "secret": "s3cret", "events": ["light"]}]`, receiver.URL))
+				args = append(args, fmt.Sprintf("-webhooksFile=%s", path))
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/light?state=on", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				var delivery *http.Request
+				Eventually(deliveries).Should(Receive(&delivery))
+				Expect(delivery.Header.Get(webhooks.HeaderEvent)).To(Equal("light"))
+				Expect(delivery.Header.Get(webhooks.HeaderSignature)).To(HavePrefix("sha256="))
+
+				Eventually(func() string {
+					resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/webhooks", httpPort))
+					Expect(err).NotTo(HaveOccurred())
+					defer resp.Body.Close()
+					body, err := ioutil.ReadAll(resp.Body)
+					Expect(err).NotTo(HaveOccurred())
+					return string(body)
+				}).Should(ContainSubstring(`"delivered":1`))
+			})
+		})
+
+		Describe("metrics", func() {
+			BeforeEach(func() {
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			scrape := func(req *http.Request) (*http.Response, string) {
+				resp, err := new(http.Transport).RoundTrip(req)
+				Expect(err).NotTo(HaveOccurred())
+				defer resp.Body.Close()
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				return resp, string(body)
+			}
+
+			It("exits with error when -metricsPassword is not provided", func() {
+				args = append(args, "-dev", "-metricsUsername=prometheus")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exposes request, door, light and build metrics", func() {
+				args = append(args, "-dev")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/toggle", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+
+				req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/metrics", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp, body := scrape(req)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Header.Get("Content-Type")).To(ContainSubstring("version=0.0.4"))
+
+				Expect(body).To(ContainSubstring(`garagepi_build_info{version="dev",goversion="`))
+				Expect(body).To(ContainSubstring(`garagepi_http_requests_total{route="/api/v1/toggle",method="POST",code="200"} 1`))
+				Expect(body).To(ContainSubstring(`garagepi_door_toggles_total{door="door",result="pulsed"} 1`))
+				Expect(body).To(ContainSubstring(`garagepi_door_state{door="door",state="unknown"}`))
+				Expect(body).To(ContainSubstring("garagepi_light_on "))
+				Expect(body).To(ContainSubstring("garagepi_webcam_clients "))
+				Expect(body).To(ContainSubstring("# TYPE garagepi_gpio_errors_total counter"))
+			})
+
+			It("accepts the metrics credentials only for /metrics", func() {
+				args = append(args,
+					"-dev=false",
+					"-username=some-user",
+					"-password=teE73F4vf0",
+					"-metricsUsername=prometheus",
+					"-metricsPassword=scrape-me",
+				)
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/metrics", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+
+				resp, _ := scrape(req)
+				Expect(resp.StatusCode).To(Equal(http.StatusFound))
+
+				req.SetBasicAuth("prometheus", "scrape-me")
+				resp, body := scrape(req)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(body).To(ContainSubstring("garagepi_build_info"))
+
+				req.SetBasicAuth("some-user", "teE73F4vf0")
+				resp, _ = scrape(req)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.SetBasicAuth("prometheus", "scrape-me")
+
+				resp, _ = scrape(req)
+				Expect(resp.StatusCode).To(Equal(http.StatusFound))
+			})
+		})
+
+		Describe("health", func() {
+			var webcamServer *httptest.Server
+
+			BeforeEach(func() {
+				webcamServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("jpeg"))
+				}))
+
+				webcamURL, err := url.Parse(webcamServer.URL)
+				Expect(err).NotTo(HaveOccurred())
+				host, port, err := net.SplitHostPort(webcamURL.Host)
+				Expect(err).NotTo(HaveOccurred())
+
+				args = append(args,
+					fmt.Sprintf("-httpPort=%d", httpPort),
+					"-dev=false",
+					"-username=some-user",
+					"-password=teE73F4vf0",
+					"-webcamHost="+host,
+					"-webcamPort="+port,
+					"-gpioBackend=sim",
+					"-readyCacheDuration=0",
+				)
+			})
+
+			AfterEach(func() {
+				webcamServer.Close()
+			})
+
+			It("reports liveness and readiness without authentication", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/healthz", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				resp.Body.Close()
+
+				resp, err = http.Get(fmt.Sprintf("http://localhost:%d/readyz", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"name":"webcam","healthy":true`))
+				Expect(string(body)).To(ContainSubstring(`"name":"gpio","healthy":true`))
+
+				webcamServer.Close()
+
+				resp, err = http.Get(fmt.Sprintf("http://localhost:%d/readyz", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				resp.Body.Close()
+			})
+		})
+
+		Describe("automation rules", func() {
+			var tempDirPath string
+
+			BeforeEach(func() {
+				var err error
+				tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+				Expect(err).NotTo(HaveOccurred())
+
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(tempDirPath)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			writeRules := func(contents string) string {
+				path := filepath.Join(tempDirPath, "rules.json")
+				err := ioutil.WriteFile(path, []byte(contents), os.ModePerm)
+				Expect(err).NotTo(HaveOccurred())
+				return path
+			}
+
+			It("exits with error when the rules are invalid", func() {
+				path := writeRules(`[{"name": "r", "trigger": {"type": "door", "door": "unknown"}, "actions": [{"type": "light", "state": "on"}]}]`)
+				args = append(args, fmt.Sprintf("-rulesFile=%s", path))
+
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("lists the rules", func() {
+				path := writeRules(`[{"name": "light-at-night", "trigger": {"type": "time", "at": "22:00"}, "actions": [{"type": "light", "state": "on"}]}]`)
+				args = append(args, fmt.Sprintf("-rulesFile=%s", path))
+
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/rules", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"name":"light-at-night"`))
+				Expect(string(body)).To(ContainSubstring(`"enabled":true`))
+			})
+		})
+
+		Describe("schedules", func() {
+			var tempDirPath string
+
+			BeforeEach(func() {
+				var err error
+				tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+				Expect(err).NotTo(HaveOccurred())
+
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(tempDirPath)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("exits with error when the timezone is invalid", func() {
+				args = append(args, "-scheduleTimezone=Nowhere/Special")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("persists created schedules", func() {
+				schedulesFile := filepath.Join(tempDirPath, "schedules.json")
+				args = append(args, fmt.Sprintf("-schedulesFile=%s", schedulesFile))
+				args = append(args, "-scheduleTimezone=UTC")
+
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(
+					fmt.Sprintf("http://localhost:%d/api/v1/schedules", httpPort),
+					"application/json",
+					strings.NewReader(`{"name": "light-off", "cron": "30 23 * * *", "actions": [{"type": "light", "state": "off"}]}`),
+				)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(MatchRegexp(`"nextRun":"\d{4}-\d{2}-\d{2}T23:30:00Z"`))
+
+				contents, err := ioutil.ReadFile(schedulesFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`"name": "light-off"`))
 			})
+		})
+
+		Describe("events", func() {
+			var tempDirPath string
+
+			BeforeEach(func() {
+				var err error
+				tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+				Expect(err).NotTo(HaveOccurred())
+
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(tempDirPath)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("exits with error when the retention is negative", func() {
+				args = append(args, "-eventsMaxEvents=-1")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("records and persists door toggles", func() {
+				eventsFile := filepath.Join(tempDirPath, "events.json")
+				args = append(args, fmt.Sprintf("-eventsFile=%s", eventsFile))
 
-			It("Should accept POST requests to /api/v1/light", func() {
 				session = startMainWithArgs(args...)
 				Eventually(session).Should(gbytes.Say("garagepi started"))
 
-				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/light", httpPort), "", strings.NewReader(""))
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/toggle", httpPort), "", strings.NewReader(""))
 				Expect(err).NotTo(HaveOccurred())
 				validateSuccessNonZeroLengthBody(resp)
+
+				resp, err = http.Get(fmt.Sprintf("http://localhost:%d/api/v1/events?type=door-toggle", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"type":"door-toggle"`))
+				Expect(string(body)).To(ContainSubstring(`"result":"pulsed"`))
+
+				contents, err := ioutil.ReadFile(eventsFile)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring(`"type":"door-toggle"`))
 			})
+		})
 
-			It("Should accept GET requests to /webcam", func() {
+		Describe("audit", func() {
+			var (
+				tempDirPath string
+				auditFile   string
+			)
+
+			verifyAudit := func(args ...string) *gexec.Session {
+				command := exec.Command(garagepiBinPath, append([]string{"verify-audit"}, args...)...)
+				verifySession, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				return verifySession
+			}
+
+			BeforeEach(func() {
+				var err error
+				tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+				Expect(err).NotTo(HaveOccurred())
+				auditFile = filepath.Join(tempDirPath, "audit.log")
+
+				args = append(args,
+					fmt.Sprintf("-httpPort=%d", httpPort),
+					"-dev=false",
+					"-username=some-user",
+					"-password=teE73F4vf0",
+					"-adminUsername=some-admin",
+					"-adminPassword=Qx83jHbz1w",
+					"-gpioBackend=sim",
+					fmt.Sprintf("-auditFile=%s", auditFile),
+				)
+			})
+
+			AfterEach(func() {
+				err := os.RemoveAll(tempDirPath)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("records who toggled the door in a trail which can be verified", func() {
 				session = startMainWithArgs(args...)
 				Eventually(session).Should(gbytes.Say("garagepi started"))
 
-				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/webcam", httpPort))
+				req, err := http.NewRequest("POST", fmt.Sprintf("http://localhost:%d/api/v1/toggle", httpPort), nil)
 				Expect(err).NotTo(HaveOccurred())
-				Expect(resp.StatusCode).To(Equal(http.StatusInternalServerError))
+				req.SetBasicAuth("some-user", "teE73F4vf0")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+
+				req, err = http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/api/v1/audit", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.SetBasicAuth("some-admin", "Qx83jHbz1w")
+				resp, err = http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"principal":"some-user","clientIP":"127.0.0.1","action":"door-toggle","target":"door","result":"pulsed"`))
+
+				verifySession := verifyAudit(auditFile)
+				Eventually(verifySession).Should(gexec.Exit(0))
+				Expect(verifySession).To(gbytes.Say("verified 1 audit records"))
+
+				contents, err := ioutil.ReadFile(auditFile)
+				Expect(err).NotTo(HaveOccurred())
+				tampered := strings.Replace(string(contents), "some-user", "other-user", 1)
+				err = ioutil.WriteFile(auditFile, []byte(tampered), 0600)
+				Expect(err).NotTo(HaveOccurred())
+
+				verifySession = verifyAudit(auditFile)
+				Eventually(verifySession).Should(gexec.Exit(1))
+				Expect(verifySession.Err).To(gbytes.Say("does not match its hash"))
 			})
 
-			It("Should serve static files", func() {
+			It("only lists the audit trail for the admin", func() {
 				session = startMainWithArgs(args...)
 				Eventually(session).Should(gbytes.Say("garagepi started"))
 
-				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/static/css/application.css", httpPort))
+				req, err := http.NewRequest("GET", fmt.Sprintf("http://localhost:%d/api/v1/audit", httpPort), nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.SetBasicAuth("some-user", "teE73F4vf0")
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			})
+
+			It("exits with error when only one of -adminUsername and -adminPassword is provided", func() {
+				args = append(args, "-adminPassword=")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exits with error when verify-audit is not given a file", func() {
+				session = verifyAudit()
+				Eventually(session).Should(gexec.Exit(2))
+			})
+		})
+
+		Describe("door auto-close", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+				args = append(args, "-doorAutoCloseAfter=10m")
+			})
+
+			Context("when enableDoorSensor is false", func() {
+				It("exits with error", func() {
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gexec.Exit(2))
+				})
+			})
+
+			Context("when enableDoorSensor is true", func() {
+				BeforeEach(func() {
+					args = append(args, "-enableDoorSensor")
+				})
+
+				It("exits with error when -doorAutoCloseWindow is invalid", func() {
+					args = append(args, "-doorAutoCloseWindow=late")
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gexec.Exit(2))
+				})
+
+				It("accepts GET requests to /api/v1/door/autoclose", func() {
+					args = append(args, "-doorAutoCloseWindow=22:00-06:00")
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gbytes.Say("garagepi started"))
+
+					resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/door/autoclose", httpPort))
+					Expect(err).NotTo(HaveOccurred())
+					validateSuccessNonZeroLengthBody(resp)
+				})
+			})
+		})
+
+		Describe("multiple doors", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+				args = append(args, "-door=name=left,relayPin=17")
+			})
+
+			It("exits with error when door names are duplicated", func() {
+				args = append(args, "-door=name=left,relayPin=22")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exits with error when a pulse duration is not positive", func() {
+				args = append(args, "-door=name=right,relayPin=22,pulseDuration=0s")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exits with error when a door specification is invalid", func() {
+				args = append(args, "-door=name=right")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exits with error when a cooldown is negative", func() {
+				args = append(args, "-door=name=right,relayPin=22,cooldown=-1s")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			Context("when door specifications are valid", func() {
+				BeforeEach(func() {
+					args = append(args, "-door=name=right,relayPin=22")
+				})
+
+				It("accepts GET requests to /api/v1/doors", func() {
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gbytes.Say("garagepi started"))
+
+					resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/doors", httpPort))
+					Expect(err).NotTo(HaveOccurred())
+					validateSuccessNonZeroLengthBody(resp)
+				})
+
+				It("accepts POST requests to /api/v1/doors/{name}/toggle", func() {
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gbytes.Say("garagepi started"))
+
+					resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/doors/right/toggle", httpPort), "", strings.NewReader(""))
+					Expect(err).NotTo(HaveOccurred())
+					validateSuccessNonZeroLengthBody(resp)
+				})
+
+				It("rejects a second toggle within the cooldown with 429", func() {
+					args = append(args, "-doorCooldown=1m")
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gbytes.Say("garagepi started"))
+
+					url := fmt.Sprintf("http://localhost:%d/api/v1/doors/right/toggle", httpPort)
+
+					resp, err := http.Post(url, "", strings.NewReader(""))
+					Expect(err).NotTo(HaveOccurred())
+					validateSuccessNonZeroLengthBody(resp)
+
+					resp, err = http.Post(url, "", strings.NewReader(""))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(429))
+					Expect(resp.Header.Get("Retry-After")).NotTo(BeEmpty())
+				})
+
+				It("rejects requests for unknown doors with 404", func() {
+					session = startMainWithArgs(args...)
+					Eventually(session).Should(gbytes.Say("garagepi started"))
+
+					resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/doors/middle/toggle", httpPort), "", strings.NewReader(""))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+				})
+			})
+		})
+
+		Describe("door interlocks", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			It("exits with error when -doorInterlock is invalid", func() {
+				args = append(args, "-doorInterlock=photoeye:5:block-open")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("exits with error when -doorInterlock is used with -door", func() {
+				args = append(args, "-door=name=left,relayPin=17")
+				args = append(args, "-doorInterlock=photoeye:5:block-close")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("rejects toggling the door while an interlock is active with 409", func() {
+				// simulated pins are low, so an active-low interlock is active
+				args = append(args, "-doorInterlock=photoeye:5:block-all:true")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/toggle", httpPort), "", strings.NewReader(""))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			})
+		})
+
+		Describe("gpio backend", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+			})
+
+			It("exits with error when -gpioBackend is invalid", func() {
+				args = append(args, "-gpioBackend=invalid")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gexec.Exit(2))
+			})
+
+			It("starts with the sysfs backend", func() {
+				args = append(args, "-gpioBackend=sysfs")
+				args = append(args, "-gpioSysfsRoot=/non-existent-gpio-root")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/door", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+
+			It("starts with the cdev backend", func() {
+				args = append(args, "-gpioBackend=cdev")
+				args = append(args, "-gpioChip=/dev/non-existent-gpiochip")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/api/v1/door", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+		})
+
+		Describe("simulated gpio", func() {
+			BeforeEach(func() {
+				args = append(args, "-dev")
+				args = append(args, fmt.Sprintf("-httpPort=%d", httpPort))
+				args = append(args, "-enableDoorSensor")
+			})
+
+			It("accepts GET requests to /dev/gpio", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/dev/gpio", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				validateSuccessNonZeroLengthBody(resp)
+			})
+
+			It("reports the door state from simulated sensor pin levels", func() {
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Post(fmt.Sprintf("http://localhost:%d/api/v1/dev/gpio/27?level=high", httpPort), "", strings.NewReader(""))
 				Expect(err).NotTo(HaveOccurred())
 				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+				resp, err = http.Get(fmt.Sprintf("http://localhost:%d/api/v1/door", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(body)).To(ContainSubstring(`"state":"closed"`))
+			})
+
+			It("does not route /dev/gpio with another backend", func() {
+				args = append(args, "-gpioBackend=sysfs")
+				session = startMainWithArgs(args...)
+				Eventually(session).Should(gbytes.Say("garagepi started"))
+
+				resp, err := http.Get(fmt.Sprintf("http://localhost:%d/dev/gpio", httpPort))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
 			})
 		})
 
@@ -463,6 +1308,53 @@ var _ = Describe("GaragepiExecutable", func() {
 
 						Expect(resp.StatusCode).To(Equal(http.StatusOK))
 					})
+
+					It("rejects unauthenticated websocket connections", func() {
+						session = startMainWithArgs(args...)
+						Eventually(session).Should(gbytes.Say("garagepi started"))
+
+						_, err := websocket.Dial(fmt.Sprintf("ws://localhost:%d/api/v1/ws", httpPort), nil)
+						Expect(err).To(MatchError(ContainSubstring("302")))
+
+						_, err = websocket.Dial(fmt.Sprintf("ws://baduser:badpassword@localhost:%d/api/v1/ws", httpPort), nil)
+						Expect(err).To(MatchError(ContainSubstring("302")))
+					})
+
+					It("accepts websocket connections with basic auth", func() {
+						session = startMainWithArgs(args...)
+						Eventually(session).Should(gbytes.Say("garagepi started"))
+
+						conn, err := websocket.Dial(fmt.Sprintf("ws://some-user:teE73F4vf0@localhost:%d/api/v1/ws", httpPort), nil)
+						Expect(err).NotTo(HaveOccurred())
+						conn.Close()
+					})
+
+					It("accepts websocket connections with a session cookie", func() {
+						session = startMainWithArgs(args...)
+						Eventually(session).Should(gbytes.Say("garagepi started"))
+
+						transport := http.Transport{}
+						req, err := http.NewRequest(
+							"POST",
+							fmt.Sprintf("http://localhost:%d/login", httpPort),
+							strings.NewReader("name=some-user&password=teE73F4vf0"),
+						)
+						Expect(err).NotTo(HaveOccurred())
+						req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+						resp, err := transport.RoundTrip(req)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(resp.Cookies()).NotTo(BeEmpty())
+
+						header := http.Header{}
+						for _, c := range resp.Cookies() {
+							header.Add("Cookie", c.String())
+						}
+
+						conn, err := websocket.Dial(fmt.Sprintf("ws://localhost:%d/api/v1/ws", httpPort), header)
+						Expect(err).NotTo(HaveOccurred())
+						conn.Close()
+					})
 				})
 			})
 		})
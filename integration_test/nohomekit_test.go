@@ -0,0 +1,44 @@
+//go:build !homekit
+// +build !homekit
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("GaragepiExecutable", func() {
+	Describe("homekit", func() {
+		var tempDirPath string
+
+		BeforeEach(func() {
+			var err error
+			tempDirPath, err = ioutil.TempDir(os.TempDir(), "garagepi-integration-test")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			err := os.RemoveAll(tempDirPath)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("exits when built without the homekit build tag", func() {
+			session := startMainWithArgs(
+				"-dev",
+				fmt.Sprintf("-httpPort=%d", httpPort),
+				fmt.Sprintf("-homekitFile=%s", filepath.Join(tempDirPath, "homekit.json")),
+				"-homekitSetupCode=031-45-154",
+			)
+			Eventually(session).Should(gexec.Exit(2))
+			Expect(session).To(gbytes.Say("homekit build tag"))
+		})
+	})
+})
@@ -8,19 +8,37 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/securecookie"
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/audit"
 	"github.com/robdimsdale/garagepi/api/door"
+	"github.com/robdimsdale/garagepi/api/events"
+	"github.com/robdimsdale/garagepi/api/homeassistant"
 	"github.com/robdimsdale/garagepi/api/light"
 	"github.com/robdimsdale/garagepi/api/loglevel"
+	apimetrics "github.com/robdimsdale/garagepi/api/metrics"
+	"github.com/robdimsdale/garagepi/api/rules"
+	"github.com/robdimsdale/garagepi/api/schedules"
+	"github.com/robdimsdale/garagepi/api/stream"
+	"github.com/robdimsdale/garagepi/api/webhooks"
 	"github.com/robdimsdale/garagepi/filesystem"
 	"github.com/robdimsdale/garagepi/gpio"
+	"github.com/robdimsdale/garagepi/gpio/cdev"
+	"github.com/robdimsdale/garagepi/gpio/sim"
+	"github.com/robdimsdale/garagepi/gpio/sysfs"
+	"github.com/robdimsdale/garagepi/health"
 	"github.com/robdimsdale/garagepi/logger"
+	"github.com/robdimsdale/garagepi/metrics"
 	"github.com/robdimsdale/garagepi/middleware"
+	"github.com/robdimsdale/garagepi/mqtt"
 	gpos "github.com/robdimsdale/garagepi/os"
+	"github.com/robdimsdale/garagepi/timewindow"
+	"github.com/robdimsdale/garagepi/web/devgpio"
 	"github.com/robdimsdale/garagepi/web/homepage"
 	"github.com/robdimsdale/garagepi/web/login"
 	"github.com/robdimsdale/garagepi/web/static"
@@ -33,12 +51,73 @@ var (
 	// version is deliberately left uninitialized so it can be set at compile-time
 	version string
 
+	// newHomekitMembers returns the members which serve HomeKit. It is only
+	// set if garagepi is built with the homekit build tag, which requires
+	// Go 1.25 or higher.
+	newHomekitMembers func(
+		logger lager.Logger,
+		lh light.Handler,
+		doors door.Doors,
+		subscriber events.Subscriber,
+	) ([]grouper.Member, error)
+
 	webcamHost = flag.String("webcamHost", "localhost", "Host of webcam image.")
 	webcamPort = flag.Uint("webcamPort", 8080, "Port of webcam image.")
 
+	gpioBackend   = flag.String("gpioBackend", "", "Gpio backend: rpio (Raspberry Pi gpio memory), cdev (Linux gpio character device), sysfs (Linux sysfs gpio interface) or sim (simulated). Defaults to sim in dev mode and rpio otherwise.")
+	gpioChip      = flag.String("gpioChip", "/dev/gpiochip0", "Gpio character device (if gpioBackend is cdev). Pins are line offsets on this chip.")
+	gpioSysfsRoot = flag.String("gpioSysfsRoot", sysfs.DefaultRoot, "Root of the sysfs gpio interface (if gpioBackend is sysfs).")
+	gpioSimFile   = flag.String("gpioSimFile", "", "JSON file in which simulated pin levels are persisted (if gpioBackend is sim). Not persisted if empty.")
+
 	gpioDoorPin  = flag.Uint("gpioDoorPin", 17, "Gpio pin of door.")
 	gpioLightPin = flag.Uint("gpioLightPin", 2, "Gpio pin of light.")
 
+	lightMaxOnTime = flag.Duration("lightMaxOnTime", 0, "Maximum time the light stays on before it is switched off. 0 disables.")
+
+	rulesFile   = flag.String("rulesFile", "", "JSON file of automation rules. No rules are loaded if empty. The messages of notify actions are recorded as notification events, which are delivered to webhooks.")
+	rulesDryRun = flag.Bool("rulesDryRun", false, "Evaluate rules without performing their actions.")
+
+	auditFile = flag.String("auditFile", "", "File to which an audit trail of door and light operations is appended. Not persisted if empty. Verify it with 'garagepi verify-audit <file>'.")
+
+	eventsFile      = flag.String("eventsFile", "", "File in which events are persisted. Not persisted if empty.")
+	eventsMaxAge    = flag.Duration("eventsMaxAge", 30*24*time.Hour, "Events older than this are removed. 0 keeps events regardless of age.")
+	eventsMaxEvents = flag.Int("eventsMaxEvents", 10000, "Maximum number of events kept. 0 is unlimited.")
+
+	schedulesFile    = flag.String("schedulesFile", "", "JSON file in which schedules are persisted. Not persisted if empty.")
+	scheduleTimezone = flag.String("scheduleTimezone", "Local", "Timezone in which schedules are evaluated, e.g. America/New_York.")
+
+	mqttBroker          = flag.String("mqttBroker", "", "URL of the MQTT broker, e.g. tcp://localhost:1883 or tls://broker:8883. MQTT is disabled if empty.")
+	mqttClientID        = flag.String("mqttClientID", "garagepi", "MQTT client ID. Also identifies this garagepi in Home Assistant.")
+	mqttUsername        = flag.String("mqttUsername", "", "Username for the MQTT broker.")
+	mqttPassword        = flag.String("mqttPassword", "", "Password for the MQTT broker.")
+	mqttTopicPrefix     = flag.String("mqttTopicPrefix", "garagepi", "Prefix of the MQTT state and command topics.")
+	mqttDiscoveryPrefix = flag.String("mqttDiscoveryPrefix", "homeassistant", "Home Assistant MQTT discovery prefix. Discovery payloads are not published if empty.")
+
+	webhooksFile        = flag.String("webhooksFile", "", "JSON file of webhook endpoints. No webhooks are delivered if empty.")
+	webhooksQueueFile   = flag.String("webhooksQueueFile", "", "File in which undelivered webhook events and the last delivery ID are persisted. Not persisted if empty, in which case delivery IDs restart at 1.")
+	webhooksQueueSize   = flag.Int("webhooksQueueSize", 1000, "Maximum number of undelivered events for each webhook. The oldest is dropped when full.")
+	webhooksMaxAttempts = flag.Int("webhooksMaxAttempts", 20, "Number of failed attempts after which a webhook delivery is abandoned. 0 is unlimited.")
+
+	homekitSetupCode = flag.String("homekitSetupCode", "", "HomeKit setup code in the form 123-45-678. HomeKit is disabled if empty. Requires garagepi to be built with the homekit build tag.")
+	homekitPort      = flag.Uint("homekitPort", 51826, "Port for HomeKit connections.")
+	homekitFile      = flag.String("homekitFile", "", "File in which the HomeKit identity and pairings are persisted. Required if HomeKit is enabled.")
+	homekitName      = flag.String("homekitName", "Garage", "Name of the HomeKit accessory.")
+
+	doorPulseDuration  = flag.Duration("doorPulseDuration", 500*time.Millisecond, "Duration for which the door relay is energized when toggling the door.")
+	doorRelayActiveLow = flag.Bool("doorRelayActiveLow", false, "Door relay is energized by writing low to gpioDoorPin.")
+	doorCooldown       = flag.Duration("doorCooldown", 1*time.Second, "Minimum time between door toggles. Toggles within this time are rejected.")
+
+	enableDoorSensor    = flag.Bool("enableDoorSensor", false, "Enable reading door position from gpioDoorSensorPin.")
+	gpioDoorSensorPin   = flag.Uint("gpioDoorSensorPin", 27, "Gpio pin of door sensor (if enabled).")
+	doorSensorActiveLow = flag.Bool("doorSensorActiveLow", false, "Door sensor pin reads low when its contact is made.")
+	doorSensorContact   = flag.String("doorSensorContact", string(door.SensorContactClosed), "Door position at which the sensor contact is made: closed or open.")
+
+	doorSensorPollInterval = flag.Duration("doorSensorPollInterval", 500*time.Millisecond, "Interval at which the door sensor is read (if enabled).")
+	doorTravelTime         = flag.Duration("doorTravelTime", 15*time.Second, "Time the door takes to fully open or close.")
+
+	doorAutoCloseAfter  = flag.Duration("doorAutoCloseAfter", 0, "Close the door once it has been open this long; 0 disables auto-close. Requires enableDoorSensor.")
+	doorAutoCloseWindow = flag.String("doorAutoCloseWindow", "", "Only auto-close the door within this daily window, e.g. 22:00-06:00.")
+
 	logLevel = flag.String("logLevel", string(logger.LogLevelInfo), "log level: debug, info, error or fatal")
 
 	enableHTTP  = flag.Bool("enableHTTP", true, "Enable HTTP traffic.")
@@ -55,13 +134,29 @@ var (
 	username = flag.String("username", "", "Username for HTTP authentication.")
 	password = flag.String("password", "", "Password for HTTP authentication.")
 
+	adminUsername = flag.String("adminUsername", "", "Username of the admin, who may also view the audit trail. Requires adminPassword.")
+	adminPassword = flag.String("adminPassword", "", "Password of the admin. Requires adminUsername.")
+
+	readyCacheDuration = flag.Duration("readyCacheDuration", 5*time.Second, "Duration for which the result of the /readyz checks is reused, so that probes do not repeatedly access the webcam and gpio.")
+
+	metricsUsername = flag.String("metricsUsername", "", "Username with which /metrics may also be scraped. Requires metricsPassword.")
+	metricsPassword = flag.String("metricsPassword", "", "Password with which /metrics may also be scraped. Requires metricsUsername.")
+
 	cookieMaxAge = flag.Int("cookieMaxAge", 3600, "Maximum age of cookie in seconds.")
 
 	pidFile = flag.String("pidFile", "", "File to which PID is written")
 
 	dev = flag.Bool("dev", false, "Development mode; do not require username/password")
+
+	doorSpecs          door.ConfigSpecs
+	doorInterlockSpecs door.ConfigSpecs
 )
 
+func init() {
+	flag.Var(&doorSpecs, "door", "Door specification, e.g. name=left,relayPin=17,sensorPin=27. May be repeated for multiple doors; if omitted a single door named 'door' is configured from the gpioDoorPin and doorSensor flags.")
+	flag.Var(&doorInterlockSpecs, "doorInterlock", "Interlock for the door configured without -door, e.g. photoeye:5:block-close. Policy is one of block-close, block-all or warn-only. May be repeated.")
+}
+
 func main() {
 	if version == "" {
 		version = "dev"
@@ -73,6 +168,9 @@ func main() {
 			fmt.Printf("%s\n", version)
 			os.Exit(0)
 		}
+		if arg == "verify-audit" {
+			os.Exit(verifyAudit(os.Args[2:]))
+		}
 	}
 
 	flag.Parse()
@@ -112,6 +210,34 @@ func main() {
 		logger.Fatal("exiting", fmt.Errorf("must specify -username and -password or turn on dev mode"))
 	}
 
+	if (*adminUsername == "") != (*adminPassword == "") {
+		logger.Fatal("exiting", fmt.Errorf("adminUsername and adminPassword must be provided together"))
+	}
+
+	if (*metricsUsername == "") != (*metricsPassword == "") {
+		logger.Fatal("exiting", fmt.Errorf("metricsUsername and metricsPassword must be provided together"))
+	}
+
+	doorConfigs, err := parseDoorConfigs()
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
+	var autoCloseWindow *timewindow.TimeWindow
+	if *doorAutoCloseAfter > 0 {
+		if !anyDoorHasSensor(doorConfigs) {
+			logger.Fatal("exiting", fmt.Errorf("at least one door must have a sensor if doorAutoCloseAfter is provided"))
+		}
+
+		if *doorAutoCloseWindow != "" {
+			w, err := timewindow.Parse(*doorAutoCloseWindow)
+			if err != nil {
+				logger.Fatal("exiting", err)
+			}
+			autoCloseWindow = &w
+		}
+	}
+
 	var tlsConfig *tls.Config
 	if *keyFile != "" && *certFile != "" {
 		var err error
@@ -133,66 +259,367 @@ func main() {
 
 	osHelper := gpos.NewOSHelper(logger)
 
+	if *eventsMaxAge < 0 || *eventsMaxEvents < 0 {
+		logger.Fatal("exiting", fmt.Errorf("eventsMaxAge and eventsMaxEvents must not be negative"))
+	}
+
+	eventStore, err := events.NewStore(
+		logger,
+		osHelper,
+		*eventsFile,
+		events.Retention{
+			MaxAge:    *eventsMaxAge,
+			MaxEvents: *eventsMaxEvents,
+		},
+		time.Hour,
+	)
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
+	auditTrail, err := audit.NewTrail(logger, osHelper, *auditFile)
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
 	loginHandler := login.NewHandler(
 		logger,
 		templates,
 		cookieHandler,
 		*cookieMaxAge,
+		*username,
+		*password,
+		*adminUsername,
+		*adminPassword,
+		eventStore,
+	)
+
+	registry := metrics.NewRegistry()
+	registry.NewGaugeFunc(
+		"garagepi_build_info",
+		"Version of garagepi and the Go version with which it was built.",
+		[]string{"version", "goversion"},
+		func() []metrics.Sample {
+			return []metrics.Sample{{LabelValues: []string{version, runtime.Version()}, Value: 1}}
+		},
 	)
 
 	webcamURL := fmt.Sprintf("%s:%d", *webcamHost, *webcamPort)
 	wh := webcam.NewHandler(
 		logger,
 		webcamURL,
+		registry,
 	)
 
-	gpio := gpio.NewGpio(osHelper, logger)
+	backend, err := newGpioBackend(logger, osHelper)
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
+	driver := gpio.NewDriver(logger, backend)
+	gpio := gpio.NewInstrumentedGpio(driver, registry)
+
+	if *lightMaxOnTime < 0 {
+		logger.Fatal("exiting", fmt.Errorf("lightMaxOnTime must not be negative"))
+	}
 
 	lh := light.NewHandler(
 		logger,
+		osHelper,
 		gpio,
 		*gpioLightPin,
+		*lightMaxOnTime,
+		time.Second,
+		eventStore,
+		auditTrail,
+	)
+
+	doorHandlers := []door.Handler{}
+	autoClosers := map[string]door.AutoCloser{}
+	doorMembers := grouper.Members{}
+	for _, c := range doorConfigs {
+		dh := door.NewHandler(
+			logger,
+			osHelper,
+			gpio,
+			c,
+			eventStore,
+			auditTrail,
+		)
+		doorHandlers = append(doorHandlers, dh)
+
+		err := dh.IdleRelay()
+		if err != nil {
+			logger.Error("failed to set door relay to idle", err, lager.Data{"door": c.Name})
+		}
+
+		if c.Sensor == nil && len(c.Interlocks) == 0 {
+			continue
+		}
+
+		doorMembers = append(doorMembers, grouper.Member{
+			Name:   "door-monitor-" + c.Name,
+			Runner: door.NewMonitor(logger, dh, *doorSensorPollInterval),
+		})
+
+		if c.Sensor != nil && *doorAutoCloseAfter > 0 {
+			autoCloser := door.NewAutoCloser(
+				logger.WithData(lager.Data{"door": c.Name}),
+				osHelper,
+				dh,
+				*doorAutoCloseAfter,
+				autoCloseWindow,
+				c.TravelTime,
+				*doorSensorPollInterval,
+			)
+			autoClosers[c.Name] = autoCloser
+
+			doorMembers = append(doorMembers, grouper.Member{
+				Name:   "door-autoclose-" + c.Name,
+				Runner: autoCloser,
+			})
+		}
+	}
+
+	doors := door.NewDoors(
+		logger,
+		doorHandlers,
+		autoClosers,
 	)
 
+	// The unnamed /door routes act on the first configured door.
+	dh := doorHandlers[0]
+
+	doorNames := []string{}
+	for _, c := range doorConfigs {
+		doorNames = append(doorNames, c.Name)
+	}
+
+	var automationRules []rules.Rule
+	if *rulesFile != "" {
+		automationRules, err = rules.Load(*rulesFile, doorNames)
+		if err != nil {
+			logger.Fatal("exiting", err)
+		}
+	}
+
+	rulesEngine := rules.NewEngine(
+		logger,
+		osHelper,
+		doors,
+		lh,
+		gpio,
+		eventStore,
+		rules.NewEventNotifier(logger, eventStore),
+		automationRules,
+		time.Second,
+		*rulesDryRun,
+	)
+
+	scheduleLocation, err := time.LoadLocation(*scheduleTimezone)
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
+	var savedSchedules []schedules.Schedule
+	if *schedulesFile != "" {
+		savedSchedules, err = schedules.Load(*schedulesFile, doorNames)
+		if err != nil {
+			logger.Fatal("exiting", err)
+		}
+	}
+
+	scheduler := schedules.NewScheduler(
+		logger,
+		osHelper,
+		rulesEngine,
+		scheduleLocation,
+		*schedulesFile,
+		doorNames,
+		savedSchedules,
+		time.Second,
+	)
+
+	var webhookEndpoints []webhooks.Endpoint
+	if *webhooksFile != "" {
+		webhookEndpoints, err = webhooks.Load(*webhooksFile)
+		if err != nil {
+			logger.Fatal("exiting", err)
+		}
+	}
+
+	webhookDispatcher, err := webhooks.NewDispatcher(
+		logger,
+		osHelper,
+		eventStore,
+		webhookEndpoints,
+		webhooks.Config{
+			QueuePath:   *webhooksQueueFile,
+			QueueSize:   *webhooksQueueSize,
+			MaxAttempts: *webhooksMaxAttempts,
+			MinBackoff:  time.Second,
+			MaxBackoff:  10 * time.Minute,
+			Timeout:     10 * time.Second,
+		},
+	)
+	if err != nil {
+		logger.Fatal("exiting", err)
+	}
+
 	hh := homepage.NewHandler(
 		logger,
 		templates,
 		lh,
+		doors,
 		loginHandler,
 	)
 
-	dh := door.NewHandler(
+	streamHandler := stream.NewHandler(
 		logger,
-		osHelper,
-		gpio,
-		*gpioDoorPin)
+		eventStore,
+		lh,
+		doors,
+		15*time.Second,
+	)
 
 	loglevelHandler := loglevel.NewServer(
 		logger,
 		sink,
 	)
 
+	healthHandler := health.NewHandler(
+		logger,
+		osHelper,
+		[]health.Check{
+			{Name: "webcam", Probe: wh.Probe, Failure: "unreachable"},
+			{Name: "gpio", Probe: func() error {
+				return readPins(gpio, *gpioLightPin, doorConfigs)
+			}, Failure: "read failed"},
+		},
+		*readyCacheDuration,
+	)
+
 	staticFileServer := http.FileServer(static.FS(false))
 
 	rtr := mux.NewRouter()
 
-	rtr.PathPrefix("/static/").Handler(staticFileServer)
+	// The static route is named so that each file is not counted separately.
+	rtr.PathPrefix("/static/").Handler(staticFileServer).Name("/static/")
 
 	rtr.HandleFunc("/", hh.Handle).Methods("GET")
 	rtr.HandleFunc("/webcam", wh.Handle).Methods("GET")
+	rtr.Handle("/metrics", registry).Methods("GET")
+	rtr.HandleFunc("/healthz", healthHandler.HandleHealthz).Methods("GET")
+	rtr.HandleFunc("/readyz", healthHandler.HandleReadyz).Methods("GET")
 
 	s := rtr.PathPrefix("/api/v1").Subrouter()
 	s.HandleFunc("/toggle", dh.HandleToggle).Methods("POST")
+	s.HandleFunc("/door", dh.HandleGet).Methods("GET")
+	s.HandleFunc("/door/open", dh.HandleOpen).Methods("POST")
+	s.HandleFunc("/door/close", dh.HandleClose).Methods("POST")
+	if autoCloser, ok := autoClosers[dh.Name()]; ok {
+		s.HandleFunc("/door/autoclose", autoCloser.HandleGet).Methods("GET")
+		s.HandleFunc("/door/autoclose", autoCloser.HandleSet).Methods("POST")
+	}
+	s.HandleFunc("/doors", doors.HandleList).Methods("GET")
+	s.HandleFunc("/doors/{name}", doors.HandleGet).Methods("GET")
+	s.HandleFunc("/doors/{name}/toggle", doors.HandleToggle).Methods("POST")
+	s.HandleFunc("/doors/{name}/open", doors.HandleOpen).Methods("POST")
+	s.HandleFunc("/doors/{name}/close", doors.HandleClose).Methods("POST")
+	s.HandleFunc("/doors/{name}/autoclose", doors.HandleGetAutoClose).Methods("GET")
+	s.HandleFunc("/doors/{name}/autoclose", doors.HandleSetAutoClose).Methods("POST")
 	s.HandleFunc("/light", lh.HandleGet).Methods("GET")
 	s.HandleFunc("/light", lh.HandleSet).Methods("POST")
 	s.HandleFunc("/loglevel", loglevelHandler.GetMinLevel).Methods("GET")
 	s.HandleFunc("/loglevel", loglevelHandler.SetMinLevel).Methods("POST")
+	s.HandleFunc("/events", eventStore.HandleList).Methods("GET")
+	s.HandleFunc("/audit", auditTrail.HandleList).Methods("GET")
+	s.HandleFunc("/webhooks", webhookDispatcher.HandleList).Methods("GET")
+	s.HandleFunc("/stream", streamHandler.HandleStream).Methods("GET")
+	s.HandleFunc("/ws", streamHandler.HandleWebSocket).Methods("GET")
+
+	s.HandleFunc("/rules", rulesEngine.HandleList).Methods("GET")
+	s.HandleFunc("/rules/{name}", rulesEngine.HandleSet).Methods("POST")
+	s.HandleFunc("/rules/{name}/dry-run", rulesEngine.HandleDryRun).Methods("POST")
+
+	s.HandleFunc("/schedules", scheduler.HandleList).Methods("GET")
+	s.HandleFunc("/schedules", scheduler.HandleCreate).Methods("POST")
+	s.HandleFunc("/schedules/{name}", scheduler.HandleGet).Methods("GET")
+	s.HandleFunc("/schedules/{name}", scheduler.HandleUpdate).Methods("PUT")
+	s.HandleFunc("/schedules/{name}", scheduler.HandleDelete).Methods("DELETE")
+
+	if simulator, ok := backend.(sim.Simulator); ok && *dev {
+		dgh := devgpio.NewHandler(logger, templates, simulator)
+		rtr.HandleFunc("/dev/gpio", dgh.Handle).Methods("GET")
+		s.HandleFunc("/dev/gpio", dgh.HandleGet).Methods("GET")
+		s.HandleFunc("/dev/gpio/{pin}", dgh.HandleSet).Methods("POST")
+	}
 
 	rtr.HandleFunc("/login", loginHandler.LoginGET).Methods("GET")
 	rtr.HandleFunc("/login", loginHandler.LoginPOST).Methods("POST")
 	rtr.HandleFunc("/logout", loginHandler.LogoutPOST).Methods("POST")
 
-	members := grouper.Members{}
+	members := append(grouper.Members{{Name: "light", Runner: lh}}, doorMembers...)
+	members = append(members, grouper.Member{Name: "rules", Runner: rulesEngine})
+	members = append(members, grouper.Member{Name: "schedules", Runner: scheduler})
+	members = append(members, grouper.Member{Name: "webhooks", Runner: webhookDispatcher})
+	members = append(members, grouper.Member{
+		Name:   "metrics",
+		Runner: apimetrics.NewCollector(logger, registry, eventStore, doors, lh),
+	})
+
+	requestMetrics := middleware.NewMetrics(registry, rtr)
+
+	var metricsAuth middleware.Middleware
+	if *metricsUsername != "" {
+		metricsAuth = middleware.NewMetricsAuth(*metricsUsername, *metricsPassword, registry, logger)
+	}
+
+	if *mqttBroker != "" {
+		haConfig := homeassistant.Config{
+			TopicPrefix:     *mqttTopicPrefix,
+			DiscoveryPrefix: *mqttDiscoveryPrefix,
+			NodeID:          *mqttClientID,
+		}
+
+		mqttClient, err := mqtt.NewClient(logger, mqtt.Options{
+			Broker:   *mqttBroker,
+			ClientID: *mqttClientID,
+			Username: *mqttUsername,
+			Password: *mqttPassword,
+			Will: &mqtt.Message{
+				Topic:   haConfig.AvailabilityTopic(),
+				Payload: []byte(homeassistant.PayloadOffline),
+				Retain:  true,
+			},
+		})
+		if err != nil {
+			logger.Fatal("exiting", err)
+		}
+
+		bridge := homeassistant.NewBridge(logger, mqttClient, haConfig, eventStore, lh, doors)
+
+		members = append(members, grouper.Member{Name: "homeassistant", Runner: bridge})
+		members = append(members, grouper.Member{Name: "mqtt", Runner: mqttClient})
+	}
+
+	if *homekitSetupCode != "" {
+		if *homekitFile == "" {
+			logger.Fatal("exiting", fmt.Errorf("homekitFile must be provided if homekitSetupCode is provided"))
+		}
+
+		if newHomekitMembers == nil {
+			logger.Fatal("exiting", fmt.Errorf("HomeKit is not supported by this build of garagepi - it must be built with the homekit build tag"))
+		}
+
+		homekitMembers, err := newHomekitMembers(logger, lh, doors, eventStore)
+		if err != nil {
+			logger.Fatal("exiting", err)
+		}
+
+		members = append(members, homekitMembers...)
+	}
+
 	if *enableHTTPS {
 		forceHTTPS := false
 		httpsRunner := NewWebRunner(
@@ -204,7 +631,12 @@ func main() {
 			*redirectPort,
 			*username,
 			*password,
+			*adminUsername,
+			*adminPassword,
 			cookieHandler,
+			eventStore,
+			requestMetrics,
+			metricsAuth,
 		)
 
 		members = append(members, grouper.Member{
@@ -224,7 +656,12 @@ func main() {
 			*redirectPort,
 			*username,
 			*password,
+			*adminUsername,
+			*adminPassword,
 			cookieHandler,
+			eventStore,
+			requestMetrics,
+			metricsAuth,
 		)
 		members = append(members, grouper.Member{
 			Name:   "http",
@@ -232,7 +669,14 @@ func main() {
 		})
 	}
 
-	group := grouper.NewParallel(os.Kill, members)
+	// The gpio driver starts first and stops last so that it remains
+	// open for as long as anything else is running, and likewise the
+	// event store so that events are recorded until shutdown.
+	group := grouper.NewOrdered(os.Kill, grouper.Members{
+		{Name: "gpio", Runner: driver},
+		{Name: "events", Runner: eventStore},
+		{Name: "garagepi", Runner: grouper.NewParallel(os.Kill, members)},
+	})
 	process := ifrit.Invoke(group)
 
 	if *pidFile != "" {
@@ -253,6 +697,141 @@ func main() {
 	}
 }
 
+// verifyAudit verifies the audit trail in the file named by args, and returns
+// the exit code.
+func verifyAudit(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: garagepi verify-audit <file>\n")
+		return 2
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	n, err := audit.Verify(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit trail verification failed after %d records: %s\n", n, err)
+		return 1
+	}
+
+	fmt.Printf("verified %d audit records\n", n)
+	return 0
+}
+
+func newGpioBackend(logger lager.Logger, osHelper gpos.OSHelper) (gpio.Backend, error) {
+	backend := *gpioBackend
+	if backend == "" {
+		backend = "rpio"
+		if *dev {
+			backend = "sim"
+		}
+	}
+
+	switch backend {
+	case "rpio":
+		return gpio.NewRPIOBackend(), nil
+	case "cdev":
+		return cdev.NewBackend(cdev.NewSyscaller(), *gpioChip), nil
+	case "sysfs":
+		return sysfs.NewBackend(logger, osHelper, *gpioSysfsRoot), nil
+	case "sim":
+		return sim.NewSimulator(logger, *gpioSimFile), nil
+	default:
+		return nil, fmt.Errorf("invalid gpioBackend: '%s'", *gpioBackend)
+	}
+}
+
+func parseDoorConfigs() ([]door.Config, error) {
+	defaults := door.Config{
+		Name:           "door",
+		RelayPin:       *gpioDoorPin,
+		PulseDuration:  *doorPulseDuration,
+		TravelTime:     *doorTravelTime,
+		Cooldown:       *doorCooldown,
+		RelayActiveLow: *doorRelayActiveLow,
+	}
+
+	configs := []door.Config{}
+
+	if len(doorSpecs) == 0 {
+		c := defaults
+		if *enableDoorSensor {
+			contact, err := door.ParseSensorContact(*doorSensorContact)
+			if err != nil {
+				return nil, err
+			}
+
+			c.Sensor = &door.Sensor{
+				Pin:       *gpioDoorSensorPin,
+				ActiveLow: *doorSensorActiveLow,
+				Contact:   contact,
+			}
+		}
+
+		for _, spec := range doorInterlockSpecs {
+			i, err := door.ParseInterlock(spec)
+			if err != nil {
+				return nil, err
+			}
+			c.Interlocks = append(c.Interlocks, i)
+		}
+
+		configs = append(configs, c)
+	} else if len(doorInterlockSpecs) > 0 {
+		return nil, fmt.Errorf("-doorInterlock cannot be used with -door; use the interlock key of the door specification")
+	}
+
+	for _, spec := range doorSpecs {
+		c, err := door.ParseConfig(spec, defaults)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+
+	err := door.ValidateConfigs(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+// readPins reads the light pin and the sensor pin of each door, returning
+// the first error.
+func readPins(g gpio.Gpio, lightPin uint, configs []door.Config) error {
+	_, err := g.Read(lightPin)
+	if err != nil {
+		return fmt.Errorf("reading light pin %d: %s", lightPin, err)
+	}
+
+	for _, c := range configs {
+		if c.Sensor == nil {
+			continue
+		}
+
+		_, err := g.Read(c.Sensor.Pin)
+		if err != nil {
+			return fmt.Errorf("reading sensor pin %d of door %s: %s", c.Sensor.Pin, c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func anyDoorHasSensor(configs []door.Config) bool {
+	for _, c := range configs {
+		if c.Sensor != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func createTLSConfig(keyFile string, certFile string) (*tls.Config, error) {
 	// Load client cert
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
@@ -285,18 +864,27 @@ func NewWebRunner(
 	redirectPort uint,
 	username string,
 	password string,
+	adminUsername string,
+	adminPassword string,
 	cookieHandler *securecookie.SecureCookie,
+	recorder events.Recorder,
+	requestMetrics middleware.Middleware,
+	metricsAuth middleware.Middleware,
 ) ifrit.Runner {
 
 	m := middleware.Chain{
 		middleware.NewPanicRecovery(logger),
+		requestMetrics,
 		middleware.NewLogger(logger),
 	}
 
 	if forceHTTPS {
 		m = append(m, middleware.NewHTTPSEnforcer(redirectPort))
 	} else if username != "" && password != "" {
-		m = append(m, middleware.NewAuth(username, password, logger, cookieHandler))
+		if metricsAuth != nil {
+			m = append(m, metricsAuth)
+		}
+		m = append(m, middleware.NewAuth(username, password, adminUsername, adminPassword, logger, cookieHandler, recorder))
 	}
 
 	return &webRunner{
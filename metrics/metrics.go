@@ -0,0 +1,379 @@
+// Package metrics collects counters, gauges and histograms, and serves them
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds of histogram buckets for durations
+// in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Sample is the value of a metric for one set of label values, in the order
+// of the metric's label names.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry holds metrics and serves them. Metrics are written in the order
+// in which they were created.
+type Registry struct {
+	mutex      sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: map[string]bool{},
+	}
+}
+
+// register panics if name is invalid or already registered, as both
+// are programming errors.
+func (r *Registry) register(name string, labelNames []string, c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name: '%s'", name))
+	}
+	for _, l := range labelNames {
+		if !validName.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic(fmt.Sprintf("invalid label name for %s: '%s'", name, l))
+		}
+	}
+	if r.names[name] {
+		panic(fmt.Sprintf("duplicate metric: %s", name))
+	}
+
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter returns a counter with labelNames, which is zero for each set
+// of label values until it is first incremented.
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{newVec(name, help, "counter", labelNames)}
+	r.register(name, labelNames, c)
+	return c
+}
+
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{newVec(name, help, "gauge", labelNames)}
+	r.register(name, labelNames, g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose samples are returned by f each time
+// the metrics are written.
+func (r *Registry) NewGaugeFunc(name, help string, labelNames []string, f func() []Sample) {
+	r.register(name, labelNames, &gaugeFunc{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		f:          f,
+	})
+}
+
+// NewHistogram returns a histogram with the bucket upper bounds buckets,
+// which must be sorted. An implicit +Inf bucket counts all observations.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("buckets for %s are not sorted", name))
+	}
+
+	h := &Histogram{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*histogramSeries{},
+	}
+	r.register(name, labelNames, h)
+	return h
+}
+
+// Write writes the metrics in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// vec holds a value for each set of label values.
+type vec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+
+	mutex  sync.Mutex
+	values map[string]*Sample
+}
+
+func newVec(name, help, typ string, labelNames []string) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		values:     map[string]*Sample{},
+	}
+}
+
+// sample must be called with the mutex held.
+func (v *vec) sample(labelValues []string) *Sample {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("%s has %d labels but %d values were provided", v.name, len(v.labelNames), len(labelValues)))
+	}
+
+	key := seriesKey(labelValues)
+	s, ok := v.values[key]
+	if !ok {
+		s = &Sample{LabelValues: append([]string{}, labelValues...)}
+		v.values[key] = s
+	}
+	return s
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.sample(labelValues).Value += delta
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.sample(labelValues).Value = value
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mutex.Lock()
+	samples := make([]Sample, 0, len(v.values))
+	for _, s := range v.values {
+		samples = append(samples, *s)
+	}
+	v.mutex.Unlock()
+
+	writeSamples(w, v.name, v.help, v.typ, v.labelNames, samples)
+}
+
+type Counter struct {
+	vec
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add panics if delta is negative, as counters only increase.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("%s cannot be decreased", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+type Gauge struct {
+	vec
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.set(value, labelValues)
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+type gaugeFunc struct {
+	name       string
+	help       string
+	labelNames []string
+	f          func() []Sample
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	writeSamples(w, g.name, g.help, "gauge", g.labelNames, g.f())
+}
+
+type Histogram struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mutex  sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labelNames) {
+		panic(fmt.Sprintf("%s has %d labels but %d values were provided", h.name, len(h.labelNames), len(labelValues)))
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labelNames := append(append([]string{}, h.labelNames...), "le")
+	for _, k := range keys {
+		s := h.series[k]
+		for i, upper := range h.buckets {
+			labelValues := append(append([]string{}, s.labelValues...), formatFloat(upper))
+			writeSample(w, h.name+"_bucket", labelNames, labelValues, float64(s.counts[i]))
+		}
+		labelValues := append(append([]string{}, s.labelValues...), "+Inf")
+		writeSample(w, h.name+"_bucket", labelNames, labelValues, float64(s.count))
+		writeSample(w, h.name+"_sum", h.labelNames, s.labelValues, s.sum)
+		writeSample(w, h.name+"_count", h.labelNames, s.labelValues, float64(s.count))
+	}
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// writeSamples writes samples sorted by their label values. Samples with
+// the wrong number of label values are skipped.
+func writeSamples(w io.Writer, name, help, typ string, labelNames []string, samples []Sample) {
+	writeHeader(w, name, help, typ)
+
+	sort.Sort(byLabelValues(samples))
+	for _, s := range samples {
+		if len(s.LabelValues) != len(labelNames) {
+			continue
+		}
+		writeSample(w, name, labelNames, s.LabelValues, s.Value)
+	}
+}
+
+func writeSample(w io.Writer, name string, labelNames []string, labelValues []string, value float64) {
+	io.WriteString(w, name)
+
+	if len(labelNames) > 0 {
+		io.WriteString(w, "{")
+		for i, l := range labelNames {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, escapeLabelValue(labelValues[i]))
+		}
+		io.WriteString(w, "}")
+	}
+
+	fmt.Fprintf(w, " %s\n", formatFloat(value))
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+type byLabelValues []Sample
+
+func (s byLabelValues) Len() int      { return len(s) }
+func (s byLabelValues) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLabelValues) Less(i, j int) bool {
+	return seriesKey(s[i].LabelValues) < seriesKey(s[j].LabelValues)
+}
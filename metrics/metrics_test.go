@@ -0,0 +1,111 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/metrics"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *metrics.Registry
+
+	output := func() string {
+		buf := new(bytes.Buffer)
+		Expect(registry.Write(buf)).To(Succeed())
+		return buf.String()
+	}
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+	})
+
+	It("writes counters and gauges, sorted by label values", func() {
+		c := registry.NewCounter("toggles_total", "Toggles.", "door", "result")
+		c.Inc("shed", "pulsed")
+		c.Inc("garage", "pulsed")
+		c.Add(2, "garage", "pulsed")
+
+		g := registry.NewGauge("clients", "Clients.")
+		g.Inc()
+		g.Inc()
+		g.Dec()
+
+		Expect(output()).To(Equal(`# HELP toggles_total Toggles.
+# TYPE toggles_total counter
+toggles_total{door="garage",result="pulsed"} 3
+toggles_total{door="shed",result="pulsed"} 1
+# HELP clients Clients.
+# TYPE clients gauge
+clients 1
+`))
+	})
+
+	It("writes gauges whose samples are returned by a function", func() {
+		value := 1.0
+		registry.NewGaugeFunc("light_on", "Light.", []string{"pin"}, func() []metrics.Sample {
+			return []metrics.Sample{
+				{LabelValues: []string{"3"}, Value: value},
+				{LabelValues: []string{"too", "many"}, Value: 2},
+			}
+		})
+
+		Expect(output()).To(ContainSubstring("light_on{pin=\"3\"} 1\n"))
+		value = 0
+		Expect(output()).To(ContainSubstring("light_on{pin=\"3\"} 0\n"))
+		Expect(output()).NotTo(ContainSubstring("too"))
+	})
+
+	It("writes histograms with cumulative buckets", func() {
+		h := registry.NewHistogram("duration_seconds", "Duration.", []float64{0.1, 1}, "route")
+		h.Observe(0.05, "/")
+		h.Observe(0.5, "/")
+		h.Observe(5, "/")
+
+		Expect(output()).To(Equal(`# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/",le="0.1"} 1
+duration_seconds_bucket{route="/",le="1"} 2
+duration_seconds_bucket{route="/",le="+Inf"} 3
+duration_seconds_sum{route="/"} 5.55
+duration_seconds_count{route="/"} 3
+`))
+	})
+
+	It("escapes help and label values", func() {
+		registry.NewGauge("info", "Some\\help\nhere.", "value").Set(1, "a \"quoted\"\\value\n")
+		Expect(output()).To(Equal(`# HELP info Some\\help\nhere.
+# TYPE info gauge
+info{value="a \"quoted\"\\value\n"} 1
+`))
+	})
+
+	It("panics for invalid metrics", func() {
+		registry.NewCounter("requests_total", "Requests.", "code")
+
+		Expect(func() { registry.NewCounter("requests_total", "Duplicate.") }).To(Panic())
+		Expect(func() { registry.NewCounter("invalid-name", "Invalid.") }).To(Panic())
+		Expect(func() { registry.NewHistogram("h", "Reserved label.", metrics.DefaultBuckets, "le") }).To(Panic())
+		Expect(func() { registry.NewHistogram("h", "Unsorted.", []float64{1, 0.1}) }).To(Panic())
+	})
+
+	It("panics when the wrong number of label values is provided", func() {
+		c := registry.NewCounter("requests_total", "Requests.", "code")
+		Expect(func() { c.Inc() }).To(Panic())
+		Expect(func() { c.Add(-1, "200") }).To(Panic())
+	})
+
+	It("serves the metrics with the exposition content type", func() {
+		registry.NewGauge("up", "Up.").Set(1)
+
+		w := httptest.NewRecorder()
+		registry.ServeHTTP(w, new(http.Request))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(w.Body.String()).To(ContainSubstring("up 1\n"))
+	})
+})
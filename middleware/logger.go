@@ -12,6 +12,11 @@ import (
 	"github.com/pivotal-golang/lager"
 )
 
+// streamedPrefixes are the URLs of responses which are streamed to the client.
+// They must be written through to the client as they are produced rather than
+// captured, and WebSocket connections must be able to hijack the connection.
+var streamedPrefixes = []string{"/webcam", "/api/v1/stream", "/api/v1/ws"}
+
 type logger struct {
 	logger lager.Logger
 }
@@ -24,7 +29,7 @@ func NewLogger(l lager.Logger) Middleware {
 
 func (l logger) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if urlInPrefixes(req.URL.Path, []string{"/webcam"}) {
+		if urlInPrefixes(req.URL.Path, streamedPrefixes) {
 			l.logger.Debug("skipping logging for URL", lager.Data{"url": req.URL.Path})
 			next.ServeHTTP(rw, req)
 		} else {
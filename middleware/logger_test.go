@@ -51,4 +51,20 @@ var _ = Describe("Logger", func() {
 		Expect(arg0).ToNot(BeNil())
 		Expect(arg1).To(Equal(dummyRequest))
 	})
+
+	It("should not wrap the response writer of streamed responses", func() {
+		for i, url := range []string{"/api/v1/stream", "/api/v1/ws"} {
+			streamRequest, err := http.NewRequest("GET", url, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			loggerMiddleware := middleware.NewLogger(fakeLogger)
+			loggerHandler := loggerMiddleware.Wrap(fakeHandler)
+
+			loggerHandler.ServeHTTP(fakeResponseWriter, streamRequest)
+
+			Expect(fakeHandler.ServeHTTPCallCount()).To(Equal(i + 1))
+			arg0, _ := fakeHandler.ServeHTTPArgsForCall(i)
+			Expect(arg0).To(Equal(fakeResponseWriter), url)
+		}
+	})
 })
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/metrics"
+)
+
+// unmatchedRoute is the route of requests which do not match a route whose
+// path can be built, so that arbitrary paths do not each create a series.
+const unmatchedRoute = "unmatched"
+
+type requestMetrics struct {
+	router    *mux.Router
+	requests  *metrics.Counter
+	durations *metrics.Histogram
+}
+
+// NewMetrics returns middleware which counts and times requests by the route
+// of router which they match. The route is the name of the route if it has
+// one, otherwise the path with the values of route variables replaced by
+// their names, e.g. /api/v1/doors/{name}. Streamed responses are not
+// counted, as they last as long as the client is connected.
+func NewMetrics(registry *metrics.Registry, router *mux.Router) Middleware {
+	return requestMetrics{
+		router: router,
+		requests: registry.NewCounter(
+			"garagepi_http_requests_total",
+			"HTTP requests by route, method and status code.",
+			"route", "method", "code",
+		),
+		durations: registry.NewHistogram(
+			"garagepi_http_request_duration_seconds",
+			"Duration of HTTP requests by route and method.",
+			metrics.DefaultBuckets,
+			"route", "method",
+		),
+	}
+}
+
+func (m requestMetrics) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if urlInPrefixes(req.URL.Path, streamedPrefixes) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: rw}
+		next.ServeHTTP(sw, req)
+
+		if sw.statusCode == 0 {
+			sw.statusCode = http.StatusOK
+		}
+
+		r := m.route(req)
+		m.requests.Inc(r, req.Method, strconv.Itoa(sw.statusCode))
+		m.durations.Observe(time.Since(start).Seconds(), r, req.Method)
+	})
+}
+
+func (m requestMetrics) route(req *http.Request) string {
+	var match mux.RouteMatch
+	if !m.router.Match(req, &match) {
+		return unmatchedRoute
+	}
+
+	if name := match.Route.GetName(); name != "" {
+		return name
+	}
+
+	// Build the path of the route with the names of its variables as their values.
+	var pairs []string
+	for name := range match.Vars {
+		pairs = append(pairs, name, "{"+name+"}")
+	}
+
+	u, err := match.Route.URLPath(pairs...)
+	if err != nil {
+		return unmatchedRoute
+	}
+	return u.Path
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (sw *statusWriter) WriteHeader(s int) {
+	if sw.statusCode == 0 {
+		sw.statusCode = s
+	}
+	sw.ResponseWriter.WriteHeader(s)
+}
+
+type metricsAuth struct {
+	username, password string
+	handler            http.Handler
+	logger             lager.Logger
+}
+
+// NewMetricsAuth returns middleware which serves requests for /metrics with
+// handler if they have basic auth credentials matching username and password,
+// so that metrics can be scraped without the credentials of the user. Other
+// requests are passed to the next handler.
+func NewMetricsAuth(
+	username string,
+	password string,
+	handler http.Handler,
+	logger lager.Logger,
+) Middleware {
+	return metricsAuth{
+		username: username,
+		password: password,
+		handler:  handler,
+		logger:   logger,
+	}
+}
+
+func (a metricsAuth) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/metrics" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		username, password, ok := req.BasicAuth()
+		if ok && secureCompare(username, a.username) && secureCompare(password, a.password) {
+			a.logger.Debug("successfully validated metrics credentials")
+			a.handler.ServeHTTP(rw, req)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,135 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/metrics"
+	"github.com/robdimsdale/garagepi/middleware"
+	"github.com/robdimsdale/garagepi/middleware/fakes"
+)
+
+var _ = Describe("Metrics", func() {
+	var (
+		registry *metrics.Registry
+		router   *mux.Router
+		handler  http.Handler
+	)
+
+	output := func() string {
+		buf := new(bytes.Buffer)
+		Expect(registry.Write(buf)).To(Succeed())
+		return buf.String()
+	}
+
+	serve := func(method, url string) {
+		req, err := http.NewRequest(method, url, nil)
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+
+		router = mux.NewRouter()
+		s := router.PathPrefix("/api/v1").Subrouter()
+		s.HandleFunc("/doors/{name}/toggle", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}).Methods("POST")
+		s.HandleFunc("/light", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("{}"))
+		}).Methods("GET")
+		router.PathPrefix("/static/").Handler(http.NotFoundHandler()).Name("/static/")
+
+		handler = middleware.NewMetrics(registry, router).Wrap(router)
+	})
+
+	It("counts and times requests by route, method and status code", func() {
+		serve("POST", "/api/v1/doors/garage/toggle")
+		serve("POST", "/api/v1/doors/doors/toggle")
+		serve("GET", "/api/v1/light")
+
+		Expect(output()).To(ContainSubstring(
+			`garagepi_http_requests_total{route="/api/v1/doors/{name}/toggle",method="POST",code="503"} 2` + "\n",
+		))
+		Expect(output()).To(ContainSubstring(
+			`garagepi_http_requests_total{route="/api/v1/light",method="GET",code="200"} 1` + "\n",
+		))
+		Expect(output()).To(ContainSubstring(
+			`garagepi_http_request_duration_seconds_count{route="/api/v1/light",method="GET"} 1` + "\n",
+		))
+	})
+
+	It("uses the name of named routes", func() {
+		serve("GET", "/static/styles/main.css")
+		Expect(output()).To(ContainSubstring(`route="/static/",method="GET",code="404"`))
+	})
+
+	It("does not create a series for each unmatched path", func() {
+		serve("GET", "/some/path")
+		serve("GET", "/other/path")
+		Expect(output()).To(ContainSubstring(`garagepi_http_requests_total{route="unmatched",method="GET",code="404"} 2`))
+	})
+
+	It("does not count streamed responses", func() {
+		fakeHandler := &fakes.FakeHandler{}
+		fakeResponseWriter := &fakes.FakeResponseWriter{}
+		handler = middleware.NewMetrics(metrics.NewRegistry(), router).Wrap(fakeHandler)
+
+		req, err := http.NewRequest("GET", "/api/v1/ws", nil)
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(fakeResponseWriter, req)
+
+		Expect(fakeHandler.ServeHTTPCallCount()).To(Equal(1))
+		w, _ := fakeHandler.ServeHTTPArgsForCall(0)
+		Expect(w).To(Equal(fakeResponseWriter))
+	})
+})
+
+var _ = Describe("MetricsAuth", func() {
+	var (
+		metricsHandler *fakes.FakeHandler
+		next           *fakes.FakeHandler
+		handler        http.Handler
+	)
+
+	serve := func(url, username, password string) {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	BeforeEach(func() {
+		metricsHandler = &fakes.FakeHandler{}
+		next = &fakes.FakeHandler{}
+		handler = middleware.NewMetricsAuth(
+			"prometheus",
+			"scrape",
+			metricsHandler,
+			lagertest.NewTestLogger("middleware test"),
+		).Wrap(next)
+	})
+
+	It("serves metrics to requests with the metrics credentials", func() {
+		serve("/metrics", "prometheus", "scrape")
+		Expect(metricsHandler.ServeHTTPCallCount()).To(Equal(1))
+		Expect(next.ServeHTTPCallCount()).To(BeZero())
+	})
+
+	It("passes other requests to the next handler", func() {
+		serve("/metrics", "prometheus", "wrong")
+		serve("/metrics", "", "")
+		serve("/api/v1/light", "prometheus", "scrape")
+
+		Expect(metricsHandler.ServeHTTPCallCount()).To(BeZero())
+		Expect(next.ServeHTTPCallCount()).To(Equal(3))
+	})
+})
@@ -5,35 +5,63 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/context"
 	"github.com/gorilla/securecookie"
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
 )
 
 type auth struct {
-	username, password string
-	logger             lager.Logger
-	cookieHandler      *securecookie.SecureCookie
+	username, password           string
+	adminUsername, adminPassword string
+	logger                       lager.Logger
+	cookieHandler                *securecookie.SecureCookie
+	recorder                     events.Recorder
 }
 
+// NewAuth returns middleware which requires a valid session cookie or basic auth,
+// with the credentials of the user or of the admin. There is no admin if
+// adminUsername or adminPassword is empty.
+// Requests with invalid basic auth credentials are recorded with recorder as failed logins.
 func NewAuth(
 	username string,
 	password string,
+	adminUsername string,
+	adminPassword string,
 	logger lager.Logger,
 	cookieHandler *securecookie.SecureCookie,
+	recorder events.Recorder,
 ) Middleware {
 	return auth{
 		username:      username,
 		password:      password,
+		adminUsername: adminUsername,
+		adminPassword: adminPassword,
 		logger:        logger,
 		cookieHandler: cookieHandler,
+		recorder:      recorder,
 	}
 }
 
+// Wrap stores the authenticated user and client IP of each request in its
+// context, from which they are returned by events.RequestSource, and whether
+// the user is the admin, which is returned by events.RequestAdmin.
 func (s auth) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if s.unauthenticatedAccessAllowedForURL(req.URL.Path) ||
-			s.validSession(req) ||
-			s.validBasicAuth(req) {
+		defer context.Clear(req)
+
+		if s.unauthenticatedAccessAllowedForURL(req.URL.Path) {
+			next.ServeHTTP(rw, req)
+		} else if admin, ok := s.authenticate(req); ok {
+			user := s.username
+			if admin {
+				user = s.adminUsername
+				events.SetRequestAdmin(req)
+			}
+			events.SetRequestSource(req, events.Source{
+				User:     user,
+				ClientIP: events.RequestSource(req).ClientIP,
+			})
 			next.ServeHTTP(rw, req)
 		} else {
 			s.logger.Debug("not logged in - redirecting")
@@ -43,7 +71,7 @@ func (s auth) Wrap(next http.Handler) http.Handler {
 }
 
 func (s auth) unauthenticatedAccessAllowedForURL(url string) bool {
-	openURLs := []string{"/login", "/static"}
+	openURLs := []string{"/login", "/static", "/healthz", "/readyz"}
 
 	for _, u := range openURLs {
 		if strings.HasPrefix(url, u) {
@@ -55,23 +83,56 @@ func (s auth) unauthenticatedAccessAllowedForURL(url string) bool {
 	return false
 }
 
-func (s auth) validBasicAuth(request *http.Request) bool {
+// authenticate returns whether the request has a valid session or basic
+// auth, and if so whether its credentials are those of the admin.
+func (s auth) authenticate(request *http.Request) (bool, bool) {
+	if admin, ok := s.validSession(request); ok {
+		return admin, true
+	}
+	return s.validBasicAuth(request)
+}
+
+// credentials returns whether username and password are valid, and if so
+// whether they are those of the admin.
+func (s auth) credentials(username, password string) (bool, bool) {
+	if secureCompare(username, s.username) && secureCompare(password, s.password) {
+		return false, true
+	}
+
+	admin := s.adminUsername != "" && s.adminPassword != "" &&
+		secureCompare(username, s.adminUsername) &&
+		secureCompare(password, s.adminPassword)
+	return admin, admin
+}
+
+func (s auth) validBasicAuth(request *http.Request) (bool, bool) {
 	username, password, ok := request.BasicAuth()
 
-	validated := ok &&
-		secureCompare(username, s.username) &&
-		secureCompare(password, s.password)
+	var admin, validated bool
+	if ok {
+		admin, validated = s.credentials(username, password)
+	}
 
 	if validated {
 		s.logger.Debug("successfully validated via basic auth")
-		return true
+		return admin, true
 	}
 
 	s.logger.Debug("failed validation via basic auth")
-	return false
+
+	if ok {
+		e := events.Event{
+			Type:   events.TypeLoginFailed,
+			Source: events.RequestSource(request),
+		}
+		s.logger.Info("basic auth failed", lager.Data{"user": e.User, "clientIP": e.ClientIP})
+		s.recorder.Record(e)
+	}
+
+	return false, false
 }
 
-func (s auth) validSession(request *http.Request) bool {
+func (s auth) validSession(request *http.Request) (bool, bool) {
 	var username, password string
 	if cookie, err := request.Cookie("session"); err == nil {
 		cookieValue := make(map[string]string)
@@ -82,15 +143,14 @@ func (s auth) validSession(request *http.Request) bool {
 		}
 	}
 
-	validated := secureCompare(username, s.username) &&
-		secureCompare(password, s.password)
+	admin, validated := s.credentials(username, password)
 
 	if validated {
 		s.logger.Debug("successfully validated via session")
-		return true
+		return admin, true
 	}
 	s.logger.Debug("failed validation via session")
-	return false
+	return false, false
 }
 
 func secureCompare(a, b string) bool {
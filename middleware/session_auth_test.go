@@ -0,0 +1,115 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/securecookie"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/events"
+	events_fakes "github.com/robdimsdale/garagepi/api/events/fakes"
+	"github.com/robdimsdale/garagepi/middleware"
+)
+
+var _ = Describe("Auth", func() {
+	var (
+		cookieHandler *securecookie.SecureCookie
+		fakeRecorder  *events_fakes.FakeRecorder
+		handler       http.Handler
+
+		sources []events.Source
+		admins  []bool
+		served  int
+	)
+
+	newRequest := func(url string) *http.Request {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).NotTo(HaveOccurred())
+		req.RemoteAddr = "192.168.1.10:54321"
+		return req
+	}
+
+	BeforeEach(func() {
+		cookieHandler = securecookie.New(securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32))
+		fakeRecorder = new(events_fakes.FakeRecorder)
+
+		sources = nil
+		admins = nil
+		served = 0
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served++
+			sources = append(sources, events.RequestSource(r))
+			admins = append(admins, events.RequestAdmin(r))
+		})
+
+		handler = middleware.NewAuth(
+			"some-user",
+			"some-password",
+			"some-admin",
+			"admin-password",
+			lagertest.NewTestLogger("middleware test"),
+			cookieHandler,
+			fakeRecorder,
+		).Wrap(next)
+	})
+
+	It("stores the user and client IP of requests with basic auth", func() {
+		req := newRequest("/api/v1/toggle")
+		req.SetBasicAuth("some-user", "some-password")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(sources).To(Equal([]events.Source{{User: "some-user", ClientIP: "192.168.1.10"}}))
+		Expect(admins).To(Equal([]bool{false}))
+	})
+
+	It("stores that the user is the admin for requests with the admin's credentials", func() {
+		req := newRequest("/api/v1/audit")
+		req.SetBasicAuth("some-admin", "admin-password")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(sources).To(Equal([]events.Source{{User: "some-admin", ClientIP: "192.168.1.10"}}))
+		Expect(admins).To(Equal([]bool{true}))
+	})
+
+	It("does not accept the admin's username with the user's password", func() {
+		req := newRequest("/api/v1/audit")
+		req.SetBasicAuth("some-admin", "some-password")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(served).To(Equal(0))
+	})
+
+	It("stores the user of requests with a session cookie", func() {
+		value, err := cookieHandler.Encode("session", map[string]string{
+			"name":     "some-user",
+			"password": "some-password",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		req := newRequest("/api/v1/toggle")
+		req.AddCookie(&http.Cookie{Name: "session", Value: value})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(sources).To(Equal([]events.Source{{User: "some-user", ClientIP: "192.168.1.10"}}))
+	})
+
+	It("redirects requests with invalid credentials and records the failed login", func() {
+		req := newRequest("/api/v1/toggle")
+		req.SetBasicAuth("some-user", "wrong")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusFound))
+		Expect(served).To(BeZero())
+		Expect(fakeRecorder.RecordCallCount()).To(Equal(1))
+	})
+
+	It("allows unauthenticated requests for health checks", func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest("/healthz"))
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest("/readyz"))
+
+		Expect(served).To(Equal(2))
+	})
+})
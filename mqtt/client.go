@@ -0,0 +1,411 @@
+// Package mqtt implements an MQTT 3.1.1 client which publishes at QoS 0 and
+// subscribes at QoS 1, reconnecting to the broker whenever the connection is lost.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+	"github.com/tedsuo/ifrit"
+)
+
+const (
+	DefaultKeepAlive  = 30 * time.Second
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 2 * time.Minute
+
+	dialTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// ErrNotConnected is returned when publishing while there is no connection to the broker.
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+type Options struct {
+	// Broker is the URL of the broker, e.g. tcp://localhost:1883 or tls://broker:8883.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+
+	// Will is published by the broker if the connection is lost, and by the
+	// client itself before disconnecting, so that subscribers see the same
+	// message however the client goes away.
+	Will *Message
+
+	// KeepAlive is how often the broker is pinged.
+	KeepAlive time.Duration
+
+	// The delay before reconnecting doubles from MinBackoff up to MaxBackoff
+	// while connecting fails.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+//go:generate counterfeiter . Client
+
+// Client is connected to the broker while it runs.
+type Client interface {
+	ifrit.Runner
+
+	// Handle subscribes to topic, which may not contain wildcards.
+	// Handle and OnConnect must be called before the client runs.
+	// Handlers are called one at a time.
+	Handle(topic string, handler func(m Message))
+
+	// OnConnect registers f to be called each time the client connects.
+	OnConnect(f func())
+
+	Publish(m Message) error
+}
+
+type client struct {
+	logger  lager.Logger
+	options Options
+	address string
+	tls     bool
+
+	handlers  map[string]func(m Message)
+	onConnect []func()
+
+	mutex    sync.Mutex
+	conn     *connection
+	packetID uint16
+}
+
+// NewClient returns an error if the broker URL is invalid. Zero durations
+// in options are replaced with their defaults.
+func NewClient(logger lager.Logger, options Options) (Client, error) {
+	u, err := url.Parse(options.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{
+		logger:   logger.Session("mqtt", lager.Data{"broker": options.Broker}),
+		options:  options,
+		address:  u.Host,
+		handlers: map[string]func(m Message){},
+	}
+
+	defaultPort := "1883"
+	switch u.Scheme {
+	case "tcp":
+	case "tls":
+		c.tls = true
+		defaultPort = "8883"
+	default:
+		return nil, fmt.Errorf("invalid MQTT broker: %s - scheme must be tcp or tls", options.Broker)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker: %s - host required", options.Broker)
+	}
+	if _, _, err := net.SplitHostPort(u.Host); err != nil {
+		c.address = net.JoinHostPort(u.Host, defaultPort)
+	}
+
+	if options.ClientID == "" {
+		return nil, errors.New("MQTT client ID required")
+	}
+
+	if c.options.KeepAlive <= 0 {
+		c.options.KeepAlive = DefaultKeepAlive
+	}
+	if c.options.MinBackoff <= 0 {
+		c.options.MinBackoff = DefaultMinBackoff
+	}
+	if c.options.MaxBackoff < c.options.MinBackoff {
+		c.options.MaxBackoff = DefaultMaxBackoff
+		if c.options.MaxBackoff < c.options.MinBackoff {
+			c.options.MaxBackoff = c.options.MinBackoff
+		}
+	}
+
+	return c, nil
+}
+
+func (c *client) Handle(topic string, handler func(m Message)) {
+	c.handlers[topic] = handler
+}
+
+func (c *client) OnConnect(f func()) {
+	c.onConnect = append(c.onConnect, f)
+}
+
+func (c *client) Publish(m Message) error {
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	return conn.write(publishPacket(m))
+}
+
+// Run does not wait for a connection before becoming ready.
+func (c *client) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+
+	backoff := c.options.MinBackoff
+
+	for {
+		conn, err := c.connect()
+		if err == nil {
+			c.logger.Info("connected to broker")
+			connectedAt := time.Now()
+
+			if c.serve(conn, signals) {
+				return nil
+			}
+
+			// Only reset the backoff once a connection has proved stable,
+			// so that a broker which drops every connection is not hammered.
+			if time.Since(connectedAt) > c.options.MaxBackoff {
+				backoff = c.options.MinBackoff
+			}
+		} else {
+			c.logger.Error("error connecting to broker", err, lager.Data{"retryIn": backoff.String()})
+		}
+
+		select {
+		case <-signals:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+type connection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+
+	pingMutex       sync.Mutex
+	pingOutstanding bool
+}
+
+func (c *client) connect() (*connection, error) {
+	var conn net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if c.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.address, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", c.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keepAlive := uint16(c.options.KeepAlive / time.Second)
+	if keepAlive == 0 {
+		keepAlive = 1
+	}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	_, err = conn.Write(connectPacket(c.options, keepAlive).bytes())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	p, err := readPacket(reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if p.kind != packetConnack || len(p.body) != 2 {
+		conn.Close()
+		return nil, errors.New("broker did not acknowledge connection")
+	}
+
+	if code := p.body[1]; code != 0 {
+		conn.Close()
+		reason, ok := connectReturnCodes[code]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", code)
+		}
+		return nil, fmt.Errorf("broker refused connection: %s", reason)
+	}
+
+	return &connection{
+		conn:   conn,
+		reader: reader,
+	}, nil
+}
+
+// serve returns true if it returns because the client was signalled,
+// and false if the connection was lost.
+func (c *client) serve(conn *connection, signals <-chan os.Signal) bool {
+	c.mutex.Lock()
+	c.conn = conn
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.conn = nil
+		c.mutex.Unlock()
+
+		conn.conn.Close()
+	}()
+
+	readErrs := make(chan error, 1)
+	go func() {
+		readErrs <- c.read(conn)
+	}()
+
+	if len(c.handlers) > 0 {
+		var topics []string
+		for t := range c.handlers {
+			topics = append(topics, t)
+		}
+
+		err := conn.write(subscribePacket(c.nextPacketID(), topics))
+		if err != nil {
+			c.logger.Error("error subscribing", err)
+			return false
+		}
+	}
+
+	for _, f := range c.onConnect {
+		f()
+	}
+
+	ticker := time.NewTicker(c.options.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			if c.options.Will != nil {
+				conn.write(publishPacket(*c.options.Will))
+			}
+			conn.write(packet{kind: packetDisconnect})
+			c.logger.Info("disconnected from broker")
+			return true
+
+		case err := <-readErrs:
+			c.logger.Error("connection to broker lost", err)
+			return false
+
+		case <-ticker.C:
+			if conn.awaitingPing() {
+				c.logger.Error("connection to broker lost", errors.New("broker did not respond to ping"))
+				return false
+			}
+
+			err := conn.write(packet{kind: packetPingreq})
+			if err != nil {
+				c.logger.Error("connection to broker lost", err)
+				return false
+			}
+		}
+	}
+}
+
+// read dispatches messages until reading from the connection fails.
+func (c *client) read(conn *connection) error {
+	for {
+		p, err := readPacket(conn.reader)
+		if err != nil {
+			return err
+		}
+
+		switch p.kind {
+		case packetPublish:
+			m, id, qos, err := parsePublish(p)
+			if err != nil {
+				return err
+			}
+
+			if qos > 0 {
+				err = conn.write(packet{kind: packetPuback, body: appendUint16(nil, id)})
+				if err != nil {
+					return err
+				}
+			}
+
+			handler, ok := c.handlers[m.Topic]
+			if !ok {
+				c.logger.Debug("ignoring message", lager.Data{"topic": m.Topic})
+				continue
+			}
+			handler(m)
+
+		case packetSuback:
+			if len(p.body) < 2 {
+				return errors.New("malformed packet")
+			}
+			for _, code := range p.body[2:] {
+				if code == 0x80 {
+					c.logger.Error("broker rejected subscription", nil)
+				}
+			}
+
+		case packetPingresp:
+			conn.pingMutex.Lock()
+			conn.pingOutstanding = false
+			conn.pingMutex.Unlock()
+		}
+	}
+}
+
+func (c *client) nextPacketID() uint16 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.packetID++
+	if c.packetID == 0 {
+		c.packetID = 1
+	}
+	return c.packetID
+}
+
+// awaitingPing reports whether the last ping is unanswered,
+// and otherwise records that a ping is about to be sent.
+func (conn *connection) awaitingPing() bool {
+	conn.pingMutex.Lock()
+	defer conn.pingMutex.Unlock()
+
+	if conn.pingOutstanding {
+		return true
+	}
+	conn.pingOutstanding = true
+	return false
+}
+
+func (conn *connection) write(p packet) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+
+	conn.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := conn.conn.Write(p.bytes())
+	return err
+}
@@ -0,0 +1,218 @@
+package mqtt_test
+
+import (
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/mqtt"
+	"github.com/robdimsdale/garagepi/mqtt/mqtttest"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		logger  *lagertest.TestLogger
+		broker  *mqtttest.Broker
+		options mqtt.Options
+
+		client  mqtt.Client
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("mqtt test")
+
+		var err error
+		broker, err = mqtttest.NewBroker()
+		Expect(err).NotTo(HaveOccurred())
+
+		options = mqtt.Options{
+			Broker:   broker.URL(),
+			ClientID: "garagepi",
+			Will: &mqtt.Message{
+				Topic:   "garagepi/availability",
+				Payload: []byte("offline"),
+				Retain:  true,
+			},
+			KeepAlive:  time.Second,
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 40 * time.Millisecond,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		client, err = mqtt.NewClient(logger, options)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// run registers an availability message on connect, so that
+	// specs can wait for the client to be connected.
+	run := func() {
+		client.OnConnect(func() {
+			client.Publish(mqtt.Message{
+				Topic:   "garagepi/availability",
+				Payload: []byte("online"),
+				Retain:  true,
+			})
+		})
+		process = ifrit.Invoke(client)
+	}
+
+	online := func() string {
+		m, _ := broker.Retained("garagepi/availability")
+		return m.Payload
+	}
+
+	AfterEach(func() {
+		if process != nil {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			process = nil
+		}
+		broker.Close()
+	})
+
+	It("connects with the client ID and will", func() {
+		run()
+		Eventually(online).Should(Equal("online"))
+
+		connects := broker.Connects()
+		Expect(connects).To(HaveLen(1))
+		Expect(connects[0].ClientID).To(Equal("garagepi"))
+		Expect(connects[0].KeepAlive).To(Equal(uint16(1)))
+		Expect(connects[0].Will).To(Equal(&mqtttest.Message{
+			Topic:   "garagepi/availability",
+			Payload: "offline",
+			Retain:  true,
+		}))
+	})
+
+	It("returns an error when publishing while not connected", func() {
+		err := client.Publish(mqtt.Message{Topic: "garagepi/light/state"})
+		Expect(err).To(Equal(mqtt.ErrNotConnected))
+	})
+
+	It("publishes messages", func() {
+		run()
+		Eventually(online).Should(Equal("online"))
+
+		err := client.Publish(mqtt.Message{Topic: "garagepi/light/state", Payload: []byte("ON")})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(broker.Published).Should(ContainElement(mqtttest.Message{
+			Topic:   "garagepi/light/state",
+			Payload: "ON",
+		}))
+	})
+
+	It("delivers messages on subscribed topics to their handlers", func() {
+		received := make(chan mqtt.Message, 1)
+		client.Handle("garagepi/light/set", func(m mqtt.Message) {
+			received <- m
+		})
+		run()
+
+		Eventually(func() bool {
+			return broker.Subscribed("garagepi/light/set")
+		}).Should(BeTrue())
+
+		broker.Publish(mqtttest.Message{Topic: "garagepi/other", Payload: "ignored"})
+		broker.Publish(mqtttest.Message{Topic: "garagepi/light/set", Payload: "ON"})
+
+		Eventually(received).Should(Receive(Equal(mqtt.Message{
+			Topic:   "garagepi/light/set",
+			Payload: []byte("ON"),
+		})))
+		Consistently(received).ShouldNot(Receive())
+	})
+
+	It("publishes its will before disconnecting", func() {
+		run()
+		Eventually(online).Should(Equal("online"))
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+		process = nil
+
+		Expect(online()).To(Equal("offline"))
+		Eventually(logger).Should(gbytes.Say("disconnected from broker"))
+	})
+
+	It("reconnects when the connection is lost", func() {
+		run()
+		Eventually(online).Should(Equal("online"))
+
+		broker.DropClients()
+		Eventually(logger).Should(gbytes.Say("connection to broker lost"))
+
+		Eventually(broker.Connects).Should(HaveLen(2))
+		Eventually(online).Should(Equal("online"))
+
+		Expect(broker.Published()).To(ContainElement(mqtttest.Message{
+			Topic:   "garagepi/availability",
+			Payload: "offline",
+			Retain:  true,
+		}))
+	})
+
+	Context("when the broker requires credentials", func() {
+		BeforeEach(func() {
+			broker.RequireCredentials("some-user", "some-password")
+		})
+
+		Context("with valid credentials", func() {
+			BeforeEach(func() {
+				options.Username = "some-user"
+				options.Password = "some-password"
+			})
+
+			It("connects with the username and password", func() {
+				run()
+				Eventually(online).Should(Equal("online"))
+
+				connects := broker.Connects()
+				Expect(connects[0].Username).To(Equal("some-user"))
+				Expect(connects[0].Password).To(Equal("some-password"))
+			})
+		})
+
+		Context("with invalid credentials", func() {
+			BeforeEach(func() {
+				options.Username = "some-user"
+				options.Password = "wrong-password"
+			})
+
+			It("retries with backoff", func() {
+				run()
+				Eventually(logger).Should(gbytes.Say("bad user name or password"))
+				Eventually(broker.Connects).Should(HaveLen(3))
+				Expect(online()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("NewClient", func() {
+		It("returns an error for an unsupported scheme", func() {
+			options.Broker = "http://localhost:1883"
+			_, err := mqtt.NewClient(logger, options)
+			Expect(err).To(MatchError(ContainSubstring("scheme must be tcp or tls")))
+		})
+
+		It("returns an error without a host", func() {
+			options.Broker = "tcp://"
+			_, err := mqtt.NewClient(logger, options)
+			Expect(err).To(MatchError(ContainSubstring("host required")))
+		})
+
+		It("returns an error without a client ID", func() {
+			options.ClientID = ""
+			_, err := mqtt.NewClient(logger, options)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,154 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"os"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/mqtt"
+)
+
+type FakeClient struct {
+	RunStub        func(signals <-chan os.Signal, ready chan<- struct{}) error
+	runMutex       sync.RWMutex
+	runArgsForCall []struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}
+	runReturns struct {
+		result1 error
+	}
+	HandleStub        func(topic string, handler func(m mqtt.Message))
+	handleMutex       sync.RWMutex
+	handleArgsForCall []struct {
+		topic   string
+		handler func(m mqtt.Message)
+	}
+	OnConnectStub        func(f func())
+	onConnectMutex       sync.RWMutex
+	onConnectArgsForCall []struct {
+		f func()
+	}
+	PublishStub        func(m mqtt.Message) error
+	publishMutex       sync.RWMutex
+	publishArgsForCall []struct {
+		m mqtt.Message
+	}
+	publishReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeClient) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	fake.runMutex.Lock()
+	fake.runArgsForCall = append(fake.runArgsForCall, struct {
+		signals <-chan os.Signal
+		ready   chan<- struct{}
+	}{signals, ready})
+	fake.runMutex.Unlock()
+	if fake.RunStub != nil {
+		return fake.RunStub(signals, ready)
+	} else {
+		return fake.runReturns.result1
+	}
+}
+
+func (fake *FakeClient) RunCallCount() int {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return len(fake.runArgsForCall)
+}
+
+func (fake *FakeClient) RunArgsForCall(i int) (<-chan os.Signal, chan<- struct{}) {
+	fake.runMutex.RLock()
+	defer fake.runMutex.RUnlock()
+	return fake.runArgsForCall[i].signals, fake.runArgsForCall[i].ready
+}
+
+func (fake *FakeClient) RunReturns(result1 error) {
+	fake.RunStub = nil
+	fake.runReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Handle(topic string, handler func(m mqtt.Message)) {
+	fake.handleMutex.Lock()
+	fake.handleArgsForCall = append(fake.handleArgsForCall, struct {
+		topic   string
+		handler func(m mqtt.Message)
+	}{topic, handler})
+	fake.handleMutex.Unlock()
+	if fake.HandleStub != nil {
+		fake.HandleStub(topic, handler)
+	}
+}
+
+func (fake *FakeClient) HandleCallCount() int {
+	fake.handleMutex.RLock()
+	defer fake.handleMutex.RUnlock()
+	return len(fake.handleArgsForCall)
+}
+
+func (fake *FakeClient) HandleArgsForCall(i int) (string, func(m mqtt.Message)) {
+	fake.handleMutex.RLock()
+	defer fake.handleMutex.RUnlock()
+	return fake.handleArgsForCall[i].topic, fake.handleArgsForCall[i].handler
+}
+
+func (fake *FakeClient) OnConnect(f func()) {
+	fake.onConnectMutex.Lock()
+	fake.onConnectArgsForCall = append(fake.onConnectArgsForCall, struct {
+		f func()
+	}{f})
+	fake.onConnectMutex.Unlock()
+	if fake.OnConnectStub != nil {
+		fake.OnConnectStub(f)
+	}
+}
+
+func (fake *FakeClient) OnConnectCallCount() int {
+	fake.onConnectMutex.RLock()
+	defer fake.onConnectMutex.RUnlock()
+	return len(fake.onConnectArgsForCall)
+}
+
+func (fake *FakeClient) OnConnectArgsForCall(i int) func() {
+	fake.onConnectMutex.RLock()
+	defer fake.onConnectMutex.RUnlock()
+	return fake.onConnectArgsForCall[i].f
+}
+
+func (fake *FakeClient) Publish(m mqtt.Message) error {
+	fake.publishMutex.Lock()
+	fake.publishArgsForCall = append(fake.publishArgsForCall, struct {
+		m mqtt.Message
+	}{m})
+	fake.publishMutex.Unlock()
+	if fake.PublishStub != nil {
+		return fake.PublishStub(m)
+	} else {
+		return fake.publishReturns.result1
+	}
+}
+
+func (fake *FakeClient) PublishCallCount() int {
+	fake.publishMutex.RLock()
+	defer fake.publishMutex.RUnlock()
+	return len(fake.publishArgsForCall)
+}
+
+func (fake *FakeClient) PublishArgsForCall(i int) mqtt.Message {
+	fake.publishMutex.RLock()
+	defer fake.publishMutex.RUnlock()
+	return fake.publishArgsForCall[i].m
+}
+
+func (fake *FakeClient) PublishReturns(result1 error) {
+	fake.PublishStub = nil
+	fake.publishReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ mqtt.Client = new(FakeClient)
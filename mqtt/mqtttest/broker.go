@@ -0,0 +1,424 @@
+// Package mqtttest provides an in-process MQTT 3.1.1 broker for tests.
+// It is implemented independently of package mqtt so that each can be
+// tested against the other.
+package mqtttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+type Message struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+// Connect records the CONNECT packet of a client.
+type Connect struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive uint16
+	Will      *Message
+}
+
+// Broker delivers messages to subscribers of their exact topic, retains
+// messages and publishes the wills of clients whose connections are lost.
+// Messages are delivered to subscribers at QoS 1.
+type Broker struct {
+	listener net.Listener
+
+	mutex     sync.Mutex
+	username  string
+	password  string
+	clients   map[*brokerClient]struct{}
+	connects  []Connect
+	published []Message
+	retained  map[string]Message
+	packetID  uint16
+}
+
+type brokerClient struct {
+	conn          net.Conn
+	writeMutex    sync.Mutex
+	will          *Message
+	subscriptions map[string]bool
+}
+
+// NewBroker returns a broker listening on a local port.
+func NewBroker() (*Broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Broker{
+		listener: listener,
+		clients:  map[*brokerClient]struct{}{},
+		retained: map[string]Message{},
+	}
+
+	go b.accept()
+	return b, nil
+}
+
+// URL is the URL clients connect to, e.g. tcp://127.0.0.1:61234.
+func (b *Broker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// RequireCredentials refuses connections without the username and password.
+func (b *Broker) RequireCredentials(username string, password string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.username = username
+	b.password = password
+}
+
+// Close stops listening and closes the connections of all clients
+// without publishing their wills.
+func (b *Broker) Close() {
+	b.listener.Close()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for c := range b.clients {
+		c.will = nil
+		c.conn.Close()
+	}
+}
+
+// DropClients closes the connections of all clients, as if they were lost.
+func (b *Broker) DropClients() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for c := range b.clients {
+		c.conn.Close()
+	}
+}
+
+// Connects returns the CONNECT packets received, in order.
+func (b *Broker) Connects() []Connect {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]Connect{}, b.connects...)
+}
+
+// Published returns the messages published by clients, in order,
+// including wills.
+func (b *Broker) Published() []Message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]Message{}, b.published...)
+}
+
+// Retained returns the retained message of topic.
+func (b *Broker) Retained(topic string) (Message, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	m, ok := b.retained[topic]
+	return m, ok
+}
+
+// Subscribed reports whether any client is subscribed to topic.
+func (b *Broker) Subscribed(topic string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for c := range b.clients {
+		if c.subscriptions[topic] {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish delivers a message to subscribers as if it were published by a client.
+func (b *Broker) Publish(m Message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.deliver(m)
+}
+
+func (b *Broker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(conn)
+	}
+}
+
+func (b *Broker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	c := &brokerClient{
+		conn:          conn,
+		subscriptions: map[string]bool{},
+	}
+	r := bufio.NewReader(conn)
+
+	kind, _, body, err := readPacket(r)
+	if err != nil || kind != 1 {
+		return
+	}
+
+	connect, err := parseConnect(body)
+	if err != nil {
+		return
+	}
+
+	b.mutex.Lock()
+	b.connects = append(b.connects, connect)
+	refused := b.username != "" && (connect.Username != b.username || connect.Password != b.password)
+	if !refused {
+		c.will = connect.Will
+		b.clients[c] = struct{}{}
+	}
+	b.mutex.Unlock()
+
+	if refused {
+		c.write(2, 0, []byte{0, 4}) // bad user name or password
+		return
+	}
+	c.write(2, 0, []byte{0, 0})
+
+	err = b.read(c, r)
+
+	b.mutex.Lock()
+	delete(b.clients, c)
+	if err != nil && c.will != nil {
+		b.published = append(b.published, *c.will)
+		b.deliver(*c.will)
+	}
+	b.mutex.Unlock()
+}
+
+// read returns nil once the client disconnects cleanly.
+func (b *Broker) read(c *brokerClient, r *bufio.Reader) error {
+	for {
+		kind, flags, body, err := readPacket(r)
+		if err != nil {
+			return err
+		}
+
+		switch kind {
+		case 3: // PUBLISH
+			topic, rest, err := readString(body)
+			if err != nil {
+				return err
+			}
+
+			if qos := (flags >> 1) & 0x03; qos > 0 {
+				if len(rest) < 2 {
+					return errors.New("malformed publish")
+				}
+				c.write(4, 0, rest[:2])
+				rest = rest[2:]
+			}
+
+			m := Message{Topic: topic, Payload: string(rest), Retain: flags&0x01 != 0}
+
+			b.mutex.Lock()
+			b.published = append(b.published, m)
+			b.deliver(m)
+			b.mutex.Unlock()
+
+		case 8: // SUBSCRIBE
+			if len(body) < 2 {
+				return errors.New("malformed subscribe")
+			}
+			id, rest := body[:2], body[2:]
+
+			var topics []string
+			for len(rest) > 0 {
+				var topic string
+				topic, rest, err = readString(rest)
+				if err != nil || len(rest) < 1 {
+					return errors.New("malformed subscribe")
+				}
+				rest = rest[1:]
+				topics = append(topics, topic)
+			}
+
+			granted := append([]byte{}, id...)
+			b.mutex.Lock()
+			for _, t := range topics {
+				c.subscriptions[t] = true
+				granted = append(granted, 1)
+			}
+			b.mutex.Unlock()
+			c.write(9, 0, granted)
+
+			b.mutex.Lock()
+			for _, t := range topics {
+				if m, ok := b.retained[t]; ok {
+					b.send(c, m)
+				}
+			}
+			b.mutex.Unlock()
+
+		case 12: // PINGREQ
+			c.write(13, 0, nil)
+
+		case 14: // DISCONNECT
+			return nil
+		}
+	}
+}
+
+// deliver must be called with the mutex held.
+func (b *Broker) deliver(m Message) {
+	if m.Retain {
+		if m.Payload == "" {
+			delete(b.retained, m.Topic)
+		} else {
+			b.retained[m.Topic] = m
+		}
+	}
+
+	for c := range b.clients {
+		if c.subscriptions[m.Topic] {
+			b.send(c, Message{Topic: m.Topic, Payload: m.Payload})
+		}
+	}
+}
+
+// send must be called with the mutex held.
+func (b *Broker) send(c *brokerClient, m Message) {
+	b.packetID++
+
+	body := appendString(nil, m.Topic)
+	body = append(body, byte(b.packetID>>8), byte(b.packetID))
+	body = append(body, m.Payload...)
+
+	flags := byte(0x02) // QoS 1
+	if m.Retain {
+		flags |= 0x01
+	}
+
+	c.write(3, flags, body)
+}
+
+func (c *brokerClient) write(kind byte, flags byte, body []byte) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	b := []byte{kind<<4 | flags}
+	length := len(body)
+	for {
+		digit := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	c.conn.Write(append(b, body...))
+}
+
+func readPacket(r *bufio.Reader) (byte, byte, []byte, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	length, shift := 0, uint(0)
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, 0, nil, errors.New("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return first >> 4, first & 0x0f, body, err
+}
+
+func parseConnect(body []byte) (Connect, error) {
+	protocol, rest, err := readString(body)
+	if err != nil || protocol != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+		return Connect{}, errors.New("unsupported protocol")
+	}
+
+	flags := rest[1]
+	connect := Connect{KeepAlive: binary.BigEndian.Uint16(rest[2:4])}
+	rest = rest[4:]
+
+	connect.ClientID, rest, err = readString(rest)
+	if err != nil {
+		return Connect{}, err
+	}
+
+	if flags&0x04 != 0 {
+		var topic, payload string
+		topic, rest, err = readString(rest)
+		if err == nil {
+			payload, rest, err = readString(rest)
+		}
+		if err != nil {
+			return Connect{}, err
+		}
+		connect.Will = &Message{Topic: topic, Payload: payload, Retain: flags&0x20 != 0}
+	}
+
+	if flags&0x80 != 0 {
+		connect.Username, rest, err = readString(rest)
+		if err != nil {
+			return Connect{}, err
+		}
+	}
+
+	if flags&0x40 != 0 {
+		connect.Password, rest, err = readString(rest)
+		if err != nil {
+			return Connect{}, err
+		}
+	}
+
+	return connect, nil
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+
+	length := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+length {
+		return "", nil, errors.New("malformed string")
+	}
+
+	return string(b[2 : 2+length]), b[2+length:], nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
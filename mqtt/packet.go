@@ -0,0 +1,228 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types.
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxPacketSize is the size of the largest packet which may be read.
+const maxPacketSize = 256 * 1024
+
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	// The remaining length is encoded in up to four bytes, seven bits at a time.
+	length := 0
+	for i := uint(0); ; i++ {
+		if i == 4 {
+			return packet{}, errors.New("invalid remaining length")
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+
+		length |= int(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf("packet too large: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return packet{}, err
+	}
+
+	return packet{
+		kind:  first >> 4,
+		flags: first & 0x0f,
+		body:  body,
+	}, nil
+}
+
+func (p packet) bytes() []byte {
+	b := []byte{p.kind<<4 | p.flags}
+
+	length := len(p.body)
+	for {
+		digit := byte(length & 0x7f)
+		length >>= 7
+		if length > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	return append(b, p.body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// reader decodes the fields of a packet body.
+type reader struct {
+	body []byte
+	err  error
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.body) < 2 {
+		r.err = errors.New("malformed packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.body)
+	r.body = r.body[2:]
+	return v
+}
+
+func (r *reader) string() string {
+	length := int(r.uint16())
+	if r.err != nil {
+		return ""
+	}
+	if len(r.body) < length {
+		r.err = errors.New("malformed packet")
+		return ""
+	}
+	s := string(r.body[:length])
+	r.body = r.body[length:]
+	return s
+}
+
+func connectPacket(o Options, keepAliveSeconds uint16) packet {
+	body := appendString(nil, "MQTT")
+	body = append(body, 4) // protocol level 3.1.1
+
+	flags := byte(0x02) // clean session
+	if o.Will != nil {
+		flags |= 0x04
+		if o.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if o.Username != "" {
+		flags |= 0x80
+		if o.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, flags)
+	body = appendUint16(body, keepAliveSeconds)
+
+	body = appendString(body, o.ClientID)
+	if o.Will != nil {
+		body = appendString(body, o.Will.Topic)
+		body = appendBytes(body, o.Will.Payload)
+	}
+	if o.Username != "" {
+		body = appendString(body, o.Username)
+		if o.Password != "" {
+			body = appendString(body, o.Password)
+		}
+	}
+
+	return packet{kind: packetConnect, body: body}
+}
+
+// publishPacket returns a QoS 0 PUBLISH packet.
+func publishPacket(m Message) packet {
+	var flags byte
+	if m.Retain {
+		flags |= 0x01
+	}
+
+	body := appendString(nil, m.Topic)
+	body = append(body, m.Payload...)
+
+	return packet{kind: packetPublish, flags: flags, body: body}
+}
+
+// subscribePacket requests QoS 1 for each topic.
+func subscribePacket(id uint16, topics []string) packet {
+	body := appendUint16(nil, id)
+	for _, t := range topics {
+		body = appendString(body, t)
+		body = append(body, 1)
+	}
+
+	return packet{kind: packetSubscribe, flags: 0x02, body: body}
+}
+
+// parsePublish returns the message of a PUBLISH packet, and its packet ID
+// if its QoS is greater than 0.
+func parsePublish(p packet) (Message, uint16, byte, error) {
+	qos := (p.flags >> 1) & 0x03
+
+	r := &reader{body: p.body}
+	topic := r.string()
+
+	var id uint16
+	if qos > 0 {
+		id = r.uint16()
+	}
+
+	if r.err != nil {
+		return Message{}, 0, 0, r.err
+	}
+
+	return Message{
+		Topic:   topic,
+		Payload: r.body,
+		Retain:  p.flags&0x01 != 0,
+	}, id, qos, nil
+}
+
+var connectReturnCodes = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
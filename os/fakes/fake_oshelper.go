@@ -14,6 +14,12 @@ type FakeOSHelper struct {
 	sleepArgsForCall []struct {
 		d time.Duration
 	}
+	NowStub        func() time.Time
+	nowMutex       sync.RWMutex
+	nowArgsForCall []struct{}
+	nowReturns     struct {
+		result1 time.Time
+	}
 }
 
 func (fake *FakeOSHelper) Sleep(d time.Duration) {
@@ -39,4 +45,28 @@ func (fake *FakeOSHelper) SleepArgsForCall(i int) time.Duration {
 	return fake.sleepArgsForCall[i].d
 }
 
+func (fake *FakeOSHelper) Now() time.Time {
+	fake.nowMutex.Lock()
+	fake.nowArgsForCall = append(fake.nowArgsForCall, struct{}{})
+	fake.nowMutex.Unlock()
+	if fake.NowStub != nil {
+		return fake.NowStub()
+	} else {
+		return fake.nowReturns.result1
+	}
+}
+
+func (fake *FakeOSHelper) NowCallCount() int {
+	fake.nowMutex.RLock()
+	defer fake.nowMutex.RUnlock()
+	return len(fake.nowArgsForCall)
+}
+
+func (fake *FakeOSHelper) NowReturns(result1 time.Time) {
+	fake.NowStub = nil
+	fake.nowReturns = struct {
+		result1 time.Time
+	}{result1}
+}
+
 var _ os.OSHelper = new(FakeOSHelper)
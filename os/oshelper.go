@@ -10,6 +10,7 @@ import (
 
 type OSHelper interface {
 	Sleep(d time.Duration)
+	Now() time.Time
 }
 
 type osHelper struct {
@@ -28,3 +29,7 @@ func (h *osHelper) Sleep(d time.Duration) {
 	h.logger.Info("sleeping", lager.Data{"duration": d.String()})
 	time.Sleep(d)
 }
+
+func (h *osHelper) Now() time.Time {
+	return time.Now()
+}
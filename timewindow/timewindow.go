@@ -0,0 +1,87 @@
+package timewindow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily window between two times of day.
+// A window whose end is before its start wraps around midnight, e.g. 22:00-06:00.
+// A window whose start and end are equal covers the whole day.
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Parse parses a window of the form HH:MM-HH:MM.
+func Parse(s string) (TimeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return TimeWindow{}, fmt.Errorf("invalid time window: %s", s)
+	}
+
+	start, err := ParseTimeOfDay(parts[0])
+	if err != nil {
+		return TimeWindow{}, err
+	}
+
+	end, err := ParseTimeOfDay(parts[1])
+	if err != nil {
+		return TimeWindow{}, err
+	}
+
+	return TimeWindow{
+		Start: start,
+		End:   end,
+	}, nil
+}
+
+// ParseTimeOfDay parses a time of day of the form HH:MM into its offset from midnight.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls within the window, using the location of t.
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+
+	switch {
+	case w.Start == w.End:
+		return true
+	case w.Start < w.End:
+		return offset >= w.Start && offset < w.End
+	default:
+		return offset >= w.Start || offset < w.End
+	}
+}
+
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%s-%s", FormatTimeOfDay(w.Start), FormatTimeOfDay(w.End))
+}
+
+func (w TimeWindow) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *TimeWindow) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*w = parsed
+	return nil
+}
+
+// FormatTimeOfDay formats an offset from midnight as HH:MM.
+func FormatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int((d%time.Hour)/time.Minute))
+}
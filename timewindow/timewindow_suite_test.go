@@ -0,0 +1,13 @@
+package timewindow_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTimewindow(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Timewindow Suite")
+}
@@ -0,0 +1,79 @@
+package timewindow_test
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/timewindow"
+)
+
+var _ = Describe("TimeWindow", func() {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2016, 1, 2, hour, minute, 0, 0, time.UTC)
+	}
+
+	Describe("Parsing", func() {
+		It("Should parse start and end times of day", func() {
+			w, err := timewindow.Parse("22:00-06:30")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Start).To(Equal(22 * time.Hour))
+			Expect(w.End).To(Equal(6*time.Hour + 30*time.Minute))
+			Expect(w.String()).To(Equal("22:00-06:30"))
+		})
+
+		It("Should return an error for a missing end", func() {
+			_, err := timewindow.Parse("22:00")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should return an error for an invalid time of day", func() {
+			_, err := timewindow.Parse("25:00-06:00")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should round-trip through JSON", func() {
+			w, err := timewindow.Parse("08:15-17:45")
+			Expect(err).NotTo(HaveOccurred())
+
+			b, err := json.Marshal(w)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(b)).To(Equal(`"08:15-17:45"`))
+
+			var unmarshalled timewindow.TimeWindow
+			Expect(json.Unmarshal(b, &unmarshalled)).To(Succeed())
+			Expect(unmarshalled).To(Equal(w))
+		})
+	})
+
+	Describe("Containing a time", func() {
+		It("Should contain times within a same-day window", func() {
+			w, err := timewindow.Parse("08:00-17:00")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(w.Contains(at(8, 0))).To(BeTrue())
+			Expect(w.Contains(at(12, 30))).To(BeTrue())
+			Expect(w.Contains(at(17, 0))).To(BeFalse())
+			Expect(w.Contains(at(7, 59))).To(BeFalse())
+		})
+
+		It("Should contain times either side of midnight for a wrapping window", func() {
+			w, err := timewindow.Parse("22:00-06:00")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(w.Contains(at(23, 0))).To(BeTrue())
+			Expect(w.Contains(at(0, 0))).To(BeTrue())
+			Expect(w.Contains(at(5, 59))).To(BeTrue())
+			Expect(w.Contains(at(6, 0))).To(BeFalse())
+			Expect(w.Contains(at(12, 0))).To(BeFalse())
+		})
+
+		It("Should contain all times when start and end are equal", func() {
+			w, err := timewindow.Parse("00:00-00:00")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(w.Contains(at(13, 0))).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,14 @@
+"use strict";
+
+$(document).ready(function(){
+
+  function setPin(pin, level) {
+    $.post("/api/v1/dev/gpio/" + pin + "?level=" + level, function() {
+      location.reload();
+    });
+  }
+
+  $(".btn-pin-set").on("click", function() {
+    setPin($(this).data("pin"), $(this).data("level"));
+  });
+});
@@ -4,10 +4,21 @@ $(document).ready(function(){
 
   var $btnLight = $("#btnLight");
 
+  var $lightTimer = $("#lightTimer");
+
   var lightOn = ($btnLight.text() == "Turn Off Light");
 
-  function toggleGarageDoor() {
-    $.post("/api/v1/toggle");
+  var lightRemaining = parseInt($lightTimer.data("remaining"), 10) || 0;
+
+  function toggleGarageDoor(name) {
+    $.post("/api/v1/doors/" + encodeURIComponent(name) + "/toggle")
+      .fail(function(xhr) {
+        try {
+          alert($.parseJSON(xhr.responseText).errorMsg);
+        } catch (e) {
+          alert("Door not toggled");
+        }
+      });
   }
 
   function turnLightOn() {
@@ -28,13 +39,66 @@ $(document).ready(function(){
       $btnLight.text("Turn On Light");
     }
 
-    if (!data.StateKnown) {
-      $btnLight.prop('disabled', true);
+    $btnLight.prop('disabled', !data.StateKnown);
+
+    lightRemaining = data.RemainingSeconds || 0;
+    renderLightTimer();
+  }
+
+  function renderLightTimer() {
+    if (!lightOn || lightRemaining <= 0) {
+      $lightTimer.text("");
+      return;
+    }
+
+    var minutes = Math.floor(lightRemaining / 60);
+    var seconds = lightRemaining % 60;
+    $lightTimer.text("Light turns off in " + minutes + ":" + (seconds < 10 ? "0" : "") + seconds);
+  }
+
+  function renderDoorState(data) {
+    var $doorState = $(document.getElementById("doorState-" + data.name));
+    if (data.state == "unknown") {
+      $doorState.text("");
+    } else {
+      $doorState.text($doorState.data("label") + " is " + data.state);
     }
+
+    var $doorInterlock = $(document.getElementById("doorInterlock-" + data.name));
+    $doorInterlock.empty();
+    $.each(data.interlocks || [], function(i, interlock) {
+      if (interlock.active) {
+        $("<p>").text("Interlock " + interlock.name + " is active (" + interlock.policy + ")").appendTo($doorInterlock);
+      }
+    });
+    $doorInterlock.toggle($doorInterlock.children().length > 0);
   }
 
-  $("#btnDoorToggle").on("click", function() {
-    toggleGarageDoor();
+  // The stream sends the current state when it opens, including after
+  // reconnecting, and again each time the state changes.
+  if (window.EventSource) {
+    var stream = new EventSource("/api/v1/stream");
+
+    stream.addEventListener("light", function(e) {
+      parseLightState(e.data);
+    });
+
+    stream.addEventListener("door", function(e) {
+      renderDoorState($.parseJSON(e.data));
+    });
+  }
+
+  setInterval(function() {
+    if (lightRemaining > 0) {
+      lightRemaining--;
+      renderLightTimer();
+    }
+  }, 1000);
+
+  renderLightTimer();
+
+  $(".btn-door-toggle").on("click", function() {
+    toggleGarageDoor($(this).data("door"));
   });
 
   $btnLight.on("click", function() {
@@ -0,0 +1,13 @@
+package devgpio_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDevgpio(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Devgpio Suite")
+}
@@ -0,0 +1,104 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/robdimsdale/garagepi/web/devgpio"
+)
+
+type FakeHandler struct {
+	HandleStub        func(w http.ResponseWriter, r *http.Request)
+	handleMutex       sync.RWMutex
+	handleArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleGetStub        func(w http.ResponseWriter, r *http.Request)
+	handleGetMutex       sync.RWMutex
+	handleGetArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+	HandleSetStub        func(w http.ResponseWriter, r *http.Request)
+	handleSetMutex       sync.RWMutex
+	handleSetArgsForCall []struct {
+		w http.ResponseWriter
+		r *http.Request
+	}
+}
+
+func (fake *FakeHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	fake.handleMutex.Lock()
+	fake.handleArgsForCall = append(fake.handleArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleMutex.Unlock()
+	if fake.HandleStub != nil {
+		fake.HandleStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleCallCount() int {
+	fake.handleMutex.RLock()
+	defer fake.handleMutex.RUnlock()
+	return len(fake.handleArgsForCall)
+}
+
+func (fake *FakeHandler) HandleArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleMutex.RLock()
+	defer fake.handleMutex.RUnlock()
+	return fake.handleArgsForCall[i].w, fake.handleArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	fake.handleGetMutex.Lock()
+	fake.handleGetArgsForCall = append(fake.handleGetArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleGetMutex.Unlock()
+	if fake.HandleGetStub != nil {
+		fake.HandleGetStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleGetCallCount() int {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return len(fake.handleGetArgsForCall)
+}
+
+func (fake *FakeHandler) HandleGetArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleGetMutex.RLock()
+	defer fake.handleGetMutex.RUnlock()
+	return fake.handleGetArgsForCall[i].w, fake.handleGetArgsForCall[i].r
+}
+
+func (fake *FakeHandler) HandleSet(w http.ResponseWriter, r *http.Request) {
+	fake.handleSetMutex.Lock()
+	fake.handleSetArgsForCall = append(fake.handleSetArgsForCall, struct {
+		w http.ResponseWriter
+		r *http.Request
+	}{w, r})
+	fake.handleSetMutex.Unlock()
+	if fake.HandleSetStub != nil {
+		fake.HandleSetStub(w, r)
+	}
+}
+
+func (fake *FakeHandler) HandleSetCallCount() int {
+	fake.handleSetMutex.RLock()
+	defer fake.handleSetMutex.RUnlock()
+	return len(fake.handleSetArgsForCall)
+}
+
+func (fake *FakeHandler) HandleSetArgsForCall(i int) (http.ResponseWriter, *http.Request) {
+	fake.handleSetMutex.RLock()
+	defer fake.handleSetMutex.RUnlock()
+	return fake.handleSetArgsForCall[i].w, fake.handleSetArgsForCall[i].r
+}
+
+var _ devgpio.Handler = new(FakeHandler)
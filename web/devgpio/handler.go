@@ -0,0 +1,91 @@
+package devgpio
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/gpio/sim"
+)
+
+//go:generate counterfeiter . Handler
+
+// Handler serves a page and API for inspecting simulated pins and setting
+// the level of input pins by hand. It is only routed in dev mode.
+type Handler interface {
+	Handle(w http.ResponseWriter, r *http.Request)
+	HandleGet(w http.ResponseWriter, r *http.Request)
+	HandleSet(w http.ResponseWriter, r *http.Request)
+}
+
+type handler struct {
+	logger    lager.Logger
+	templates *template.Template
+	simulator sim.Simulator
+}
+
+func NewHandler(
+	logger lager.Logger,
+	templates *template.Template,
+	simulator sim.Simulator,
+) Handler {
+	return &handler{
+		logger:    logger,
+		templates: templates,
+		simulator: simulator,
+	}
+}
+
+type pageData struct {
+	Pins []sim.Pin
+}
+
+func (h handler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.templates.ExecuteTemplate(w, "devgpio", pageData{
+		Pins: h.simulator.Pins(),
+	})
+}
+
+func (h handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(h.simulator.Pins())
+	w.Write(b)
+}
+
+func (h handler) HandleSet(w http.ResponseWriter, r *http.Request) {
+	pin, err := strconv.ParseUint(mux.Vars(r)["pin"], 10, 32)
+	if err != nil {
+		h.logger.Info("invalid pin provided", lager.Data{"pin": mux.Vars(r)["pin"]})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var high bool
+	switch r.FormValue("level") {
+	case "high":
+		high = true
+	case "low":
+		high = false
+	default:
+		h.logger.Info("invalid level provided", lager.Data{"level": r.FormValue("level")})
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = h.simulator.Set(uint(pin), high)
+	if err == sim.ErrOutputPin {
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if err != nil {
+		h.logger.Error("error setting simulated pin", err, lager.Data{"pin": pin})
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, _ := json.Marshal(h.simulator.Pins())
+	w.Write(b)
+}
@@ -0,0 +1,97 @@
+package devgpio_test
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/gpio/sim"
+	"github.com/robdimsdale/garagepi/web/devgpio"
+)
+
+const pageTemplate = `
+{{define "devgpio"}}
+{{range .Pins}}pin {{.Pin}} is {{if .High}}high{{else}}low{{end}}
+{{end}}
+{{end}}`
+
+var _ = Describe("Handler", func() {
+	var (
+		simulator sim.Simulator
+		rtr       *mux.Router
+	)
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := httptest.NewRecorder()
+		rtr.ServeHTTP(rec, req)
+		return rec
+	}
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("devgpio test")
+
+		simulator = sim.NewSimulator(logger, "")
+		Expect(simulator.Write(17, false)).To(Succeed())
+		_, err := simulator.Read(4)
+		Expect(err).NotTo(HaveOccurred())
+
+		templates, err := template.New("devgpio").Parse(pageTemplate)
+		Expect(err).NotTo(HaveOccurred())
+
+		dgh := devgpio.NewHandler(logger, templates, simulator)
+
+		rtr = mux.NewRouter()
+		rtr.HandleFunc("/dev/gpio", dgh.Handle).Methods("GET")
+		rtr.HandleFunc("/api/v1/dev/gpio", dgh.HandleGet).Methods("GET")
+		rtr.HandleFunc("/api/v1/dev/gpio/{pin}", dgh.HandleSet).Methods("POST")
+	})
+
+	It("Should render the simulated pins", func() {
+		rec := serve("GET", "/dev/gpio")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring("pin 4 is low"))
+		Expect(rec.Body.String()).To(ContainSubstring("pin 17 is low"))
+	})
+
+	It("Should return the simulated pins as JSON", func() {
+		rec := serve("GET", "/api/v1/dev/gpio")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchJSON(`[
+			{"pin":4,"high":false,"output":false},
+			{"pin":17,"high":false,"output":true}
+		]`))
+	})
+
+	Describe("Setting pins", func() {
+		It("Should set the level of an input pin", func() {
+			rec := serve("POST", "/api/v1/dev/gpio/4?level=high")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			Expect(simulator.Read(4)).To(BeTrue())
+		})
+
+		It("Should respond with HTTP status code 409 for an output pin", func() {
+			rec := serve("POST", "/api/v1/dev/gpio/17?level=high")
+			Expect(rec.Code).To(Equal(http.StatusConflict))
+
+			Expect(simulator.Read(17)).To(BeFalse())
+		})
+
+		It("Should respond with HTTP status code 400 for an invalid level", func() {
+			rec := serve("POST", "/api/v1/dev/gpio/4?level=up")
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Should respond with HTTP status code 400 for an invalid pin", func() {
+			rec := serve("POST", "/api/v1/dev/gpio/four?level=high")
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/door"
 	"github.com/robdimsdale/garagepi/api/light"
 	"github.com/robdimsdale/garagepi/web/login"
 )
@@ -15,10 +16,16 @@ type Handler interface {
 	Handle(w http.ResponseWriter, r *http.Request)
 }
 
+type homepageData struct {
+	Light *light.LightState
+	Doors []*door.DoorState
+}
+
 type handler struct {
 	logger       lager.Logger
 	templates    *template.Template
 	lightHandler light.Handler
+	doors        door.Doors
 	loginHandler login.Handler
 }
 
@@ -26,12 +33,14 @@ func NewHandler(
 	logger lager.Logger,
 	templates *template.Template,
 	lightHandler light.Handler,
+	doors door.Doors,
 	loginHandler login.Handler,
 ) Handler {
 	return &handler{
 		logger:       logger,
 		templates:    templates,
 		lightHandler: lightHandler,
+		doors:        doors,
 		loginHandler: loginHandler,
 	}
 }
@@ -42,5 +51,22 @@ func (h handler) Handle(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("error reading light state - rendering homepage without light controls", err)
 	}
 
-	h.templates.ExecuteTemplate(w, "homepage", ls)
+	doorStates := []*door.DoorState{}
+	for _, dh := range h.doors.All() {
+		ds, err := dh.DiscoverDoorState()
+		if err != nil {
+			h.logger.Error("error reading door state - rendering homepage without door state", err, lager.Data{"door": dh.Name()})
+			unknown := &door.DoorState{Name: dh.Name(), State: door.StateUnknown}
+			if ds != nil {
+				unknown.Interlocks = ds.Interlocks
+			}
+			ds = unknown
+		}
+		doorStates = append(doorStates, ds)
+	}
+
+	h.templates.ExecuteTemplate(w, "homepage", homepageData{
+		Light: ls,
+		Doors: doorStates,
+	})
 }
@@ -1,6 +1,7 @@
 package homepage_test
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 
@@ -8,6 +9,9 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/robdimsdale/garagepi/api/door"
+	door_fakes "github.com/robdimsdale/garagepi/api/door/fakes"
+	"github.com/robdimsdale/garagepi/api/light"
 	light_fakes "github.com/robdimsdale/garagepi/api/light/fakes"
 	test_helpers_fakes "github.com/robdimsdale/garagepi/fakes"
 	"github.com/robdimsdale/garagepi/web/homepage"
@@ -23,12 +27,17 @@ some head text
 {{define "homepage"}}
 {{template "head"}}
 some text here
+{{with .Light}}light is {{.StateString}}{{end}}
+{{range .Doors}}{{.Name}} is {{.State}}{{if .InterlockActive}} with interlock active{{end}}
+{{end}}
 {{end}}`
 )
 
 var (
 	fakeLogger         lager.Logger
 	fakeLightHandler   *light_fakes.FakeHandler
+	fakeDoorHandler    *door_fakes.FakeHandler
+	fakeDoors          *door_fakes.FakeDoors
 	fakeLoginHandler   *login_fakes.FakeHandler
 	fakeResponseWriter *test_helpers_fakes.FakeResponseWriter
 
@@ -42,6 +51,10 @@ var _ = Describe("Homepage", func() {
 	BeforeEach(func() {
 		fakeLogger = lagertest.NewTestLogger("homepage handle test")
 		fakeLightHandler = new(light_fakes.FakeHandler)
+		fakeDoorHandler = new(door_fakes.FakeHandler)
+		fakeDoorHandler.NameReturns("garage")
+		fakeDoors = new(door_fakes.FakeDoors)
+		fakeDoors.AllReturns([]door.Handler{fakeDoorHandler})
 		fakeLoginHandler = new(login_fakes.FakeHandler)
 		fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
 
@@ -56,6 +69,7 @@ var _ = Describe("Homepage", func() {
 			fakeLogger,
 			templates,
 			fakeLightHandler,
+			fakeDoors,
 			fakeLoginHandler,
 		)
 
@@ -67,5 +81,77 @@ var _ = Describe("Homepage", func() {
 			hh.Handle(fakeResponseWriter, dummyRequest)
 			Expect(fakeResponseWriter.WriteCallCount()).To(BeNumerically(">=", 1))
 		})
+
+		It("Should render the light and door state", func() {
+			fakeLightHandler.DiscoverLightStateReturns(&light.LightState{
+				StateKnown: true,
+				LightOn:    true,
+			}, nil)
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{
+				Name:  "garage",
+				State: door.StateClosed,
+			}, nil)
+
+			var written string
+			fakeResponseWriter.WriteStub = func(b []byte) (int, error) {
+				written += string(b)
+				return len(b), nil
+			}
+
+			hh.Handle(fakeResponseWriter, dummyRequest)
+
+			Expect(written).To(ContainSubstring("light is on"))
+			Expect(written).To(ContainSubstring("garage is closed"))
+		})
+
+		It("Should render an active interlock, even if the door state is unknown", func() {
+			fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{
+				Name:  "garage",
+				State: door.StateClosed,
+				Interlocks: []door.InterlockStatus{
+					{Name: "photoeye", Policy: door.InterlockPolicyBlockClose, Active: true},
+				},
+			}, errors.New("gpio read error"))
+
+			var written string
+			fakeResponseWriter.WriteStub = func(b []byte) (int, error) {
+				written += string(b)
+				return len(b), nil
+			}
+
+			hh.Handle(fakeResponseWriter, dummyRequest)
+
+			Expect(written).To(ContainSubstring("garage is unknown with interlock active"))
+		})
+
+		Context("When multiple doors are configured", func() {
+			var otherDoorHandler *door_fakes.FakeHandler
+
+			BeforeEach(func() {
+				otherDoorHandler = new(door_fakes.FakeHandler)
+				otherDoorHandler.NameReturns("shed")
+				fakeDoors.AllReturns([]door.Handler{fakeDoorHandler, otherDoorHandler})
+
+				fakeDoorHandler.DiscoverDoorStateReturns(&door.DoorState{
+					Name:  "garage",
+					State: door.StateOpen,
+				}, nil)
+			})
+
+			It("Should render the state of each door, reporting unknown on error", func() {
+				otherDoorHandler.DiscoverDoorStateReturns(nil, errors.New("gpio read error"))
+
+				var written string
+				fakeResponseWriter.WriteStub = func(b []byte) (int, error) {
+					written += string(b)
+					return len(b), nil
+				}
+
+				hh.Handle(fakeResponseWriter, dummyRequest)
+
+				Expect(written).To(ContainSubstring("garage is open"))
+				Expect(written).To(ContainSubstring("shed is unknown"))
+			})
+		})
 	})
 })
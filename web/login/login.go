@@ -1,11 +1,13 @@
 package login
 
 import (
+	"crypto/subtle"
 	"html/template"
 	"net/http"
 
 	"github.com/gorilla/securecookie"
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/api/events"
 )
 
 //go:generate counterfeiter . Handler
@@ -21,19 +23,37 @@ type handler struct {
 	templates     *template.Template
 	cookieHandler *securecookie.SecureCookie
 	cookieMaxAge  int
+	username      string
+	password      string
+	adminUsername string
+	adminPassword string
+	recorder      events.Recorder
 }
 
+// NewHandler returns a handler which records each login, and whether its
+// credentials matched username and password, or adminUsername and
+// adminPassword if they are not empty, with recorder.
 func NewHandler(
 	logger lager.Logger,
 	templates *template.Template,
 	cookieHandler *securecookie.SecureCookie,
 	cookieMaxAge int,
+	username string,
+	password string,
+	adminUsername string,
+	adminPassword string,
+	recorder events.Recorder,
 ) Handler {
 	return &handler{
 		logger:        logger,
 		templates:     templates,
 		cookieHandler: cookieHandler,
 		cookieMaxAge:  cookieMaxAge,
+		username:      username,
+		password:      password,
+		adminUsername: adminUsername,
+		adminPassword: adminPassword,
+		recorder:      recorder,
 	}
 }
 
@@ -45,9 +65,24 @@ func (h handler) LoginPOST(w http.ResponseWriter, request *http.Request) {
 	name := request.FormValue("name")
 	pass := request.FormValue("password")
 	if name != "" && pass != "" {
-		// .. check credentials ..
+		// The credentials are checked by the auth middleware on each request.
 		h.setSession(name, pass, w)
 	}
+
+	source := events.RequestSource(request)
+	source.User = name
+
+	eventType := events.TypeLogin
+	if !h.validCredentials(name, pass) {
+		h.logger.Info("login failed", lager.Data{"user": name, "clientIP": source.ClientIP})
+		eventType = events.TypeLoginFailed
+	}
+
+	h.recorder.Record(events.Event{
+		Type:   eventType,
+		Source: source,
+	})
+
 	http.Redirect(w, request, "/", http.StatusFound)
 }
 
@@ -86,3 +121,17 @@ func clearSession(response http.ResponseWriter) {
 	}
 	http.SetCookie(response, cookie)
 }
+
+func (h handler) validCredentials(name, pass string) bool {
+	if secureCompare(name, h.username) && secureCompare(pass, h.password) {
+		return true
+	}
+
+	return h.adminUsername != "" && h.adminPassword != "" &&
+		secureCompare(name, h.adminUsername) &&
+		secureCompare(pass, h.adminPassword)
+}
+
+func secureCompare(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -187,23 +187,47 @@ var _escData = map[string]*_escFile{
 
 	"/static/css/application.css": {
 		local: "web/assets/static/css/application.css",
-		size:  107,
+		size:  191,
 		compressed: `
-H4sIAAAJbogA/9JLKsnTTUwuyczPU6jmUgCC3MSi9Mw83ZL8AisFY4OCCmuwaEFiSkpmXrqVgqFFQYWC
-kQVMPC0/r0S3OLMq1UrByAgmmJRflJJapFuUmJJZWmylAFZcywUIAAD//xiYznRrAAAA
+H4sIAAAAAAAC/22NQQrDMAwE736FPuAQu5fgvkaJ1WBoJSOrYFry97aB9JQ9DsvMMBt7XKwIw9vBdw/U
+tbA3qQkuY+3XnVbMufCaIEy1Q5wOfhM238qLEsR4wFk0k3rFXJ4twX7enBuyiPpmaHTSCuOJM/xDRt08
+3svKCRZiI/05PxviP0u/AAAA
+`,
+	},
+
+	"/static/js/devgpio.js": {
+		local: "web/assets/static/js/devgpio.js",
+		size:  298,
+		compressed: `
+H4sIAAAAAAAC/22OwWrDMAyG73kKIXKQaWrTcxl7hb2Ca7ubqWeHWgmMkHev4raUQQ+S7F/Srw+nGqDy
+NTrGY9f15IubfkNmpa/B+j86T9lxLJnU0nUAzy/UwF8x0xjzACnMISlYpA/Q67FUJjR2jGY+GB9m8z3G
+YhB2IOOS8bNtfGxKew3wOvOwAUjF2U0SkFSsJ3VsjbXVdYPpCfWJ815c98KDSosBuhTdBd9YPpB74p9Y
+lfaWLaHsohrgv9igUN0vSd7iBqg9BT0qAQAA
 `,
 	},
 
 	"/static/js/garagepi.js": {
 		local: "web/assets/static/js/garagepi.js",
-		size:  878,
+		size:  2828,
 		compressed: `
-H4sIAAAJbogA/4xS3WqDMBS+9ynOMqERimXXRXYzGGxlvWhfINXEhblE4rHbKH33JTHWtnPSC8Ek30/y
-nY+0DYcGjcyRLKMopoXO20+uMEkNZ8UPFa3KUWpFk0MUAeyZgXiHaiXLd4QMYkru+yVJlj2kcuu1sgB6
-QqfIv5EmkGVAtq1RsBYCzom9FaAuy4o/M8NK/qS1saSDPQeI01o3SMmC1XKxf1h0QEcHOF5KWINVd4l/
-2f6Sjw0y5JlWZA41Mw33rI3bnJQV4jZdIW4SvkLQgiHr9d2/izr1oJfN+q07XvrTIWq3mYZH+0ABpAAa
-AL0awNVERobhUEfgle3GNEldcQbXO38b/5hXpb9G7WujazorZMN2FS9mc0DT8pNUkAsNcz3YhnGnto4k
-r2T+YbMdChoc/rbHx911bDCf1BjN7XL4oyld1O7sIfbffb8BAAD//zKtiT1uAwAA
+H4sIAAAAAAAC/41W32/bNhB+919x5TyUQm3ZfdlDE6fAtmLIli5A4z4Ve2AkSiIikwJJ2w3a/O87kvpB
+yU5aAwYk8u7jfXffHUX2hoOxWmSWXMxmc5qrbL/j0iap5ix/pMVeZlYoSZNvsxnAgWmY31t5I8rKwgbm
+lPzSvZLkojep3cJW7LhujYaFyMwv3ko0oT1oavlXSxPYbIBs91rCbVHAFN87fuI7JqSQJfo3TBt+LS2N
+Tk5zZhklujMjyQLerhP4/h3WHqnjBlaVZc3/YpqV/E+lNJVsxxP4hjYA87RRxlKyYo1YHd6ucjQwKwJv
+gMtM5fzzp+s/1K5RErPWOr4BsgqYJPEYAGnBRD1k82ulO3z3s/oxegNgNdfIJfW0/r67/dc5YEUMHmP4
+FjOUpFxrpT+aErPSuT1BxmxWAeXJGTjiqIFUtuWbk9i1fXrya0/j9GAZbkKp6HNZ8Wl/byyzfKMkWYSK
+eK87t/gibFH8HG5R/BTwxII6HXT47tlJMkqt3w6ZGATpFtOWtBcLgCiAtgZDeie6PSPZUBheY6O97CQn
+PuHUwbbRqqGvc2HYPRbv9QJe+SA9x3+kOsqkDfSkO7xdv3DHMyVz0/aBc9Bc5lzf9J1DzyT11Kal49Ly
+qkscYk5Ov9zAOkpX1J6B+yBCzZ0iRuRdr++E3FtukMZHZqu0qF2DTg5ZwW/rFse5mJbhZhrMr2gXzE4D
+CSPNhWAAlQZCgmvy7njs6XfunXbglzhM4D2QNYF3gDRwr916NnuuAU8l6Qdm3m35edlN4bTk9kPN3ePv
+j9c5Jb3Z0sXi6+pHTkve1cIvmgCFM3QvH5w2SFSDHmRSgqlKJ3bRe5isNbvntSdOQBjoIzJ9X44K6f1x
+RnNdq+zhxzx70/Ncx3Ap3zX2kXZ7KWdZFVIhOhOv+C//LfqqULGAfnfIj0tiv5wyND2M5ileZ5fNFUna
+7A2MXJiDo4u1S00AATq2aFQtskdnkyAaaxoUyVbRMbG+PcKEfjrPPkz0iWuaVaLOUXo0SWsuS1vBFawH
+da5WsK389c/ZDsXrVG1xIdtrdLIQRHSsuARhQWF4xiUsq/e5ayZW4DkBRjvhS44sZbkAJnNgJbYcuCqA
+xSbzuAEvq5gsuUlnIdNHIXN1TD8c8MQ7tdcZj/uijW0Dkh8hshkuiGBButkXXlOW5976RhjLJU4r4vud
+RMWPajq9MILAOwX/ENol/Rnkad/H9057SnRMWxfDra/hgUVfDPG4nUy1q3jCjveWy4tRJNMZH2T15D6M
+1utA9JzhzKs+xato6cguu4+bFAMjGar4IebfBXPyWTWnthImaceHT1ug3+Z4uOtexD17EY+/Js4OtNF3
+TMQen93/f5WRioQMCwAA
 `,
 	},
 
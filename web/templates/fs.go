@@ -185,32 +185,52 @@ func FSMustString(useLocal bool, name string) string {
 
 var _escData = map[string]*_escFile{
 
+	"/templates/devgpio.html.tmpl": {
+		local: "web/assets/templates/devgpio.html.tmpl",
+		size:  1336,
+		compressed: `
+H4sIAAAAAAAC/51UzY7bIBC+9ymm3AnaHlY9OD5VaitV2pX2CYhhbVIMCCY/q2jfvQN24jjJrqJaspj5
++OaXgcNB6VfjNDClt20wnr2/fzkcUPfBSiS401JlDKBaefVWk0BiaqIJCPgW9JKh3qNYy60cUAYpNksm
+Eko0jVgnMbperBOrKzGwRkfKbKGxMqUla7xDSalENuzNd6PfnfBLO8v3iT98O9snRvdQv5h+k6tQ8PP5
+91MlCJo8CHJxCjQo/xcWspR6/r0IveKPRbAtf5xnhHJlNRi1ZMG4xI6OCjxjZm7u+xzLaKxpp342rhK0
+ZvmHibpB4yfkj95qe9IGQZDlPIC4EaHC6Yin73CAKF2rYUFxE5RZuMzqAsqgqskwm5AFRVMfcswrLJ42
+GDZITF8EQrVNmnTjRtWpe/z8Mm1HvI6WyYf1uzs8XIGlcnLqPJ4leINWrTaI3h3Pc4UO6Od0seTGYpH3
+qSx07jxpuiFKoszakk1NGlGbj6/gZwWNJQz1HKsrBbH6RSPcy67EkOsH1Q6k6/bcaNr1SH3kgZiXY0VQ
+HvoZFI7967QNfGV985fVZeJkCFpG8K7R0MooWx0MdDJBpAkGH2EXDaJ2QCPdLyoRPr3lUH3lHOheA+fj
+I3SGnx6hcZcaVnKnxwN7W9PTSBVSgf8A01QCZTgFAAA=
+`,
+	},
+
 	"/templates/head.html.tmpl": {
 		local: "web/assets/templates/head.html.tmpl",
 		size:  726,
 		compressed: `
-H4sIAAAJbogA/5RSwY7TMBC95yuMzySm5cIhjoRKhTjBASQ4uvY0cXBs156mVFH/HTfe7nZ3tautcsjM
-y7z3lDczTQq22gKhHQhFT6eifvfl++rnnx9r0uFgmqI+v4gRtuUULG0KQurz7LlI5QAoiOxEiICc7nFb
-fqLXnzpEX8Jur0dOf5e/PpcrN3iBemOAEuksgk28b2sOqoVHTCsG4HTUcPAu4NXwQSvsuIJRSyjn5j3R
-VqMWpoxSGOCLixBqNNB8FUG0QFZJIDhTs4wWeSTKoD0SPPrkhvAPWS9GkVFKYpCcMiadgqrf7SEcK+kG
-lstyWS3SM2hb9ZE2Ncus5gZhC6isqDbOYcQgvFR2NrgH2MdqWX1gfXyAXjI02v4lAQynEY8GYgeQjLoA
-21ucZHxqlRB6SetVj4hpsXJWEN4bLVPrMv86hqz35ozuVFMC7bxHr5/9fM3yRU4TWJVu+H8AAAD//5g8
-zzzWAgAA
+H4sIAAAAAAAC/5VSPU/DMBDd8yuMZxLTsjDEkVCpEBMMIMHo2tfExbFd+9pSRf3vuAkfBQSi8uC753vv
+yXfXdQrm2gKhDQhFd7usPLm6ndw/3U1Jg62psnJ/ESNszSlYWmWElPvafZDCFlAQ2YgQATld4Ty/oIdP
+DaLPYbnSa04f84fLfOJaL1DPDFAinUWwiXcz5aBq+MK0ogVO1xo23gU8KN5ohQ1XsNYS8j45Jdpq1MLk
+UQoDfPQuhBoNVNciiBrIJAkEZ0o2oNlQEmXQHglufXJDeEG2EGsxoJTEIDllTDoFxWK5grAtpGvZEObj
+YpROq22xiLQq2cCqjhC2gMqKYuYcRgzCS2V7gw+AnRfj4owt4if0m6HR9pkEMJxG3BqIDUAyagLMj3GS
+8btVQuh7t/70iJgGK3sF4b3RMqVu4B+2YdD7d4/eVFMH6n6OXv/4fMmGjew6sCrt8CuYPM881gIAAA==
 `,
 	},
 
 	"/templates/homepage.html.tmpl": {
 		local: "web/assets/templates/homepage.html.tmpl",
-		size:  1311,
+		size:  2182,
 		compressed: `
-H4sIAAAJbogA/7RUzY7TMBC+9ykGn+BgQpcVQkuaC0gIUakHeAEncRIL2xPZE7pVlHdn4nTLlgpEQXuo
-Op6fb+b7PPE41roxXoPo0OletVpM02ocSbveKpr9WtWzDyAvsT4Aeouq3ogqaI5/clyyVQcdnr8QBSdx
-Wm2+Q2VVjJyEnhTDh2PsPBpwf/L/WmflfZTrm0dxzujWxUcVuCO8Z+CANs/Y9RMhY4hTo+Xwd20NE9rr
-slJOXI4AkQ5Wc4Kpqbt7ffOqv3/XadN2dLd+y4ezGRnQuBZiqDYie4BcsjeC0wUkmI1gHAHZH4eH/JmU
-wOOClP+oH8xWdPJNMlwtb5NhW3l7Lm05EKFPQpTkPyCGr9i2Vp/0YC/wT/K+qMFSskuL1bdkqYoMelEs
-RTDX59mCeTXFcQTTwMsvxPv12ePeQ1q/J2R/wX8739e11IfgefZ59FS+89O0axpmo23UzGHnx1H7epog
-xf9HH4Z5clHyBoMDp6lDFqXHyIIsXHmzLbY40G9EpEPPn0scSmeuFDHp/4C9Tf+XMs3azLNdKdxj/+ld
-Oka5Cb9txYrfE3K2WB0vavUjAAD//7LeXwUfBQAA
+H4sIAAAAAAAC/7VWzW7bMAy+5yk4YYf24GTpimHIEgPDBgzFinVY+wKyrdjC9GNIStPAyLuPkmzHTrNh
+KdBDEoqkPn4kRSlNU7A1VwxIpSWracnIfj9pGsdkLajzekYLrwNYZrrYgVZC02JFcsPQfiNxyy3dMXNx
+SVJ0QreCP0IuqLXopJWjCG9a29hq9LbXH+8TyZNN5lcDO3pU8/QbNRgRviCw0WI5Q9UBYYYQfaC4+L+w
+HBPasiynkjynANbtBEMHXrhq8f7qXf30qWK8rNxi/hEXI44IyGUJ1uQrMusgo/eKoDuBALMiiENg9k/y
+sHyTJIB0IUk6S9PAW7kRjteCfdXaWFisoHRwIZiCadBcwhxCw1p/QxVWLNoOhjMbAV6yMvkQBFkk10EQ
+ZXI97lG2cU6rUNHMKR/0QZelYAkymf6gkiGFvsjoAfhJ8BBSTCrImdD57yDR3HHdOiBO4gIQgYI6GjQr
+MgRNYyCfMl8fV2m/H7iiyIT1kjf6lSpwsZxF8qN86pCKj3bv8MCfTCOws97ckhM0YyKwexkTksat0xDz
+u9JbFZ1fBgfc+qpEtNatzbgeJdvNgk/oRjlmfC9OpkwFMw7Cd7KlRnFVQigD77a12SvtYNpjfcaWPnqg
+bqgKbvGi2S3QTzHSExuP1OEQ90C2r8e0xxyPYZ32zjDIwNeCxh0XXv1TC57v0HB5VIwQNrLphWGthvN6
+zviOkHC95a6C6a2/IQ45jfr+uhP7bGYDlbNGFEdvYxQm46mH7Xdqv79brw/n8U41DWaO9Q/2U6PWD5vw
+Hg9c4rPRsQiqxEVdGDHDJL4seOziJfCrW94zfHQKG4Zo1NFzO3Tcqte6MNfaSJDMVRpTr7XF0seq4gMi
+dKk37i/tcrsaB8huMsnPbFescot9G35P3n0zz+3MCg71/fPfWjEI/oVIJ/hsOynSSXskJn8A3IbX1IYI
+AAA=
 `,
 	},
 
@@ -218,12 +238,12 @@ Oka5Cb9txYrfE3K2WB0vavUjAAD//7LeXwUfBQAA
 		local: "web/assets/templates/login.html.tmpl",
 		size:  853,
 		compressed: `
-H4sIAAAJbogA/6RTS27jMAzdzykE7Q0jM8GsYp9gFrPpAWSLjoVKoiHRTQIjdy9lO/6kKFqgCxtP4iP5
-nkQNg4bGeBDS4tl4eb//GgYC11lFvNmC0mlPiFOF+lYyYKjNm6itirGQNXpSnB/kFNtHA16W/ec8m11j
-dvgtEoou+/sA2DQRKPszrp3Ojg8wB46bilyzPZT/kvJTzmgbaDA44YBa1IXsMJIUqiaDvpD55HVL36tL
-udk5YN89kZhmVQVWMKOQXjmQ5UuEkNApH0MfEozvehJ066CQBFfWse2SDjCglcLouaBI/wfme6ihRath
-6bdXnbPsHxvpmHzBoGX5f0bfMbNkfW5opUym1vXO2Nr/S3NVT4R+VhD7ypn1QCvygr+sC8apcBtxZbF+
-ncTMtz6Py1RoNzJ5MrCZ1237zWKBXGR8FDx75PishgG85tfyHgAA//9yVpMzVQMAAA==
+H4sIAAAAAAAC/6VTS27DIBDd9xSIPbLSRl3FPkEX3eQA2OAYFRgEuElk5e4dbMfGqapW6sLWm/97MAyD
+kK2yklANJ2Xp7fY0DFEap3lEZye5SD5CDjWIa4UAoVCfpNE8hJI2YCPHek+n2Dbq4bz4H+s0uwS2eyYJ
+BcNe7wDaNsjIXkbbCLa/gzmwzzpiz25XvSXmhwJRHmjBG2Jk7ECU1EGIlPAmKrAlLSatefqWXaplJw+9
+e0jCNM1rqQlmlNRyI2l1DNIndCjG0LcCZV0fSbw6WdIoL8gjn5IO0IOmRIm5IUn/O8Z7aGQHWshl3pZ1
+gbT/LcRh8hm8oNX7jP4iZqn6WdCaMola7Y2wdf6v4uo+RrAzg9DXRq0HWkdL8GPOK8P9dcS1huZjIjPf
++rwuU6PNyhRJQLav+fjMWCA2GR8F7l40eFbDIK3A1/IFclaTM1UDAAA=
 `,
 	},
 
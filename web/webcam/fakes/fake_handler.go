@@ -15,6 +15,12 @@ type FakeHandler struct {
 		w http.ResponseWriter
 		r *http.Request
 	}
+	ProbeStub        func() error
+	probeMutex       sync.RWMutex
+	probeArgsForCall []struct{}
+	probeReturns     struct {
+		result1 error
+	}
 }
 
 func (fake *FakeHandler) Handle(w http.ResponseWriter, r *http.Request) {
@@ -41,4 +47,28 @@ func (fake *FakeHandler) HandleArgsForCall(i int) (http.ResponseWriter, *http.Re
 	return fake.handleArgsForCall[i].w, fake.handleArgsForCall[i].r
 }
 
+func (fake *FakeHandler) Probe() error {
+	fake.probeMutex.Lock()
+	fake.probeArgsForCall = append(fake.probeArgsForCall, struct{}{})
+	fake.probeMutex.Unlock()
+	if fake.ProbeStub != nil {
+		return fake.ProbeStub()
+	} else {
+		return fake.probeReturns.result1
+	}
+}
+
+func (fake *FakeHandler) ProbeCallCount() int {
+	fake.probeMutex.RLock()
+	defer fake.probeMutex.RUnlock()
+	return len(fake.probeArgsForCall)
+}
+
+func (fake *FakeHandler) ProbeReturns(result1 error) {
+	fake.ProbeStub = nil
+	fake.probeReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ webcam.Handler = new(FakeHandler)
@@ -1,6 +1,8 @@
 package webcam
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -8,22 +10,34 @@ import (
 	"time"
 
 	"github.com/pivotal-golang/lager"
+	"github.com/robdimsdale/garagepi/metrics"
 )
 
 //go:generate counterfeiter . Handler
 
 type Handler interface {
 	Handle(w http.ResponseWriter, r *http.Request)
+	Probe() error
 }
 
+// probeTimeout limits the time taken to fetch a snapshot when probing the
+// webcam.
+const probeTimeout = 5 * time.Second
+
 type handler struct {
-	logger lager.Logger
-	proxy  httputil.ReverseProxy
+	logger     lager.Logger
+	webcamHost string
+	proxy      httputil.ReverseProxy
+	clients    *metrics.Gauge
+	client     *http.Client
 }
 
+// NewHandler returns a handler which proxies the stream of the webcam, and
+// registers a gauge of the number of clients streaming it with registry.
 func NewHandler(
 	logger lager.Logger,
 	webcamHost string,
+	registry *metrics.Registry,
 ) Handler {
 	director := func(req *http.Request) {
 		req.URL.Scheme = "http"
@@ -44,11 +58,36 @@ func NewHandler(
 	}
 
 	return &handler{
-		logger: logger,
-		proxy:  proxy,
+		logger:     logger,
+		webcamHost: webcamHost,
+		proxy:      proxy,
+		client:     &http.Client{Timeout: probeTimeout},
+		clients: registry.NewGauge(
+			"garagepi_webcam_clients",
+			"Clients streaming the webcam.",
+		),
 	}
 }
 
 func (h handler) Handle(w http.ResponseWriter, r *http.Request) {
+	h.clients.Inc()
+	defer h.clients.Dec()
+
 	h.proxy.ServeHTTP(w, r)
 }
+
+// Probe checks that the webcam can be reached by fetching a snapshot, as the
+// stream does not end.
+func (h handler) Probe() error {
+	resp, err := h.client.Get(fmt.Sprintf("http://%s/?action=snapshot", h.webcamHost))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code from webcam: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pivotal-golang/lager"
 	"github.com/pivotal-golang/lager/lagertest"
 	test_helpers_fakes "github.com/robdimsdale/garagepi/fakes"
+	"github.com/robdimsdale/garagepi/metrics"
 	"github.com/robdimsdale/garagepi/web/webcam"
 )
 
@@ -26,7 +27,16 @@ var (
 )
 
 var _ = Describe("Webcam", func() {
-	var server *ghttp.Server
+	var (
+		server   *ghttp.Server
+		registry *metrics.Registry
+	)
+
+	clients := func() string {
+		buf := new(bytes.Buffer)
+		Expect(registry.Write(buf)).To(Succeed())
+		return buf.String()
+	}
 
 	BeforeEach(func() {
 		server = ghttp.NewServer()
@@ -35,12 +45,14 @@ var _ = Describe("Webcam", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		fakeLogger = lagertest.NewTestLogger("webcam test")
+		registry = metrics.NewRegistry()
 		fakeResponseWriter = new(test_helpers_fakes.FakeResponseWriter)
 		fakeResponseWriter.HeaderReturns(http.Header{})
 
 		w = webcam.NewHandler(
 			fakeLogger,
 			parsedURL.Host,
+			registry,
 		)
 
 		dummyRequest = new(http.Request)
@@ -64,6 +76,17 @@ var _ = Describe("Webcam", func() {
 			Ω(server.ReceivedRequests()).Should(HaveLen(1))
 		})
 
+		It("should count the clients streaming the webcam", func() {
+			var streaming string
+			server.AppendHandlers(func(http.ResponseWriter, *http.Request) {
+				streaming = clients()
+			})
+
+			w.Handle(fakeResponseWriter, dummyRequest)
+			Expect(streaming).To(ContainSubstring("garagepi_webcam_clients 1\n"))
+			Expect(clients()).To(ContainSubstring("garagepi_webcam_clients 0\n"))
+		})
+
 		Context("When obtaining a webcam image is successful", func() {
 			contents := []byte("webcamImage")
 
@@ -92,6 +115,7 @@ var _ = Describe("Webcam", func() {
 				w = webcam.NewHandler(
 					fakeLogger,
 					"not-a-val!d-url",
+					metrics.NewRegistry(),
 				)
 			})
 
@@ -129,6 +153,36 @@ var _ = Describe("Webcam", func() {
 			})
 		})
 	})
+
+	Describe("probing the upstream server", func() {
+		It("fetches a snapshot", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/", "action=snapshot"),
+					ghttp.RespondWith(http.StatusOK, "jpeg"),
+				),
+			)
+
+			Expect(w.Probe()).To(Succeed())
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("fails if a status code other than 200 is returned", func() {
+			server.AppendHandlers(ghttp.RespondWith(http.StatusServiceUnavailable, nil))
+
+			Expect(w.Probe()).To(MatchError(ContainSubstring("503")))
+		})
+
+		It("fails if the upstream server cannot be reached", func() {
+			w = webcam.NewHandler(
+				fakeLogger,
+				"not-a-val!d-url",
+				metrics.NewRegistry(),
+			)
+
+			Expect(w.Probe()).NotTo(Succeed())
+		})
+	})
 })
 
 type errCloser struct {
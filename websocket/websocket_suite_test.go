@@ -0,0 +1,13 @@
+package websocket_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestWebsocket(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Websocket Suite")
+}
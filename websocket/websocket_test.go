@@ -0,0 +1,212 @@
+package websocket_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/robdimsdale/garagepi/websocket"
+)
+
+var _ = Describe("Websocket", func() {
+	var (
+		server    *httptest.Server
+		serverURL string
+
+		upgradeErrs chan error
+		received    chan []byte
+		readErrs    chan error
+	)
+
+	BeforeEach(func() {
+		upgradeErrs = make(chan error, 1)
+		received = make(chan []byte, 10)
+		readErrs = make(chan error, 1)
+
+		server = httptest.NewServer(echoHandler(upgradeErrs, received, readErrs))
+
+		serverURL = "ws" + strings.TrimPrefix(server.URL, "http")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// rawDial completes the handshake without a websocket.Conn, so that
+	// arbitrary frames can be written.
+	rawDial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n"+
+			"Host: "+strings.TrimPrefix(server.URL, "http://")+"\r\n"+
+			"Upgrade: websocket\r\n"+
+			"Connection: Upgrade\r\n"+
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+			"Sec-WebSocket-Version: 13\r\n\r\n")
+		Expect(err).NotTo(HaveOccurred())
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(resp.Header.Get("Sec-WebSocket-Accept")).To(Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo="))
+
+		return conn, reader
+	}
+
+	// maskedFrame returns a frame as written by a client, using a zero mask.
+	maskedFrame := func(first byte, payload string) []byte {
+		frame := []byte{first, 0x80 | byte(len(payload)), 0, 0, 0, 0}
+		return append(frame, payload...)
+	}
+
+	It("exchanges messages", func() {
+		conn, err := websocket.Dial(serverURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		err = conn.WriteMessage([]byte("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(received).Should(Receive(Equal([]byte("hello"))))
+
+		message, err := conn.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(message)).To(Equal("hello"))
+	})
+
+	It("exchanges messages longer than a single byte length", func() {
+		conn, err := websocket.Dial(serverURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		long := strings.Repeat("x", 70000)
+		Expect(len(long)).To(BeNumerically(">", websocket.MaxMessageSize))
+
+		medium := strings.Repeat("x", 1000)
+		err = conn.WriteMessage([]byte(medium))
+		Expect(err).NotTo(HaveOccurred())
+
+		message, err := conn.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(message)).To(Equal(medium))
+
+		err = conn.WriteMessage([]byte(long))
+		Expect(err).NotTo(HaveOccurred())
+
+		var readErr error
+		Eventually(readErrs).Should(Receive(&readErr))
+		Expect(readErr).To(Equal(websocket.ErrMessageTooLarge))
+
+		_, err = conn.ReadMessage()
+		Expect(err).To(Equal(websocket.ErrClosed))
+	})
+
+	It("answers pings while reading", func() {
+		conn, err := websocket.Dial(serverURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+
+		err = conn.Ping()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = conn.WriteMessage([]byte("after ping"))
+		Expect(err).NotTo(HaveOccurred())
+
+		message, err := conn.ReadMessage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(message)).To(Equal("after ping"))
+	})
+
+	It("reassembles fragmented messages", func() {
+		conn, reader := rawDial()
+		defer conn.Close()
+
+		conn.Write(maskedFrame(0x01, "frag"))
+		conn.Write(maskedFrame(0x89, "")) // ping between fragments
+		conn.Write(maskedFrame(0x80, "mented"))
+
+		Eventually(received).Should(Receive(Equal([]byte("fragmented"))))
+
+		pong, err := reader.Peek(2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pong).To(Equal([]byte{0x8a, 0x00}))
+	})
+
+	It("closes the connection when the client closes it", func() {
+		conn, err := websocket.Dial(serverURL, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = conn.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(readErrs).Should(Receive(Equal(websocket.ErrClosed)))
+	})
+
+	It("closes the connection on unmasked client frames", func() {
+		conn, reader := rawDial()
+		defer conn.Close()
+
+		conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+
+		var readErr error
+		Eventually(readErrs).Should(Receive(&readErr))
+		Expect(readErr).To(HaveOccurred())
+
+		closeFrame := make([]byte, 4)
+		_, err := io.ReadFull(reader, closeFrame)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(closeFrame).To(Equal([]byte{0x88, 0x02, 0x03, 0xea})) // 1002
+	})
+
+	It("rejects requests which are not websocket handshakes", func() {
+		resp, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Eventually(upgradeErrs).Should(Receive(HaveOccurred()))
+	})
+
+	It("rejects cross-origin requests", func() {
+		_, err := websocket.Dial(serverURL, http.Header{"Origin": {"http://example.com"}})
+		Expect(err).To(MatchError(ContainSubstring("403")))
+		Eventually(upgradeErrs).Should(Receive(HaveOccurred()))
+	})
+
+	It("accepts same-origin requests", func() {
+		conn, err := websocket.Dial(serverURL, http.Header{"Origin": {server.URL}})
+		Expect(err).NotTo(HaveOccurred())
+		conn.Close()
+	})
+})
+
+// echoHandler echoes each message it receives. Channels are passed in so
+// that connections from earlier specs do not use those of later specs.
+func echoHandler(upgradeErrs chan<- error, received chan<- []byte, readErrs chan<- error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r)
+		upgradeErrs <- err
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				readErrs <- err
+				return
+			}
+			received <- message
+
+			err = conn.WriteMessage(message)
+			if err != nil {
+				return
+			}
+		}
+	})
+}